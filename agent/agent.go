@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"github.com/joeshaw/envdecode"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+	"github.com/shaardie/mondane/httpcheck"
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+const (
+	// heartbeatInterval is the time between two heartbeats. It has to be
+	// well below the time, after which the checkmanager considers an agent
+	// disconnected.
+	heartbeatInterval = 15 * time.Second
+	// minBackoff and maxBackoff limit the time between two connection
+	// attempts
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Config read from environment
+type config struct {
+	Token string `env:"MONDANE_AGENT_TOKEN,required"`
+	// CheckManager are the checkmanager services to connect to. With
+	// multiple replicas, the agent has to connect to all of them.
+	CheckManager []string `env:"MONDANE_AGENT_CHECKMANAGER_SERVER,required"`
+	// BufferSize is the maximal number of results kept per checkmanager
+	// service while disconnected
+	BufferSize int `env:"MONDANE_AGENT_BUFFER_SIZE,default=1000"`
+	// Concurrency is the maximal number of jobs running at the same time
+	Concurrency int `env:"MONDANE_AGENT_CONCURRENCY,default=100"`
+}
+
+// connection to a single checkmanager service. It receives jobs, runs them
+// and sends back the results. Results, which can not be sent, are buffered
+// and sent after the next reconnect.
+type connection struct {
+	config  *config
+	address string
+	checker proto.HTTPCheckServiceServer
+	logger  *zap.SugaredLogger
+	// slots limits the running jobs and is shared by all connections
+	slots chan struct{}
+
+	mutex  *sync.Mutex
+	stream checkmanager.CheckManagerService_ConnectAgentClient
+	buffer []*checkmanager.AgentResult
+}
+
+// run connects to the checkmanager and reconnects with an exponential
+// backoff until the context is done
+func (c *connection) run(ctx context.Context) {
+	d, err := grpc.Dial(c.address, grpc.WithInsecure())
+	if err != nil {
+		c.logger.Errorw("Unable to connect to checkmanager service", "error", err,
+			"address", c.address)
+		return
+	}
+	defer d.Close()
+	cm := checkmanager.NewCheckManagerServiceClient(d)
+
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := c.serve(ctx, cm)
+		if ctx.Err() != nil {
+			return
+		}
+		c.logger.Warnw("Connection to checkmanager service lost", "error", err,
+			"address", c.address)
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// serve a single stream until it fails. Running jobs outlive the stream, so
+// their results are buffered for the next one.
+func (c *connection) serve(ctx context.Context, cm checkmanager.CheckManagerServiceClient) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := cm.ConnectAgent(streamCtx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&checkmanager.AgentMessage{
+		Hello: &checkmanager.AgentHello{Token: c.config.Token},
+	})
+	if err != nil {
+		return err
+	}
+	c.logger.Infow("Connected to checkmanager service", "address", c.address)
+
+	if err := c.attach(stream); err != nil {
+		return err
+	}
+	defer c.detach(stream)
+
+	go c.heartbeat(streamCtx, stream)
+
+	for {
+		job, err := stream.Recv()
+		if err == io.EOF {
+			return errors.New("stream closed by checkmanager service")
+		}
+		if err != nil {
+			return err
+		}
+		// Wait for a free slot, the checkmanager gives up on jobs, which
+		// do not start in time
+		select {
+		case c.slots <- struct{}{}:
+		case <-streamCtx.Done():
+			return streamCtx.Err()
+		}
+		go func() {
+			defer func() { <-c.slots }()
+			c.do(ctx, job)
+		}()
+	}
+}
+
+// attach the stream and flush the buffered results
+func (c *connection) attach(stream checkmanager.CheckManagerService_ConnectAgentClient) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.buffer) > 0 {
+		err := stream.Send(&checkmanager.AgentMessage{Result: c.buffer[0]})
+		if err != nil {
+			return err
+		}
+		c.buffer = c.buffer[1:]
+	}
+	c.stream = stream
+	return nil
+}
+
+// detach the stream, so new results are buffered
+func (c *connection) detach(stream checkmanager.CheckManagerService_ConnectAgentClient) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stream == stream {
+		c.stream = nil
+	}
+}
+
+// heartbeat sends heartbeats until the context is done
+func (c *connection) heartbeat(ctx context.Context, stream checkmanager.CheckManagerService_ConnectAgentClient) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mutex.Lock()
+		if c.stream != stream {
+			c.mutex.Unlock()
+			return
+		}
+		err := stream.Send(&checkmanager.AgentMessage{Heartbeat: &empty.Empty{}})
+		c.mutex.Unlock()
+		if err != nil {
+			c.logger.Warnw("Unable to send heartbeat", "error", err, "address", c.address)
+			return
+		}
+	}
+}
+
+// send the result or buffer it, if the checkmanager is not connected. If the
+// buffer is full, the oldest result is dropped.
+func (c *connection) send(r *checkmanager.AgentResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stream != nil {
+		err := c.stream.Send(&checkmanager.AgentMessage{Result: r})
+		if err == nil {
+			return
+		}
+		c.logger.Warnw("Unable to send result", "error", err, "address", c.address)
+	}
+	if c.config.BufferSize < 1 {
+		return
+	}
+	if len(c.buffer) >= c.config.BufferSize {
+		c.logger.Warnw("Result buffer full, dropping oldest result", "address", c.address)
+		c.buffer = c.buffer[1:]
+	}
+	c.buffer = append(c.buffer, r)
+}
+
+// do runs the job and sends its result. Failures are sent back as well, so
+// the checkmanager does not have to wait for the job to time out.
+func (c *connection) do(ctx context.Context, job *checkmanager.AgentJob) {
+	r := &checkmanager.AgentResult{JobId: job.Id}
+	var err error
+	switch {
+	case job.Http != nil:
+		r.Http, err = c.checker.Do(ctx, job.Http)
+	case job.Tls != nil:
+		r.Tls, err = c.checker.DoTLS(ctx, job.Tls)
+	case job.Tcp != nil:
+		r.Tcp, err = c.checker.DoTCP(ctx, job.Tcp)
+	case job.Dns != nil:
+		r.Dns, err = c.checker.DoDNS(ctx, job.Dns)
+	default:
+		err = fmt.Errorf("unknown job type %v", job.CheckType)
+	}
+	if err != nil {
+		c.logger.Errorw("Unable to run job", "error", err, "job_id", job.Id,
+			"check_id", job.CheckId, "check_type", job.CheckType)
+		r = &checkmanager.AgentResult{JobId: job.Id, Error: err.Error()}
+	}
+	c.send(r)
+}
+
+// Run the agent
+func Run() error {
+	baseLogger, err := zap.NewProduction()
+	if err != nil {
+		log.Printf("Unable to initialize logger, %v", err)
+		return err
+	}
+	logger := baseLogger.Sugar()
+	logger.Info("Initialized logger")
+
+	// Get Config
+	var c config
+	if err := envdecode.StrictDecode(&c); err != nil {
+		logger.Errorw("Unable to read config", "error", err)
+		return err
+	}
+
+	if c.Concurrency < 1 {
+		err := fmt.Errorf("invalid concurrency %v", c.Concurrency)
+		logger.Errorw("Unable to read config", "error", err)
+		return err
+	}
+
+	checker := httpcheck.NewChecker(logger)
+	slots := make(chan struct{}, c.Concurrency)
+	var wg sync.WaitGroup
+	for _, address := range c.CheckManager {
+		wg.Add(1)
+		conn := &connection{
+			config:  &c,
+			address: address,
+			checker: checker,
+			logger:  logger,
+			slots:   slots,
+			mutex:   &sync.Mutex{},
+		}
+		go func() {
+			defer wg.Done()
+			conn.run(context.Background())
+		}()
+	}
+	wg.Wait()
+	return nil
+}
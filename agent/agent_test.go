@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// failingChecker fails every check
+type failingChecker struct {
+	proto.UnimplementedHTTPCheckServiceServer
+}
+
+func (*failingChecker) Do(context.Context, *proto.Check) (*proto.Result, error) {
+	return nil, errors.New("unable to resolve host")
+}
+
+func TestDoSendsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		job   *checkmanager.AgentJob
+		error string
+	}{
+		{
+			name:  "failing check",
+			job:   &checkmanager.AgentJob{Id: "1", CheckType: "http", Http: &proto.Check{}},
+			error: "unable to resolve host",
+		},
+		{
+			name:  "unknown job type",
+			job:   &checkmanager.AgentJob{Id: "2", CheckType: "smtp"},
+			error: "unknown job type smtp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without stream, the result is buffered
+			c := &connection{
+				config:  &config{BufferSize: 1},
+				checker: &failingChecker{},
+				logger:  zap.NewNop().Sugar(),
+				mutex:   &sync.Mutex{},
+			}
+			c.do(context.Background(), tt.job)
+			if len(c.buffer) != 1 {
+				t.Fatalf("%v buffered results, expected 1", len(c.buffer))
+			}
+			r := c.buffer[0]
+			if r.JobId != tt.job.Id || r.Error != tt.error || r.Http != nil {
+				t.Errorf("result %+v, expected error %q for job %v", r, tt.error, tt.job.Id)
+			}
+		})
+	}
+}
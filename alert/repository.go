@@ -23,6 +23,10 @@ type alert struct {
 	SendMail   bool          `db:"send_mail"`
 	LastSend   time.Time     `db:"last_send"`
 	SendPeriod time.Duration `db:"send_period"`
+	// Selector and Group target the checks of the user by their labels or
+	// groups instead of a single check
+	Selector string `db:"selector"`
+	Group    string `db:"check_group"`
 }
 
 // unmarshal alert to fit to protobuf
@@ -39,6 +43,8 @@ func unmarshalAlert(a *alert) (*proto.Alert, error) {
 		SendMail:   a.SendMail,
 		LastSend:   lastSend,
 		SendPeriod: ptypes.DurationProto(a.SendPeriod),
+		Selector:   a.Selector,
+		Group:      a.Group,
 	}, nil
 }
 
@@ -63,6 +69,8 @@ type repository interface {
 	GetByUser(context.Context, int64) (*[]alert, error)
 	// Get all alerts from a check by id and type
 	GetByCheck(context.Context, int64, string) (*[]alert, error)
+	// Get all alerts from a user id targeting a selector or a group
+	GetByLabels(context.Context, int64) (*[]alert, error)
 	// Create a new alert
 	Create(context.Context, *alert) (*alert, error)
 	// Delete a alert by id
@@ -92,7 +100,7 @@ func (s *sqlRepository) Get(ctx context.Context, id int64, userID int64) (*alert
 	alert := &alert{}
 	err := s.db.GetContext(ctx, alert,
 		`SELECT id, user_id, check_id, check_type, send_mail,last_send,
-			send_period
+			send_period, selector, check_group
  		FROM alerts
 		WHERE id = ?
 		AND user_id = ?`, id, userID)
@@ -103,7 +111,7 @@ func (s *sqlRepository) GetByUser(ctx context.Context, userID int64) (*[]alert,
 	as := &[]alert{}
 	err := s.db.SelectContext(ctx, as,
 		`SELECT id, user_id, check_id, check_type, send_mail,last_send,
-			send_period
+			send_period, selector, check_group
 		FROM alerts
 		WHERE user_id = ?`, userID)
 	return as, err
@@ -113,19 +121,32 @@ func (s *sqlRepository) GetByCheck(ctx context.Context, checkID int64, checkType
 	as := &[]alert{}
 	err := s.db.SelectContext(ctx, as,
 		`SELECT id, user_id, check_id, check_type, send_mail,last_send,
-			send_period
+			send_period, selector, check_group
 		FROM alerts
 		WHERE check_id = ?
 			AND check_type = ?`, checkID, checkType)
 	return as, err
 }
 
+func (s *sqlRepository) GetByLabels(ctx context.Context, userID int64) (*[]alert, error) {
+	as := &[]alert{}
+	err := s.db.SelectContext(ctx, as,
+		`SELECT id, user_id, check_id, check_type, send_mail,last_send,
+			send_period, selector, check_group
+		FROM alerts
+		WHERE user_id = ?
+			AND (selector != '' OR check_group != '')`, userID)
+	return as, err
+}
+
 func (s *sqlRepository) Create(ctx context.Context, a *alert) (*alert, error) {
 	r, err := s.db.ExecContext(ctx,
 		`INSERT INTO alerts
-			(user_id, check_id, check_type, send_mail, send_period, last_send)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		a.UserID, a.CheckID, a.CheckType, a.SendMail, a.SendPeriod, time.Time{})
+			(user_id, check_id, check_type, send_mail, send_period, last_send,
+				selector, check_group)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.UserID, a.CheckID, a.CheckType, a.SendMail, a.SendPeriod, time.Time{},
+		a.Selector, a.Group)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create alert %w", err)
 	}
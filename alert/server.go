@@ -2,6 +2,7 @@ package alert
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -21,6 +22,7 @@ import (
 
 	"github.com/shaardie/mondane/alert/proto"
 	mail "github.com/shaardie/mondane/mail/proto"
+	"github.com/shaardie/mondane/selector"
 	user "github.com/shaardie/mondane/user/proto"
 )
 
@@ -105,9 +107,15 @@ func (s *server) Create(ctx context.Context, pCreateAlert *proto.CreateAlert) (*
 		CheckID:   pCreateAlert.CheckId,
 		CheckType: pCreateAlert.CheckType,
 		SendMail:  pCreateAlert.SendMail,
+		Selector:  pCreateAlert.Selector,
+		Group:     pCreateAlert.Group,
 	}
 
-	var err error
+	err := validateTarget(alert)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid target of alert, %v", err)
+	}
 	alert.SendPeriod, err = ptypes.Duration(pCreateAlert.SendPeriod)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument,
@@ -132,8 +140,25 @@ func (s *server) Delete(ctx context.Context, id *proto.Ids) (*empty.Empty, error
 
 // Firing triggers the firing of all alerts of a check
 func (s *server) Firing(ctx context.Context, check *proto.Check) (*empty.Empty, error) {
+	// Suppress notifications during maintenance
+	if check.Maintenance {
+		s.logger.Infow("Do not fire alerts, since check is in maintenance",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return &empty.Empty{}, nil
+	}
+
+	// Suppress notifications, if the check is unreachable, since the alerts
+	// of the parent check already fired
+	if check.Unreachable {
+		s.logger.Infow("Do not fire alerts, since check is unreachable via dependency",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return &empty.Empty{}, nil
+	}
+
 	// Get all alerts matching the check
-	alerts, err := s.db.GetByCheck(ctx, check.Id, check.Type)
+	alerts, err := s.alertsOf(ctx, check)
 	if err != nil {
 		s.logger.Warnw("Unable to get alert",
 			"check_id", check.Id,
@@ -166,34 +191,187 @@ func (s *server) Firing(ctx context.Context, check *proto.Check) (*empty.Empty,
 		// Alert should be fired
 		s.logger.Infow("Attempt to fire alert", "alert", alert)
 
-		// Get user
-		u, err := s.user.Read(ctx, &user.Id{Id: alert.UserID})
+		err = s.sendMail(ctx, alert.UserID, "[Mondane] Problem found",
+			fmt.Sprintf("Check of type %v with id %v failed", check.Type, check.Id))
 		if err != nil {
-			s.logger.Infow("Unable to get user from user service", "error", err)
 			return nil, err
 		}
 
-		// Send mail to user emails
-		_, err = s.mail.SendMail(ctx, &mail.Mail{
-			Recipient: u.Email,
-			Subject:   "[Mondane] Problem found",
-			Message:   fmt.Sprintf("Check of type %v with id %v failed", check.Type, check.Id),
-		})
+		// Update last send
+		err = s.db.UpdateLastSend(ctx, alert.ID)
 		if err != nil {
-			s.logger.Infow("Unable to send email with email service", "error", err)
+			s.logger.Infow("Unable to update alert", "error", err, "alert", alert)
 			return nil, err
 		}
+	}
+	return &empty.Empty{}, nil
+}
 
-		// Update last send
-		err = s.db.UpdateLastSend(ctx, alert.ID)
+// Resolved notifies all alerts of a check about its recovery.
+// The send period is ignored, so every outage is closed.
+func (s *server) Resolved(ctx context.Context, check *proto.Check) (*empty.Empty, error) {
+	// Suppress notifications during maintenance like for firing alerts
+	if check.Maintenance {
+		s.logger.Infow("Do not resolve alerts, since check is in maintenance",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return &empty.Empty{}, nil
+	}
+
+	alerts, err := s.alertsOf(ctx, check)
+	if err != nil {
+		s.logger.Warnw("Unable to get alert",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return nil, err
+	}
+
+	for _, alert := range *alerts {
+		if !alert.SendMail {
+			s.logger.Infow("Do not resolve alert, since email sending is disabled",
+				"alert", alert)
+			continue
+		}
+
+		s.logger.Infow("Attempt to resolve alert", "alert", alert)
+		err = s.sendMail(ctx, alert.UserID, "[Mondane] Problem resolved",
+			fmt.Sprintf("Check of type %v with id %v recovered", check.Type, check.Id))
 		if err != nil {
-			s.logger.Infow("Unable to update alert", "error", err, "alert", alert)
 			return nil, err
 		}
 	}
 	return &empty.Empty{}, nil
 }
 
+// Flapping notifies all alerts of a check, that it started or stopped
+// flapping. Like for resolved checks, the send period is ignored.
+func (s *server) Flapping(ctx context.Context, check *proto.Check) (*empty.Empty, error) {
+	if check.Maintenance {
+		s.logger.Infow("Do not notify about flapping, since check is in maintenance",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return &empty.Empty{}, nil
+	}
+
+	alerts, err := s.alertsOf(ctx, check)
+	if err != nil {
+		s.logger.Warnw("Unable to get alert",
+			"check_id", check.Id,
+			"check_type", check.Type)
+		return nil, err
+	}
+
+	subject := "[Mondane] Check is flapping"
+	message := fmt.Sprintf("Check of type %v with id %v is flapping, further notifications are suppressed until it stabilises",
+		check.Type, check.Id)
+	if !check.Flapping {
+		subject = "[Mondane] Check stopped flapping"
+		message = fmt.Sprintf("Check of type %v with id %v stopped flapping and is %v",
+			check.Type, check.Id, check.State)
+	}
+
+	for _, alert := range *alerts {
+		if !alert.SendMail {
+			s.logger.Infow("Do not notify about flapping, since email sending is disabled",
+				"alert", alert)
+			continue
+		}
+
+		s.logger.Infow("Attempt to notify about flapping", "alert", alert, "flapping", check.Flapping)
+		err = s.sendMail(ctx, alert.UserID, subject, message)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &empty.Empty{}, nil
+}
+
+// validateTarget ensures, that the alert targets exactly one of a check, a
+// selector and a group
+func validateTarget(a *alert) error {
+	targets := 0
+	if a.CheckType != "" {
+		targets++
+	}
+	if a.Selector != "" {
+		targets++
+		s, err := selector.Parse(a.Selector)
+		if err != nil {
+			return err
+		}
+		// Store the selector normalized
+		a.Selector = s.String()
+	}
+	if a.Group != "" {
+		targets++
+		if err := selector.ValidateGroup(a.Group); err != nil {
+			return err
+		}
+	}
+	if targets != 1 {
+		return errors.New("alert needs exactly one of check, selector and group")
+	}
+	if a.CheckType == "" {
+		a.CheckID = 0
+	}
+	return nil
+}
+
+// alertsOf returns the alerts of the check itself and the alerts of its user,
+// whose selector or group matches the check
+func (s *server) alertsOf(ctx context.Context, check *proto.Check) (*[]alert, error) {
+	alerts, err := s.db.GetByCheck(ctx, check.Id, check.Type)
+	if err != nil {
+		return nil, err
+	}
+	if check.UserId == 0 {
+		return alerts, nil
+	}
+	candidates, err := s.db.GetByLabels(ctx, check.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range *candidates {
+		if a.Group != "" && !selector.InGroup(check.Groups, a.Group) {
+			continue
+		}
+		if a.Selector != "" {
+			sel, err := selector.Parse(a.Selector)
+			if err != nil {
+				s.logger.Warnw("Invalid selector of alert", "error", err, "alert", a)
+				continue
+			}
+			if !sel.Matches(check.Labels) {
+				continue
+			}
+		}
+		*alerts = append(*alerts, a)
+	}
+	return alerts, nil
+}
+
+// sendMail sends a mail to the user with the given id
+func (s *server) sendMail(ctx context.Context, userID int64, subject string, message string) error {
+	// Get user
+	u, err := s.user.Read(ctx, &user.Id{Id: userID})
+	if err != nil {
+		s.logger.Infow("Unable to get user from user service", "error", err)
+		return err
+	}
+
+	// Send mail to user emails
+	_, err = s.mail.SendMail(ctx, &mail.Mail{
+		Recipient: u.Email,
+		Subject:   subject,
+		Message:   message,
+	})
+	if err != nil {
+		s.logger.Infow("Unable to send email with email service", "error", err)
+		return err
+	}
+	return nil
+}
+
 // Run the server
 func Run() error {
 	baseLogger, err := zap.NewProduction()
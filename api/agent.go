@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+	userService "github.com/shaardie/mondane/user/proto"
+)
+
+// ReadAgents returns the probe agents of the user with their liveness
+func (s *server) ReadAgents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		agents, err := s.checkmanager.GetAgentsByUser(r.Context(), &checkmanager.Id{Id: u.Id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, agents)
+	}
+}
+
+// ReadAgent returns a single probe agent of the user with its liveness
+func (s *server) ReadAgent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		agent, err := s.checkmanager.GetAgent(r.Context(), &checkmanager.Id{Id: id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		if agent.UserId != u.Id {
+			s.response(w, r, http.StatusForbidden, nil, forbiddenError)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, agent)
+	}
+}
@@ -0,0 +1,472 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+	userService "github.com/shaardie/mondane/user/proto"
+)
+
+// checkOwner returns the id of the user owning the check
+func (s *server) checkOwner(ctx context.Context, checkType string, id int64) (int64, error) {
+	checkID := &checkmanager.Id{Id: id}
+	switch checkType {
+	case "http":
+		c, err := s.checkmanager.GetHTTPCheck(ctx, checkID)
+		if err != nil {
+			return 0, err
+		}
+		return c.UserId, nil
+	case "tls":
+		c, err := s.checkmanager.GetTLSCheck(ctx, checkID)
+		if err != nil {
+			return 0, err
+		}
+		return c.UserId, nil
+	case "tcp":
+		c, err := s.checkmanager.GetTCPCheck(ctx, checkID)
+		if err != nil {
+			return 0, err
+		}
+		return c.UserId, nil
+	case "dns":
+		c, err := s.checkmanager.GetDNSCheck(ctx, checkID)
+		if err != nil {
+			return 0, err
+		}
+		return c.UserId, nil
+	case "heartbeat":
+		c, err := s.checkmanager.GetHeartbeatCheck(ctx, checkID)
+		if err != nil {
+			return 0, err
+		}
+		return c.UserId, nil
+	}
+	return 0, status.Errorf(codes.NotFound, "unknown check type %v", checkType)
+}
+
+// authorizeCheck is a middleware which ensures, that the check in the url
+// belongs to the authenticated user. It has to be wrapped by AuthenticateUser.
+func (s *server) authorizeCheck(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		owner, err := s.checkOwner(r.Context(), mux.Vars(r)["type"], id)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		if owner != u.Id {
+			s.response(w, r, http.StatusForbidden, nil, forbiddenError)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// readTimestamp reads an optional RFC 3339 timestamp from the url parameters
+func readTimestamp(r *http.Request, param string) (*timestamp.Timestamp, error) {
+	v := r.FormValue(param)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v, %w", param, err)
+	}
+	return ptypes.TimestampProto(t)
+}
+
+// readResultQuery reads the result query from the url parameters
+func readResultQuery(r *http.Request, id int64) (*checkmanager.ResultQuery, error) {
+	q := &checkmanager.ResultQuery{
+		CheckId: id,
+		Filter:  r.FormValue("filter"),
+		Cursor:  r.FormValue("cursor"),
+		Order:   r.FormValue("order"),
+	}
+	var err error
+	q.From, err = readTimestamp(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	q.To, err = readTimestamp(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	if v := r.FormValue("limit"); v != "" {
+		q.Limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit, %w", err)
+		}
+	}
+	return q, nil
+}
+
+// ReadCheckResults returns a page of results of the check
+func (s *server) ReadCheckResults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		q, err := readResultQuery(r, id)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, responseError{err.Error()})
+			return
+		}
+
+		var results proto.Message
+		switch mux.Vars(r)["type"] {
+		case "http":
+			results, err = s.checkmanager.GetHTTPCheckResultsByCheck(r.Context(), q)
+		case "tls":
+			results, err = s.checkmanager.GetTLSCheckResultsByCheck(r.Context(), q)
+		case "tcp":
+			results, err = s.checkmanager.GetTCPCheckResultsByCheck(r.Context(), q)
+		case "dns":
+			results, err = s.checkmanager.GetDNSCheckResultsByCheck(r.Context(), q)
+		case "heartbeat":
+			results, err = s.checkmanager.GetHeartbeatCheckResultsByCheck(r.Context(), q)
+		default:
+			s.response(w, r, http.StatusNotFound, nil, notFoundError)
+			return
+		}
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, results)
+	}
+}
+
+// ReadCheckStatistics returns uptime and latency statistics of the check
+func (s *server) ReadCheckStatistics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		q := &checkmanager.StatisticsQuery{
+			CheckId:   id,
+			CheckType: mux.Vars(r)["type"],
+		}
+		q.From, err = readTimestamp(r, "from")
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, responseError{err.Error()})
+			return
+		}
+		q.To, err = readTimestamp(r, "to")
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, responseError{err.Error()})
+			return
+		}
+
+		st, err := s.checkmanager.GetCheckStatistics(r.Context(), q)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, st)
+	}
+}
+
+// ReadCheckRollups returns the hourly or daily rollups of the check results
+func (s *server) ReadCheckRollups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		q := &checkmanager.RollupQuery{
+			CheckId:    id,
+			CheckType:  mux.Vars(r)["type"],
+			Resolution: r.FormValue("resolution"),
+		}
+		q.From, err = readTimestamp(r, "from")
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, responseError{err.Error()})
+			return
+		}
+		q.To, err = readTimestamp(r, "to")
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, responseError{err.Error()})
+			return
+		}
+
+		rs, err := s.checkmanager.GetCheckRollups(r.Context(), q)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, rs)
+	}
+}
+
+// RunCheck runs the check immediately and returns the recorded result
+func (s *server) RunCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		run, err := s.checkmanager.RunCheck(r.Context(), &checkmanager.CheckRef{
+			Id:   id,
+			Type: mux.Vars(r)["type"],
+		})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, run)
+	}
+}
+
+// PauseCheck stops the check until it is resumed
+func (s *server) PauseCheck() http.HandlerFunc {
+	return s.setCheckEnabled(false)
+}
+
+// ResumeCheck starts the paused check again
+func (s *server) ResumeCheck() http.HandlerFunc {
+	return s.setCheckEnabled(true)
+}
+
+func (s *server) setCheckEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		ref := &checkmanager.CheckRef{
+			Id:   id,
+			Type: mux.Vars(r)["type"],
+		}
+		if enabled {
+			_, err = s.checkmanager.ResumeCheck(r.Context(), ref)
+		} else {
+			_, err = s.checkmanager.PauseCheck(r.Context(), ref)
+		}
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
+
+// ReadCheckDependencies returns the parents and children of the check
+func (s *server) ReadCheckDependencies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		d, err := s.checkmanager.GetCheckDependencies(r.Context(), &checkmanager.CheckRef{
+			Id:   id,
+			Type: mux.Vars(r)["type"],
+		})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, d)
+	}
+}
+
+// UpdateCheckDependencies replaces the parents of the check. The checkmanager
+// ensures, that the parents belong to the same user.
+func (s *server) UpdateCheckDependencies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		d := &checkmanager.CheckDependencies{}
+		err = readJSON(r, d)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, jsonError)
+			return
+		}
+		d.Check = &checkmanager.CheckRef{
+			Id:   id,
+			Type: mux.Vars(r)["type"],
+		}
+
+		_, err = s.checkmanager.SetCheckDependencies(r.Context(), d)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
+
+// ReadDependencyGraph returns the dependencies of all checks of the user
+func (s *server) ReadDependencyGraph() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		g, err := s.checkmanager.GetDependencyGraph(r.Context(), &checkmanager.Id{Id: u.Id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, g)
+	}
+}
+
+// ReadChecks returns the checks of all types of the user. They are filtered
+// by the optional query parameters selector and group.
+func (s *server) ReadChecks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		params := r.URL.Query()
+		cs, err := s.checkmanager.GetChecksByUser(r.Context(), &checkmanager.CheckQuery{
+			UserId:   u.Id,
+			Selector: params.Get("selector"),
+			Group:    params.Get("group"),
+		})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, cs)
+	}
+}
+
+// UpdateCheckLabels replaces the labels and groups of the check
+func (s *server) UpdateCheckLabels() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getID(r)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, invalidError)
+			return
+		}
+
+		l := &checkmanager.CheckLabels{}
+		err = readJSON(r, l)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, jsonError)
+			return
+		}
+		l.Check = &checkmanager.CheckRef{
+			Id:   id,
+			Type: mux.Vars(r)["type"],
+		}
+
+		_, err = s.checkmanager.SetCheckLabels(r.Context(), l)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
+
+// ReadGroups returns the groups of the checks of the user
+func (s *server) ReadGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		gs, err := s.checkmanager.GetGroupsByUser(r.Context(), &checkmanager.Id{Id: u.Id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, gs)
+	}
+}
+
+// DryRunCheck runs the check definition in the body once without saving it
+func (s *server) DryRunCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		d := &checkmanager.DryRun{}
+		err := readJSON(r, d)
+		if err != nil {
+			s.response(
+				w, r, http.StatusBadRequest,
+				err, responseError{"Improper JSON"})
+			return
+		}
+
+		// The check runs on behalf of the user
+		switch {
+		case d.Http != nil:
+			d.Http.UserId = u.Id
+		case d.Tls != nil:
+			d.Tls.UserId = u.Id
+		case d.Tcp != nil:
+			d.Tcp.UserId = u.Id
+		case d.Dns != nil:
+			d.Dns.UserId = u.Id
+		}
+
+		run, err := s.checkmanager.DryRunCheck(r.Context(), d)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, run)
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+	userService "github.com/shaardie/mondane/user/proto"
+)
+
+// CreateMaintenanceWindow creates a maintenance window for the user
+func (s *server) CreateMaintenanceWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		mw := &checkmanager.MaintenanceWindow{}
+		err := readJSON(r, mw)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, jsonError)
+			return
+		}
+		mw.UserId = u.Id
+
+		id, err := s.checkmanager.CreateMaintenanceWindow(r.Context(), mw)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusCreated, nil, id)
+	}
+}
+
+// ReadMaintenanceWindows returns the maintenance windows of the user
+func (s *server) ReadMaintenanceWindows() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(userKey{}).(*userService.User)
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("No user in context"), internalError)
+			return
+		}
+
+		windows, err := s.checkmanager.GetMaintenanceWindowsByUser(r.Context(), &checkmanager.Id{Id: u.Id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, windows)
+	}
+}
+
+// ReadMaintenanceWindow returns a single maintenance window of the user
+func (s *server) ReadMaintenanceWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mw, ok := s.ownMaintenanceWindow(w, r)
+		if !ok {
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, mw)
+	}
+}
+
+// UpdateMaintenanceWindow replaces a maintenance window of the user
+func (s *server) UpdateMaintenanceWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		old, ok := s.ownMaintenanceWindow(w, r)
+		if !ok {
+			return
+		}
+
+		mw := &checkmanager.MaintenanceWindow{}
+		err := readJSON(r, mw)
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err, jsonError)
+			return
+		}
+		mw.Id = old.Id
+		mw.UserId = old.UserId
+
+		_, err = s.checkmanager.UpdateMaintenanceWindow(r.Context(), mw)
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
+
+// DeleteMaintenanceWindow deletes a maintenance window of the user
+func (s *server) DeleteMaintenanceWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mw, ok := s.ownMaintenanceWindow(w, r)
+		if !ok {
+			return
+		}
+
+		_, err := s.checkmanager.DeleteMaintenanceWindow(r.Context(), &checkmanager.Id{Id: mw.Id})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
+
+// ownMaintenanceWindow returns the maintenance window from the url, if it
+// belongs to the user. Otherwise it writes the error response and returns
+// false.
+func (s *server) ownMaintenanceWindow(w http.ResponseWriter, r *http.Request) (*checkmanager.MaintenanceWindow, bool) {
+	u, ok := r.Context().Value(userKey{}).(*userService.User)
+	if !ok {
+		s.response(w, r, http.StatusInternalServerError,
+			errors.New("No user in context"), internalError)
+		return nil, false
+	}
+
+	id, err := getID(r)
+	if err != nil {
+		s.response(w, r, http.StatusBadRequest, err, invalidError)
+		return nil, false
+	}
+
+	mw, err := s.checkmanager.GetMaintenanceWindow(r.Context(), &checkmanager.Id{Id: id})
+	if err != nil {
+		s.handleGRPCError(w, r, err)
+		return nil, false
+	}
+	if mw.UserId != u.Id {
+		s.response(w, r, http.StatusForbidden, nil, forbiddenError)
+		return nil, false
+	}
+	return mw, true
+}
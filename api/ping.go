@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// maxPingMessage is the number of bytes of the request body used as message
+const maxPingMessage = 255
+
+// Ping reports a heartbeat of the given kind. The optional request body is
+// stored as message, e.g. the output of a cron job.
+func (s *server) Ping(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := mux.Vars(r)["token"]
+		if !ok {
+			s.response(w, r, http.StatusInternalServerError,
+				errors.New("unable to get token from mux vars"), internalError)
+			return
+		}
+
+		message, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPingMessage))
+		if err != nil {
+			s.response(w, r, http.StatusBadRequest, err,
+				responseError{"Unable to read request body"})
+			return
+		}
+
+		_, err = s.checkmanager.PingHeartbeat(r.Context(), &checkmanager.HeartbeatPing{
+			Token:   token,
+			Kind:    kind,
+			Message: string(message),
+		})
+		if err != nil {
+			s.handleGRPCError(w, r, err)
+			return
+		}
+		s.response(w, r, http.StatusOK, nil, nil)
+	}
+}
@@ -43,6 +43,92 @@ func (s *server) routes() {
 		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.CreateAlert()))),
 	)
 
+	// Route check requests
+	s.router.Path("/api/v1/check/").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadChecks())),
+	)
+	s.router.Path("/api/v1/check/dry-run").Methods(http.MethodPost).HandlerFunc(
+		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.DryRunCheck()))),
+	)
+	checkRouter := s.router.PathPrefix("/api/v1/check/{type}/{id:[0-9]+}").Subrouter()
+	checkRouter.Path("/run").Methods(http.MethodPost).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.RunCheck()))),
+	)
+	checkRouter.Path("/pause").Methods(http.MethodPost).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.PauseCheck()))),
+	)
+	checkRouter.Path("/resume").Methods(http.MethodPost).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.ResumeCheck()))),
+	)
+	checkRouter.Path("/dependencies").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.ReadCheckDependencies()))),
+	)
+	checkRouter.Path("/dependencies").Methods(http.MethodPut).HandlerFunc(
+		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.authorizeCheck(s.UpdateCheckDependencies())))),
+	)
+	checkRouter.Path("/labels").Methods(http.MethodPut).HandlerFunc(
+		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.authorizeCheck(s.UpdateCheckLabels())))),
+	)
+	checkRouter.Path("/results").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.ReadCheckResults()))),
+	)
+	checkRouter.Path("/statistics").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.ReadCheckStatistics()))),
+	)
+	checkRouter.Path("/rollups").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.authorizeCheck(s.ReadCheckRollups()))),
+	)
+
+	// Route dependency graph requests
+	s.router.Path("/api/v1/dependencies").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadDependencyGraph())),
+	)
+
+	// Route group requests
+	s.router.Path("/api/v1/group/").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadGroups())),
+	)
+
+	// Route agent requests
+	agentRouter := s.router.PathPrefix("/api/v1/agent").Subrouter()
+	agentRouter.Path("/").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadAgents())),
+	)
+	agentRouter.Path("/{id:[0-9]+}").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadAgent())),
+	)
+
+	// Route maintenance window requests
+	maintenanceRouter := s.router.PathPrefix("/api/v1/maintenance").Subrouter()
+	maintenanceRouter.Path("/").Methods(http.MethodPost).HandlerFunc(
+		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.CreateMaintenanceWindow()))),
+	)
+	maintenanceRouter.Path("/").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadMaintenanceWindows())),
+	)
+	maintenanceRouter.Path("/{id:[0-9]+}").Methods(http.MethodGet).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.ReadMaintenanceWindow())),
+	)
+	maintenanceRouter.Path("/{id:[0-9]+}").Methods(http.MethodPut).HandlerFunc(
+		s.logRequest(s.enforceJSON(s.AuthenticateUser(s.UpdateMaintenanceWindow()))),
+	)
+	maintenanceRouter.Path("/{id:[0-9]+}").Methods(http.MethodDelete).HandlerFunc(
+		s.logRequest(s.AuthenticateUser(s.DeleteMaintenanceWindow())),
+	)
+
+	// Route heartbeat pings, authenticated by the token in the url
+	pingRouter := s.router.PathPrefix("/api/v1/ping/{token}").Subrouter()
+	pingMethods := []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	pingRouter.Path("").Methods(pingMethods...).HandlerFunc(
+		s.logRequest(s.Ping("success")),
+	)
+	pingRouter.Path("/start").Methods(pingMethods...).HandlerFunc(
+		s.logRequest(s.Ping("start")),
+	)
+	pingRouter.Path("/fail").Methods(pingMethods...).HandlerFunc(
+		s.logRequest(s.Ping("fail")),
+	)
+
 	// Use initHandler in all requests
 	s.router.Use(s.initHandler)
 
@@ -96,7 +96,7 @@ func (s *server) initHandler(h http.Handler) http.Handler {
 			}
 
 			// Connect to checkmanager grpc
-			if s.mail == nil {
+			if s.checkmanager == nil {
 				d, err := grpc.Dial(s.config.CheckManager, grpc.WithInsecure())
 				if err != nil {
 					s.logger.Errorf("unable to connect ot checkmanager service",
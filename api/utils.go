@@ -48,6 +48,12 @@ func (s *server) handleGRPCError(w http.ResponseWriter, r *http.Request, err err
 		s.response(w, r, http.StatusBadGateway, err, invalidError)
 	case codes.NotFound:
 		s.response(w, r, http.StatusNotFound, err, notFoundError)
+	case codes.FailedPrecondition:
+		// E.g. manual runs of paused checks
+		s.response(w, r, http.StatusConflict, err, responseError{e.Message()})
+	case codes.OutOfRange:
+		// The message points to the rollups, e.g. for purged results
+		s.response(w, r, http.StatusBadRequest, err, responseError{e.Message()})
 	case codes.Unauthenticated:
 		s.response(w, r, http.StatusUnauthorized, err, unauthError)
 	case codes.PermissionDenied:
@@ -0,0 +1,395 @@
+package checkmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
+)
+
+const (
+	// agentLocationPrefix is the prefix of the locations of agents
+	agentLocationPrefix = "agent:"
+	// agentTokenLength is the number of random bytes of an agent token
+	agentTokenLength = 32
+	// agentTTL is the time after which an agent without heartbeat is
+	// considered disconnected
+	agentTTL = 45 * time.Second
+	// agentResultGrace is the time to wait for the result of an agent in
+	// addition to the timeout of the check, so an agent can reconnect and
+	// deliver a buffered result in time
+	agentResultGrace = 15 * time.Second
+	// agentLateResultTTL is the time results of expired jobs are still
+	// accepted
+	agentLateResultTTL = time.Hour
+)
+
+// agentLocation returns the location of the agent
+func agentLocation(id int64) string {
+	return fmt.Sprintf("%v%v", agentLocationPrefix, id)
+}
+
+// isAgentLocation returns, if the location belongs to an agent
+func isAgentLocation(location string) bool {
+	return strings.HasPrefix(location, agentLocationPrefix)
+}
+
+// agent is a probe agent, which connects outbound to the checkmanager and
+// runs the checks with its location from inside a private network
+type agent struct {
+	ID       int64        `db:"id"`
+	UserID   int64        `db:"user_id"`
+	Name     string       `db:"name"`
+	Token    string       `db:"token"`
+	LastSeen sql.NullTime `db:"last_seen"`
+}
+
+func marshalAgent(a *proto.Agent) (*agent, error) {
+	if a.Name == "" {
+		return nil, errors.New("empty name")
+	}
+	return &agent{
+		UserID: a.UserId,
+		Name:   a.Name,
+	}, nil
+}
+
+// unmarshalAgent converts the agent without its token
+func unmarshalAgent(a *agent, now time.Time) (*proto.Agent, error) {
+	pa := &proto.Agent{
+		Id:       a.ID,
+		UserId:   a.UserID,
+		Name:     a.Name,
+		Location: agentLocation(a.ID),
+	}
+	if a.LastSeen.Valid {
+		var err error
+		pa.LastSeen, err = ptypes.TimestampProto(a.LastSeen.Time)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *a, err)
+		}
+		pa.Connected = now.Sub(a.LastSeen.Time) < agentTTL
+	}
+	return pa, nil
+}
+
+func unmarshalAgentCollection(as *[]agent, now time.Time) (*proto.Agents, error) {
+	agents := make([]*proto.Agent, len(*as))
+	for i, a := range *as {
+		pa, err := unmarshalAgent(&a, now)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in agent collection, %w", a, err)
+		}
+		agents[i] = pa
+	}
+	return &proto.Agents{Agents: agents}, nil
+}
+
+// runRef references a single run of a check
+type runRef struct {
+	checkID   int64
+	checkType string
+	timestamp time.Time
+}
+
+type runKey struct{}
+
+// withRun returns a context carrying the run, so jobs sent to agents can be
+// traced back to it
+func withRun(ctx context.Context, c check, t time.Time) context.Context {
+	return context.WithValue(ctx, runKey{}, runRef{
+		checkID:   c.CheckID(),
+		checkType: c.CheckType(),
+		timestamp: t,
+	})
+}
+
+// expiredJob is a job, whose result did not arrive in time
+type expiredJob struct {
+	run     runRef
+	expired time.Time
+}
+
+// agentConn is the connection of an agent to this replica. It implements the
+// client of the httpcheck service by sending jobs over the stream opened by
+// the agent, so the worker pool uses agents like any other worker.
+//
+// Pending jobs survive a reconnect of the agent. Results of jobs, which did
+// not arrive in time, are stored as late results without changing the state
+// of the check.
+type agentConn struct {
+	agent  agent
+	logger *zap.SugaredLogger
+	// epoch makes the job ids unique across restarts of the replica
+	epoch int64
+
+	mutex   *sync.Mutex
+	stream  proto.CheckManagerService_ConnectAgentServer
+	next    int64
+	pending map[string]chan *proto.AgentResult
+	expired map[string]expiredJob
+	// sendMutex serializes the sends on the stream
+	sendMutex *sync.Mutex
+}
+
+func newAgentConn(a agent, logger *zap.SugaredLogger) *agentConn {
+	return &agentConn{
+		agent:     a,
+		logger:    logger,
+		epoch:     time.Now().UnixNano(),
+		mutex:     &sync.Mutex{},
+		pending:   make(map[string]chan *proto.AgentResult),
+		expired:   make(map[string]expiredJob),
+		sendMutex: &sync.Mutex{},
+	}
+}
+
+// connected returns, if the agent has an open stream
+func (ac *agentConn) connected() bool {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	return ac.stream != nil
+}
+
+// call sends the job to the agent and waits for its result
+func (ac *agentConn) call(ctx context.Context, job *proto.AgentJob, timeout int64) (*proto.AgentResult, error) {
+	run, ok := ctx.Value(runKey{}).(runRef)
+	if !ok {
+		return nil, errors.New("no run in context")
+	}
+	var err error
+	job.CheckId = run.checkID
+	job.CheckType = run.checkType
+	job.Timestamp, err = ptypes.TimestampProto(run.timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", run, err)
+	}
+	wait := time.Duration(timeout)
+	if wait <= 0 {
+		wait = maxTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait+agentResultGrace)
+	defer cancel()
+
+	result := make(chan *proto.AgentResult, 1)
+	ac.mutex.Lock()
+	stream := ac.stream
+	if stream == nil {
+		ac.mutex.Unlock()
+		return nil, fmt.Errorf("agent %v disconnected", ac.agent.ID)
+	}
+	ac.next++
+	job.Id = fmt.Sprintf("%x-%x", ac.epoch, ac.next)
+	ac.pending[job.Id] = result
+	ac.mutex.Unlock()
+
+	ac.sendMutex.Lock()
+	err = stream.Send(job)
+	ac.sendMutex.Unlock()
+	if err != nil {
+		ac.mutex.Lock()
+		delete(ac.pending, job.Id)
+		ac.mutex.Unlock()
+		return nil, fmt.Errorf("unable to send job to agent %v, %w", ac.agent.ID, err)
+	}
+
+	select {
+	case r := <-result:
+		if r.Error != "" {
+			return nil, fmt.Errorf("agent %v unable to run job, %v", ac.agent.ID, r.Error)
+		}
+		return r, nil
+	case <-ctx.Done():
+		now := time.Now()
+		ac.mutex.Lock()
+		delete(ac.pending, job.Id)
+		ac.pruneExpired(now)
+		ac.expired[job.Id] = expiredJob{run: run, expired: now}
+		ac.mutex.Unlock()
+		return nil, fmt.Errorf("no result from agent %v, %w", ac.agent.ID, ctx.Err())
+	}
+}
+
+// pruneExpired forgets expired jobs, whose results are not accepted anymore.
+// The mutex has to be held.
+func (ac *agentConn) pruneExpired(now time.Time) {
+	for id, job := range ac.expired {
+		if now.Sub(job.expired) > agentLateResultTTL {
+			delete(ac.expired, id)
+		}
+	}
+}
+
+// deliver the result to the waiting job. It returns the run of the job, if
+// the result arrived too late.
+func (ac *agentConn) deliver(r *proto.AgentResult, now time.Time) (runRef, bool) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	ac.pruneExpired(now)
+	if result, ok := ac.pending[r.JobId]; ok {
+		delete(ac.pending, r.JobId)
+		result <- r
+		return runRef{}, false
+	}
+	job, ok := ac.expired[r.JobId]
+	if !ok {
+		ac.logger.Warnw("Result of unknown job", "agent_id", ac.agent.ID, "job_id", r.JobId)
+		return runRef{}, false
+	}
+	delete(ac.expired, r.JobId)
+	return job.run, true
+}
+
+func (ac *agentConn) Do(ctx context.Context, c *httpcheck.Check, _ ...grpc.CallOption) (*httpcheck.Result, error) {
+	r, err := ac.call(ctx, &proto.AgentJob{Http: c}, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.Http == nil {
+		return nil, fmt.Errorf("no http result from agent %v", ac.agent.ID)
+	}
+	return r.Http, nil
+}
+
+func (ac *agentConn) DoTLS(ctx context.Context, c *httpcheck.TLSCheck, _ ...grpc.CallOption) (*httpcheck.TLSResult, error) {
+	r, err := ac.call(ctx, &proto.AgentJob{Tls: c}, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.Tls == nil {
+		return nil, fmt.Errorf("no tls result from agent %v", ac.agent.ID)
+	}
+	return r.Tls, nil
+}
+
+func (ac *agentConn) DoTCP(ctx context.Context, c *httpcheck.TCPCheck, _ ...grpc.CallOption) (*httpcheck.TCPResult, error) {
+	r, err := ac.call(ctx, &proto.AgentJob{Tcp: c}, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.Tcp == nil {
+		return nil, fmt.Errorf("no tcp result from agent %v", ac.agent.ID)
+	}
+	return r.Tcp, nil
+}
+
+func (ac *agentConn) DoDNS(ctx context.Context, c *httpcheck.DNSCheck, _ ...grpc.CallOption) (*httpcheck.DNSResult, error) {
+	r, err := ac.call(ctx, &proto.AgentJob{Dns: c}, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if r.Dns == nil {
+		return nil, fmt.Errorf("no dns result from agent %v", ac.agent.ID)
+	}
+	return r.Dns, nil
+}
+
+// attachAgent attaches the stream to the connection of the agent. A newer
+// stream replaces an older one.
+func (wp *workerPool) attachAgent(a agent, stream proto.CheckManagerService_ConnectAgentServer) *agentConn {
+	location := agentLocation(a.ID)
+	wp.mutex.Lock()
+	ac, ok := wp.agents[location]
+	if !ok {
+		ac = newAgentConn(a, wp.logger)
+		wp.agents[location] = ac
+	}
+	wp.mutex.Unlock()
+
+	ac.mutex.Lock()
+	ac.stream = stream
+	ac.mutex.Unlock()
+	return ac
+}
+
+// detachAgent detaches the stream from the connection of the agent, if it
+// was not already replaced
+func (wp *workerPool) detachAgent(ac *agentConn, stream proto.CheckManagerService_ConnectAgentServer) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if ac.stream == stream {
+		ac.stream = nil
+	}
+}
+
+// removeAgent drops the connection of a deleted agent
+func (wp *workerPool) removeAgent(id int64) {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	delete(wp.agents, agentLocation(id))
+}
+
+// storeLateResult stores the result of an agent, which arrived after the run
+// already gave up on it
+func (s *server) storeLateResult(ctx context.Context, a *agent, run runRef, r *proto.AgentResult) error {
+	// Dry runs and failed jobs are not stored
+	if run.checkID == 0 || r.Error != "" {
+		return nil
+	}
+	location := agentLocation(a.ID)
+	// Checks only run on agents of their user
+	inMaintenance := s.maintenance.modeOf(a.UserID,
+		checkKey{checkID: run.checkID, checkType: run.checkType}, run.timestamp) != ""
+	var err error
+	switch {
+	case run.checkType == "http" && r.Http != nil:
+		result := newHTTPResult(run.checkID, run.timestamp, location, r.Http)
+		result.Maintenance = inMaintenance
+		_, err = s.db.CreateHTTPResult(ctx, result)
+	case run.checkType == "tls" && r.Tls != nil:
+		var result *tlsResult
+		result, err = newTLSResult(run.checkID, run.timestamp, location, r.Tls)
+		if err == nil {
+			result.Maintenance = inMaintenance
+			_, err = s.db.CreateTLSResult(ctx, result)
+		}
+	case run.checkType == "tcp" && r.Tcp != nil:
+		result := newTCPResult(run.checkID, run.timestamp, location, r.Tcp)
+		result.Maintenance = inMaintenance
+		_, err = s.db.CreateTCPResult(ctx, result)
+	case run.checkType == "dns" && r.Dns != nil:
+		result := newDNSResult(run.checkID, run.timestamp, location, r.Dns)
+		result.Maintenance = inMaintenance
+		_, err = s.db.CreateDNSResult(ctx, result)
+	default:
+		return fmt.Errorf("no %v result in late result of job %v", run.checkType, r.JobId)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to store late result of job %v, %w", r.JobId, err)
+	}
+	return nil
+}
+
+// authorizePlacement ensures, that a check only runs on agents of its user
+func (s *server) authorizePlacement(ctx context.Context, userID int64, p placement) error {
+	for _, l := range p.Locations {
+		if !isAgentLocation(l) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(l, agentLocationPrefix), 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid agent location %v", l)
+		}
+		a, err := s.db.GetAgent(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && a.UserID != userID) {
+			return status.Errorf(codes.InvalidArgument, "unknown agent location %v", l)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,792 @@
+package checkmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	protobuf "google.golang.org/protobuf/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+	"github.com/shaardie/mondane/checkmanager/proto"
+	"github.com/shaardie/mondane/selector"
+)
+
+// nameLabel stores the name of a check of a document. It identifies the
+// check between applies.
+const nameLabel = "mondane.name"
+
+// defaultSendPeriod of the alerts of a document
+const defaultSendPeriod = time.Hour
+
+// Actions of the changes of an apply
+const (
+	applyCreate = "create"
+	applyUpdate = "update"
+	applyDelete = "delete"
+)
+
+// appliedCheck is a check of a document or of the database
+type appliedCheck struct {
+	name      string
+	checkType string
+	// id is unset for checks of a document, which do not exist yet
+	id int64
+	// config is one of httpCheck, tlsCheck, tcpCheck, dnsCheck and
+	// heartbeatCheck
+	config  interface{}
+	enabled bool
+	labels  map[string]string
+	groups  []string
+}
+
+func (c *appliedCheck) key() checkKey {
+	return checkKey{checkID: c.id, checkType: c.checkType}
+}
+
+// defaultName is the name of a check, which was not created by an apply
+func defaultName(key checkKey) string {
+	return fmt.Sprintf("%v-%v", key.checkType, key.checkID)
+}
+
+// marshalDocumentCheck validates the check of the document
+func marshalDocumentCheck(userID int64, dc *proto.DocumentCheck) (*appliedCheck, error) {
+	if dc.Name == "" || selector.ValidateLabel(nameLabel, dc.Name) != nil {
+		return nil, fmt.Errorf("invalid name %q", dc.Name)
+	}
+	labels, groups, err := marshalLabels(dc.Labels, dc.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid labels of check %v, %w", dc.Name, err)
+	}
+	if _, ok := labels[nameLabel]; ok {
+		return nil, fmt.Errorf("label %v of check %v is reserved", nameLabel, dc.Name)
+	}
+	c := &appliedCheck{
+		name:    dc.Name,
+		enabled: !dc.Paused,
+		labels:  labels,
+		groups:  groups,
+	}
+
+	types := 0
+	for _, set := range []bool{dc.Http != nil, dc.Tls != nil, dc.Tcp != nil, dc.Dns != nil, dc.Heartbeat != nil} {
+		if set {
+			types++
+		}
+	}
+	if types != 1 {
+		return nil, fmt.Errorf("check %v needs exactly one of http, tls, tcp, dns and heartbeat", dc.Name)
+	}
+
+	switch {
+	case dc.Http != nil:
+		hc, err := marshalHTTPCheck(dc.Http)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http check %v, %w", dc.Name, err)
+		}
+		hc.ID, hc.UserID = 0, userID
+		c.checkType, c.config = "http", *hc
+	case dc.Tls != nil:
+		tc, err := marshalTLSCheck(dc.Tls)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls check %v, %w", dc.Name, err)
+		}
+		tc.ID, tc.UserID = 0, userID
+		c.checkType, c.config = "tls", *tc
+	case dc.Tcp != nil:
+		tc, err := marshalTCPCheck(dc.Tcp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tcp check %v, %w", dc.Name, err)
+		}
+		tc.ID, tc.UserID = 0, userID
+		c.checkType, c.config = "tcp", *tc
+	case dc.Dns != nil:
+		dnc, err := marshalDNSCheck(dc.Dns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns check %v, %w", dc.Name, err)
+		}
+		dnc.ID, dnc.UserID = 0, userID
+		c.checkType, c.config = "dns", *dnc
+	case dc.Heartbeat != nil:
+		hc, err := marshalHeartbeatCheck(dc.Heartbeat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid heartbeat check %v, %w", dc.Name, err)
+		}
+		hc.ID, hc.UserID, hc.Token = 0, userID, ""
+		c.checkType, c.config = "heartbeat", *hc
+	}
+	return c, nil
+}
+
+// spec returns the stored check as check of a document without its name,
+// identity, labels and state
+func spec(config interface{}) *proto.DocumentCheck {
+	switch c := config.(type) {
+	case httpCheck:
+		pc := unmarshalHTTPCheck(&c)
+		pc.Id, pc.UserId, pc.Enabled = 0, 0, false
+		return &proto.DocumentCheck{Http: pc}
+	case tlsCheck:
+		pc := unmarshalTLSCheck(&c)
+		pc.Id, pc.UserId, pc.Enabled = 0, 0, false
+		return &proto.DocumentCheck{Tls: pc}
+	case tcpCheck:
+		pc := unmarshalTCPCheck(&c)
+		pc.Id, pc.UserId, pc.Enabled = 0, 0, false
+		return &proto.DocumentCheck{Tcp: pc}
+	case dnsCheck:
+		pc := unmarshalDNSCheck(&c)
+		pc.Id, pc.UserId, pc.Enabled = 0, 0, false
+		return &proto.DocumentCheck{Dns: pc}
+	case heartbeatCheck:
+		pc := unmarshalHeartbeatCheck(&c)
+		pc.Id, pc.UserId, pc.Enabled, pc.Token = 0, 0, false, ""
+		return &proto.DocumentCheck{Heartbeat: pc}
+	}
+	return &proto.DocumentCheck{}
+}
+
+func unmarshalAppliedCheck(c *appliedCheck) *proto.DocumentCheck {
+	dc := spec(c.config)
+	if dc.Http != nil {
+		redactHTTPCheck(dc.Http)
+	}
+	dc.Name = c.name
+	dc.Labels = c.labels
+	dc.Groups = c.groups
+	dc.Paused = !c.enabled
+	return dc
+}
+
+// changed returns, if the check differs from the old one
+func (c *appliedCheck) changed(old *appliedCheck) bool {
+	return c.enabled != old.enabled ||
+		!reflect.DeepEqual(c.labels, old.labels) ||
+		!reflect.DeepEqual(c.groups, old.groups) ||
+		!protobuf.Equal(spec(c.config), spec(old.config))
+}
+
+// keepSecrets takes the unchanged secrets of the current check, which is
+// nil for new checks
+func (c *appliedCheck) keepSecrets(current *appliedCheck) {
+	hc, ok := c.config.(httpCheck)
+	if !ok {
+		return
+	}
+	old := httpCheck{}
+	if current != nil {
+		if oc, ok := current.config.(httpCheck); ok {
+			old = oc
+		}
+	}
+	hc.keepSecrets(&old)
+	c.config = hc
+}
+
+// placement returns the locations of the check
+func (c *appliedCheck) placement() placement {
+	switch config := c.config.(type) {
+	case httpCheck:
+		return config.placement
+	case tlsCheck:
+		return config.placement
+	case tcpCheck:
+		return config.placement
+	case dnsCheck:
+		return config.placement
+	}
+	return placement{}
+}
+
+// create stores the check and sets its id
+func (c *appliedCheck) create(ctx context.Context, db repository) error {
+	var err error
+	switch config := c.config.(type) {
+	case httpCheck:
+		c.id, err = db.CreateHTTPCheck(ctx, &config)
+	case tlsCheck:
+		c.id, err = db.CreateTLSCheck(ctx, &config)
+	case tcpCheck:
+		c.id, err = db.CreateTCPCheck(ctx, &config)
+	case dnsCheck:
+		c.id, err = db.CreateDNSCheck(ctx, &config)
+	case heartbeatCheck:
+		config.Token, err = generateToken(32)
+		if err != nil {
+			return fmt.Errorf("unable to generate heartbeat token, %w", err)
+		}
+		c.id, err = db.CreateHeartbeatCheck(ctx, &config)
+	default:
+		return fmt.Errorf("unknown check type %v", c.checkType)
+	}
+	return err
+}
+
+// update replaces the stored check old by the check
+func (c *appliedCheck) update(ctx context.Context, db repository, old *appliedCheck) error {
+	c.id = old.id
+	switch config := c.config.(type) {
+	case httpCheck:
+		config.ID = c.id
+		return db.UpdateHTTPCheck(ctx, &config)
+	case tlsCheck:
+		config.ID = c.id
+		return db.UpdateTLSCheck(ctx, &config)
+	case tcpCheck:
+		config.ID = c.id
+		return db.UpdateTCPCheck(ctx, &config)
+	case dnsCheck:
+		config.ID = c.id
+		return db.UpdateDNSCheck(ctx, &config)
+	case heartbeatCheck:
+		// Keep the token, so the pinging jobs do not have to change
+		config.ID = c.id
+		config.Token = old.config.(heartbeatCheck).Token
+		return db.UpdateHeartbeatCheck(ctx, &config)
+	}
+	return fmt.Errorf("unknown check type %v", c.checkType)
+}
+
+// deleteCheck deletes the stored check
+func deleteCheck(ctx context.Context, db repository, key checkKey) error {
+	switch key.checkType {
+	case "http":
+		return db.DeleteHTTPCheck(ctx, key.checkID)
+	case "tls":
+		return db.DeleteTLSCheck(ctx, key.checkID)
+	case "tcp":
+		return db.DeleteTCPCheck(ctx, key.checkID)
+	case "dns":
+		return db.DeleteDNSCheck(ctx, key.checkID)
+	case "heartbeat":
+		return db.DeleteHeartbeatCheck(ctx, key.checkID)
+	}
+	return fmt.Errorf("unknown check type %v", key.checkType)
+}
+
+// appliedAlert is an alert of a document or of the alert service
+type appliedAlert struct {
+	// id is unset for alerts of a document
+	id int64
+	// check is the name of the targeted check, empty for alerts of checks
+	// without name
+	check      string
+	key        checkKey
+	selector   string
+	group      string
+	sendMail   bool
+	sendPeriod time.Duration
+}
+
+// target returns the description of the targeted checks
+func (a *appliedAlert) target() string {
+	switch {
+	case a.selector != "":
+		return "selector " + a.selector
+	case a.group != "":
+		return "group " + a.group
+	case a.check != "":
+		return a.check
+	}
+	return defaultName(a.key)
+}
+
+func (a *appliedAlert) equal(b *appliedAlert) bool {
+	return a.key == b.key &&
+		a.selector == b.selector &&
+		a.group == b.group &&
+		a.sendMail == b.sendMail &&
+		a.sendPeriod == b.sendPeriod
+}
+
+// marshalDocumentAlert validates the alert of the document. types maps the
+// names of the checks of the document to their types.
+func marshalDocumentAlert(da *proto.DocumentAlert, types map[string]string) (*appliedAlert, error) {
+	a := &appliedAlert{
+		check:      da.Check,
+		group:      da.Group,
+		sendMail:   da.SendMail,
+		sendPeriod: defaultSendPeriod,
+	}
+	targets := 0
+	if da.Check != "" {
+		targets++
+		checkType, ok := types[da.Check]
+		if !ok {
+			return nil, fmt.Errorf("alert for unknown check %v", da.Check)
+		}
+		a.key.checkType = checkType
+	}
+	if da.Selector != "" {
+		targets++
+		s, err := selector.Parse(da.Selector)
+		if err != nil {
+			return nil, err
+		}
+		// The alert service stores the selector normalized
+		a.selector = s.String()
+	}
+	if da.Group != "" {
+		targets++
+		if err := selector.ValidateGroup(da.Group); err != nil {
+			return nil, err
+		}
+	}
+	if targets != 1 {
+		return nil, errors.New("alert needs exactly one of check, selector and group")
+	}
+	if da.SendPeriod != nil {
+		var err error
+		a.sendPeriod, err = ptypes.Duration(da.SendPeriod)
+		if err != nil || a.sendPeriod < 0 {
+			return nil, fmt.Errorf("invalid send period of alert for %v", a.target())
+		}
+	}
+	return a, nil
+}
+
+func unmarshalAppliedAlert(a *appliedAlert) *proto.DocumentAlert {
+	return &proto.DocumentAlert{
+		Check:      a.check,
+		Selector:   a.selector,
+		Group:      a.group,
+		SendMail:   a.sendMail,
+		SendPeriod: ptypes.DurationProto(a.sendPeriod),
+	}
+}
+
+// marshalDocument validates the checks and alerts of the document
+func marshalDocument(userID int64, d *proto.Document) ([]*appliedCheck, []*appliedAlert, error) {
+	if d == nil {
+		return nil, nil, errors.New("missing document")
+	}
+	checks := make([]*appliedCheck, len(d.Checks))
+	types := map[string]string{}
+	for i, dc := range d.Checks {
+		c, err := marshalDocumentCheck(userID, dc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := types[c.name]; ok {
+			return nil, nil, fmt.Errorf("duplicate check %v", c.name)
+		}
+		types[c.name] = c.checkType
+		checks[i] = c
+	}
+	alerts := make([]*appliedAlert, len(d.Alerts))
+	for i, da := range d.Alerts {
+		a, err := marshalDocumentAlert(da, types)
+		if err != nil {
+			return nil, nil, err
+		}
+		alerts[i] = a
+	}
+	return checks, alerts, nil
+}
+
+// unmarshalDocument returns the checks sorted by name and the alerts. Alerts
+// of checks without name are skipped.
+func unmarshalDocument(checks []*appliedCheck, alerts []*appliedAlert) *proto.Document {
+	sorted := make([]*appliedCheck, len(checks))
+	copy(sorted, checks)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+	d := &proto.Document{
+		Checks: make([]*proto.DocumentCheck, len(sorted)),
+		Alerts: []*proto.DocumentAlert{},
+	}
+	for i, c := range sorted {
+		d.Checks[i] = unmarshalAppliedCheck(c)
+	}
+	for _, a := range alerts {
+		if a.key.checkType != "" && a.check == "" {
+			continue
+		}
+		d.Alerts = append(d.Alerts, unmarshalAppliedAlert(a))
+	}
+	return d
+}
+
+// checkChange is a single change of the checks of an apply
+type checkChange struct {
+	action string
+	// desired is the check of the document, unset on delete
+	desired *appliedCheck
+	// current is the stored check, unset on create
+	current *appliedCheck
+}
+
+// planChecks returns the changes from the current to the desired checks and
+// the number of unchanged checks. A check, whose type changed, is replaced.
+// Checks missing in the document are only deleted on prune. Current checks
+// sharing a name are an error, since they cannot be told apart.
+func planChecks(desired []*appliedCheck, current []*appliedCheck, prune bool) ([]checkChange, int64, error) {
+	byName := map[string]*appliedCheck{}
+	for _, c := range current {
+		if other, ok := byName[c.name]; ok {
+			return nil, 0, fmt.Errorf("checks %v and %v share the name %v",
+				defaultName(other.key()), defaultName(c.key()), c.name)
+		}
+		byName[c.name] = c
+	}
+
+	changes := []checkChange{}
+	matched := map[*appliedCheck]bool{}
+	var unchanged int64
+	for _, d := range desired {
+		c, ok := byName[d.name]
+		d.keepSecrets(c)
+		switch {
+		case !ok:
+			changes = append(changes, checkChange{action: applyCreate, desired: d})
+		case c.checkType != d.checkType:
+			matched[c] = true
+			changes = append(changes,
+				checkChange{action: applyDelete, current: c},
+				checkChange{action: applyCreate, desired: d})
+		case d.changed(c):
+			matched[c] = true
+			d.id = c.id
+			changes = append(changes, checkChange{action: applyUpdate, desired: d, current: c})
+		default:
+			matched[c] = true
+			d.id = c.id
+			unchanged++
+		}
+	}
+	if prune {
+		for _, c := range current {
+			if !matched[c] {
+				changes = append(changes, checkChange{action: applyDelete, current: c})
+			}
+		}
+	}
+	return changes, unchanged, nil
+}
+
+// applyChecks stores the changes of the checks of the user
+func applyChecks(ctx context.Context, db repository, userID int64, changes []checkChange) error {
+	for _, ch := range changes {
+		var err error
+		switch ch.action {
+		case applyDelete:
+			err = deleteCheck(ctx, db, ch.current.key())
+			if err != nil {
+				return fmt.Errorf("unable to delete check %v, %w", ch.current.name, err)
+			}
+			continue
+		case applyCreate:
+			err = ch.desired.create(ctx, db)
+		case applyUpdate:
+			err = ch.desired.update(ctx, db, ch.current)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to %v check %v, %w", ch.action, ch.desired.name, err)
+		}
+
+		d := ch.desired
+		labels := map[string]string{nameLabel: d.name}
+		for name, value := range d.labels {
+			labels[name] = value
+		}
+		err = db.SetLabels(ctx, userID, d.key(), labels, d.groups)
+		if err != nil {
+			return err
+		}
+		err = db.SetCheckEnabled(ctx, d.id, d.checkType, d.enabled)
+		if err != nil {
+			return fmt.Errorf("unable to set state of check %v, %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+// alertChange is a single change of the alerts of an apply
+type alertChange struct {
+	action string
+	alert  *appliedAlert
+	// applied is set, once the change is done in the alert service
+	applied bool
+}
+
+// deletedChecks returns the checks deleted by the changes
+func deletedChecks(changes []checkChange) map[checkKey]bool {
+	deleted := map[checkKey]bool{}
+	for _, ch := range changes {
+		if ch.action == applyDelete {
+			deleted[ch.current.key()] = true
+		}
+	}
+	return deleted
+}
+
+// resolveAlerts sets the checks targeted by the alerts of the document from
+// the names of the checks
+func resolveAlerts(checks []*appliedCheck, alerts []*appliedAlert) {
+	names := map[string]checkKey{}
+	for _, c := range checks {
+		names[c.name] = c.key()
+	}
+	for _, a := range alerts {
+		if a.check != "" {
+			a.key = names[a.check]
+		}
+	}
+}
+
+// planAlerts returns the changes from the current to the desired alerts and
+// the number of unchanged alerts. Alerts have no identity, so changed alerts
+// are replaced. Alerts missing in the document are only deleted on prune or
+// if their check gets deleted, like a check replaced due to a new type.
+func planAlerts(desired []*appliedAlert, current []*appliedAlert, deleted map[checkKey]bool, prune bool) ([]alertChange, int64) {
+	changes := []alertChange{}
+	matched := map[*appliedAlert]bool{}
+	var unchanged int64
+	for _, d := range desired {
+		found := false
+		for _, c := range current {
+			if !matched[c] && d.equal(c) {
+				matched[c] = true
+				found = true
+				break
+			}
+		}
+		if found {
+			unchanged++
+			continue
+		}
+		changes = append(changes, alertChange{action: applyCreate, alert: d})
+	}
+	for _, c := range current {
+		if !matched[c] && (prune || deleted[c.key]) {
+			changes = append(changes, alertChange{action: applyDelete, alert: c})
+		}
+	}
+	return changes, unchanged
+}
+
+// loadAppliedChecks returns the checks of the user with their names
+func (s *server) loadAppliedChecks(ctx context.Context, userID int64) ([]*appliedCheck, error) {
+	ls, err := s.db.GetLabelsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	gs, err := s.db.GetGroupsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	index := newLabelIndex(*ls, *gs)
+
+	runners := []check{}
+	httpChecks, err := s.db.GetHTTPChecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *httpChecks {
+		runners = append(runners, s.newHTTPRunnerCheck(c))
+	}
+	tlsChecks, err := s.db.GetTLSChecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *tlsChecks {
+		runners = append(runners, s.newTLSRunnerCheck(c))
+	}
+	tcpChecks, err := s.db.GetTCPChecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *tcpChecks {
+		runners = append(runners, s.newTCPRunnerCheck(c))
+	}
+	dnsChecks, err := s.db.GetDNSChecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *dnsChecks {
+		runners = append(runners, s.newDNSRunnerCheck(c))
+	}
+	heartbeatChecks, err := s.db.GetHeartbeatChecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *heartbeatChecks {
+		runners = append(runners, s.newHeartbeatRunnerCheck(c))
+	}
+
+	checks := make([]*appliedCheck, len(runners))
+	for i, r := range runners {
+		key := checkKey{checkID: r.CheckID(), checkType: r.CheckType()}
+		cl := index.get(key)
+		name := defaultName(key)
+		labels := map[string]string{}
+		for n, v := range cl.Labels {
+			if n == nameLabel {
+				name = v
+				continue
+			}
+			labels[n] = v
+		}
+		checks[i] = &appliedCheck{
+			name:      name,
+			checkType: key.checkType,
+			id:        key.checkID,
+			config:    r.Config(),
+			enabled:   r.Enabled(),
+			labels:    labels,
+			groups:    cl.Groups,
+		}
+	}
+	return checks, nil
+}
+
+// loadAppliedAlerts returns the alerts of the user. The alerts of single
+// checks get the names of the checks.
+func (s *server) loadAppliedAlerts(ctx context.Context, userID int64, checks []*appliedCheck) ([]*appliedAlert, error) {
+	as, err := s.alert.ReadAll(ctx, &alert.UserId{UserId: userID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get alerts from alert service, %w", err)
+	}
+	names := map[checkKey]string{}
+	for _, c := range checks {
+		names[c.key()] = c.name
+	}
+	alerts := make([]*appliedAlert, len(as.Alerts))
+	for i, a := range as.Alerts {
+		period, err := ptypes.Duration(a.SendPeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid send period of alert %v, %w", a.Id, err)
+		}
+		alerts[i] = &appliedAlert{
+			id:         a.Id,
+			selector:   a.Selector,
+			group:      a.Group,
+			sendMail:   a.SendMail,
+			sendPeriod: period,
+		}
+		if a.CheckType != "" {
+			alerts[i].key = checkKey{checkID: a.CheckId, checkType: a.CheckType}
+			alerts[i].check = names[alerts[i].key]
+		}
+	}
+	return alerts, nil
+}
+
+// applyAlerts creates and deletes the alerts of the user in the alert service
+// and marks the changes done
+func (s *server) applyAlerts(ctx context.Context, userID int64, changes []alertChange) error {
+	for i, ch := range changes {
+		a := ch.alert
+		switch ch.action {
+		case applyCreate:
+			id, err := s.createAlert(ctx, userID, a)
+			if err != nil {
+				return fmt.Errorf("unable to create alert for %v, %w", a.target(), err)
+			}
+			a.id = id
+		case applyDelete:
+			_, err := s.alert.Delete(ctx, &alert.Ids{Id: a.id, UserId: userID})
+			if err != nil {
+				return fmt.Errorf("unable to delete alert for %v, %w", a.target(), err)
+			}
+		}
+		changes[i].applied = true
+	}
+	return nil
+}
+
+// revertAlerts reverts the done changes of the alerts in reverse order.
+// Deleted alerts are created again with a new id. Failures are only logged,
+// since there is nothing left to fall back to.
+func (s *server) revertAlerts(ctx context.Context, userID int64, changes []alertChange) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		ch := changes[i]
+		if !ch.applied {
+			continue
+		}
+		a := ch.alert
+		var err error
+		switch ch.action {
+		case applyCreate:
+			_, err = s.alert.Delete(ctx, &alert.Ids{Id: a.id, UserId: userID})
+		case applyDelete:
+			a.id, err = s.createAlert(ctx, userID, a)
+		}
+		if err != nil {
+			s.logger.Errorw("Unable to revert alert", "error", err, "user_id", userID,
+				"action", ch.action, "target", a.target())
+			continue
+		}
+		changes[i].applied = false
+	}
+}
+
+// createAlert creates the alert in the alert service and returns its id
+func (s *server) createAlert(ctx context.Context, userID int64, a *appliedAlert) (int64, error) {
+	created, err := s.alert.Create(ctx, &alert.CreateAlert{
+		UserId:     userID,
+		CheckId:    a.key.checkID,
+		CheckType:  a.key.checkType,
+		SendMail:   a.sendMail,
+		SendPeriod: ptypes.DurationProto(a.sendPeriod),
+		Selector:   a.selector,
+		Group:      a.group,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created.Id, nil
+}
+
+// runnerCheck returns the runner of the stored check
+func (s *server) runnerCheck(config interface{}) check {
+	switch c := config.(type) {
+	case httpCheck:
+		return s.newHTTPRunnerCheck(c)
+	case tlsCheck:
+		return s.newTLSRunnerCheck(c)
+	case tcpCheck:
+		return s.newTCPRunnerCheck(c)
+	case dnsCheck:
+		return s.newDNSRunnerCheck(c)
+	case heartbeatCheck:
+		return s.newHeartbeatRunnerCheck(c)
+	}
+	return nil
+}
+
+func unmarshalApplyReport(checks []checkChange, alerts []alertChange, unchanged int64, dryRun bool) *proto.ApplyReport {
+	r := &proto.ApplyReport{
+		Changes:   []*proto.ApplyChange{},
+		Unchanged: unchanged,
+		DryRun:    dryRun,
+	}
+	for _, ch := range checks {
+		c := ch.desired
+		if ch.action == applyDelete {
+			c = ch.current
+		}
+		r.Changes = append(r.Changes, &proto.ApplyChange{
+			Action:    ch.action,
+			Kind:      "check",
+			Name:      c.name,
+			CheckType: c.checkType,
+			Id:        c.id,
+		})
+	}
+	for _, ch := range alerts {
+		r.Changes = append(r.Changes, &proto.ApplyChange{
+			Action:    ch.action,
+			Kind:      "alert",
+			Name:      ch.alert.target(),
+			CheckType: ch.alert.key.checkType,
+			Id:        ch.alert.id,
+		})
+	}
+	return r
+}
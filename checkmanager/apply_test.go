@@ -0,0 +1,119 @@
+package checkmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanAlerts(t *testing.T) {
+	web := checkKey{checkID: 1, checkType: "http"}
+	db := checkKey{checkID: 2, checkType: "tcp"}
+	alertFor := func(id int64, key checkKey) *appliedAlert {
+		return &appliedAlert{id: id, key: key, sendMail: true, sendPeriod: time.Hour}
+	}
+	group := func(id int64, g string) *appliedAlert {
+		return &appliedAlert{id: id, group: g, sendPeriod: time.Hour}
+	}
+
+	tests := []struct {
+		name      string
+		desired   []*appliedAlert
+		current   []*appliedAlert
+		deleted   map[checkKey]bool
+		prune     bool
+		want      []alertChange
+		unchanged int64
+	}{
+		{
+			name:      "unchanged",
+			desired:   []*appliedAlert{alertFor(0, web)},
+			current:   []*appliedAlert{alertFor(1, web)},
+			want:      []alertChange{},
+			unchanged: 1,
+		},
+		{
+			name:    "create",
+			desired: []*appliedAlert{alertFor(0, web), group(0, "customers")},
+			current: []*appliedAlert{alertFor(1, web)},
+			want: []alertChange{
+				{action: applyCreate, alert: group(0, "customers")},
+			},
+			unchanged: 1,
+		},
+		{
+			name:    "changed alert is replaced only on prune",
+			desired: []*appliedAlert{alertFor(0, db)},
+			current: []*appliedAlert{alertFor(1, web)},
+			want: []alertChange{
+				{action: applyCreate, alert: alertFor(0, db)},
+			},
+		},
+		{
+			name:    "prune",
+			desired: []*appliedAlert{alertFor(0, db)},
+			current: []*appliedAlert{alertFor(1, web), group(2, "customers")},
+			prune:   true,
+			want: []alertChange{
+				{action: applyCreate, alert: alertFor(0, db)},
+				{action: applyDelete, alert: alertFor(1, web)},
+				{action: applyDelete, alert: group(2, "customers")},
+			},
+		},
+		{
+			// The check web got a new type and is replaced by a new check
+			name:    "alert of deleted check without prune",
+			desired: []*appliedAlert{alertFor(0, checkKey{checkID: 3, checkType: "tcp"})},
+			current: []*appliedAlert{alertFor(1, web), group(2, "customers")},
+			deleted: map[checkKey]bool{web: true},
+			want: []alertChange{
+				{action: applyCreate, alert: alertFor(0, checkKey{checkID: 3, checkType: "tcp"})},
+				{action: applyDelete, alert: alertFor(1, web)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, unchanged := planAlerts(tt.desired, tt.current, tt.deleted, tt.prune)
+			if unchanged != tt.unchanged {
+				t.Errorf("unchanged %v, expected %v", unchanged, tt.unchanged)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("%v changes, expected %v", len(changes), len(tt.want))
+			}
+			for i, ch := range changes {
+				want := tt.want[i]
+				if ch.action != want.action || ch.alert.id != want.alert.id || !ch.alert.equal(want.alert) {
+					t.Errorf("change %v is %v %+v, expected %v %+v",
+						i, ch.action, *ch.alert, want.action, *want.alert)
+				}
+			}
+		})
+	}
+}
+
+func TestDeletedChecks(t *testing.T) {
+	web := &appliedCheck{name: "web", checkType: "http", id: 1}
+	db := &appliedCheck{name: "db", checkType: "tcp", id: 2}
+	replaced := &appliedCheck{name: "web", checkType: "tls"}
+	changes, _, err := planChecks([]*appliedCheck{replaced}, []*appliedCheck{web, db}, false)
+	if err != nil {
+		t.Fatalf("unable to plan checks, %v", err)
+	}
+	deleted := deletedChecks(changes)
+	if len(deleted) != 1 || !deleted[web.key()] {
+		t.Errorf("deleted checks %v, expected only %v", deleted, web.key())
+	}
+}
+
+func TestPlanChecksDuplicateNames(t *testing.T) {
+	current := []*appliedCheck{
+		{name: "web", checkType: "http", id: 1},
+		{name: "web", checkType: "tcp", id: 2},
+	}
+	for _, prune := range []bool{false, true} {
+		_, _, err := planChecks([]*appliedCheck{}, current, prune)
+		if err == nil || err.Error() != "checks http-1 and tcp-2 share the name web" {
+			t.Errorf("error %v with prune %v", err, prune)
+		}
+	}
+}
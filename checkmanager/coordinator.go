@@ -0,0 +1,234 @@
+package checkmanager
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// shardOf returns the shard of the check
+func shardOf(checkID int64, checkType string, shards int) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%v:%v", checkType, checkID)
+	return int(h.Sum32() % uint32(shards))
+}
+
+// replicaID returns a unique id of this replica
+func replicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "checkmanager"
+	}
+	return fmt.Sprintf("%v-%x", host, rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+}
+
+// coordinator distributes the checks between the replicas of the
+// checkmanager.
+//
+// The checks are split into a fixed number of shards. Every replica holds
+// time-limited leases in the database on a fair share of the shards and
+// only runs the checks of these shards. Replicas announce themselves with a
+// heartbeat, so the fair share shrinks when a replica joins and grows when
+// one dies. Superfluous shards are released after their checks are stopped
+// and leases of dead replicas are taken over after they expired.
+//
+// A replica, which is unable to renew a lease, stops the checks of the shard
+// before the lease expires, so no check runs twice. This relies on the
+// clocks of the replicas being synchronized.
+type coordinator struct {
+	db     repository
+	logger *zap.SugaredLogger
+	id     string
+	shards int
+	ttl    time.Duration
+	// changed is called after shards were acquired or before they are
+	// released
+	changed func(ctx context.Context)
+
+	mutex *sync.Mutex
+	// held are the shards with their lease expiry
+	held map[int]time.Time
+	// done is closed after all leases are released
+	done chan struct{}
+}
+
+func newCoordinator(db repository, logger *zap.SugaredLogger, id string, shards int, ttl time.Duration, changed func(ctx context.Context)) *coordinator {
+	return &coordinator{
+		db:      db,
+		logger:  logger,
+		id:      id,
+		shards:  shards,
+		ttl:     ttl,
+		changed: changed,
+		mutex:   &sync.Mutex{},
+		held:    make(map[int]time.Time),
+		done:    make(chan struct{}),
+	}
+}
+
+// owns returns, if this replica runs the check
+func (co *coordinator) owns(checkID int64, checkType string) bool {
+	return co.holds(shardOf(checkID, checkType, co.shards))
+}
+
+// holds returns, if this replica holds the lease on the shard
+func (co *coordinator) holds(shard int) bool {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+	_, ok := co.held[shard]
+	return ok
+}
+
+// run the coordination until the context is done and release all leases
+// afterwards
+func (co *coordinator) run(ctx context.Context) {
+	defer close(co.done)
+	err := co.db.InitShardLeases(ctx, co.shards)
+	if err != nil {
+		co.logger.Errorw("Unable to initialize shard leases", "error", err)
+	}
+
+	ticker := time.NewTicker(co.ttl / 3)
+	defer ticker.Stop()
+	for {
+		co.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			co.releaseAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// wait until the coordination stopped
+func (co *coordinator) wait() {
+	<-co.done
+}
+
+// tick renews, releases and acquires leases
+func (co *coordinator) tick(ctx context.Context, now time.Time) {
+	err := co.db.UpdateReplica(ctx, co.id, now)
+	if err != nil {
+		co.logger.Errorw("Unable to update replica heartbeat", "error", err)
+	}
+	replicas, err := co.db.CountReplicas(ctx, now.Add(-co.ttl))
+	if err != nil || replicas < 1 {
+		co.logger.Errorw("Unable to count replicas", "error", err)
+		replicas = 1
+	}
+	share := (co.shards + int(replicas) - 1) / int(replicas)
+
+	lost := co.renew(ctx, now)
+	if len(lost) > 0 {
+		co.logger.Warnw("Lost shard leases", "shards", lost)
+		co.changed(ctx)
+	}
+
+	held := co.heldShards()
+	if len(held) > share {
+		co.release(ctx, held[share:])
+		return
+	}
+	if len(held) < share {
+		co.acquire(ctx, now, share-len(held))
+	}
+}
+
+// heldShards returns the held shards in order
+func (co *coordinator) heldShards() []int {
+	co.mutex.Lock()
+	defer co.mutex.Unlock()
+	shards := make([]int, 0, len(co.held))
+	for shard := range co.held {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+// renew all held leases and return the shards, which are lost. A lease,
+// which could not be renewed due to an error, is given up a third of the
+// ttl before it expires.
+func (co *coordinator) renew(ctx context.Context, now time.Time) []int {
+	lost := []int{}
+	for _, shard := range co.heldShards() {
+		expires := now.Add(co.ttl)
+		ok, err := co.db.RenewShardLease(ctx, shard, co.id, expires)
+		co.mutex.Lock()
+		switch {
+		case err == nil && ok:
+			co.held[shard] = expires
+		case err == nil || now.After(co.held[shard].Add(-co.ttl/3)):
+			delete(co.held, shard)
+			lost = append(lost, shard)
+		default:
+			co.logger.Errorw("Unable to renew shard lease", "error", err, "shard", shard)
+		}
+		co.mutex.Unlock()
+	}
+	return lost
+}
+
+// release the shards after stopping their checks
+func (co *coordinator) release(ctx context.Context, shards []int) {
+	co.mutex.Lock()
+	for _, shard := range shards {
+		delete(co.held, shard)
+	}
+	co.mutex.Unlock()
+	co.changed(ctx)
+
+	for _, shard := range shards {
+		err := co.db.ReleaseShardLease(ctx, shard, co.id)
+		if err != nil {
+			co.logger.Errorw("Unable to release shard lease", "error", err, "shard", shard)
+		}
+	}
+	co.logger.Infow("Released shards", "shards", shards)
+}
+
+// releaseAll releases all leases on shutdown
+func (co *coordinator) releaseAll() {
+	co.release(context.Background(), co.heldShards())
+}
+
+// acquire up to n free or expired shards
+func (co *coordinator) acquire(ctx context.Context, now time.Time, n int) {
+	free, err := co.db.GetFreeShards(ctx, now)
+	if err != nil {
+		co.logger.Errorw("Unable to get free shards", "error", err)
+		return
+	}
+
+	acquired := []int{}
+	expires := now.Add(co.ttl)
+	for _, shard := range free {
+		if len(acquired) == n {
+			break
+		}
+		ok, err := co.db.AcquireShardLease(ctx, shard, co.id, expires, now)
+		if err != nil {
+			co.logger.Errorw("Unable to acquire shard lease", "error", err, "shard", shard)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		co.mutex.Lock()
+		co.held[shard] = expires
+		co.mutex.Unlock()
+		acquired = append(acquired, shard)
+	}
+	if len(acquired) > 0 {
+		co.logger.Infow("Acquired shards", "shards", acquired)
+		co.changed(ctx)
+	}
+}
@@ -0,0 +1,179 @@
+package checkmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// maxParents is the maximal number of parents of a single check
+const maxParents = 16
+
+// dependency is the edge from a check to one of its parent checks. While a
+// parent is down, the check is considered unreachable.
+type dependency struct {
+	UserID     int64  `db:"user_id"`
+	CheckID    int64  `db:"check_id"`
+	CheckType  string `db:"check_type"`
+	ParentID   int64  `db:"parent_id"`
+	ParentType string `db:"parent_type"`
+}
+
+func (d *dependency) check() checkKey {
+	return checkKey{checkID: d.CheckID, checkType: d.CheckType}
+}
+
+func (d *dependency) parent() checkKey {
+	return checkKey{checkID: d.ParentID, checkType: d.ParentType}
+}
+
+// validCheckType returns, if the check type is known
+func validCheckType(checkType string) bool {
+	switch checkType {
+	case "http", "tls", "tcp", "dns", "heartbeat":
+		return true
+	}
+	return false
+}
+
+func marshalCheckRef(ref *proto.CheckRef) (checkKey, error) {
+	if ref == nil {
+		return checkKey{}, errors.New("missing check")
+	}
+	if !validCheckType(ref.Type) {
+		return checkKey{}, fmt.Errorf("unknown check type %v", ref.Type)
+	}
+	return checkKey{checkID: ref.Id, checkType: ref.Type}, nil
+}
+
+func unmarshalCheckRef(key checkKey) *proto.CheckRef {
+	return &proto.CheckRef{Id: key.checkID, Type: key.checkType}
+}
+
+// marshalCheckDependencies returns the check and its parents
+func marshalCheckDependencies(d *proto.CheckDependencies) (checkKey, []checkKey, error) {
+	key, err := marshalCheckRef(d.Check)
+	if err != nil {
+		return key, nil, err
+	}
+	if len(d.Parents) > maxParents {
+		return key, nil, fmt.Errorf("more than %v parents", maxParents)
+	}
+	parents := []checkKey{}
+	seen := map[checkKey]bool{}
+	for _, ref := range d.Parents {
+		parent, err := marshalCheckRef(ref)
+		if err != nil {
+			return key, nil, fmt.Errorf("invalid parent, %w", err)
+		}
+		if parent == key {
+			return key, nil, errors.New("check depends on itself")
+		}
+		if seen[parent] {
+			return key, nil, fmt.Errorf("duplicate parent %v check %v", parent.checkType, parent.checkID)
+		}
+		seen[parent] = true
+		parents = append(parents, parent)
+	}
+	return key, parents, nil
+}
+
+// sortCheckKeys sorts the keys by type and id
+func sortCheckKeys(keys []checkKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].checkType != keys[j].checkType {
+			return keys[i].checkType < keys[j].checkType
+		}
+		return keys[i].checkID < keys[j].checkID
+	})
+}
+
+// unmarshalCheckDependencies returns the parents and children of the check
+func unmarshalCheckDependencies(key checkKey, ds []dependency) *proto.CheckDependencies {
+	parents := []checkKey{}
+	children := []checkKey{}
+	for _, d := range ds {
+		if d.check() == key {
+			parents = append(parents, d.parent())
+		}
+		if d.parent() == key {
+			children = append(children, d.check())
+		}
+	}
+	sortCheckKeys(parents)
+	sortCheckKeys(children)
+	return &proto.CheckDependencies{
+		Check:    unmarshalCheckRef(key),
+		Parents:  unmarshalCheckRefs(parents),
+		Children: unmarshalCheckRefs(children),
+	}
+}
+
+// unmarshalDependencyGraph returns the dependencies of all checks with a
+// parent or a child
+func unmarshalDependencyGraph(ds []dependency) *proto.DependencyGraph {
+	keys := []checkKey{}
+	seen := map[checkKey]bool{}
+	for _, d := range ds {
+		for _, key := range []checkKey{d.check(), d.parent()} {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sortCheckKeys(keys)
+	checks := make([]*proto.CheckDependencies, len(keys))
+	for i, key := range keys {
+		checks[i] = unmarshalCheckDependencies(key, ds)
+	}
+	return &proto.DependencyGraph{Checks: checks}
+}
+
+// findCycle returns a parent, which would introduce a cycle into the graph,
+// if the check gets the parents. The edges of the check itself are replaced
+// by the new parents.
+func findCycle(ds []dependency, key checkKey, parents []checkKey) (checkKey, bool) {
+	graph := map[checkKey][]checkKey{}
+	for _, d := range ds {
+		if d.check() != key {
+			graph[d.check()] = append(graph[d.check()], d.parent())
+		}
+	}
+
+	// A cycle exists, if the check is reachable from one of its parents
+	for _, parent := range parents {
+		visited := map[checkKey]bool{}
+		stack := []checkKey{parent}
+		for len(stack) > 0 {
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if current == key {
+				return parent, true
+			}
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+			stack = append(stack, graph[current]...)
+		}
+	}
+	return checkKey{}, false
+}
+
+// parentDown returns, if one of the parents of the check is down
+func parentDown(ctx context.Context, db repository, c check) (bool, error) {
+	states, err := db.GetParentCheckStates(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		return false, err
+	}
+	for _, s := range *states {
+		if s.State == stateDown {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package checkmanager
+
+import "testing"
+
+func TestFindCycle(t *testing.T) {
+	http := func(id int64) checkKey { return checkKey{checkID: id, checkType: "http"} }
+	tcp := func(id int64) checkKey { return checkKey{checkID: id, checkType: "tcp"} }
+	edge := func(child checkKey, parent checkKey) dependency {
+		return dependency{
+			CheckID: child.checkID, CheckType: child.checkType,
+			ParentID: parent.checkID, ParentType: parent.checkType,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		ds      []dependency
+		key     checkKey
+		parents []checkKey
+		cycle   bool
+		parent  checkKey
+	}{
+		{
+			name: "no dependencies",
+			key:  http(1),
+		},
+		{
+			name:    "new parent",
+			key:     http(1),
+			parents: []checkKey{http(2)},
+		},
+		{
+			name:    "self",
+			key:     http(1),
+			parents: []checkKey{http(1)},
+			cycle:   true,
+			parent:  http(1),
+		},
+		{
+			name:    "direct cycle",
+			ds:      []dependency{edge(http(2), http(1))},
+			key:     http(1),
+			parents: []checkKey{http(2)},
+			cycle:   true,
+			parent:  http(2),
+		},
+		{
+			name: "indirect cycle",
+			ds: []dependency{
+				edge(http(2), http(1)),
+				edge(tcp(3), http(2)),
+			},
+			key:     http(1),
+			parents: []checkKey{http(4), tcp(3)},
+			cycle:   true,
+			parent:  tcp(3),
+		},
+		{
+			name:    "same id of another type",
+			ds:      []dependency{edge(tcp(2), tcp(1))},
+			key:     http(1),
+			parents: []checkKey{tcp(2)},
+		},
+		{
+			name: "diamond",
+			ds: []dependency{
+				edge(http(2), http(4)),
+				edge(http(3), http(4)),
+			},
+			key:     http(1),
+			parents: []checkKey{http(2), http(3)},
+		},
+		{
+			name: "existing cycle elsewhere",
+			ds: []dependency{
+				edge(http(2), http(3)),
+				edge(http(3), http(2)),
+			},
+			key:     http(1),
+			parents: []checkKey{http(2)},
+		},
+		{
+			name: "cycle with existing parent",
+			ds: []dependency{
+				edge(http(1), http(2)),
+				edge(http(3), http(1)),
+			},
+			key:     http(2),
+			parents: []checkKey{http(3)},
+			cycle:   true,
+			parent:  http(3),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, cycle := findCycle(tt.ds, tt.key, tt.parents)
+			if cycle != tt.cycle {
+				t.Fatalf("cycle %v, expected %v", cycle, tt.cycle)
+			}
+			if parent != tt.parent {
+				t.Errorf("parent %v, expected %v", parent, tt.parent)
+			}
+		})
+	}
+}
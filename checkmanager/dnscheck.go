@@ -0,0 +1,292 @@
+package checkmanager
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// dnsRecordTypes are the supported record types
+var dnsRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "MX": true, "TXT": true, "NS": true,
+}
+
+// dnsRCodes are the supported response codes
+var dnsRCodes = map[string]bool{
+	"NOERROR": true, "FORMERR": true, "SERVFAIL": true, "NXDOMAIN": true,
+	"NOTIMP": true, "REFUSED": true,
+}
+
+// stringList is stored as json in the database
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return jsonValue([]string(l))
+}
+
+func (l *stringList) Scan(src interface{}) error {
+	*l = nil
+	return jsonScan(src, (*[]string)(l))
+}
+
+type dnsRunnerCheck struct {
+	dnsCheck    dnsCheck
+	db          repository
+	alert       alert.AlertServiceClient
+	workers     *workerPool
+	maintenance *maintenance
+}
+
+func (drc *dnsRunnerCheck) CheckID() int64 {
+	return drc.dnsCheck.ID
+}
+
+func (drc *dnsRunnerCheck) UserID() int64 {
+	return drc.dnsCheck.UserID
+}
+
+func (drc *dnsRunnerCheck) Enabled() bool {
+	return drc.dnsCheck.Enabled
+}
+
+func (*dnsRunnerCheck) CheckType() string {
+	return "dns"
+}
+
+func (drc *dnsRunnerCheck) Config() interface{} {
+	return drc.dnsCheck
+}
+
+func (drc *dnsRunnerCheck) Interval() time.Duration {
+	return drc.dnsCheck.Interval
+}
+
+func (drc *dnsRunnerCheck) DoCheck(ctx context.Context, t time.Time) error {
+	if drc.maintenance.paused(drc, t) {
+		return nil
+	}
+	_, err := drc.Run(ctx, t, true)
+	return err
+}
+
+func (drc *dnsRunnerCheck) Run(ctx context.Context, t time.Time, record bool) (*proto.RunResult, error) {
+	run, err := newRunResult(drc, t)
+	if err != nil {
+		return nil, err
+	}
+	inMaintenance := record && drc.maintenance.active(drc, t)
+	mutex := &sync.Mutex{}
+	success, err := drc.workers.probe(ctx, drc, t, drc.dnsCheck.placement, func(ctx context.Context, client httpcheck.HTTPCheckServiceClient, location string) (bool, error) {
+		r, err := client.DoDNS(ctx, &httpcheck.DNSCheck{
+			Name:       drc.dnsCheck.Name,
+			RecordType: drc.dnsCheck.RecordType,
+			Resolver:   drc.dnsCheck.Resolver,
+			Timeout:    int64(drc.dnsCheck.Timeout),
+			Expected:   drc.dnsCheck.Expected,
+			MinTtl:     drc.dnsCheck.MinTTL,
+			MaxTtl:     drc.dnsCheck.MaxTTL,
+			Rcode:      drc.dnsCheck.RCode,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to do check via httpcheck service, %w", err)
+		}
+
+		result := newDNSResult(drc.dnsCheck.ID, t, location, r)
+		result.Maintenance = inMaintenance
+		if record {
+			result.ID, err = drc.db.CreateDNSResult(ctx, result)
+			if err != nil {
+				return false, fmt.Errorf("unable to store new dns result, %w", err)
+			}
+		}
+		pr, err := unmarshalDNSResult(result)
+		if err != nil {
+			return false, err
+		}
+		mutex.Lock()
+		run.Dns = append(run.Dns, pr)
+		mutex.Unlock()
+		return r.Success, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.Success = success
+	if !record {
+		return run, nil
+	}
+
+	return run, recordState(ctx, drc.db, drc.alert, drc, success,
+		drc.dnsCheck.Threshold, t, inMaintenance)
+}
+
+// newDNSResult returns the result of a run in the location
+func newDNSResult(checkID int64, t time.Time, location string, r *httpcheck.DNSResult) *dnsResult {
+	return &dnsResult{
+		CheckID:   checkID,
+		Duration:  r.Duration,
+		Error:     truncateError(r.Error),
+		Success:   r.Success,
+		Timestamp: t,
+		RCode:     r.Rcode,
+		Answers:   r.Answers,
+		Location:  location,
+	}
+}
+
+type dnsCheck struct {
+	ID         int64      `db:"id"`
+	UserID     int64      `db:"user_id"`
+	Name       string     `db:"name"`
+	RecordType string     `db:"record_type"`
+	Resolver   string     `db:"resolver"`
+	Expected   stringList `db:"expected"`
+	MinTTL     int64      `db:"min_ttl"`
+	MaxTTL     int64      `db:"max_ttl"`
+	RCode      string     `db:"rcode"`
+	// Enabled is false, while the check is paused
+	Enabled bool `db:"enabled"`
+	schedule
+	placement
+}
+
+func marshalDNSCheck(c *proto.DNSCheck) (*dnsCheck, error) {
+	if c.Name == "" {
+		return nil, errors.New("empty name")
+	}
+	recordType := strings.ToUpper(c.RecordType)
+	if !dnsRecordTypes[recordType] {
+		return nil, fmt.Errorf("unsupported record type %v", c.RecordType)
+	}
+	rcode := strings.ToUpper(c.Rcode)
+	if rcode == "" {
+		rcode = "NOERROR"
+	}
+	if !dnsRCodes[rcode] {
+		return nil, fmt.Errorf("unsupported response code %v", c.Rcode)
+	}
+	if c.Resolver != "" {
+		if _, _, err := net.SplitHostPort(c.Resolver); err != nil {
+			return nil, fmt.Errorf("invalid resolver %v, %w", c.Resolver, err)
+		}
+	}
+	if c.MinTtl < 0 || c.MaxTtl < 0 || (c.MaxTtl > 0 && c.MinTtl > c.MaxTtl) {
+		return nil, fmt.Errorf("invalid ttl bounds %v-%v", c.MinTtl, c.MaxTtl)
+	}
+	schedule, err := marshalSchedule(c.Interval, c.Timeout, c.FailureThreshold)
+	if err != nil {
+		return nil, err
+	}
+	placement, err := marshalPlacement(c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsCheck{
+		ID:         c.Id,
+		UserID:     c.UserId,
+		Name:       c.Name,
+		RecordType: recordType,
+		Resolver:   c.Resolver,
+		Expected:   c.Expected,
+		MinTTL:     c.MinTtl,
+		MaxTTL:     c.MaxTtl,
+		RCode:      rcode,
+		schedule:   schedule,
+		placement:  placement,
+	}, nil
+}
+
+func unmarshalDNSCheck(c *dnsCheck) *proto.DNSCheck {
+	return &proto.DNSCheck{
+		Id:                 c.ID,
+		UserId:             c.UserID,
+		Name:               c.Name,
+		RecordType:         c.RecordType,
+		Resolver:           c.Resolver,
+		Timeout:            ptypes.DurationProto(c.Timeout),
+		Expected:           c.Expected,
+		MinTtl:             c.MinTTL,
+		MaxTtl:             c.MaxTTL,
+		Rcode:              c.RCode,
+		Interval:           ptypes.DurationProto(c.Interval),
+		FailureThreshold:   c.Threshold,
+		Locations:          c.Locations,
+		MinFailedLocations: c.MinFailedLocations,
+		Enabled:            c.Enabled,
+	}
+}
+
+// unmarshalDNSCheckCollection returns the checks matching the filter with
+// their labels and groups
+func unmarshalDNSCheckCollection(cs *[]dnsCheck, f *labelFilter) *proto.DNSChecks {
+	checks := []*proto.DNSCheck{}
+	for _, c := range *cs {
+		l, ok := f.match(checkKey{checkID: c.ID, checkType: "dns"})
+		if !ok {
+			continue
+		}
+		pc := unmarshalDNSCheck(&c)
+		pc.Labels, pc.Groups = l.Labels, l.Groups
+		checks = append(checks, pc)
+	}
+	return &proto.DNSChecks{Checks: checks}
+}
+
+type dnsResult struct {
+	ID          int64      `db:"id"`
+	CheckID     int64      `db:"check_id"`
+	Timestamp   time.Time  `db:"timestamp"`
+	Success     bool       `db:"success"`
+	Duration    int64      `db:"duration"`
+	Error       string     `db:"error"`
+	RCode       string     `db:"rcode"`
+	Answers     stringList `db:"answers"`
+	Location    string     `db:"location"`
+	Maintenance bool       `db:"maintenance"`
+}
+
+func unmarshalDNSResult(c *dnsResult) (*proto.DNSResult, error) {
+	t, err := ptypes.TimestampProto(c.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w",
+			*c, err)
+	}
+	return &proto.DNSResult{
+		Id:          c.ID,
+		CheckId:     c.CheckID,
+		Timestamp:   t,
+		Success:     c.Success,
+		Duration:    c.Duration,
+		Error:       c.Error,
+		Rcode:       c.RCode,
+		Answers:     c.Answers,
+		Location:    c.Location,
+		Maintenance: c.Maintenance,
+	}, nil
+}
+
+func unmarshalDNSResultCollection(cs *[]dnsResult) (*proto.DNSResults, error) {
+	results := make([]*proto.DNSResult, len(*cs))
+	for i, c := range *cs {
+		r, err := unmarshalDNSResult(&c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in result collection, %w", c, err)
+		}
+		results[i] = r
+	}
+	return &proto.DNSResults{Results: results}, nil
+}
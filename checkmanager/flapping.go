@@ -0,0 +1,83 @@
+package checkmanager
+
+const (
+	// flapWindow is the number of recent runs considered by the flap
+	// detection
+	flapWindow = 21
+	// flapHighThreshold is the state change percentage, from which on a
+	// check starts flapping
+	flapHighThreshold = 50.0
+	// flapLowThreshold is the state change percentage, below which a
+	// flapping check is stable again
+	flapLowThreshold = 25.0
+)
+
+// Outcomes of runs in the history of a check
+const (
+	historySuccess = '+'
+	historyFailure = '-'
+)
+
+// flapTransition is the result of the flap detection for a run
+type flapTransition int
+
+const (
+	flapNone flapTransition = iota
+	// flapStart means the check started flapping
+	flapStart
+	// flapStop means the check stopped flapping
+	flapStop
+)
+
+// appendHistory appends the outcome of a run to the history and drops the
+// runs outside of the window
+func appendHistory(history string, success bool) string {
+	outcome := historyFailure
+	if success {
+		outcome = historySuccess
+	}
+	history += string(outcome)
+	if len(history) > flapWindow {
+		history = history[len(history)-flapWindow:]
+	}
+	return history
+}
+
+// stateChange returns the weighted percentage of changes between success and
+// failure in the history.
+//
+// Newer changes weigh more than older ones, from 0.8 for the oldest to 1.2
+// for the newest change in a full window, so a check stabilises faster than
+// by a plain count. A history shorter than the window is treated as stable
+// before its first run.
+func stateChange(history string) float64 {
+	changes := flapWindow - 1
+	offset := flapWindow - len(history)
+	total := 0.0
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			position := i - 1 + offset
+			total += 0.8 + 0.4*float64(position)/float64(changes-1)
+		}
+	}
+	return total * 100 / float64(changes)
+}
+
+// flap records the outcome of a run in the history and returns, if the check
+// started or stopped flapping.
+//
+// The detection uses a hysteresis, so a check starts flapping above the high
+// threshold, but stops only below the low threshold.
+func (cs *checkState) flap(success bool) flapTransition {
+	cs.History = appendHistory(cs.History, success)
+	change := stateChange(cs.History)
+	switch {
+	case !cs.Flapping && change >= flapHighThreshold:
+		cs.Flapping = true
+		return flapStart
+	case cs.Flapping && change < flapLowThreshold:
+		cs.Flapping = false
+		return flapStop
+	}
+	return flapNone
+}
@@ -0,0 +1,96 @@
+package checkmanager
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAppendHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		history string
+		success bool
+		want    string
+	}{
+		{name: "empty success", history: "", success: true, want: "+"},
+		{name: "empty failure", history: "", success: false, want: "-"},
+		{name: "short", history: "+-", success: true, want: "+-+"},
+		{
+			name:    "full window drops oldest run",
+			history: "-" + strings.Repeat("+", flapWindow-1),
+			success: false,
+			want:    strings.Repeat("+", flapWindow-1) + "-",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendHistory(tt.history, tt.success); got != tt.want {
+				t.Errorf("history %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		history string
+		want    float64
+	}{
+		{name: "empty", history: "", want: 0},
+		{name: "single run", history: "-", want: 0},
+		{name: "stable", history: strings.Repeat("+", flapWindow), want: 0},
+		{name: "alternating", history: strings.Repeat("+-", flapWindow/2) + "+", want: 100},
+		{name: "newest change", history: strings.Repeat("+", flapWindow-1) + "-", want: 6},
+		{name: "oldest change", history: "-" + strings.Repeat("+", flapWindow-1), want: 4},
+		// A short history counts as stable before its first run, so its
+		// changes are the newest ones
+		{name: "short history", history: "+-", want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stateChange(tt.history); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("state change %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlap(t *testing.T) {
+	// Appending a success results in a state change of about 54%, 34% and
+	// 23%, which is above, between and below the thresholds.
+	high := strings.Repeat("+", 10) + "-+-+-+-+-+"
+	between := strings.Repeat("+", 14) + "-+-+-+"
+	low := strings.Repeat("+", 16) + "-+-+"
+
+	tests := []struct {
+		name         string
+		history      string
+		flapping     bool
+		want         flapTransition
+		wantFlapping bool
+	}{
+		{name: "new check", history: "", want: flapNone},
+		{name: "start above high threshold", history: high, want: flapStart, wantFlapping: true},
+		{name: "keep flapping above high threshold", history: high, flapping: true, want: flapNone, wantFlapping: true},
+		{name: "no start between thresholds", history: between, want: flapNone},
+		{name: "no stop between thresholds", history: between, flapping: true, want: flapNone, wantFlapping: true},
+		{name: "stop below low threshold", history: low, flapping: true, want: flapStop},
+		{name: "stable below low threshold", history: low, want: flapNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &checkState{History: tt.history, Flapping: tt.flapping}
+			if got := cs.flap(true); got != tt.want {
+				t.Errorf("transition %v, expected %v", got, tt.want)
+			}
+			if cs.Flapping != tt.wantFlapping {
+				t.Errorf("flapping %v, expected %v", cs.Flapping, tt.wantFlapping)
+			}
+			if cs.History != appendHistory(tt.history, true) {
+				t.Errorf("history %q not updated", cs.History)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package checkmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+)
+
+const (
+	// minHeartbeatPeriod is the minimal period between two pings
+	minHeartbeatPeriod = proto.MinHeartbeatPeriod
+	// defaultHeartbeatGrace is used, if no grace time is configured
+	defaultHeartbeatGrace = time.Minute
+	// maxHeartbeatMessage is the number of bytes of a ping message stored
+	maxHeartbeatMessage = 255
+	// heartbeatInterval is the time between two verifications of the pings
+	heartbeatInterval = 30 * time.Second
+)
+
+// kinds of heartbeat results
+const (
+	heartbeatSuccess = "success"
+	heartbeatStart   = "start"
+	heartbeatFail    = "fail"
+	heartbeatMissed  = "missed"
+)
+
+// heartbeatRunnerCheck does not poll anything, but verifies that pings
+// arrived in time.
+type heartbeatRunnerCheck struct {
+	heartbeatCheck heartbeatCheck
+	// since is the reference time, if no ping arrived yet
+	since       time.Time
+	db          repository
+	alert       alert.AlertServiceClient
+	maintenance *maintenance
+}
+
+func (hrc *heartbeatRunnerCheck) CheckID() int64 {
+	return hrc.heartbeatCheck.ID
+}
+
+func (hrc *heartbeatRunnerCheck) UserID() int64 {
+	return hrc.heartbeatCheck.UserID
+}
+
+func (hrc *heartbeatRunnerCheck) Enabled() bool {
+	return hrc.heartbeatCheck.Enabled
+}
+
+func (*heartbeatRunnerCheck) CheckType() string {
+	return "heartbeat"
+}
+
+func (hrc *heartbeatRunnerCheck) Config() interface{} {
+	return hrc.heartbeatCheck
+}
+
+// Interval is fixed, since the period of a heartbeat check is the time
+// between pings and not between runs.
+func (*heartbeatRunnerCheck) Interval() time.Duration {
+	return heartbeatInterval
+}
+
+func (hrc *heartbeatRunnerCheck) DoCheck(ctx context.Context, t time.Time) error {
+	if hrc.maintenance.paused(hrc, t) {
+		return nil
+	}
+	inMaintenance := hrc.maintenance.active(hrc, t)
+	success, err := hrc.verify(ctx, t, inMaintenance)
+	if err != nil {
+		return err
+	}
+	// A single failed or missed ping already means the job failed
+	return recordState(ctx, hrc.db, hrc.alert, hrc, success, 1, t, inMaintenance)
+}
+
+// verify that the last ping was successful and arrived in time. A missing
+// ping is stored as missed result, flagged, if the check is in maintenance.
+func (hrc *heartbeatRunnerCheck) verify(ctx context.Context, t time.Time, inMaintenance bool) (bool, error) {
+	last, err := hrc.db.GetLastHeartbeatResult(ctx, hrc.heartbeatCheck.ID)
+	if err != nil {
+		return false, fmt.Errorf("unable to get last heartbeat result, %w", err)
+	}
+
+	reference := hrc.since
+	if last != nil {
+		if last.Kind == heartbeatFail || last.Kind == heartbeatMissed {
+			return false, nil
+		}
+		reference = last.Timestamp
+	}
+
+	deadline := reference.Add(hrc.heartbeatCheck.Period + hrc.heartbeatCheck.Grace)
+	if t.Before(deadline) {
+		return true, nil
+	}
+
+	_, err = hrc.db.CreateHeartbeatResult(ctx, &heartbeatResult{
+		CheckID:     hrc.heartbeatCheck.ID,
+		Timestamp:   t,
+		Kind:        heartbeatMissed,
+		Success:     false,
+		Message:     fmt.Sprintf("no ping since %v", reference.Format(time.RFC3339)),
+		Maintenance: inMaintenance,
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to store new heartbeat result, %w", err)
+	}
+	return false, nil
+}
+
+type heartbeatCheck struct {
+	ID     int64         `db:"id"`
+	UserID int64         `db:"user_id"`
+	Token  string        `db:"token"`
+	Period time.Duration `db:"period"`
+	Grace  time.Duration `db:"grace"`
+	// Enabled is false, while the check is paused
+	Enabled bool `db:"enabled"`
+}
+
+// generateToken generates a url friendly secure token
+func generateToken(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func marshalHeartbeatCheck(c *proto.HeartbeatCheck) (*heartbeatCheck, error) {
+	if c.Period == nil {
+		return nil, fmt.Errorf("missing period")
+	}
+	period, err := ptypes.Duration(c.Period)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal period, %w", err)
+	}
+	if period < minHeartbeatPeriod {
+		return nil, fmt.Errorf("period %v shorter than %v", period, minHeartbeatPeriod)
+	}
+	grace := defaultHeartbeatGrace
+	if c.Grace != nil {
+		grace, err = ptypes.Duration(c.Grace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal grace time, %w", err)
+		}
+		if grace < 0 {
+			return nil, fmt.Errorf("negative grace time %v", grace)
+		}
+	}
+	return &heartbeatCheck{
+		ID:     c.Id,
+		UserID: c.UserId,
+		Token:  c.Token,
+		Period: period,
+		Grace:  grace,
+	}, nil
+}
+
+func unmarshalHeartbeatCheck(c *heartbeatCheck) *proto.HeartbeatCheck {
+	return &proto.HeartbeatCheck{
+		Id:      c.ID,
+		UserId:  c.UserID,
+		Token:   c.Token,
+		Period:  ptypes.DurationProto(c.Period),
+		Grace:   ptypes.DurationProto(c.Grace),
+		Enabled: c.Enabled,
+	}
+}
+
+// unmarshalHeartbeatCheckCollection returns the checks matching the filter with
+// their labels and groups
+func unmarshalHeartbeatCheckCollection(cs *[]heartbeatCheck, f *labelFilter) *proto.HeartbeatChecks {
+	checks := []*proto.HeartbeatCheck{}
+	for _, c := range *cs {
+		l, ok := f.match(checkKey{checkID: c.ID, checkType: "heartbeat"})
+		if !ok {
+			continue
+		}
+		pc := unmarshalHeartbeatCheck(&c)
+		pc.Labels, pc.Groups = l.Labels, l.Groups
+		checks = append(checks, pc)
+	}
+	return &proto.HeartbeatChecks{Checks: checks}
+}
+
+type heartbeatResult struct {
+	ID          int64     `db:"id"`
+	CheckID     int64     `db:"check_id"`
+	Timestamp   time.Time `db:"timestamp"`
+	Kind        string    `db:"kind"`
+	Success     bool      `db:"success"`
+	Duration    int64     `db:"duration"`
+	Message     string    `db:"message"`
+	Maintenance bool      `db:"maintenance"`
+}
+
+func unmarshalHeartbeatResult(c *heartbeatResult) (*proto.HeartbeatResult, error) {
+	t, err := ptypes.TimestampProto(c.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w",
+			*c, err)
+	}
+	return &proto.HeartbeatResult{
+		Id:          c.ID,
+		CheckId:     c.CheckID,
+		Timestamp:   t,
+		Kind:        c.Kind,
+		Success:     c.Success,
+		Duration:    c.Duration,
+		Message:     c.Message,
+		Maintenance: c.Maintenance,
+	}, nil
+}
+
+func unmarshalHeartbeatResultCollection(cs *[]heartbeatResult) (*proto.HeartbeatResults, error) {
+	results := make([]*proto.HeartbeatResult, len(*cs))
+	for i, c := range *cs {
+		r, err := unmarshalHeartbeatResult(&c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in result collection, %w", c, err)
+		}
+		results[i] = r
+	}
+	return &proto.HeartbeatResults{Results: results}, nil
+}
@@ -2,7 +2,14 @@ package checkmanager
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
@@ -13,95 +20,463 @@ import (
 )
 
 type httpRunnerCheck struct {
-	faiures   int
-	httpCheck httpCheck
-	db        repository
-	alert     alert.AlertServiceClient
-	httpcheck httpcheck.HTTPCheckServiceClient
+	httpCheck   httpCheck
+	db          repository
+	alert       alert.AlertServiceClient
+	workers     *workerPool
+	maintenance *maintenance
 }
 
 func (hrc *httpRunnerCheck) CheckID() int64 {
 	return hrc.httpCheck.ID
 }
 
+func (hrc *httpRunnerCheck) UserID() int64 {
+	return hrc.httpCheck.UserID
+}
+
+func (hrc *httpRunnerCheck) Enabled() bool {
+	return hrc.httpCheck.Enabled
+}
+
 func (*httpRunnerCheck) CheckType() string {
 	return "http"
 }
 
+func (hrc *httpRunnerCheck) Config() interface{} {
+	return hrc.httpCheck
+}
+
+func (hrc *httpRunnerCheck) Interval() time.Duration {
+	return hrc.httpCheck.Interval
+}
+
 func (hrc *httpRunnerCheck) DoCheck(ctx context.Context, t time.Time) error {
-	r, err := hrc.httpcheck.Do(ctx, &httpcheck.Check{Url: hrc.httpCheck.URL})
+	if hrc.maintenance.paused(hrc, t) {
+		return nil
+	}
+	_, err := hrc.Run(ctx, t, true)
+	return err
+}
+
+func (hrc *httpRunnerCheck) Run(ctx context.Context, t time.Time, record bool) (*proto.RunResult, error) {
+	run, err := newRunResult(hrc, t)
 	if err != nil {
-		return fmt.Errorf("unable to do check via httpcheck service, %w", err)
+		return nil, err
 	}
-	result := &httpResult{
-		CheckID:    hrc.httpCheck.ID,
+	inMaintenance := record && hrc.maintenance.active(hrc, t)
+	mutex := &sync.Mutex{}
+	success, err := hrc.workers.probe(ctx, hrc, t, hrc.httpCheck.placement, func(ctx context.Context, client httpcheck.HTTPCheckServiceClient, location string) (bool, error) {
+		r, err := client.Do(ctx, &httpcheck.Check{
+			Url:         hrc.httpCheck.URL,
+			Method:      hrc.httpCheck.Method,
+			Headers:     hrc.httpCheck.Headers,
+			Body:        hrc.httpCheck.Body,
+			Username:    hrc.httpCheck.Username,
+			Password:    hrc.httpCheck.Password,
+			BearerToken: hrc.httpCheck.BearerToken,
+			Assertions:  httpcheckAssertions(&hrc.httpCheck.Assertions),
+			Timeout:     int64(hrc.httpCheck.Timeout),
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to do check via httpcheck service, %w", err)
+		}
+		result := newHTTPResult(hrc.httpCheck.ID, t, location, r)
+		result.Maintenance = inMaintenance
+		if record {
+			result.ID, err = hrc.db.CreateHTTPResult(ctx, result)
+			if err != nil {
+				return false, fmt.Errorf("unable to store new http check, %w", err)
+			}
+		}
+		pr, err := unmarshalHTTPResult(result)
+		if err != nil {
+			return false, err
+		}
+		mutex.Lock()
+		run.Http = append(run.Http, pr)
+		mutex.Unlock()
+		return r.Success, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.Success = success
+	if !record {
+		return run, nil
+	}
+
+	return run, recordState(ctx, hrc.db, hrc.alert, hrc, success,
+		hrc.httpCheck.Threshold, t, inMaintenance)
+}
+
+// newHTTPResult returns the result of a run in the location
+func newHTTPResult(checkID int64, t time.Time, location string, r *httpcheck.Result) *httpResult {
+	return &httpResult{
+		CheckID:    checkID,
 		Duration:   r.Duration,
-		Error:      r.Error,
+		Error:      truncateError(r.Error),
 		StatusCode: r.StatusCode,
 		Success:    r.Success,
 		Timestamp:  t,
+		Location:   location,
+		httpTimings: httpTimings{
+			DNSLookup:       r.DnsLookup,
+			TCPConnect:      r.TcpConnect,
+			TLSHandshake:    r.TlsHandshake,
+			TimeToFirstByte: r.TimeToFirstByte,
+			ContentTransfer: r.ContentTransfer,
+			RemoteIP:        r.RemoteIp,
+			Protocol:        r.Protocol,
+			TLSVersion:      r.TlsVersion,
+		},
 	}
-	_, err = hrc.db.CreateHTTPResult(ctx, result)
+}
+
+// jsonValue encodes v as json for storing it in the database
+func jsonValue(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		return fmt.Errorf("unable to store new http check, %w", err)
+		return nil, fmt.Errorf("unable to marshal %T to json, %w", v, err)
 	}
+	return string(b), nil
+}
 
-	if !r.Success {
-		hrc.faiures++
+// jsonScan decodes json from the database into v
+func jsonScan(src interface{}, v interface{}) error {
+	var b []byte
+	switch s := src.(type) {
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unable to scan %T from %T", v, src)
+	}
+	if len(b) == 0 {
+		return nil
 	}
+	return json.Unmarshal(b, v)
+}
 
-	if hrc.faiures > 3 {
-		_, err = hrc.alert.Firing(ctx, &alert.Check{
-			Id:   hrc.CheckID(),
-			Type: hrc.CheckType(),
-		})
+// httpHeaders are stored as json in the database
+type httpHeaders map[string]string
+
+func (h httpHeaders) Value() (driver.Value, error) {
+	if h == nil {
+		return "{}", nil
+	}
+	return jsonValue(map[string]string(h))
+}
+
+func (h *httpHeaders) Scan(src interface{}) error {
+	*h = nil
+	return jsonScan(src, (*map[string]string)(h))
+}
+
+type statusCodeRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type jsonPathAssertion struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+type headerAssertion struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// maxAssertionLength is the maximal length of the values of assertions,
+// which are part of the errors of failed runs
+const maxAssertionLength = 200
+
+// httpAssertions are stored as json in the database
+type httpAssertions struct {
+	StatusCodes     []statusCodeRange   `json:"status_codes,omitempty"`
+	BodyContains    []string            `json:"body_contains,omitempty"`
+	BodyNotContains []string            `json:"body_not_contains,omitempty"`
+	BodyMatches     []string            `json:"body_matches,omitempty"`
+	BodyNotMatches  []string            `json:"body_not_matches,omitempty"`
+	JSONPaths       []jsonPathAssertion `json:"json_paths,omitempty"`
+	Headers         []headerAssertion   `json:"headers,omitempty"`
+	MaxResponseTime time.Duration       `json:"max_response_time,omitempty"`
+}
+
+func (a httpAssertions) Value() (driver.Value, error) {
+	return jsonValue(a)
+}
+
+func (a *httpAssertions) Scan(src interface{}) error {
+	*a = httpAssertions{}
+	return jsonScan(src, a)
+}
+
+// validate the assertions, so broken checks are rejected on creation
+func (a *httpAssertions) validate() error {
+	for _, values := range [][]string{a.BodyContains, a.BodyNotContains, a.BodyMatches, a.BodyNotMatches} {
+		for _, v := range values {
+			if len(v) > maxAssertionLength {
+				return fmt.Errorf("body assertion longer than %v bytes", maxAssertionLength)
+			}
+		}
+	}
+	for _, h := range a.Headers {
+		if len(h.Name) > maxAssertionLength || len(h.Value) > maxAssertionLength {
+			return fmt.Errorf("header assertion longer than %v bytes", maxAssertionLength)
+		}
+	}
+	for _, jp := range a.JSONPaths {
+		if len(jp.Path) > maxAssertionLength || len(jp.Value) > maxAssertionLength {
+			return fmt.Errorf("json path assertion longer than %v bytes", maxAssertionLength)
+		}
+	}
+	for _, r := range a.StatusCodes {
+		if r.From < 100 || r.From > 599 || (r.To != 0 && (r.To < r.From || r.To > 599)) {
+			return fmt.Errorf("invalid status code range %v-%v", r.From, r.To)
+		}
+	}
+	for _, exprs := range [][]string{a.BodyMatches, a.BodyNotMatches} {
+		for _, e := range exprs {
+			if _, err := regexp.Compile(e); err != nil {
+				return fmt.Errorf("invalid regular expression %q, %w", e, err)
+			}
+		}
+	}
+	for _, h := range a.Headers {
+		if h.Name == "" {
+			return errors.New("header assertion without name")
+		}
+		if _, err := regexp.Compile(h.Value); err != nil {
+			return fmt.Errorf("invalid regular expression %q for header %v, %w",
+				h.Value, h.Name, err)
+		}
+	}
+	for _, jp := range a.JSONPaths {
+		if !strings.HasPrefix(jp.Path, "$") {
+			return fmt.Errorf("json path %v does not start with $", jp.Path)
+		}
+	}
+	if a.MaxResponseTime < 0 {
+		return fmt.Errorf("negative maximum response time %v", a.MaxResponseTime)
+	}
+	return nil
+}
+
+func marshalHTTPAssertions(a *proto.HTTPAssertions) (httpAssertions, error) {
+	if a == nil {
+		return httpAssertions{}, nil
+	}
+	r := httpAssertions{
+		BodyContains:    a.BodyContains,
+		BodyNotContains: a.BodyNotContains,
+		BodyMatches:     a.BodyMatches,
+		BodyNotMatches:  a.BodyNotMatches,
+	}
+	for _, sc := range a.StatusCodes {
+		r.StatusCodes = append(r.StatusCodes, statusCodeRange{From: sc.From, To: sc.To})
+	}
+	for _, jp := range a.JsonPaths {
+		r.JSONPaths = append(r.JSONPaths, jsonPathAssertion{Path: jp.Path, Value: jp.Value})
+	}
+	for _, h := range a.Headers {
+		r.Headers = append(r.Headers, headerAssertion{Name: h.Name, Value: h.Value})
+	}
+	if a.MaxResponseTime != nil {
+		d, err := ptypes.Duration(a.MaxResponseTime)
 		if err != nil {
-			return fmt.Errorf("unable to fire alert %w", err)
+			return r, fmt.Errorf("unable to marshal maximum response time, %w", err)
 		}
-		hrc.faiures = 0
+		r.MaxResponseTime = d
 	}
+	return r, r.validate()
+}
 
-	return nil
+func unmarshalHTTPAssertions(a *httpAssertions) *proto.HTTPAssertions {
+	r := &proto.HTTPAssertions{
+		BodyContains:    a.BodyContains,
+		BodyNotContains: a.BodyNotContains,
+		BodyMatches:     a.BodyMatches,
+		BodyNotMatches:  a.BodyNotMatches,
+	}
+	for _, sc := range a.StatusCodes {
+		r.StatusCodes = append(r.StatusCodes, &proto.StatusCodeRange{From: sc.From, To: sc.To})
+	}
+	for _, jp := range a.JSONPaths {
+		r.JsonPaths = append(r.JsonPaths, &proto.JSONPathAssertion{Path: jp.Path, Value: jp.Value})
+	}
+	for _, h := range a.Headers {
+		r.Headers = append(r.Headers, &proto.HeaderAssertion{Name: h.Name, Value: h.Value})
+	}
+	if a.MaxResponseTime != 0 {
+		r.MaxResponseTime = ptypes.DurationProto(a.MaxResponseTime)
+	}
+	return r
+}
+
+// httpcheckAssertions converts the assertions for the httpcheck service
+func httpcheckAssertions(a *httpAssertions) *httpcheck.Assertions {
+	r := &httpcheck.Assertions{
+		BodyContains:    a.BodyContains,
+		BodyNotContains: a.BodyNotContains,
+		BodyMatches:     a.BodyMatches,
+		BodyNotMatches:  a.BodyNotMatches,
+		MaxResponseTime: int64(a.MaxResponseTime),
+	}
+	for _, sc := range a.StatusCodes {
+		r.StatusCodes = append(r.StatusCodes, &httpcheck.StatusCodeRange{From: sc.From, To: sc.To})
+	}
+	for _, jp := range a.JSONPaths {
+		r.JsonPaths = append(r.JsonPaths, &httpcheck.JSONPathAssertion{Path: jp.Path, Value: jp.Value})
+	}
+	for _, h := range a.Headers {
+		r.Headers = append(r.Headers, &httpcheck.HeaderAssertion{Name: h.Name, Value: h.Value})
+	}
+	return r
 }
 
+// secretSet replaces the password and bearer token of a check in read
+// responses. Updates with it keep the stored secret, while an empty value
+// removes it.
+const secretSet = "(set)"
+
 type httpCheck struct {
-	ID     int64  `db:"id"`
-	UserID int64  `db:"user_id"`
-	URL    string `db:"url"`
+	ID          int64          `db:"id"`
+	UserID      int64          `db:"user_id"`
+	URL         string         `db:"url"`
+	Method      string         `db:"method"`
+	Headers     httpHeaders    `db:"headers"`
+	Body        string         `db:"body"`
+	Username    string         `db:"username"`
+	Password    string         `db:"password"`
+	BearerToken string         `db:"bearer_token"`
+	Assertions  httpAssertions `db:"assertions"`
+	// Enabled is false, while the check is paused
+	Enabled bool `db:"enabled"`
+	schedule
+	placement
 }
 
-func marshalHTTPCheck(c *proto.HTTPCheck) *httpCheck {
-	return &httpCheck{
-		ID:     c.Id,
-		UserID: c.UserId,
-		URL:    c.Url,
+func marshalHTTPCheck(c *proto.HTTPCheck) (*httpCheck, error) {
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	assertions, err := marshalHTTPAssertions(c.Assertions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertions, %w", err)
+	}
+	schedule, err := marshalSchedule(c.Interval, c.Timeout, c.FailureThreshold)
+	if err != nil {
+		return nil, err
 	}
+	placement, err := marshalPlacement(c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return nil, err
+	}
+	return &httpCheck{
+		ID:          c.Id,
+		UserID:      c.UserId,
+		URL:         c.Url,
+		Method:      method,
+		Headers:     c.Headers,
+		Body:        c.Body,
+		Username:    c.Username,
+		Password:    c.Password,
+		BearerToken: c.BearerToken,
+		Assertions:  assertions,
+		schedule:    schedule,
+		placement:   placement,
+	}, nil
 }
 
 func unmarshalHTTPCheck(c *httpCheck) *proto.HTTPCheck {
 	return &proto.HTTPCheck{
-		Id:     c.ID,
-		UserId: c.UserID,
-		Url:    c.URL,
+		Id:                 c.ID,
+		UserId:             c.UserID,
+		Url:                c.URL,
+		Method:             c.Method,
+		Headers:            c.Headers,
+		Body:               c.Body,
+		Username:           c.Username,
+		Password:           c.Password,
+		BearerToken:        c.BearerToken,
+		Assertions:         unmarshalHTTPAssertions(&c.Assertions),
+		Interval:           ptypes.DurationProto(c.Interval),
+		Timeout:            ptypes.DurationProto(c.Timeout),
+		FailureThreshold:   c.Threshold,
+		Locations:          c.Locations,
+		MinFailedLocations: c.MinFailedLocations,
+		Enabled:            c.Enabled,
 	}
 }
 
-func unmarshalCheckCollection(cs *[]httpCheck) *proto.HTTPChecks {
-	checks := make([]*proto.HTTPCheck, len(*cs))
-	for i, c := range *cs {
-		checks[i] = unmarshalHTTPCheck(&c)
+// redactHTTPCheck replaces the secrets of the check by secretSet
+func redactHTTPCheck(c *proto.HTTPCheck) {
+	if c.Password != "" {
+		c.Password = secretSet
+	}
+	if c.BearerToken != "" {
+		c.BearerToken = secretSet
+	}
+}
+
+// keepSecrets takes the secrets of the old check, which are marked as set.
+// With an empty old check, it only drops the markers of redacted secrets.
+func (c *httpCheck) keepSecrets(old *httpCheck) {
+	if c.Password == secretSet {
+		c.Password = old.Password
+	}
+	if c.BearerToken == secretSet {
+		c.BearerToken = old.BearerToken
+	}
+}
+
+// unmarshalCheckCollection returns the checks matching the filter with
+// their labels and groups
+func unmarshalCheckCollection(cs *[]httpCheck, f *labelFilter) *proto.HTTPChecks {
+	checks := []*proto.HTTPCheck{}
+	for _, c := range *cs {
+		l, ok := f.match(checkKey{checkID: c.ID, checkType: "http"})
+		if !ok {
+			continue
+		}
+		pc := unmarshalHTTPCheck(&c)
+		redactHTTPCheck(pc)
+		pc.Labels, pc.Groups = l.Labels, l.Groups
+		checks = append(checks, pc)
 	}
 	return &proto.HTTPChecks{Checks: checks}
 }
 
+// httpTimings are the phases of an http request in nanoseconds and details
+// of the connection
+type httpTimings struct {
+	DNSLookup       int64  `db:"dns_lookup"`
+	TCPConnect      int64  `db:"tcp_connect"`
+	TLSHandshake    int64  `db:"tls_handshake"`
+	TimeToFirstByte int64  `db:"time_to_first_byte"`
+	ContentTransfer int64  `db:"content_transfer"`
+	RemoteIP        string `db:"remote_ip"`
+	Protocol        string `db:"protocol"`
+	TLSVersion      string `db:"tls_version"`
+}
+
 type httpResult struct {
-	ID         int64     `db:"id"`
-	CheckID    int64     `db:"check_id"`
-	Timestamp  time.Time `db:"timestamp"`
-	Success    bool      `db:"success"`
-	StatusCode int64     `db:"status_code"`
-	Duration   int64     `db:"duration"`
-	Error      string    `db:"error"`
+	ID          int64     `db:"id"`
+	CheckID     int64     `db:"check_id"`
+	Timestamp   time.Time `db:"timestamp"`
+	Success     bool      `db:"success"`
+	StatusCode  int64     `db:"status_code"`
+	Duration    int64     `db:"duration"`
+	Error       string    `db:"error"`
+	Location    string    `db:"location"`
+	Maintenance bool      `db:"maintenance"`
+	httpTimings
 }
 
 func marshalHTTPResult(c *proto.HTTPResult) (*httpResult, error) {
@@ -118,6 +493,18 @@ func marshalHTTPResult(c *proto.HTTPResult) (*httpResult, error) {
 		StatusCode: c.StatusCode,
 		Duration:   c.Duration,
 		Error:      c.Error,
+		Location:   c.Location,
+		httpTimings: httpTimings{
+			DNSLookup:       c.DnsLookup,
+			TCPConnect:      c.TcpConnect,
+			TLSHandshake:    c.TlsHandshake,
+			TimeToFirstByte: c.TimeToFirstByte,
+			ContentTransfer: c.ContentTransfer,
+			RemoteIP:        c.RemoteIp,
+			Protocol:        c.Protocol,
+			TLSVersion:      c.TlsVersion,
+		},
+		Maintenance: c.Maintenance,
 	}, nil
 }
 
@@ -128,13 +515,23 @@ func unmarshalHTTPResult(c *httpResult) (*proto.HTTPResult, error) {
 			*c, err)
 	}
 	return &proto.HTTPResult{
-		Id:         c.ID,
-		CheckId:    c.CheckID,
-		Timestamp:  t,
-		Success:    c.Success,
-		StatusCode: c.StatusCode,
-		Duration:   c.Duration,
-		Error:      c.Error,
+		Id:              c.ID,
+		CheckId:         c.CheckID,
+		Timestamp:       t,
+		Success:         c.Success,
+		StatusCode:      c.StatusCode,
+		Duration:        c.Duration,
+		Error:           c.Error,
+		Location:        c.Location,
+		DnsLookup:       c.DNSLookup,
+		TcpConnect:      c.TCPConnect,
+		TlsHandshake:    c.TLSHandshake,
+		TimeToFirstByte: c.TimeToFirstByte,
+		ContentTransfer: c.ContentTransfer,
+		RemoteIp:        c.RemoteIP,
+		Protocol:        c.Protocol,
+		TlsVersion:      c.TLSVersion,
+		Maintenance:     c.Maintenance,
 	}, nil
 }
 
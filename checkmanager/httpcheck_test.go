@@ -0,0 +1,58 @@
+package checkmanager
+
+import "testing"
+
+func TestKeepSecrets(t *testing.T) {
+	stored := &httpCheck{Password: "password", BearerToken: "token"}
+	tests := []struct {
+		name        string
+		check       httpCheck
+		old         *httpCheck
+		password    string
+		bearerToken string
+	}{
+		{
+			name:        "marked as set",
+			check:       httpCheck{Password: secretSet, BearerToken: secretSet},
+			old:         stored,
+			password:    "password",
+			bearerToken: "token",
+		},
+		{
+			name:        "changed",
+			check:       httpCheck{Password: "new", BearerToken: "new"},
+			old:         stored,
+			password:    "new",
+			bearerToken: "new",
+		},
+		{
+			name:  "removed",
+			check: httpCheck{},
+			old:   stored,
+		},
+		{
+			name:        "only token removed",
+			check:       httpCheck{Password: secretSet},
+			old:         stored,
+			password:    "password",
+			bearerToken: "",
+		},
+		{
+			name:  "marker without stored secret",
+			check: httpCheck{Password: secretSet, BearerToken: secretSet},
+			old:   &httpCheck{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.check
+			c.keepSecrets(tt.old)
+			if c.Password != tt.password {
+				t.Errorf("password %q, expected %q", c.Password, tt.password)
+			}
+			if c.BearerToken != tt.bearerToken {
+				t.Errorf("bearer token %q, expected %q", c.BearerToken, tt.bearerToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package importer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"gopkg.in/yaml.v2"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// blackboxDefaultModule is used by the blackbox_exporter, if a target has
+// no module
+const blackboxDefaultModule = "http_2xx"
+
+// prometheusDefaultInterval is used by Prometheus, if no scrape interval is
+// configured
+const prometheusDefaultInterval = time.Minute
+
+// dnsRecordTypes are the record types supported by the checkmanager
+var dnsRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "MX": true, "TXT": true, "NS": true,
+}
+
+// blackboxConfig is the module configuration of the blackbox_exporter
+type blackboxConfig struct {
+	Modules map[string]blackboxModule `yaml:"modules"`
+}
+
+type blackboxModule struct {
+	Prober  string        `yaml:"prober"`
+	Timeout time.Duration `yaml:"timeout"`
+	HTTP    blackboxHTTP  `yaml:"http"`
+	TCP     blackboxTCP   `yaml:"tcp"`
+	DNS     blackboxDNS   `yaml:"dns"`
+}
+
+type blackboxHTTP struct {
+	Method                     string            `yaml:"method"`
+	Headers                    map[string]string `yaml:"headers"`
+	Body                       string            `yaml:"body"`
+	ValidStatusCodes           []int64           `yaml:"valid_status_codes"`
+	FailIfBodyMatchesRegexp    []string          `yaml:"fail_if_body_matches_regexp"`
+	FailIfBodyNotMatchesRegexp []string          `yaml:"fail_if_body_not_matches_regexp"`
+	FailIfSSL                  bool              `yaml:"fail_if_ssl"`
+	FailIfNotSSL               bool              `yaml:"fail_if_not_ssl"`
+	BasicAuth                  struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"basic_auth"`
+	BearerToken string `yaml:"bearer_token"`
+}
+
+type blackboxTCP struct {
+	QueryResponse []struct {
+		Expect string `yaml:"expect"`
+		Send   string `yaml:"send"`
+	} `yaml:"query_response"`
+	TLS bool `yaml:"tls"`
+}
+
+type blackboxDNS struct {
+	QueryName         string   `yaml:"query_name"`
+	QueryType         string   `yaml:"query_type"`
+	ValidRcodes       []string `yaml:"valid_rcodes"`
+	ValidateAnswerRRs struct {
+		FailIfMatchesRegexp    []string `yaml:"fail_if_matches_regexp"`
+		FailIfNotMatchesRegexp []string `yaml:"fail_if_not_matches_regexp"`
+	} `yaml:"validate_answer_rrs"`
+}
+
+// prometheusConfig is the Prometheus configuration with the targets of the
+// blackbox_exporter
+type prometheusConfig struct {
+	Global struct {
+		ScrapeInterval time.Duration `yaml:"scrape_interval"`
+	} `yaml:"global"`
+	ScrapeConfigs []scrapeConfig `yaml:"scrape_configs"`
+}
+
+type scrapeConfig struct {
+	JobName        string              `yaml:"job_name"`
+	ScrapeInterval time.Duration       `yaml:"scrape_interval"`
+	MetricsPath    string              `yaml:"metrics_path"`
+	Params         map[string][]string `yaml:"params"`
+	StaticConfigs  []struct {
+		Targets []string          `yaml:"targets"`
+		Labels  map[string]string `yaml:"labels"`
+	} `yaml:"static_configs"`
+	FileSDConfigs []interface{} `yaml:"file_sd_configs"`
+}
+
+// Blackbox imports the targets of a Prometheus configuration, which are
+// probed by the blackbox_exporter with the modules of its configuration.
+// Only jobs with the metrics path /probe and static targets are imported.
+func Blackbox(modules []byte, targets []byte) (*Result, error) {
+	bc := blackboxConfig{}
+	if err := yaml.Unmarshal(modules, &bc); err != nil {
+		return nil, fmt.Errorf("invalid blackbox_exporter configuration, %w", err)
+	}
+	pc := prometheusConfig{}
+	if err := yaml.Unmarshal(targets, &pc); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus configuration, %w", err)
+	}
+	globalInterval := pc.Global.ScrapeInterval
+	if globalInterval == 0 {
+		globalInterval = prometheusDefaultInterval
+	}
+
+	i := newImporter()
+	for _, sc := range pc.ScrapeConfigs {
+		if sc.MetricsPath != "/probe" {
+			i.skip(sc.JobName, "not a blackbox_exporter job")
+			continue
+		}
+		if len(sc.FileSDConfigs) > 0 {
+			i.unmapped(sc.JobName, "file_sd_configs, only the targets of static_configs are imported")
+		}
+		module := blackboxDefaultModule
+		if ms := sc.Params["module"]; len(ms) > 0 {
+			module = ms[0]
+		}
+		m, ok := bc.Modules[module]
+		if !ok {
+			i.skip(sc.JobName, "unknown module %v", module)
+			continue
+		}
+		interval := sc.ScrapeInterval
+		if interval == 0 {
+			interval = globalInterval
+		}
+		for _, static := range sc.StaticConfigs {
+			for _, target := range static.Targets {
+				source := fmt.Sprintf("%v/%v", sc.JobName, target)
+				c := i.blackboxCheck(source, target, m, interval)
+				if c == nil {
+					continue
+				}
+				c.Name = fmt.Sprintf("%v-%v", sc.JobName, target)
+				i.label(source, c, "source", "blackbox")
+				i.label(source, c, "job", sc.JobName)
+				i.label(source, c, "module", module)
+				for name, value := range static.Labels {
+					// Skip the internal labels of Prometheus
+					if strings.HasPrefix(name, "__") {
+						continue
+					}
+					i.label(source, c, name, value)
+				}
+				i.add(c)
+			}
+		}
+	}
+	return i.result, nil
+}
+
+// blackboxCheck returns the check for the target probed by the module or nil,
+// if the module can not be mapped
+func (i *importer) blackboxCheck(source string, target string, m blackboxModule, interval time.Duration) *proto.DocumentCheck {
+	pi, pt := i.schedule(source, interval, m.Timeout)
+	switch m.Prober {
+	case "http":
+		return &proto.DocumentCheck{Http: i.blackboxHTTPCheck(source, target, m.HTTP, pi, pt)}
+	case "tcp":
+		if m.TCP.TLS {
+			if len(m.TCP.QueryResponse) > 0 {
+				i.unmapped(source, "query_response of tls connections")
+			}
+			return &proto.DocumentCheck{Tls: &proto.TLSCheck{
+				Address:  target,
+				Interval: pi,
+				Timeout:  pt,
+			}}
+		}
+		c := &proto.TCPCheck{
+			Address:  target,
+			Interval: pi,
+			Timeout:  pt,
+		}
+		sends, expects := 0, 0
+		for _, qr := range m.TCP.QueryResponse {
+			if qr.Send != "" {
+				if sends == 0 && expects == 0 {
+					c.Payload = qr.Send
+				}
+				sends++
+			}
+			if qr.Expect != "" {
+				if expects == 0 {
+					c.Expect = qr.Expect
+				}
+				expects++
+			}
+		}
+		if sends > 1 || expects > 1 || (c.Payload == "" && sends > 0) {
+			i.unmapped(source, "query_response with multiple steps, only a single send followed by an expect is used")
+		}
+		return &proto.DocumentCheck{Tcp: c}
+	case "dns":
+		return i.blackboxDNSCheck(source, target, m.DNS, pi, pt)
+	}
+	i.skip(source, "prober %v is not supported", m.Prober)
+	return nil
+}
+
+func (i *importer) blackboxHTTPCheck(source string, target string, h blackboxHTTP, pi, pt *duration.Duration) *proto.HTTPCheck {
+	// The blackbox_exporter defaults to http
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	c := &proto.HTTPCheck{
+		Url:         target,
+		Method:      h.Method,
+		Headers:     h.Headers,
+		Body:        h.Body,
+		Username:    h.BasicAuth.Username,
+		Password:    h.BasicAuth.Password,
+		BearerToken: h.BearerToken,
+		Interval:    pi,
+		Timeout:     pt,
+		Assertions: &proto.HTTPAssertions{
+			BodyMatches:    h.FailIfBodyNotMatchesRegexp,
+			BodyNotMatches: h.FailIfBodyMatchesRegexp,
+		},
+	}
+	for _, code := range h.ValidStatusCodes {
+		c.Assertions.StatusCodes = append(c.Assertions.StatusCodes,
+			&proto.StatusCodeRange{From: code, To: code})
+	}
+	if h.FailIfSSL || h.FailIfNotSSL {
+		i.unmapped(source, "fail_if_ssl and fail_if_not_ssl")
+	}
+	return c
+}
+
+func (i *importer) blackboxDNSCheck(source string, target string, d blackboxDNS, pi, pt *duration.Duration) *proto.DocumentCheck {
+	if d.QueryName == "" {
+		i.skip(source, "dns module without query_name")
+		return nil
+	}
+	recordType := strings.ToUpper(d.QueryType)
+	if recordType == "" {
+		recordType = "ANY"
+	}
+	if !dnsRecordTypes[recordType] {
+		i.skip(source, "record type %v is not supported", recordType)
+		return nil
+	}
+	// The target is the resolver
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "53")
+	}
+	c := &proto.DNSCheck{
+		Name:       d.QueryName,
+		RecordType: recordType,
+		Resolver:   target,
+		Interval:   pi,
+		Timeout:    pt,
+	}
+	switch len(d.ValidRcodes) {
+	case 0:
+	case 1:
+		c.Rcode = strings.ToUpper(d.ValidRcodes[0])
+	default:
+		c.Rcode = strings.ToUpper(d.ValidRcodes[0])
+		i.unmapped(source, "multiple valid_rcodes, only %v is used", c.Rcode)
+	}
+	if len(d.ValidateAnswerRRs.FailIfMatchesRegexp) > 0 || len(d.ValidateAnswerRRs.FailIfNotMatchesRegexp) > 0 {
+		i.unmapped(source, "validate_answer_rrs")
+	}
+	return &proto.DocumentCheck{Dns: c}
+}
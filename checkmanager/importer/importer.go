@@ -0,0 +1,187 @@
+// Package importer converts the configurations of other monitoring tools to
+// documents, which are applied by the Apply RPC of the checkmanager.
+//
+// The imported checks are named after their source, so importing the same
+// configuration again updates the checks instead of duplicating them.
+// Everything without an equivalent in Mondane is reported.
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+	"github.com/shaardie/mondane/selector"
+)
+
+// maxNameLength is the maximal length of the name of a check
+const maxNameLength = selector.MaxValueLength
+
+// Unmapped is a part of the source, which has no equivalent in Mondane
+type Unmapped struct {
+	// Source is the monitor or target in the source
+	Source string
+	// Reason describes what was not mapped
+	Reason string
+	// Skipped is set, if no check was created for the source at all
+	Skipped bool
+}
+
+// Result of an import
+type Result struct {
+	Document *proto.Document
+	Unmapped []Unmapped
+}
+
+// AddGroup puts all imported checks into the group
+func (r *Result) AddGroup(group string) error {
+	if err := selector.ValidateGroup(group); err != nil {
+		return err
+	}
+	for _, c := range r.Document.Checks {
+		c.Groups = append(c.Groups, group)
+	}
+	return nil
+}
+
+// importer collects the checks of a single import
+type importer struct {
+	result *Result
+	names  map[string]bool
+}
+
+func newImporter() *importer {
+	return &importer{
+		result: &Result{
+			Document: &proto.Document{
+				Checks: []*proto.DocumentCheck{},
+				Alerts: []*proto.DocumentAlert{},
+			},
+			Unmapped: []Unmapped{},
+		},
+		names: map[string]bool{},
+	}
+}
+
+// add the check with a unique name derived from its name and returns the
+// name
+func (i *importer) add(c *proto.DocumentCheck) string {
+	c.Name = i.uniqueName(c.Name)
+	i.result.Document.Checks = append(i.result.Document.Checks, c)
+	return c.Name
+}
+
+// alert adds a mail alert for the check
+func (i *importer) alert(name string) {
+	i.result.Document.Alerts = append(i.result.Document.Alerts, &proto.DocumentAlert{
+		Check:    name,
+		SendMail: true,
+	})
+}
+
+// label sets the label of the check, if it is valid
+func (i *importer) label(source string, c *proto.DocumentCheck, name string, value string) {
+	if err := selector.ValidateLabel(name, value); err != nil {
+		i.unmapped(source, "label %v, %v", name, err)
+		return
+	}
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	c.Labels[name] = value
+}
+
+func (i *importer) unmapped(source string, format string, a ...interface{}) {
+	i.result.Unmapped = append(i.result.Unmapped, Unmapped{
+		Source: source,
+		Reason: fmt.Sprintf(format, a...),
+	})
+}
+
+func (i *importer) skip(source string, format string, a ...interface{}) {
+	i.result.Unmapped = append(i.result.Unmapped, Unmapped{
+		Source:  source,
+		Reason:  fmt.Sprintf(format, a...),
+		Skipped: true,
+	})
+}
+
+// schedule fits interval and timeout into the limits of the checkmanager.
+// Unset durations use the defaults of the checkmanager.
+func (i *importer) schedule(source string, interval time.Duration, timeout time.Duration) (*duration.Duration, *duration.Duration) {
+	var pi, pt *duration.Duration
+	if interval != 0 {
+		if interval < proto.MinInterval || interval > proto.MaxInterval {
+			i.unmapped(source, "interval %v not between %v and %v", interval, proto.MinInterval, proto.MaxInterval)
+			interval = bound(interval, proto.MinInterval, proto.MaxInterval)
+		}
+		pi = ptypes.DurationProto(interval)
+	}
+	if timeout != 0 {
+		if timeout < proto.MinTimeout || timeout > proto.MaxTimeout {
+			i.unmapped(source, "timeout %v not between %v and %v", timeout, proto.MinTimeout, proto.MaxTimeout)
+			timeout = bound(timeout, proto.MinTimeout, proto.MaxTimeout)
+		}
+		if interval != 0 && timeout > interval {
+			timeout = interval
+		}
+		pt = ptypes.DurationProto(timeout)
+	}
+	return pi, pt
+}
+
+func bound(d time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// uniqueName returns a valid name for a check, which is not used by another
+// check of the import
+func (i *importer) uniqueName(s string) string {
+	name := sanitizeName(s, maxNameLength)
+	candidate := name
+	for n := 2; i.names[candidate]; n++ {
+		suffix := fmt.Sprintf("-%v", n)
+		candidate = sanitizeName(name, maxNameLength-len(suffix)) + suffix
+	}
+	i.names[candidate] = true
+	return candidate
+}
+
+// sanitizeName replaces all characters, which are not allowed in names, by
+// dashes
+func sanitizeName(s string, length int) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		valid := r < 128 && (r == '_' || r == '.' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+		if !valid {
+			if !dash {
+				b.WriteByte('-')
+			}
+			dash = true
+			continue
+		}
+		b.WriteRune(r)
+		dash = r == '-'
+	}
+	name := b.String()
+	if len(name) > length {
+		name = name[:length]
+	}
+	name = strings.Trim(name, "_.-")
+	if name == "" {
+		return "check"
+	}
+	return name
+}
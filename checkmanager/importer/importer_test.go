@@ -0,0 +1,332 @@
+package importer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// fixture returns the content of the file in testdata
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("unable to read fixture, %v", err)
+	}
+	return data
+}
+
+func dur(d time.Duration) *duration.Duration {
+	return ptypes.DurationProto(d)
+}
+
+// checkResult compares the result of an import with the expected checks,
+// alerts and unmapped parts
+func checkResult(t *testing.T, r *Result, checks []*proto.DocumentCheck, alerts []*proto.DocumentAlert, unmapped []Unmapped) {
+	t.Helper()
+	if len(r.Document.Checks) != len(checks) {
+		t.Errorf("%v checks, expected %v", len(r.Document.Checks), len(checks))
+	}
+	for i := 0; i < len(checks) && i < len(r.Document.Checks); i++ {
+		if !protobuf.Equal(r.Document.Checks[i], checks[i]) {
+			t.Errorf("check %v\n%v\nexpected\n%v", i, r.Document.Checks[i], checks[i])
+		}
+	}
+	if len(r.Document.Alerts) != len(alerts) {
+		t.Errorf("%v alerts, expected %v", len(r.Document.Alerts), len(alerts))
+	}
+	for i := 0; i < len(alerts) && i < len(r.Document.Alerts); i++ {
+		if !protobuf.Equal(r.Document.Alerts[i], alerts[i]) {
+			t.Errorf("alert %v\n%v\nexpected\n%v", i, r.Document.Alerts[i], alerts[i])
+		}
+	}
+	if !reflect.DeepEqual(r.Unmapped, unmapped) {
+		t.Errorf("unmapped\n%+v\nexpected\n%+v", r.Unmapped, unmapped)
+	}
+}
+
+func TestBlackbox(t *testing.T) {
+	r, err := Blackbox(fixture(t, "blackbox.yml"), fixture(t, "prometheus.yml"))
+	if err != nil {
+		t.Fatalf("unable to import, %v", err)
+	}
+	labels := func(job string, module string) map[string]string {
+		return map[string]string{"source": "blackbox", "job": job, "module": module}
+	}
+	webLabels := labels("web", "http_2xx")
+	webLabels["env"] = "prod"
+
+	checks := []*proto.DocumentCheck{
+		{
+			Name:   "web-https-example.com",
+			Labels: webLabels,
+			Http: &proto.HTTPCheck{
+				Url:        "https://example.com",
+				Interval:   dur(30 * time.Second),
+				Timeout:    dur(5 * time.Second),
+				Assertions: &proto.HTTPAssertions{},
+			},
+		},
+		{
+			Name:   "web-example.org",
+			Labels: webLabels,
+			Http: &proto.HTTPCheck{
+				Url:        "http://example.org",
+				Interval:   dur(30 * time.Second),
+				Timeout:    dur(5 * time.Second),
+				Assertions: &proto.HTTPAssertions{},
+			},
+		},
+		{
+			Name:   "api-https-api.example.com-health",
+			Labels: labels("api", "http_post_auth"),
+			Http: &proto.HTTPCheck{
+				Url:      "https://api.example.com/health",
+				Method:   "POST",
+				Headers:  map[string]string{"Content-Type": "application/json"},
+				Body:     `{"ping": true}`,
+				Username: "monitor",
+				Password: "secret",
+				Interval: dur(10 * time.Second),
+				Timeout:  dur(10 * time.Second),
+				Assertions: &proto.HTTPAssertions{
+					StatusCodes: []*proto.StatusCodeRange{{From: 200, To: 200}, {From: 204, To: 204}},
+					BodyMatches: []string{"ok"},
+				},
+			},
+		},
+		{
+			Name:   "db-db.example.com-5432",
+			Labels: labels("db", "tcp_connect"),
+			Tcp: &proto.TCPCheck{
+				Address:  "db.example.com:5432",
+				Interval: dur(30 * time.Second),
+				Timeout:  dur(5 * time.Second),
+			},
+		},
+		{
+			Name:   "smtp-mail.example.com-25",
+			Labels: labels("smtp", "smtp_banner"),
+			Tcp: &proto.TCPCheck{
+				Address:  "mail.example.com:25",
+				Expect:   "^220",
+				Interval: dur(30 * time.Second),
+			},
+		},
+		{
+			Name:   "tls-example.com-443",
+			Labels: labels("tls", "tls_connect"),
+			Tls: &proto.TLSCheck{
+				Address:  "example.com:443",
+				Interval: dur(30 * time.Second),
+			},
+		},
+		{
+			Name:   "dns-192.0.2.53",
+			Labels: labels("dns", "dns_mx"),
+			Dns: &proto.DNSCheck{
+				Name:       "example.com",
+				RecordType: "MX",
+				Resolver:   "192.0.2.53:53",
+				Rcode:      "NOERROR",
+				Interval:   dur(30 * time.Second),
+			},
+		},
+	}
+	unmapped := []Unmapped{
+		{Source: "node", Reason: "not a blackbox_exporter job", Skipped: true},
+		{Source: "api/https://api.example.com/health", Reason: "interval 5s not between 10s and 24h0m0s"},
+		{Source: "api/https://api.example.com/health", Reason: "timeout 2m0s not between 1s and 1m0s"},
+		{Source: "api/https://api.example.com/health", Reason: "fail_if_ssl and fail_if_not_ssl"},
+		{Source: "db", Reason: "file_sd_configs, only the targets of static_configs are imported"},
+		{Source: "smtp/mail.example.com:25", Reason: "query_response with multiple steps, only a single send followed by an expect is used"},
+		{Source: "dns/192.0.2.53", Reason: "multiple valid_rcodes, only NOERROR is used"},
+		{Source: "soa/192.0.2.53", Reason: "record type SOA is not supported", Skipped: true},
+		{Source: "ping/example.com", Reason: "prober icmp is not supported", Skipped: true},
+		{Source: "missing", Reason: "unknown module http_3xx", Skipped: true},
+	}
+	checkResult(t, r, checks, []*proto.DocumentAlert{}, unmapped)
+}
+
+func TestUptimeRobotJSON(t *testing.T) {
+	r, err := UptimeRobotJSON(fixture(t, "uptimerobot.json"))
+	if err != nil {
+		t.Fatalf("unable to import, %v", err)
+	}
+	labels := func(id string) map[string]string {
+		return map[string]string{"source": "uptimerobot", "uptimerobot.id": id}
+	}
+
+	checks := []*proto.DocumentCheck{
+		{
+			Name:   "Website",
+			Labels: labels("777"),
+			Http: &proto.HTTPCheck{
+				Url:      "https://example.com",
+				Method:   "GET",
+				Interval: dur(5 * time.Minute),
+				Timeout:  dur(30 * time.Second),
+			},
+		},
+		{
+			Name:   "Shop-keyword",
+			Labels: labels("778"),
+			Paused: true,
+			Http: &proto.HTTPCheck{
+				Url:        "https://shop.example.com",
+				Username:   "monitor",
+				Password:   "secret",
+				Interval:   dur(10 * time.Second),
+				Assertions: &proto.HTTPAssertions{BodyNotContains: []string{"error"}},
+			},
+		},
+		{
+			Name:   "Mail",
+			Labels: labels("779"),
+			Tcp:    &proto.TCPCheck{Address: "mail.example.com:25", Interval: dur(time.Minute)},
+		},
+		{
+			Name:   "Custom-port",
+			Labels: labels("780"),
+			Tcp:    &proto.TCPCheck{Address: "db.example.com:5432", Interval: dur(time.Minute)},
+		},
+		{
+			Name:      "Backup",
+			Labels:    labels("781"),
+			Heartbeat: &proto.HeartbeatCheck{Period: dur(24 * time.Hour)},
+		},
+		{
+			Name:      "Queue",
+			Labels:    labels("785"),
+			Heartbeat: &proto.HeartbeatCheck{Period: dur(time.Minute)},
+		},
+		{
+			Name:   "Website-2",
+			Labels: labels("784"),
+			Http:   &proto.HTTPCheck{Url: "https://www.example.com", Interval: dur(time.Minute)},
+		},
+	}
+	alerts := []*proto.DocumentAlert{{Check: "Website", SendMail: true}}
+	unmapped := []Unmapped{
+		{Source: "Shop keyword", Reason: "interval 5s not between 10s and 24h0m0s"},
+		{Source: "Backup", Reason: "the ping url of the heartbeat changes, update the pinging jobs"},
+		{Source: "Queue", Reason: "period 30s shorter than 1m0s"},
+		{Source: "Queue", Reason: "the ping url of the heartbeat changes, update the pinging jobs"},
+		{Source: "Router", Reason: "ping monitors are not supported", Skipped: true},
+		{Source: "Port without port", Reason: "port monitor without port", Skipped: true},
+	}
+	checkResult(t, r, checks, alerts, unmapped)
+}
+
+func TestUptimeRobotCSV(t *testing.T) {
+	r, err := UptimeRobotCSV(fixture(t, "uptimerobot.csv"))
+	if err != nil {
+		t.Fatalf("unable to import, %v", err)
+	}
+	labels := map[string]string{"source": "uptimerobot"}
+
+	checks := []*proto.DocumentCheck{
+		{
+			Name:   "Website",
+			Labels: labels,
+			Http:   &proto.HTTPCheck{Url: "https://example.com", Interval: dur(5 * time.Minute)},
+		},
+		{
+			Name:   "Status-page",
+			Labels: labels,
+			Http: &proto.HTTPCheck{
+				Url:        "https://status.example.com",
+				Interval:   dur(time.Minute),
+				Assertions: &proto.HTTPAssertions{BodyContains: []string{"operational"}},
+			},
+		},
+		{
+			Name:   "SSH",
+			Labels: labels,
+			Tcp:    &proto.TCPCheck{Address: "ssh.example.com:22", Interval: dur(time.Minute)},
+		},
+		{
+			Name:      "Cron",
+			Labels:    labels,
+			Heartbeat: &proto.HeartbeatCheck{Period: dur(time.Hour)},
+		},
+	}
+	unmapped := []Unmapped{
+		{Source: "Router", Reason: "ping monitors are not supported", Skipped: true},
+		{Source: "Cron", Reason: "the ping url of the heartbeat changes, update the pinging jobs"},
+		{Source: "Broken", Reason: `invalid interval "often"`, Skipped: true},
+		{Source: "line 8", Reason: `unknown monitor type "dns"`, Skipped: true},
+	}
+	checkResult(t, r, checks, []*proto.DocumentAlert{}, unmapped)
+}
+
+func TestInvalidExports(t *testing.T) {
+	tests := []struct {
+		name string
+		load func() (*Result, error)
+		err  string
+	}{
+		{
+			name: "blackbox modules",
+			load: func() (*Result, error) { return Blackbox([]byte("modules: ["), nil) },
+			err:  "invalid blackbox_exporter configuration",
+		},
+		{
+			name: "prometheus configuration",
+			load: func() (*Result, error) { return Blackbox(nil, []byte("scrape_configs: {")) },
+			err:  "invalid Prometheus configuration",
+		},
+		{
+			name: "uptimerobot json",
+			load: func() (*Result, error) { return UptimeRobotJSON([]byte(`{"monitors": {}}`)) },
+			err:  "invalid UptimeRobot export",
+		},
+		{
+			name: "uptimerobot csv without header",
+			load: func() (*Result, error) { return UptimeRobotCSV(nil) },
+			err:  "missing header",
+		},
+		{
+			name: "uptimerobot csv without type",
+			load: func() (*Result, error) {
+				return UptimeRobotCSV([]byte("Friendly Name,URL\nWebsite,https://example.com\n"))
+			},
+			err: "missing column type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.load()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAddGroup(t *testing.T) {
+	r, err := UptimeRobotCSV(fixture(t, "uptimerobot.csv"))
+	if err != nil {
+		t.Fatalf("unable to import, %v", err)
+	}
+	if err := r.AddGroup("imported/uptimerobot"); err != nil {
+		t.Fatalf("unable to add group, %v", err)
+	}
+	for _, c := range r.Document.Checks {
+		if !reflect.DeepEqual(c.Groups, []string{"imported/uptimerobot"}) {
+			t.Errorf("groups %v of check %v", c.Groups, c.Name)
+		}
+	}
+	if err := r.AddGroup("imported//uptimerobot"); err == nil {
+		t.Error("invalid group added")
+	}
+}
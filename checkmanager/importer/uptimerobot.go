@@ -0,0 +1,293 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// Types of UptimeRobot monitors
+const (
+	uptimeRobotHTTP      = 1
+	uptimeRobotKeyword   = 2
+	uptimeRobotPing      = 3
+	uptimeRobotPort      = 4
+	uptimeRobotHeartbeat = 5
+)
+
+// Keyword types of UptimeRobot monitors, which describe when the monitor is
+// down
+const (
+	uptimeRobotKeywordExists    = 1
+	uptimeRobotKeywordNotExists = 2
+)
+
+// uptimeRobotStatusPaused is the status of paused monitors
+const uptimeRobotStatusPaused = 0
+
+// uptimeRobotPorts are the ports of the sub types of port monitors
+var uptimeRobotPorts = map[int64]string{
+	1: "80", 2: "443", 3: "21", 4: "25", 5: "110", 6: "143",
+}
+
+// uptimeRobotMethods are the http methods of monitors
+var uptimeRobotMethods = map[int64]string{
+	1: "HEAD", 2: "GET", 3: "POST", 4: "PUT", 5: "PATCH", 6: "DELETE", 7: "OPTIONS",
+}
+
+// uptimeRobotTypes are the names of the monitor types in CSV exports
+var uptimeRobotTypes = map[string]int64{
+	"http":      uptimeRobotHTTP,
+	"http(s)":   uptimeRobotHTTP,
+	"https":     uptimeRobotHTTP,
+	"keyword":   uptimeRobotKeyword,
+	"ping":      uptimeRobotPing,
+	"port":      uptimeRobotPort,
+	"heartbeat": uptimeRobotHeartbeat,
+}
+
+// uptimeRobotNumber is a number, which UptimeRobot exports as number or as
+// string
+type uptimeRobotNumber int64
+
+func (n *uptimeRobotNumber) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %v", string(data))
+	}
+	*n = uptimeRobotNumber(i)
+	return nil
+}
+
+// uptimeRobotMonitor is a monitor of the getMonitors API of UptimeRobot
+type uptimeRobotMonitor struct {
+	ID            uptimeRobotNumber  `json:"id"`
+	FriendlyName  string             `json:"friendly_name"`
+	URL           string             `json:"url"`
+	Type          uptimeRobotNumber  `json:"type"`
+	SubType       uptimeRobotNumber  `json:"sub_type"`
+	Port          uptimeRobotNumber  `json:"port"`
+	KeywordType   uptimeRobotNumber  `json:"keyword_type"`
+	KeywordValue  string             `json:"keyword_value"`
+	HTTPUsername  string             `json:"http_username"`
+	HTTPPassword  string             `json:"http_password"`
+	HTTPMethod    uptimeRobotNumber  `json:"http_method"`
+	Interval      uptimeRobotNumber  `json:"interval"`
+	Timeout       uptimeRobotNumber  `json:"timeout"`
+	Status        *uptimeRobotNumber `json:"status"`
+	AlertContacts []interface{}      `json:"alert_contacts"`
+}
+
+// UptimeRobotJSON imports the monitors of a response of the getMonitors API
+// of UptimeRobot or of a plain list of these monitors
+func UptimeRobotJSON(data []byte) (*Result, error) {
+	monitors := []uptimeRobotMonitor{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &monitors); err != nil {
+			return nil, fmt.Errorf("invalid UptimeRobot export, %w", err)
+		}
+	} else {
+		export := struct {
+			Monitors []uptimeRobotMonitor `json:"monitors"`
+		}{}
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, fmt.Errorf("invalid UptimeRobot export, %w", err)
+		}
+		monitors = export.Monitors
+	}
+	i := newImporter()
+	for _, m := range monitors {
+		i.uptimeRobotMonitor(m)
+	}
+	return i.result, nil
+}
+
+// UptimeRobotCSV imports the monitors of a CSV export of UptimeRobot. The
+// columns are identified by the header. Friendly Name, URL and Type are
+// required, Port, Interval, Keyword Type and Keyword Value are optional.
+// Intervals are in seconds.
+func UptimeRobotCSV(data []byte) (*Result, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UptimeRobot export, %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("invalid UptimeRobot export, missing header")
+	}
+	columns := map[string]int{}
+	for index, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	column := func(record []string, names ...string) string {
+		for _, name := range names {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+		}
+		return ""
+	}
+	for _, required := range [][]string{{"friendly name", "name"}, {"url", "url/ip"}, {"type"}} {
+		found := false
+		for _, name := range required {
+			_, ok := columns[name]
+			found = found || ok
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid UptimeRobot export, missing column %v", required[0])
+		}
+	}
+
+	i := newImporter()
+	for line, record := range records[1:] {
+		m := uptimeRobotMonitor{
+			FriendlyName: column(record, "friendly name", "name"),
+			URL:          column(record, "url", "url/ip"),
+			KeywordValue: column(record, "keyword value"),
+		}
+		source := m.FriendlyName
+		if source == "" {
+			source = fmt.Sprintf("line %v", line+2)
+		}
+		monitorType := strings.ToLower(column(record, "type"))
+		if t, ok := uptimeRobotTypes[monitorType]; ok {
+			m.Type = uptimeRobotNumber(t)
+		} else if t, err := strconv.ParseInt(monitorType, 10, 64); err == nil {
+			m.Type = uptimeRobotNumber(t)
+		} else {
+			i.skip(source, "unknown monitor type %q", monitorType)
+			continue
+		}
+		if port := column(record, "port"); port != "" {
+			p, err := strconv.ParseInt(port, 10, 64)
+			if err != nil {
+				i.skip(source, "invalid port %q", port)
+				continue
+			}
+			m.Port = uptimeRobotNumber(p)
+		}
+		if interval := column(record, "interval"); interval != "" {
+			seconds, err := strconv.ParseInt(interval, 10, 64)
+			if err != nil {
+				i.skip(source, "invalid interval %q", interval)
+				continue
+			}
+			m.Interval = uptimeRobotNumber(seconds)
+		}
+		switch strings.ToLower(column(record, "keyword type")) {
+		case "1", "exists":
+			m.KeywordType = uptimeRobotKeywordExists
+		case "2", "not exists":
+			m.KeywordType = uptimeRobotKeywordNotExists
+		}
+		i.uptimeRobotMonitor(m)
+	}
+	return i.result, nil
+}
+
+// uptimeRobotMonitor adds the check and the alert for the monitor
+func (i *importer) uptimeRobotMonitor(m uptimeRobotMonitor) {
+	source := m.FriendlyName
+	if source == "" {
+		source = m.URL
+	}
+	c := &proto.DocumentCheck{
+		Name:   m.FriendlyName,
+		Paused: m.Status != nil && *m.Status == uptimeRobotStatusPaused,
+	}
+	if c.Name == "" {
+		c.Name = m.URL
+	}
+	interval := time.Duration(m.Interval) * time.Second
+	timeout := time.Duration(m.Timeout) * time.Second
+
+	switch m.Type {
+	case uptimeRobotHTTP, uptimeRobotKeyword:
+		pi, pt := i.schedule(source, interval, timeout)
+		hc := &proto.HTTPCheck{
+			Url:      m.URL,
+			Method:   uptimeRobotMethods[int64(m.HTTPMethod)],
+			Username: m.HTTPUsername,
+			Password: m.HTTPPassword,
+			Interval: pi,
+			Timeout:  pt,
+		}
+		if m.Type == uptimeRobotKeyword {
+			hc.Assertions = &proto.HTTPAssertions{}
+			switch m.KeywordType {
+			case uptimeRobotKeywordExists:
+				hc.Assertions.BodyNotContains = []string{m.KeywordValue}
+			case uptimeRobotKeywordNotExists:
+				hc.Assertions.BodyContains = []string{m.KeywordValue}
+			default:
+				i.unmapped(source, "unknown keyword type %v", m.KeywordType)
+			}
+		}
+		c.Http = hc
+	case uptimeRobotPort:
+		port, ok := uptimeRobotPorts[int64(m.SubType)]
+		if !ok {
+			port = strconv.FormatInt(int64(m.Port), 10)
+		}
+		if port == "0" {
+			i.skip(source, "port monitor without port")
+			return
+		}
+		pi, pt := i.schedule(source, interval, timeout)
+		c.Tcp = &proto.TCPCheck{
+			Address:  net.JoinHostPort(uptimeRobotHost(m.URL), port),
+			Interval: pi,
+			Timeout:  pt,
+		}
+	case uptimeRobotHeartbeat:
+		if interval == 0 {
+			i.skip(source, "heartbeat monitor without interval")
+			return
+		}
+		if interval < proto.MinHeartbeatPeriod {
+			i.unmapped(source, "period %v shorter than %v", interval, proto.MinHeartbeatPeriod)
+			interval = proto.MinHeartbeatPeriod
+		}
+		c.Heartbeat = &proto.HeartbeatCheck{Period: ptypes.DurationProto(interval)}
+		i.unmapped(source, "the ping url of the heartbeat changes, update the pinging jobs")
+	case uptimeRobotPing:
+		i.skip(source, "ping monitors are not supported")
+		return
+	default:
+		i.skip(source, "unknown monitor type %v", m.Type)
+		return
+	}
+
+	i.label(source, c, "source", "uptimerobot")
+	if m.ID != 0 {
+		i.label(source, c, "uptimerobot.id", strconv.FormatInt(int64(m.ID), 10))
+	}
+	name := i.add(c)
+	if len(m.AlertContacts) > 0 {
+		i.alert(name)
+	}
+}
+
+// uptimeRobotHost returns the host of the url or hostname of a monitor
+func uptimeRobotHost(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return s
+}
@@ -0,0 +1,213 @@
+package checkmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+	"github.com/shaardie/mondane/selector"
+)
+
+// Limits of the labels and groups of a single check
+const (
+	maxLabels = 32
+	maxGroups = 16
+)
+
+// label is a key value pair attached to a check
+type label struct {
+	UserID    int64  `db:"user_id"`
+	CheckID   int64  `db:"check_id"`
+	CheckType string `db:"check_type"`
+	Name      string `db:"name"`
+	Value     string `db:"value"`
+}
+
+// groupMember puts a check into a named group
+type groupMember struct {
+	UserID    int64  `db:"user_id"`
+	CheckID   int64  `db:"check_id"`
+	CheckType string `db:"check_type"`
+	Name      string `db:"name"`
+}
+
+func (l *label) check() checkKey {
+	return checkKey{checkID: l.CheckID, checkType: l.CheckType}
+}
+
+func (g *groupMember) check() checkKey {
+	return checkKey{checkID: g.CheckID, checkType: g.CheckType}
+}
+
+// marshalCheckLabels returns the check with its validated labels and groups
+func marshalCheckLabels(l *proto.CheckLabels) (checkKey, map[string]string, []string, error) {
+	key, err := marshalCheckRef(l.Check)
+	if err != nil {
+		return key, nil, nil, err
+	}
+	labels, groups, err := marshalLabels(l.Labels, l.Groups)
+	return key, labels, groups, err
+}
+
+// marshalLabels validates the labels and returns the sorted groups without
+// duplicates
+func marshalLabels(labels map[string]string, groups []string) (map[string]string, []string, error) {
+	if len(labels) > maxLabels {
+		return nil, nil, fmt.Errorf("more than %v labels", maxLabels)
+	}
+	for name, value := range labels {
+		if err := selector.ValidateLabel(name, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if len(groups) > maxGroups {
+		return nil, nil, fmt.Errorf("more than %v groups", maxGroups)
+	}
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, group := range groups {
+		if err := selector.ValidateGroup(group); err != nil {
+			return nil, nil, err
+		}
+		if !seen[group] {
+			seen[group] = true
+			unique = append(unique, group)
+		}
+	}
+	sort.Strings(unique)
+	return labels, unique, nil
+}
+
+// labelIndex contains the labels and groups of checks
+type labelIndex map[checkKey]*proto.CheckLabels
+
+func newLabelIndex(ls []label, gs []groupMember) labelIndex {
+	index := labelIndex{}
+	for _, l := range ls {
+		index.get(l.check()).Labels[l.Name] = l.Value
+	}
+	for _, g := range gs {
+		cl := index.get(g.check())
+		cl.Groups = append(cl.Groups, g.Name)
+	}
+	for _, cl := range index {
+		sort.Strings(cl.Groups)
+	}
+	return index
+}
+
+// get returns the labels and groups of the check, which are empty for a
+// check without them
+func (index labelIndex) get(key checkKey) *proto.CheckLabels {
+	cl, ok := index[key]
+	if !ok {
+		cl = &proto.CheckLabels{
+			Check:  unmarshalCheckRef(key),
+			Labels: map[string]string{},
+			Groups: []string{},
+		}
+		index[key] = cl
+	}
+	return cl
+}
+
+// getCheckLabels returns the labels and groups of a single check
+func getCheckLabels(ctx context.Context, db repository, key checkKey) (*proto.CheckLabels, error) {
+	ls, err := db.GetLabels(ctx, key.checkID, key.checkType)
+	if err != nil {
+		return nil, err
+	}
+	gs, err := db.GetGroups(ctx, key.checkID, key.checkType)
+	if err != nil {
+		return nil, err
+	}
+	return newLabelIndex(*ls, *gs).get(key), nil
+}
+
+// labelFilter chooses the checks of a user by a selector and a group
+type labelFilter struct {
+	index    labelIndex
+	selector selector.Selector
+	group    string
+}
+
+// marshalCheckQuery returns the filter of the query. Its labels are loaded
+// separately.
+func marshalCheckQuery(q *proto.CheckQuery) (*labelFilter, error) {
+	s, err := selector.Parse(q.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector, %w", err)
+	}
+	if q.Group != "" {
+		if err := selector.ValidateGroup(q.Group); err != nil {
+			return nil, err
+		}
+	}
+	return &labelFilter{
+		index:    labelIndex{},
+		selector: s,
+		group:    q.Group,
+	}, nil
+}
+
+// load the labels and groups of the checks of the user
+func (f *labelFilter) load(ctx context.Context, db repository, userID int64) error {
+	ls, err := db.GetLabelsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	gs, err := db.GetGroupsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	f.index = newLabelIndex(*ls, *gs)
+	return nil
+}
+
+// match returns the labels and groups of the check and, if it matches
+func (f *labelFilter) match(key checkKey) (*proto.CheckLabels, bool) {
+	cl := f.index.get(key)
+	if f.group != "" && !selector.InGroup(cl.Groups, f.group) {
+		return cl, false
+	}
+	return cl, f.selector.Matches(cl.Labels)
+}
+
+// unmarshalGroups counts the checks in each group. Checks in subfolders also
+// count for their parent folders.
+func unmarshalGroups(gs []groupMember) *proto.Groups {
+	checks := map[string]map[checkKey]bool{}
+	for _, g := range gs {
+		for _, folder := range parentFolders(g.Name) {
+			if checks[folder] == nil {
+				checks[folder] = map[checkKey]bool{}
+			}
+			checks[folder][g.check()] = true
+		}
+	}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	groups := make([]*proto.Group, len(names))
+	for i, name := range names {
+		groups[i] = &proto.Group{Name: name, Checks: int64(len(checks[name]))}
+	}
+	return &proto.Groups{Groups: groups}
+}
+
+// parentFolders returns the group and all of its parent folders
+func parentFolders(group string) []string {
+	folders := []string{group}
+	for i := len(group) - 1; i > 0; i-- {
+		if group[i] == '/' {
+			folders = append(folders, group[:i])
+		}
+	}
+	return folders
+}
@@ -0,0 +1,316 @@
+package checkmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// Modes of maintenance windows
+const (
+	// maintenancePause does not run the checks during the window
+	maintenancePause = "pause"
+	// maintenanceRecord runs the checks and flags their results
+	maintenanceRecord = "record"
+)
+
+const (
+	// maintenanceRefreshInterval is the time between two refreshes of the
+	// maintenance windows from the database
+	maintenanceRefreshInterval = 30 * time.Second
+	// maxMaintenanceDuration is the maximal duration of a recurring window
+	maxMaintenanceDuration = 7 * 24 * time.Hour
+	// defaultTimezone of the schedule of recurring windows
+	defaultTimezone = "UTC"
+)
+
+// maintenanceWindow suppresses the alerts of a single check or of all checks
+// of a user.
+//
+// A window is either one-off from StartsAt to EndsAt or recurring, starting
+// at the times of the cron rule in Schedule and lasting for Duration.
+type maintenanceWindow struct {
+	ID     int64 `db:"id"`
+	UserID int64 `db:"user_id"`
+	// CheckID and CheckType select the check, all checks of the user, if
+	// CheckType is empty
+	CheckID   int64         `db:"check_id"`
+	CheckType string        `db:"check_type"`
+	Name      string        `db:"name"`
+	Mode      string        `db:"mode"`
+	StartsAt  sql.NullTime  `db:"starts_at"`
+	EndsAt    sql.NullTime  `db:"ends_at"`
+	Schedule  string        `db:"schedule"`
+	Duration  time.Duration `db:"duration"`
+	Timezone  string        `db:"timezone"`
+}
+
+// compiledWindow is a maintenance window with its parsed schedule
+type compiledWindow struct {
+	window   maintenanceWindow
+	schedule cron.Schedule
+	location *time.Location
+}
+
+// compile parses the schedule of the window
+func (w *maintenanceWindow) compile() (*compiledWindow, error) {
+	cw := &compiledWindow{window: *w}
+	if w.Schedule == "" {
+		return cw, nil
+	}
+	var err error
+	cw.schedule, err = cron.ParseStandard(w.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q, %w", w.Schedule, err)
+	}
+	cw.location, err = time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %v, %w", w.Timezone, err)
+	}
+	return cw, nil
+}
+
+// active returns, if the window is active at t
+func (cw *compiledWindow) active(t time.Time) bool {
+	w := &cw.window
+	if cw.schedule == nil {
+		return w.StartsAt.Valid && w.EndsAt.Valid &&
+			!t.Before(w.StartsAt.Time) && t.Before(w.EndsAt.Time)
+	}
+	// The window is active, if it started within the last duration
+	start := cw.schedule.Next(t.Add(-w.Duration).In(cw.location))
+	return !start.After(t)
+}
+
+// covers returns, if the window applies to the check of the user
+func (cw *compiledWindow) covers(userID int64, key checkKey) bool {
+	w := &cw.window
+	if w.UserID != userID {
+		return false
+	}
+	return w.CheckType == "" || (w.CheckType == key.checkType && w.CheckID == key.checkID)
+}
+
+func marshalMaintenanceWindow(w *proto.MaintenanceWindow) (*maintenanceWindow, error) {
+	mw := &maintenanceWindow{
+		ID:        w.Id,
+		UserID:    w.UserId,
+		CheckID:   w.CheckId,
+		CheckType: w.CheckType,
+		Name:      w.Name,
+		Mode:      w.Mode,
+		Schedule:  w.Schedule,
+		Timezone:  w.Timezone,
+	}
+	if mw.Name == "" {
+		return nil, errors.New("empty name")
+	}
+	switch mw.Mode {
+	case "":
+		mw.Mode = maintenanceRecord
+	case maintenancePause, maintenanceRecord:
+	default:
+		return nil, fmt.Errorf("unknown mode %v", mw.Mode)
+	}
+	if mw.CheckType == "" {
+		mw.CheckID = 0
+	} else if !validCheckType(mw.CheckType) {
+		return nil, fmt.Errorf("unknown check type %v", mw.CheckType)
+	}
+
+	if mw.Schedule == "" {
+		if w.StartsAt == nil || w.EndsAt == nil {
+			return nil, errors.New("neither schedule nor start and end")
+		}
+		if w.Duration != nil || w.Timezone != "" {
+			return nil, errors.New("duration and timezone only apply to a schedule")
+		}
+		start, err := ptypes.Timestamp(w.StartsAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start, %w", err)
+		}
+		end, err := ptypes.Timestamp(w.EndsAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end, %w", err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("end %v not after start %v", end, start)
+		}
+		mw.StartsAt = sql.NullTime{Time: start, Valid: true}
+		mw.EndsAt = sql.NullTime{Time: end, Valid: true}
+		return mw, nil
+	}
+
+	if w.StartsAt != nil || w.EndsAt != nil {
+		return nil, errors.New("start and end only apply without schedule")
+	}
+	if w.Duration == nil {
+		return nil, errors.New("schedule without duration")
+	}
+	var err error
+	mw.Duration, err = ptypes.Duration(w.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration, %w", err)
+	}
+	if mw.Duration < time.Minute || mw.Duration > maxMaintenanceDuration {
+		return nil, fmt.Errorf("duration %v not between %v and %v",
+			mw.Duration, time.Minute, maxMaintenanceDuration)
+	}
+	if mw.Timezone == "" {
+		mw.Timezone = defaultTimezone
+	}
+	if _, err := mw.compile(); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+func unmarshalMaintenanceWindow(w *maintenanceWindow, now time.Time) (*proto.MaintenanceWindow, error) {
+	pw := &proto.MaintenanceWindow{
+		Id:        w.ID,
+		UserId:    w.UserID,
+		CheckId:   w.CheckID,
+		CheckType: w.CheckType,
+		Name:      w.Name,
+		Mode:      w.Mode,
+		Schedule:  w.Schedule,
+		Timezone:  w.Timezone,
+	}
+	var err error
+	if w.StartsAt.Valid {
+		pw.StartsAt, err = ptypes.TimestampProto(w.StartsAt.Time)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *w, err)
+		}
+	}
+	if w.EndsAt.Valid {
+		pw.EndsAt, err = ptypes.TimestampProto(w.EndsAt.Time)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *w, err)
+		}
+	}
+	if w.Schedule != "" {
+		pw.Duration = ptypes.DurationProto(w.Duration)
+	}
+	cw, err := w.compile()
+	if err != nil {
+		return nil, err
+	}
+	pw.Active = cw.active(now)
+	return pw, nil
+}
+
+func unmarshalMaintenanceWindowCollection(ws *[]maintenanceWindow, now time.Time) (*proto.MaintenanceWindows, error) {
+	windows := make([]*proto.MaintenanceWindow, len(*ws))
+	for i, w := range *ws {
+		pw, err := unmarshalMaintenanceWindow(&w, now)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in window collection, %w", w, err)
+		}
+		windows[i] = pw
+	}
+	return &proto.MaintenanceWindows{Windows: windows}, nil
+}
+
+// maintenance keeps all maintenance windows in memory, so the runs of the
+// checks do not have to query the database. Windows are refreshed
+// periodically and after changes.
+type maintenance struct {
+	db     repository
+	logger *zap.SugaredLogger
+
+	mutex   *sync.RWMutex
+	windows []*compiledWindow
+}
+
+func newMaintenance(db repository, logger *zap.SugaredLogger) *maintenance {
+	return &maintenance{
+		db:     db,
+		logger: logger,
+		mutex:  &sync.RWMutex{},
+	}
+}
+
+// run refreshes the windows periodically until the context is done
+func (m *maintenance) run(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := m.refresh(ctx)
+			if err != nil {
+				m.logger.Errorw("Unable to refresh maintenance windows", "error", err)
+			}
+		}
+	}
+}
+
+// refresh the windows from the database
+func (m *maintenance) refresh(ctx context.Context) error {
+	ws, err := m.db.GetMaintenanceWindows(ctx)
+	if err != nil {
+		return err
+	}
+	windows := make([]*compiledWindow, 0, len(*ws))
+	for _, w := range *ws {
+		cw, err := w.compile()
+		if err != nil {
+			m.logger.Errorw("Invalid maintenance window", "error", err, "window_id", w.ID)
+			continue
+		}
+		windows = append(windows, cw)
+	}
+	m.mutex.Lock()
+	m.windows = windows
+	m.mutex.Unlock()
+	return nil
+}
+
+// mode returns the mode of the maintenance of the check at t or an empty
+// string, if the check is not in maintenance.
+func (m *maintenance) mode(c check, t time.Time) string {
+	return m.modeOf(c.UserID(), checkKey{checkID: c.CheckID(), checkType: c.CheckType()}, t)
+}
+
+// modeOf returns the mode of the maintenance of the check of the user at t.
+// Pausing takes precedence over recording, if multiple windows are active.
+func (m *maintenance) modeOf(userID int64, key checkKey, t time.Time) string {
+	if m == nil {
+		return ""
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	mode := ""
+	for _, cw := range m.windows {
+		if !cw.covers(userID, key) || !cw.active(t) {
+			continue
+		}
+		if cw.window.Mode == maintenancePause {
+			return maintenancePause
+		}
+		mode = maintenanceRecord
+	}
+	return mode
+}
+
+// paused returns, if the check does not run at t
+func (m *maintenance) paused(c check, t time.Time) bool {
+	return m.mode(c, t) == maintenancePause
+}
+
+// active returns, if the check is in maintenance at t
+func (m *maintenance) active(c check, t time.Time) bool {
+	return m.mode(c, t) != ""
+}
@@ -0,0 +1,59 @@
+package checkmanager
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestCompiledWindowActive(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	valid := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	oneOff := maintenanceWindow{StartsAt: valid(at(1, 10, 0)), EndsAt: valid(at(1, 12, 0))}
+	daily := maintenanceWindow{Schedule: "0 2 * * *", Duration: time.Hour, Timezone: "UTC"}
+	// 2020-01-04 is a Saturday
+	weekend := maintenanceWindow{Schedule: "0 22 * * 6", Duration: 4 * time.Hour, Timezone: "UTC"}
+	berlin := maintenanceWindow{Schedule: "0 2 * * *", Duration: time.Hour, Timezone: "Europe/Berlin"}
+
+	tests := []struct {
+		name   string
+		window maintenanceWindow
+		t      time.Time
+		want   bool
+	}{
+		{name: "one-off before", window: oneOff, t: at(1, 9, 59), want: false},
+		{name: "one-off start", window: oneOff, t: at(1, 10, 0), want: true},
+		{name: "one-off within", window: oneOff, t: at(1, 11, 59), want: true},
+		{name: "one-off end", window: oneOff, t: at(1, 12, 0), want: false},
+		{
+			name:   "one-off without end",
+			window: maintenanceWindow{StartsAt: valid(at(1, 10, 0))},
+			t:      at(1, 11, 0),
+			want:   false,
+		},
+		{name: "recurring before", window: daily, t: at(1, 1, 59), want: false},
+		{name: "recurring start", window: daily, t: at(1, 2, 0), want: true},
+		{name: "recurring within", window: daily, t: at(1, 2, 59), want: true},
+		{name: "recurring end", window: daily, t: at(1, 3, 0), want: false},
+		{name: "recurring next day", window: daily, t: at(2, 2, 30), want: true},
+		{name: "recurring over midnight", window: weekend, t: at(5, 1, 0), want: true},
+		{name: "recurring after midnight", window: weekend, t: at(5, 2, 0), want: false},
+		{name: "recurring other weekday", window: weekend, t: at(3, 23, 0), want: false},
+		{name: "timezone within", window: berlin, t: at(1, 1, 30), want: true},
+		{name: "timezone outside", window: berlin, t: at(1, 2, 30), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw, err := tt.window.compile()
+			if err != nil {
+				t.Fatalf("unable to compile window, %v", err)
+			}
+			if got := cw.active(tt.t); got != tt.want {
+				t.Errorf("active %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,112 +1,252 @@
 package checkmanager
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
+	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"go.uber.org/zap"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
 )
 
 type check interface {
 	CheckID() int64
 	CheckType() string
+	// UserID is the owner of the check
+	UserID() int64
+	// Enabled is false, while the check is paused
+	Enabled() bool
+	// Interval is the time between two runs of the check
+	Interval() time.Duration
+	// Config returns the stored configuration of the check. A running check
+	// is restarted, if its configuration changed.
+	Config() interface{}
 	DoCheck(context.Context, time.Time) error
 }
 
-type memoryRunner struct {
-	check    check
-	ticker   *time.Ticker
-	stopping chan bool
-	stopped  chan bool
-	logger   *zap.SugaredLogger
+// runnable is a check, which can also be run on demand
+type runnable interface {
+	check
+	// Run does a single run of the check and returns the results of all
+	// locations. The results are only stored and the state of the check is
+	// only updated, if record is set.
+	Run(ctx context.Context, t time.Time, record bool) (*proto.RunResult, error)
 }
 
-func newMemoryRunner(interval time.Duration, logger *zap.SugaredLogger, check check) *memoryRunner {
-	return &memoryRunner{
-		check:    check,
-		ticker:   time.NewTicker(interval),
-		stopping: make(chan bool, 1),
-		stopped:  make(chan bool, 1),
-		logger:   logger,
+// newRunResult returns the empty result of a run of the check
+func newRunResult(c check, t time.Time) (*proto.RunResult, error) {
+	timestamp, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp %v, %w", t, err)
 	}
+	return &proto.RunResult{
+		Check:     &proto.CheckRef{Id: c.CheckID(), Type: c.CheckType()},
+		Timestamp: timestamp,
+	}, nil
+}
+
+type checkKey struct {
+	checkID   int64
+	checkType string
 }
 
-// start the memoryRunner async
-func (mr *memoryRunner) start() {
-	mr.logger.Infow("Starting Memory Runner",
-		"check id ", mr.check.CheckID(),
-		"check type", mr.check.CheckType())
-	go mr.run()
+// scheduledCheck is the bookkeeping of a check in the memoryManager
+type scheduledCheck struct {
+	check check
+	// next is the time of the next run
+	next time.Time
+	// index in the queue, -1 if the check is not queued
+	index int
+	// removed is set, when the check got stopped
+	removed bool
+	// running is done, when the current run finished
+	running sync.WaitGroup
 }
 
-// stop the memoryRunner without waiting
-func (mr *memoryRunner) stop() {
-	mr.logger.Infow("Stopping Memory Runner",
-		"check id ", mr.check.CheckID(),
-		"check type", mr.check.CheckType())
-	mr.stopping <- true
+// checkQueue is a min heap of the checks ordered by their next run
+type checkQueue []*scheduledCheck
+
+func (q checkQueue) Len() int           { return len(q) }
+func (q checkQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q checkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *checkQueue) Push(x interface{}) {
+	sc := x.(*scheduledCheck)
+	sc.index = len(*q)
+	*q = append(*q, sc)
 }
 
-// Wait for the memoryRunner to stop
-func (mr *memoryRunner) wait() {
-	mr.logger.Infow("Wait for Memory Runner",
-		"check id ", mr.check.CheckID(),
-		"check type", mr.check.CheckType())
-	<-mr.stopped
+func (q *checkQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	sc := old[n-1]
+	old[n-1] = nil
+	sc.index = -1
+	*q = old[:n-1]
+	return sc
+}
+
+// nextRun returns the first run after now in the interval grid starting at
+// the last scheduled run and the number of runs skipped, because the check
+// was late.
+func nextRun(scheduled time.Time, interval time.Duration, now time.Time) (time.Time, int64) {
+	next := scheduled.Add(interval)
+	if next.After(now) {
+		return next, 0
+	}
+	skipped := int64(now.Sub(scheduled) / interval)
+	return scheduled.Add(time.Duration(skipped+1) * interval), skipped
+}
+
+// memoryManager schedules all checks with a single scheduler, which hands
+// due checks to a bounded pool of workers.
+//
+// New checks start at a random offset within their interval, so checks
+// created at the same time do not run in lockstep. A check never runs
+// concurrently with itself. If the workers cannot keep up, the scheduler
+// blocks and runs which are late by more than an interval are skipped.
+type memoryManager struct {
+	checks  map[checkKey]*scheduledCheck
+	queue   checkQueue
+	mutex   *sync.Mutex
+	random  *rand.Rand
+	wake    chan struct{}
+	work    chan *scheduledCheck
+	stopped chan struct{}
+	wg      sync.WaitGroup
+	logger  *zap.SugaredLogger
+}
+
+func newMemoryManager(logger *zap.SugaredLogger, workers int) *memoryManager {
+	if workers < 1 {
+		workers = 1
+	}
+	mm := &memoryManager{
+		checks:  make(map[checkKey]*scheduledCheck),
+		mutex:   &sync.Mutex{},
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:    make(chan struct{}, 1),
+		work:    make(chan *scheduledCheck),
+		stopped: make(chan struct{}),
+		logger:  logger,
+	}
+	mm.wg.Add(workers + 1)
+	go mm.schedule()
+	for i := 0; i < workers; i++ {
+		go mm.worker()
+	}
+	return mm
+}
+
+// notify the scheduler about a change of the queue
+func (mm *memoryManager) notify() {
+	select {
+	case mm.wake <- struct{}{}:
+	default:
+	}
 }
 
-// run the memoryRunner
-func (mr *memoryRunner) run() {
-	mr.logger.Infow("Memory Runner started",
-		"check id ", mr.check.CheckID(),
-		"check type", mr.check.CheckType())
+// schedule hands due checks to the workers
+func (mm *memoryManager) schedule() {
+	defer mm.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
 	for {
+		mm.mutex.Lock()
+		var sc *scheduledCheck
+		wait := time.Hour
+		if len(mm.queue) > 0 {
+			wait = time.Until(mm.queue[0].next)
+			if wait <= 0 {
+				sc = heap.Pop(&mm.queue).(*scheduledCheck)
+				sc.running.Add(1)
+			}
+		}
+		mm.mutex.Unlock()
+
+		if sc != nil {
+			select {
+			case mm.work <- sc:
+			case <-mm.stopped:
+				sc.running.Done()
+				return
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
 		select {
-		case <-mr.stopping:
-			mr.ticker.Stop()
-			mr.stopped <- true
-			mr.logger.Infow("Memory Runner stopped",
-				"check id ", mr.check.CheckID(),
-				"check type", mr.check.CheckType())
+		case <-timer.C:
+		case <-mm.wake:
+		case <-mm.stopped:
 			return
-		case t := <-mr.ticker.C:
-			mr.logger.Infow("Memory Runner do check",
-				"check id ", mr.check.CheckID(),
-				"check type", mr.check.CheckType())
-			err := mr.check.DoCheck(context.Background(), t)
-			if err != nil {
-				mr.logger.Errorw("Memory Runner check failed",
-					"check id ", mr.check.CheckID(),
-					"check type", mr.check.CheckType(),
-					"error", err)
-			}
-		default:
-			time.Sleep(time.Millisecond)
 		}
 	}
 }
 
-type checkKey struct {
-	checkID   int64
-	checkType string
+// worker runs the checks handed over by the scheduler
+func (mm *memoryManager) worker() {
+	defer mm.wg.Done()
+	for {
+		select {
+		case sc := <-mm.work:
+			mm.run(sc)
+		case <-mm.stopped:
+			return
+		}
+	}
 }
 
-type memoryManager struct {
-	interval     time.Duration
-	storage      map[checkKey]*memoryRunner
-	storageMutex *sync.Mutex
-	logger       *zap.SugaredLogger
-}
+// run the check and queue its next run
+func (mm *memoryManager) run(sc *scheduledCheck) {
+	defer sc.running.Done()
 
-func newMemoryManager(interval time.Duration, logger *zap.SugaredLogger) *memoryManager {
-	return &memoryManager{
-		interval:     interval,
-		logger:       logger,
-		storage:      make(map[checkKey]*memoryRunner),
-		storageMutex: &sync.Mutex{},
+	mm.mutex.Lock()
+	removed := sc.removed
+	mm.mutex.Unlock()
+	if removed {
+		return
 	}
+
+	err := sc.check.DoCheck(context.Background(), time.Now())
+	if err != nil {
+		mm.logger.Errorw("Check failed",
+			"check_id", sc.check.CheckID(),
+			"check_type", sc.check.CheckType(),
+			"error", err)
+	}
+
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	if sc.removed {
+		return
+	}
+	var skipped int64
+	sc.next, skipped = nextRun(sc.next, sc.check.Interval(), time.Now())
+	if skipped > 0 {
+		mm.logger.Warnw("Check is late, skipped runs",
+			"check_id", sc.check.CheckID(),
+			"check_type", sc.check.CheckType(),
+			"skipped", skipped)
+	}
+	heap.Push(&mm.queue, sc)
+	mm.notify()
 }
 
 func (mm *memoryManager) start(c check) error {
@@ -115,14 +255,44 @@ func (mm *memoryManager) start(c check) error {
 		checkType: c.CheckType(),
 	}
 
-	mm.storageMutex.Lock()
-	defer mm.storageMutex.Unlock()
-	if _, ok := mm.storage[key]; ok {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	if _, ok := mm.checks[key]; ok {
 		mm.logger.Errorw("key already exist in storage", "key", key)
 		return fmt.Errorf("key already exist, %v", key)
 	}
-	mm.storage[key] = newMemoryRunner(mm.interval, mm.logger, c)
-	mm.storage[key].start()
+	offset := time.Duration(mm.random.Int63n(int64(c.Interval())))
+	sc := &scheduledCheck{
+		check: c,
+		next:  time.Now().Add(offset),
+	}
+	mm.checks[key] = sc
+	heap.Push(&mm.queue, sc)
+	mm.notify()
+	mm.logger.Infow("Scheduled check",
+		"check_id", key.checkID,
+		"check_type", key.checkType,
+		"next", sc.next)
+	return nil
+}
+
+// remove the check and wait for a running run to finish
+func (mm *memoryManager) remove(key checkKey) error {
+	mm.mutex.Lock()
+	sc, ok := mm.checks[key]
+	if !ok {
+		mm.mutex.Unlock()
+		mm.logger.Errorw("key do not exist in storage", "key", key)
+		return fmt.Errorf("key do not exist, %v", key)
+	}
+	sc.removed = true
+	if sc.index >= 0 {
+		heap.Remove(&mm.queue, sc.index)
+	}
+	delete(mm.checks, key)
+	mm.mutex.Unlock()
+
+	sc.running.Wait()
 	return nil
 }
 
@@ -131,17 +301,12 @@ func (mm *memoryManager) stop(c check) error {
 		checkID:   c.CheckID(),
 		checkType: c.CheckType(),
 	}
-	mm.storageMutex.Lock()
-	defer mm.storageMutex.Unlock()
-	mr, ok := mm.storage[key]
-	if !ok {
-		mm.logger.Errorw("key do not exist in storage", "key", key)
-		return fmt.Errorf("key do not exist, %v", key)
+	if err := mm.remove(key); err != nil {
+		return err
 	}
-
-	mr.stop()
-	mr.wait()
-	delete(mm.storage, key)
+	mm.logger.Infow("Stopped check",
+		"check_id", key.checkID,
+		"check_type", key.checkType)
 	return nil
 }
 
@@ -150,35 +315,115 @@ func (mm *memoryManager) update(c check) error {
 		checkID:   c.CheckID(),
 		checkType: c.CheckType(),
 	}
-	mm.storageMutex.Lock()
-	defer mm.storageMutex.Unlock()
-	mr, ok := mm.storage[key]
-	if !ok {
-		mm.logger.Errorw("key do not exist in storage", "key", key)
-		return fmt.Errorf("key do not exist, %v", key)
+	if err := mm.remove(key); err != nil {
+		return err
+	}
+	return mm.start(c)
+}
+
+// reconcileReport lists the checks changed by a reconciliation
+type reconcileReport struct {
+	Added   []checkKey
+	Removed []checkKey
+	Updated []checkKey
+	// Running is the number of running checks afterwards
+	Running int
+}
+
+// empty returns, if nothing changed
+func (r *reconcileReport) empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Updated) == 0
+}
+
+// running returns, if the check is running
+func (mm *memoryManager) running(key checkKey) bool {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	_, ok := mm.checks[key]
+	return ok
+}
+
+func unmarshalCheckRefs(keys []checkKey) []*proto.CheckRef {
+	refs := make([]*proto.CheckRef, len(keys))
+	for i, key := range keys {
+		refs[i] = &proto.CheckRef{Id: key.checkID, Type: key.checkType}
 	}
+	return refs
+}
 
-	mr.stop()
-	mr.wait()
-	delete(mm.storage, key)
+func unmarshalReconcileReport(r *reconcileReport, t time.Time) (*proto.ReconcileReport, error) {
+	timestamp, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp %v, %w", t, err)
+	}
+	return &proto.ReconcileReport{
+		Timestamp: timestamp,
+		Added:     unmarshalCheckRefs(r.Added),
+		Removed:   unmarshalCheckRefs(r.Removed),
+		Updated:   unmarshalCheckRefs(r.Updated),
+		Running:   int64(r.Running),
+	}, nil
+}
 
-	mm.storage[key] = newMemoryRunner(mm.interval, mm.logger, c)
-	mm.storage[key].start()
+// reconcileOne starts, stops or restarts the check, so that it runs with
+// the configuration of c. A nil c means, that the check should not run.
+func (mm *memoryManager) reconcileOne(key checkKey, c check, report *reconcileReport) {
+	mm.mutex.Lock()
+	sc, running := mm.checks[key]
+	changed := running && c != nil && !reflect.DeepEqual(sc.check.Config(), c.Config())
+	mm.mutex.Unlock()
 
-	return nil
+	switch {
+	case running && c == nil:
+		if mm.remove(key) == nil {
+			report.Removed = append(report.Removed, key)
+		}
+	case !running && c != nil:
+		if mm.start(c) == nil {
+			report.Added = append(report.Added, key)
+		}
+	case changed:
+		if mm.update(c) == nil {
+			report.Updated = append(report.Updated, key)
+		}
+	}
 }
 
-func (mm *memoryManager) stopAll() error {
-	mm.logger.Info("Stopping all memory runner")
-	for _, v := range mm.storage {
-		v.stop()
+// reconcile runs exactly the wanted checks with their current configuration
+func (mm *memoryManager) reconcile(wanted map[checkKey]check) *reconcileReport {
+	mm.mutex.Lock()
+	keys := make([]checkKey, 0, len(mm.checks))
+	for key := range mm.checks {
+		if _, ok := wanted[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	mm.mutex.Unlock()
+	for key := range wanted {
+		keys = append(keys, key)
 	}
 
-	mm.logger.Info("Waiting for memory runner to stop")
-	for k, v := range mm.storage {
-		v.wait()
-		delete(mm.storage, k)
+	report := &reconcileReport{}
+	for _, key := range keys {
+		mm.reconcileOne(key, wanted[key], report)
 	}
-	mm.logger.Info("Stopped all memory runner")
+
+	mm.mutex.Lock()
+	report.Running = len(mm.checks)
+	mm.mutex.Unlock()
+	return report
+}
+
+// stopAll stops the scheduler and the workers and waits for running checks
+func (mm *memoryManager) stopAll() error {
+	mm.logger.Info("Stopping scheduler and workers")
+	close(mm.stopped)
+	mm.wg.Wait()
+
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	mm.checks = make(map[checkKey]*scheduledCheck)
+	mm.queue = nil
+	mm.logger.Info("Stopped scheduler and workers")
 	return nil
 }
@@ -0,0 +1,143 @@
+package checkmanager
+
+import (
+	"container/heap"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNextRun(t *testing.T) {
+	scheduled := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		interval time.Duration
+		now      time.Duration
+		next     time.Duration
+		skipped  int64
+	}{
+		{name: "early", interval: time.Minute, now: 0, next: time.Minute},
+		{name: "on time", interval: time.Minute, now: 30 * time.Second, next: time.Minute},
+		{name: "due", interval: time.Minute, now: time.Minute, next: 2 * time.Minute, skipped: 1},
+		{name: "late", interval: time.Minute, now: 90 * time.Second, next: 2 * time.Minute, skipped: 1},
+		{name: "very late", interval: time.Minute, now: 210 * time.Second, next: 4 * time.Minute, skipped: 3},
+		{name: "long interval", interval: time.Hour, now: 59 * time.Minute, next: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, skipped := nextRun(scheduled, tt.interval, scheduled.Add(tt.now))
+			if !next.Equal(scheduled.Add(tt.next)) {
+				t.Errorf("next run %v, expected %v", next.Sub(scheduled), tt.next)
+			}
+			if skipped != tt.skipped {
+				t.Errorf("skipped %v, expected %v", skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestCheckQueue(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	tests := []struct {
+		name string
+		// next runs of the pushed checks
+		next []int
+		// remove the check pushed at this position, if not negative
+		remove int
+		// order in which the checks are popped by their next runs
+		want []int
+	}{
+		{name: "empty", remove: -1},
+		{name: "ordered", next: []int{1, 2, 3}, remove: -1, want: []int{1, 2, 3}},
+		{name: "reversed", next: []int{30, 20, 10, 5}, remove: -1, want: []int{5, 10, 20, 30}},
+		{name: "duplicates", next: []int{2, 1, 2, 1}, remove: -1, want: []int{1, 1, 2, 2}},
+		{name: "remove earliest", next: []int{4, 1, 3, 2}, remove: 1, want: []int{2, 3, 4}},
+		{name: "remove latest", next: []int{4, 1, 3, 2}, remove: 0, want: []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := checkQueue{}
+			pushed := []*scheduledCheck{}
+			for _, n := range tt.next {
+				sc := &scheduledCheck{next: at(n)}
+				pushed = append(pushed, sc)
+				heap.Push(&q, sc)
+			}
+			for i, sc := range q {
+				if sc.index != i {
+					t.Fatalf("index %v at position %v", sc.index, i)
+				}
+			}
+			if tt.remove >= 0 {
+				sc := pushed[tt.remove]
+				heap.Remove(&q, sc.index)
+				if sc.index != -1 {
+					t.Errorf("index %v of removed check, expected -1", sc.index)
+				}
+			}
+			got := []int{}
+			for q.Len() > 0 {
+				sc := heap.Pop(&q).(*scheduledCheck)
+				if sc.index != -1 {
+					t.Errorf("index %v of popped check, expected -1", sc.index)
+				}
+				got = append(got, int(sc.next.Sub(start)/time.Second))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("popped %v, expected %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("popped %v, expected %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// blockingCheck signals the start of its run and finishes after a delay
+type blockingCheck struct {
+	started  chan struct{}
+	finished int32
+}
+
+func (c *blockingCheck) CheckID() int64          { return 1 }
+func (c *blockingCheck) CheckType() string       { return "http" }
+func (c *blockingCheck) UserID() int64           { return 1 }
+func (c *blockingCheck) Enabled() bool           { return true }
+func (c *blockingCheck) Interval() time.Duration { return time.Hour }
+func (c *blockingCheck) Config() interface{}     { return nil }
+
+func (c *blockingCheck) DoCheck(ctx context.Context, t time.Time) error {
+	close(c.started)
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&c.finished, 1)
+	return nil
+}
+
+func TestStopAllWaitsForRunningChecks(t *testing.T) {
+	mm := newMemoryManager(zap.NewNop().Sugar(), 1)
+	c := &blockingCheck{started: make(chan struct{})}
+	if err := mm.start(c); err != nil {
+		t.Fatalf("unable to start check, %v", err)
+	}
+	// Run the check right away instead of at its random offset
+	mm.mutex.Lock()
+	mm.checks[checkKey{checkID: 1, checkType: "http"}].next = time.Now()
+	heap.Init(&mm.queue)
+	mm.mutex.Unlock()
+	mm.notify()
+
+	<-c.started
+	if err := mm.stopAll(); err != nil {
+		t.Fatalf("unable to stop, %v", err)
+	}
+	if atomic.LoadInt32(&c.finished) != 1 {
+		t.Error("stopped before the running check finished")
+	}
+}
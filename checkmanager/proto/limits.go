@@ -0,0 +1,17 @@
+package proto
+
+import "time"
+
+// Limits of the schedule of polled checks, which are enforced by the
+// checkmanager and respected by the clients preparing checks, like the
+// importer.
+const (
+	MinInterval = 10 * time.Second
+	MaxInterval = 24 * time.Hour
+	MinTimeout  = time.Second
+	MaxTimeout  = time.Minute
+)
+
+// MinHeartbeatPeriod is the minimal period between two pings of a heartbeat
+// check
+const MinHeartbeatPeriod = time.Minute
@@ -2,7 +2,10 @@ package checkmanager
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
@@ -17,13 +20,127 @@ type repository interface {
 	CreateHTTPCheck(ctx context.Context, c *httpCheck) (int64, error)
 	UpdateHTTPCheck(ctx context.Context, c *httpCheck) error
 	DeleteHTTPCheck(ctx context.Context, id int64) error
-	GetHTTPResults(ctx context.Context, id int64) (*[]httpResult, error)
+	GetHTTPResults(ctx context.Context, q *resultQuery) (*[]httpResult, error)
 	CreateHTTPResult(ctx context.Context, r *httpResult) (int64, error)
+
+	GetTLSChecks(ctx context.Context) (*[]tlsCheck, error)
+	GetTLSCheck(ctx context.Context, id int64) (*tlsCheck, error)
+	GetTLSChecksByUser(ctx context.Context, id int64) (*[]tlsCheck, error)
+	CreateTLSCheck(ctx context.Context, c *tlsCheck) (int64, error)
+	UpdateTLSCheck(ctx context.Context, c *tlsCheck) error
+	DeleteTLSCheck(ctx context.Context, id int64) error
+	GetTLSResults(ctx context.Context, q *resultQuery) (*[]tlsResult, error)
+	CreateTLSResult(ctx context.Context, r *tlsResult) (int64, error)
+
+	GetTCPChecks(ctx context.Context) (*[]tcpCheck, error)
+	GetTCPCheck(ctx context.Context, id int64) (*tcpCheck, error)
+	GetTCPChecksByUser(ctx context.Context, id int64) (*[]tcpCheck, error)
+	CreateTCPCheck(ctx context.Context, c *tcpCheck) (int64, error)
+	UpdateTCPCheck(ctx context.Context, c *tcpCheck) error
+	DeleteTCPCheck(ctx context.Context, id int64) error
+	GetTCPResults(ctx context.Context, q *resultQuery) (*[]tcpResult, error)
+	CreateTCPResult(ctx context.Context, r *tcpResult) (int64, error)
+
+	GetDNSChecks(ctx context.Context) (*[]dnsCheck, error)
+	GetDNSCheck(ctx context.Context, id int64) (*dnsCheck, error)
+	GetDNSChecksByUser(ctx context.Context, id int64) (*[]dnsCheck, error)
+	CreateDNSCheck(ctx context.Context, c *dnsCheck) (int64, error)
+	UpdateDNSCheck(ctx context.Context, c *dnsCheck) error
+	DeleteDNSCheck(ctx context.Context, id int64) error
+	GetDNSResults(ctx context.Context, q *resultQuery) (*[]dnsResult, error)
+	CreateDNSResult(ctx context.Context, r *dnsResult) (int64, error)
+
+	GetHeartbeatChecks(ctx context.Context) (*[]heartbeatCheck, error)
+	GetHeartbeatCheck(ctx context.Context, id int64) (*heartbeatCheck, error)
+	GetHeartbeatCheckByToken(ctx context.Context, token string) (*heartbeatCheck, error)
+	GetHeartbeatChecksByUser(ctx context.Context, id int64) (*[]heartbeatCheck, error)
+	CreateHeartbeatCheck(ctx context.Context, c *heartbeatCheck) (int64, error)
+	UpdateHeartbeatCheck(ctx context.Context, c *heartbeatCheck) error
+	DeleteHeartbeatCheck(ctx context.Context, id int64) error
+	GetHeartbeatResults(ctx context.Context, q *resultQuery) (*[]heartbeatResult, error)
+	GetLastHeartbeatResult(ctx context.Context, id int64) (*heartbeatResult, error)
+	CreateHeartbeatResult(ctx context.Context, r *heartbeatResult) (int64, error)
+
+	SetCheckEnabled(ctx context.Context, id int64, checkType string, enabled bool) error
+
+	// WithTransaction runs fn with a repository, whose changes are committed
+	// together, if fn succeeds
+	WithTransaction(ctx context.Context, fn func(db repository) error) error
+
+	GetCheckState(ctx context.Context, id int64, checkType string) (*checkState, error)
+	CreateCheckState(ctx context.Context, cs *checkState) error
+	LockCheckState(ctx context.Context, id int64, checkType string) (*checkState, error)
+	UpdateCheckState(ctx context.Context, cs *checkState) error
+	DeleteCheckState(ctx context.Context, id int64, checkType string) error
+
+	GetDependencies(ctx context.Context, id int64, checkType string) (*[]dependency, error)
+	GetDependenciesByUser(ctx context.Context, id int64) (*[]dependency, error)
+	SetDependencies(ctx context.Context, userID int64, key checkKey, parents []checkKey) error
+	DeleteDependencies(ctx context.Context, id int64, checkType string) error
+	GetParentCheckStates(ctx context.Context, id int64, checkType string) (*[]checkState, error)
+
+	GetLabels(ctx context.Context, id int64, checkType string) (*[]label, error)
+	GetLabelsByUser(ctx context.Context, id int64) (*[]label, error)
+	GetGroups(ctx context.Context, id int64, checkType string) (*[]groupMember, error)
+	GetGroupsByUser(ctx context.Context, id int64) (*[]groupMember, error)
+	SetLabels(ctx context.Context, userID int64, key checkKey, labels map[string]string, groups []string) error
+	DeleteLabels(ctx context.Context, id int64, checkType string) error
+
+	GetResultSamples(ctx context.Context, id int64, checkType string, from time.Time, to time.Time) (*[]resultSample, error)
+	GetResultSamplesByType(ctx context.Context, checkType string, from time.Time, to time.Time) (*[]resultSample, error)
+	GetFirstResultTimestamp(ctx context.Context, checkType string) (time.Time, error)
+	PurgeResults(ctx context.Context, checkType string, before time.Time, limit int64) (int64, error)
+
+	GetRollups(ctx context.Context, q *rollupQuery) (*[]rollup, error)
+	GetRollupsByType(ctx context.Context, resolution string, checkType string, from time.Time, to time.Time) (*[]rollup, error)
+	GetFirstRollupBucket(ctx context.Context, resolution string, checkType string) (time.Time, error)
+	CreateRollup(ctx context.Context, resolution string, r *rollup) error
+	PurgeRollups(ctx context.Context, resolution string, checkType string, before time.Time, limit int64) (int64, error)
+	DeleteRollups(ctx context.Context, id int64, checkType string) error
+	GetRollupProgress(ctx context.Context, resolution string, checkType string) (time.Time, error)
+	UpdateRollupProgress(ctx context.Context, resolution string, checkType string, t time.Time) error
+
+	UpdateReplica(ctx context.Context, id string, heartbeat time.Time) error
+	CountReplicas(ctx context.Context, since time.Time) (int64, error)
+	InitShardLeases(ctx context.Context, shards int) error
+	GetFreeShards(ctx context.Context, now time.Time) ([]int, error)
+	AcquireShardLease(ctx context.Context, shard int, owner string, expires time.Time, now time.Time) (bool, error)
+	RenewShardLease(ctx context.Context, shard int, owner string, expires time.Time) (bool, error)
+	ReleaseShardLease(ctx context.Context, shard int, owner string) error
+
+	UpdateWorker(ctx context.Context, w *worker) error
+	GetWorkers(ctx context.Context, since time.Time) (*[]worker, error)
+
+	GetAgent(ctx context.Context, id int64) (*agent, error)
+	GetAgentByToken(ctx context.Context, token string) (*agent, error)
+	GetAgentsByUser(ctx context.Context, id int64) (*[]agent, error)
+	CreateAgent(ctx context.Context, a *agent) (int64, error)
+	DeleteAgent(ctx context.Context, id int64) error
+	UpdateAgentSeen(ctx context.Context, id int64, t time.Time) error
+
+	GetMaintenanceWindows(ctx context.Context) (*[]maintenanceWindow, error)
+	GetMaintenanceWindow(ctx context.Context, id int64) (*maintenanceWindow, error)
+	GetMaintenanceWindowsByUser(ctx context.Context, id int64) (*[]maintenanceWindow, error)
+	CreateMaintenanceWindow(ctx context.Context, w *maintenanceWindow) (int64, error)
+	UpdateMaintenanceWindow(ctx context.Context, w *maintenanceWindow) error
+	DeleteMaintenanceWindow(ctx context.Context, id int64) error
+	DeleteMaintenanceWindowsByCheck(ctx context.Context, id int64, checkType string) error
 }
 
 // sqlRepository fullfills the repository interface
 type sqlRepository struct {
-	db *sqlx.DB
+	// db is the database or the transaction the queries run in
+	db queryer
+	// conn is the database connection, nil within a transaction
+	conn *sqlx.DB
+}
+
+// queryer is implemented by the database and by transactions
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
 }
 
 // newSQLRepository returns a new repository
@@ -35,14 +152,44 @@ func newSQLRepository(dialect string, database string) (*sqlRepository, error) {
 		return res, err
 	}
 	res.db = db
+	res.conn = db
 	return res, nil
 }
 
+// transaction runs fn in a transaction, which is committed, if fn succeeds.
+// Within a transaction, fn joins the running one.
+func (s *sqlRepository) transaction(ctx context.Context, fn func(tx *sqlRepository) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	tx, err := s.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction, %w", err)
+	}
+	defer tx.Rollback()
+
+	err = fn(&sqlRepository{db: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTransaction runs fn with a repository, whose changes are committed
+// together, if fn succeeds
+func (s *sqlRepository) WithTransaction(ctx context.Context, fn func(db repository) error) error {
+	return s.transaction(ctx, func(tx *sqlRepository) error {
+		return fn(tx)
+	})
+}
+
 func (s *sqlRepository) GetHTTPChecks(ctx context.Context) (*[]httpCheck, error) {
 	c := &[]httpCheck{}
 	err := s.db.SelectContext(ctx, c,
 		`SELECT
-			id, user_id, url
+			id, user_id, url, method, headers, body, username, password,
+			bearer_token, assertions, check_interval, timeout, threshold,
+			locations, min_failed_locations, enabled
 		FROM
 			http_checks`)
 	if err != nil {
@@ -55,7 +202,9 @@ func (s *sqlRepository) GetHTTPCheck(ctx context.Context, id int64) (*httpCheck,
 	c := &httpCheck{}
 	err := s.db.GetContext(ctx, c,
 		`SELECT
-			id, user_id, url
+			id, user_id, url, method, headers, body, username, password,
+			bearer_token, assertions, check_interval, timeout, threshold,
+			locations, min_failed_locations, enabled
 		FROM
 			http_checks
 		WHERE
@@ -71,7 +220,9 @@ func (s *sqlRepository) GetHTTPChecksByUser(ctx context.Context, id int64) (*[]h
 	cs := &[]httpCheck{}
 	err := s.db.SelectContext(ctx, cs,
 		`SELECT
-			id, user_id, url
+			id, user_id, url, method, headers, body, username, password,
+			bearer_token, assertions, check_interval, timeout, threshold,
+			locations, min_failed_locations, enabled
 		FROM
 			http_checks
 		WHERE
@@ -86,11 +237,15 @@ func (s *sqlRepository) GetHTTPChecksByUser(ctx context.Context, id int64) (*[]h
 func (s *sqlRepository) CreateHTTPCheck(ctx context.Context, c *httpCheck) (int64, error) {
 	r, err := s.db.ExecContext(ctx,
 		`INSERT INTO http_checks
-			(user_id, url)
-		VALUES (?, ?)`,
-		c.UserID, c.URL)
+			(user_id, url, method, headers, body, username, password,
+				bearer_token, assertions, check_interval, timeout, threshold,
+				locations, min_failed_locations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.URL, c.Method, c.Headers, c.Body, c.Username, c.Password,
+		c.BearerToken, c.Assertions, c.Interval, c.Timeout, c.Threshold,
+		c.Locations, c.MinFailedLocations)
 	if err != nil {
-		return 0, fmt.Errorf("unable to insert new check %v into database, %w", *c, err)
+		return 0, fmt.Errorf("unable to insert new check for url %v into database, %w", c.URL, err)
 	}
 	return r.LastInsertId()
 }
@@ -102,8 +257,14 @@ func (s *sqlRepository) UpdateHTTPCheck(ctx context.Context, c *httpCheck) error
 
 	_, err := s.db.ExecContext(ctx,
 		`UPDATE http_checks
-		SET url = ?
-		WHERE id = ?`, c.URL, c.ID)
+		SET url = ?, method = ?, headers = ?, body = ?, username = ?,
+			password = ?, bearer_token = ?, assertions = ?,
+			check_interval = ?, timeout = ?, threshold = ?, locations = ?,
+			min_failed_locations = ?
+		WHERE id = ?`,
+		c.URL, c.Method, c.Headers, c.Body, c.Username, c.Password,
+		c.BearerToken, c.Assertions, c.Interval, c.Timeout, c.Threshold,
+		c.Locations, c.MinFailedLocations, c.ID)
 	if err != nil {
 		return fmt.Errorf("unable to update check %v, %w", c.ID, err)
 	}
@@ -118,18 +279,21 @@ func (s *sqlRepository) DeleteHTTPCheck(ctx context.Context, id int64) error {
 	return err
 }
 
-func (s *sqlRepository) GetHTTPResults(ctx context.Context, id int64) (*[]httpResult, error) {
+func (s *sqlRepository) GetHTTPResults(ctx context.Context, q *resultQuery) (*[]httpResult, error) {
 	rs := &[]httpResult{}
+	where, args := q.sql()
 	err := s.db.SelectContext(ctx, rs,
 		`SELECT
-			id, timestamp, check_id, success, status_code, duration, error
+			id, timestamp, check_id, success, status_code, duration, error,
+			location, dns_lookup, tcp_connect, tls_handshake,
+			time_to_first_byte, content_transfer, remote_ip, protocol,
+			tls_version, maintenance
 		FROM
 			http_results
-		WHERE
-			check_id = ?`,
-		id)
+		`+where,
+		args...)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get http results for check %v, %w", id, err)
+		return nil, fmt.Errorf("Unable to get http results for check %v, %w", q.CheckID, err)
 	}
 	return rs, nil
 }
@@ -137,11 +301,1403 @@ func (s *sqlRepository) GetHTTPResults(ctx context.Context, id int64) (*[]httpRe
 func (s *sqlRepository) CreateHTTPResult(ctx context.Context, r *httpResult) (int64, error) {
 	o, err := s.db.ExecContext(ctx,
 		`INSERT INTO http_results
-			(timestamp, check_id, success, status_code, duration, error)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		r.Timestamp, r.CheckID, r.Success, r.StatusCode, r.Duration, r.Error)
+			(timestamp, check_id, success, status_code, duration, error,
+				location, dns_lookup, tcp_connect, tls_handshake,
+				time_to_first_byte, content_transfer, remote_ip, protocol,
+				tls_version, maintenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp, r.CheckID, r.Success, r.StatusCode, r.Duration, r.Error,
+		r.Location, r.DNSLookup, r.TCPConnect, r.TLSHandshake,
+		r.TimeToFirstByte, r.ContentTransfer, r.RemoteIP, r.Protocol,
+		r.TLSVersion, r.Maintenance)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new result %v into database, %w", *r, err)
+	}
+	return o.LastInsertId()
+}
+
+func (s *sqlRepository) GetTLSChecks(ctx context.Context) (*[]tlsCheck, error) {
+	c := &[]tlsCheck{}
+	err := s.db.SelectContext(ctx, c,
+		`SELECT
+			id, user_id, address, server_name, min_days_valid, check_interval,
+			timeout, threshold, locations, min_failed_locations, enabled
+		FROM
+			tls_checks`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get tls checks, %w", err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetTLSCheck(ctx context.Context, id int64) (*tlsCheck, error) {
+	c := &tlsCheck{}
+	err := s.db.GetContext(ctx, c,
+		`SELECT
+			id, user_id, address, server_name, min_days_valid, check_interval,
+			timeout, threshold, locations, min_failed_locations, enabled
+		FROM
+			tls_checks
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get tls check %v, %w", id, err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetTLSChecksByUser(ctx context.Context, id int64) (*[]tlsCheck, error) {
+	cs := &[]tlsCheck{}
+	err := s.db.SelectContext(ctx, cs,
+		`SELECT
+			id, user_id, address, server_name, min_days_valid, check_interval,
+			timeout, threshold, locations, min_failed_locations, enabled
+		FROM
+			tls_checks
+		WHERE
+			user_id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get tls checks from user %v, %w", id, err)
+	}
+	return cs, err
+}
+
+func (s *sqlRepository) CreateTLSCheck(ctx context.Context, c *tlsCheck) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO tls_checks
+			(user_id, address, server_name, min_days_valid, check_interval,
+				timeout, threshold, locations, min_failed_locations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.Address, c.ServerName, c.MinDaysValid, c.Interval,
+		c.Timeout, c.Threshold, c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new check %v into database, %w", *c, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) UpdateTLSCheck(ctx context.Context, c *tlsCheck) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tls_checks
+		SET address = ?, server_name = ?, min_days_valid = ?,
+			check_interval = ?, timeout = ?, threshold = ?, locations = ?,
+			min_failed_locations = ?
+		WHERE id = ?`,
+		c.Address, c.ServerName, c.MinDaysValid, c.Interval, c.Timeout,
+		c.Threshold, c.Locations, c.MinFailedLocations, c.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update check %v, %w", c.ID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteTLSCheck(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM tls_checks
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+func (s *sqlRepository) GetTLSResults(ctx context.Context, q *resultQuery) (*[]tlsResult, error) {
+	rs := &[]tlsResult{}
+	where, args := q.sql()
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			id, timestamp, check_id, success, duration, error, not_after,
+			issuer, location, maintenance
+		FROM
+			tls_results
+		`+where,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get tls results for check %v, %w", q.CheckID, err)
+	}
+	return rs, nil
+}
+
+func (s *sqlRepository) CreateTLSResult(ctx context.Context, r *tlsResult) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`INSERT INTO tls_results
+			(timestamp, check_id, success, duration, error, not_after, issuer,
+				location, maintenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp, r.CheckID, r.Success, r.Duration, r.Error, r.NotAfter,
+		r.Issuer, r.Location, r.Maintenance)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new result %v into database, %w", *r, err)
+	}
+	return o.LastInsertId()
+}
+
+func (s *sqlRepository) GetTCPChecks(ctx context.Context) (*[]tcpCheck, error) {
+	c := &[]tcpCheck{}
+	err := s.db.SelectContext(ctx, c,
+		`SELECT
+			id, user_id, address, timeout, payload, expect, check_interval,
+			threshold, locations, min_failed_locations, enabled
+		FROM
+			tcp_checks`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get tcp checks, %w", err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetTCPCheck(ctx context.Context, id int64) (*tcpCheck, error) {
+	c := &tcpCheck{}
+	err := s.db.GetContext(ctx, c,
+		`SELECT
+			id, user_id, address, timeout, payload, expect, check_interval,
+			threshold, locations, min_failed_locations, enabled
+		FROM
+			tcp_checks
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get tcp check %v, %w", id, err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetTCPChecksByUser(ctx context.Context, id int64) (*[]tcpCheck, error) {
+	cs := &[]tcpCheck{}
+	err := s.db.SelectContext(ctx, cs,
+		`SELECT
+			id, user_id, address, timeout, payload, expect, check_interval,
+			threshold, locations, min_failed_locations, enabled
+		FROM
+			tcp_checks
+		WHERE
+			user_id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get tcp checks from user %v, %w", id, err)
+	}
+	return cs, err
+}
+
+func (s *sqlRepository) CreateTCPCheck(ctx context.Context, c *tcpCheck) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO tcp_checks
+			(user_id, address, timeout, payload, expect, check_interval,
+				threshold, locations, min_failed_locations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.Address, c.Timeout, c.Payload, c.Expect, c.Interval,
+		c.Threshold, c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new check %v into database, %w", *c, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) UpdateTCPCheck(ctx context.Context, c *tcpCheck) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tcp_checks
+		SET address = ?, timeout = ?, payload = ?, expect = ?,
+			check_interval = ?, threshold = ?, locations = ?,
+			min_failed_locations = ?
+		WHERE id = ?`,
+		c.Address, c.Timeout, c.Payload, c.Expect, c.Interval, c.Threshold,
+		c.Locations, c.MinFailedLocations, c.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update check %v, %w", c.ID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteTCPCheck(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM tcp_checks
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+func (s *sqlRepository) GetTCPResults(ctx context.Context, q *resultQuery) (*[]tcpResult, error) {
+	rs := &[]tcpResult{}
+	where, args := q.sql()
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			id, timestamp, check_id, success, duration, error, response,
+			location, maintenance
+		FROM
+			tcp_results
+		`+where,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get tcp results for check %v, %w", q.CheckID, err)
+	}
+	return rs, nil
+}
+
+func (s *sqlRepository) CreateTCPResult(ctx context.Context, r *tcpResult) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`INSERT INTO tcp_results
+			(timestamp, check_id, success, duration, error, response,
+				location, maintenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp, r.CheckID, r.Success, r.Duration, r.Error, r.Response,
+		r.Location, r.Maintenance)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new result %v into database, %w", *r, err)
+	}
+	return o.LastInsertId()
+}
+
+func (s *sqlRepository) GetDNSChecks(ctx context.Context) (*[]dnsCheck, error) {
+	c := &[]dnsCheck{}
+	err := s.db.SelectContext(ctx, c,
+		`SELECT
+			id, user_id, name, record_type, resolver, timeout, expected,
+			min_ttl, max_ttl, rcode, check_interval, threshold, locations,
+			min_failed_locations, enabled
+		FROM
+			dns_checks`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get dns checks, %w", err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetDNSCheck(ctx context.Context, id int64) (*dnsCheck, error) {
+	c := &dnsCheck{}
+	err := s.db.GetContext(ctx, c,
+		`SELECT
+			id, user_id, name, record_type, resolver, timeout, expected,
+			min_ttl, max_ttl, rcode, check_interval, threshold, locations,
+			min_failed_locations, enabled
+		FROM
+			dns_checks
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get dns check %v, %w", id, err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetDNSChecksByUser(ctx context.Context, id int64) (*[]dnsCheck, error) {
+	cs := &[]dnsCheck{}
+	err := s.db.SelectContext(ctx, cs,
+		`SELECT
+			id, user_id, name, record_type, resolver, timeout, expected,
+			min_ttl, max_ttl, rcode, check_interval, threshold, locations,
+			min_failed_locations, enabled
+		FROM
+			dns_checks
+		WHERE
+			user_id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get dns checks from user %v, %w", id, err)
+	}
+	return cs, err
+}
+
+func (s *sqlRepository) CreateDNSCheck(ctx context.Context, c *dnsCheck) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO dns_checks
+			(user_id, name, record_type, resolver, timeout, expected, min_ttl,
+				max_ttl, rcode, check_interval, threshold, locations,
+				min_failed_locations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.Name, c.RecordType, c.Resolver, c.Timeout, c.Expected,
+		c.MinTTL, c.MaxTTL, c.RCode, c.Interval, c.Threshold, c.Locations,
+		c.MinFailedLocations)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new check %v into database, %w", *c, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) UpdateDNSCheck(ctx context.Context, c *dnsCheck) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE dns_checks
+		SET name = ?, record_type = ?, resolver = ?, timeout = ?,
+			expected = ?, min_ttl = ?, max_ttl = ?, rcode = ?,
+			check_interval = ?, threshold = ?, locations = ?,
+			min_failed_locations = ?
+		WHERE id = ?`,
+		c.Name, c.RecordType, c.Resolver, c.Timeout, c.Expected, c.MinTTL,
+		c.MaxTTL, c.RCode, c.Interval, c.Threshold, c.Locations,
+		c.MinFailedLocations, c.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update check %v, %w", c.ID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteDNSCheck(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM dns_checks
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+func (s *sqlRepository) GetDNSResults(ctx context.Context, q *resultQuery) (*[]dnsResult, error) {
+	rs := &[]dnsResult{}
+	where, args := q.sql()
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			id, timestamp, check_id, success, duration, error, rcode, answers,
+			location, maintenance
+		FROM
+			dns_results
+		`+where,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get dns results for check %v, %w", q.CheckID, err)
+	}
+	return rs, nil
+}
+
+func (s *sqlRepository) CreateDNSResult(ctx context.Context, r *dnsResult) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`INSERT INTO dns_results
+			(timestamp, check_id, success, duration, error, rcode, answers,
+				location, maintenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp, r.CheckID, r.Success, r.Duration, r.Error, r.RCode,
+		r.Answers, r.Location, r.Maintenance)
 	if err != nil {
 		return 0, fmt.Errorf("unable to insert new result %v into database, %w", *r, err)
 	}
 	return o.LastInsertId()
 }
+
+func (s *sqlRepository) GetHeartbeatChecks(ctx context.Context) (*[]heartbeatCheck, error) {
+	c := &[]heartbeatCheck{}
+	err := s.db.SelectContext(ctx, c,
+		`SELECT
+			id, user_id, token, period, grace, enabled
+		FROM
+			heartbeat_checks`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get heartbeat checks, %w", err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetHeartbeatCheck(ctx context.Context, id int64) (*heartbeatCheck, error) {
+	c := &heartbeatCheck{}
+	err := s.db.GetContext(ctx, c,
+		`SELECT
+			id, user_id, token, period, grace, enabled
+		FROM
+			heartbeat_checks
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get heartbeat check %v, %w", id, err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetHeartbeatCheckByToken(ctx context.Context, token string) (*heartbeatCheck, error) {
+	c := &heartbeatCheck{}
+	err := s.db.GetContext(ctx, c,
+		`SELECT
+			id, user_id, token, period, grace, enabled
+		FROM
+			heartbeat_checks
+		WHERE
+			token = ?`,
+		token)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get heartbeat check by token, %w", err)
+	}
+	return c, nil
+}
+
+func (s *sqlRepository) GetHeartbeatChecksByUser(ctx context.Context, id int64) (*[]heartbeatCheck, error) {
+	cs := &[]heartbeatCheck{}
+	err := s.db.SelectContext(ctx, cs,
+		`SELECT
+			id, user_id, token, period, grace, enabled
+		FROM
+			heartbeat_checks
+		WHERE
+			user_id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get heartbeat checks from user %v, %w", id, err)
+	}
+	return cs, err
+}
+
+func (s *sqlRepository) CreateHeartbeatCheck(ctx context.Context, c *heartbeatCheck) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO heartbeat_checks
+			(user_id, token, period, grace)
+		VALUES (?, ?, ?, ?)`,
+		c.UserID, c.Token, c.Period, c.Grace)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new check for user %v into database, %w", c.UserID, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) UpdateHeartbeatCheck(ctx context.Context, c *heartbeatCheck) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE heartbeat_checks
+		SET period = ?, grace = ?
+		WHERE id = ?`,
+		c.Period, c.Grace, c.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update check %v, %w", c.ID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteHeartbeatCheck(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM heartbeat_checks
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+func (s *sqlRepository) GetHeartbeatResults(ctx context.Context, q *resultQuery) (*[]heartbeatResult, error) {
+	rs := &[]heartbeatResult{}
+	where, args := q.sql()
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			id, timestamp, check_id, kind, success, duration, message,
+			maintenance
+		FROM
+			heartbeat_results
+		`+where,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get heartbeat results for check %v, %w", q.CheckID, err)
+	}
+	return rs, nil
+}
+
+// GetLastHeartbeatResult returns the newest result of the check or nil, if
+// there is none.
+func (s *sqlRepository) GetLastHeartbeatResult(ctx context.Context, id int64) (*heartbeatResult, error) {
+	r := &heartbeatResult{}
+	err := s.db.GetContext(ctx, r,
+		`SELECT
+			id, timestamp, check_id, kind, success, duration, message,
+			maintenance
+		FROM
+			heartbeat_results
+		WHERE
+			check_id = ?
+		ORDER BY timestamp DESC, id DESC
+		LIMIT 1`,
+		id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get last heartbeat result for check %v, %w", id, err)
+	}
+	return r, nil
+}
+
+func (s *sqlRepository) CreateHeartbeatResult(ctx context.Context, r *heartbeatResult) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`INSERT INTO heartbeat_results
+			(timestamp, check_id, kind, success, duration, message,
+				maintenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp, r.CheckID, r.Kind, r.Success, r.Duration, r.Message,
+		r.Maintenance)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new result %v into database, %w", *r, err)
+	}
+	return o.LastInsertId()
+}
+
+// SetCheckEnabled pauses or resumes the check
+func (s *sqlRepository) SetCheckEnabled(ctx context.Context, id int64, checkType string, enabled bool) error {
+	switch checkType {
+	case "http", "tls", "tcp", "dns", "heartbeat":
+	default:
+		return fmt.Errorf("unknown check type %v", checkType)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE `+checkType+`_checks
+		SET enabled = ?
+		WHERE id = ?`,
+		enabled, id)
+	if err != nil {
+		return fmt.Errorf("unable to set enabled of %v check %v, %w", checkType, id, err)
+	}
+	return nil
+}
+
+// GetCheckState returns the state of the check or an unknown state, if the
+// check has none yet.
+func (s *sqlRepository) GetCheckState(ctx context.Context, id int64, checkType string) (*checkState, error) {
+	cs := &checkState{}
+	err := s.db.GetContext(ctx, cs,
+		`SELECT
+			check_id, check_type, state, failures, changed, updated,
+			suppressed, unreachable, history, flapping
+		FROM
+			check_states
+		WHERE
+			check_id = ?
+			AND check_type = ?`,
+		id, checkType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &checkState{
+			CheckID:   id,
+			CheckType: checkType,
+			State:     stateUnknown,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get state of %v check %v, %w", checkType, id, err)
+	}
+	return cs, nil
+}
+
+// CreateCheckState stores the state, if the check has none yet
+func (s *sqlRepository) CreateCheckState(ctx context.Context, cs *checkState) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT IGNORE INTO check_states
+			(check_id, check_type, state, failures, changed, updated,
+				suppressed, unreachable, history, flapping)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cs.CheckID, cs.CheckType, cs.State, cs.Failures, cs.Changed, cs.Updated,
+		cs.Suppressed, cs.Unreachable, cs.History, cs.Flapping)
+	if err != nil {
+		return fmt.Errorf("unable to create state of %v check %v, %w", cs.CheckType, cs.CheckID, err)
+	}
+	return nil
+}
+
+// LockCheckState returns the state of the check and locks it until the end
+// of the transaction
+func (s *sqlRepository) LockCheckState(ctx context.Context, id int64, checkType string) (*checkState, error) {
+	cs := &checkState{}
+	err := s.db.GetContext(ctx, cs,
+		`SELECT
+			check_id, check_type, state, failures, changed, updated,
+			suppressed, unreachable, history, flapping
+		FROM
+			check_states
+		WHERE
+			check_id = ?
+			AND check_type = ?
+		FOR UPDATE`,
+		id, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock state of %v check %v, %w", checkType, id, err)
+	}
+	return cs, nil
+}
+
+func (s *sqlRepository) UpdateCheckState(ctx context.Context, cs *checkState) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO check_states
+			(check_id, check_type, state, failures, changed, updated,
+				suppressed, unreachable, history, flapping)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			state = VALUES(state), failures = VALUES(failures),
+			changed = VALUES(changed), updated = VALUES(updated),
+			suppressed = VALUES(suppressed), unreachable = VALUES(unreachable),
+			history = VALUES(history), flapping = VALUES(flapping)`,
+		cs.CheckID, cs.CheckType, cs.State, cs.Failures, cs.Changed, cs.Updated,
+		cs.Suppressed, cs.Unreachable, cs.History, cs.Flapping)
+	if err != nil {
+		return fmt.Errorf("unable to update state of %v check %v, %w", cs.CheckType, cs.CheckID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteCheckState(ctx context.Context, id int64, checkType string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM check_states
+		WHERE check_id = ? AND check_type = ?`,
+		id, checkType)
+	return err
+}
+
+// GetDependencies returns the dependencies of the check on its parents and
+// of its children on it
+func (s *sqlRepository) GetDependencies(ctx context.Context, id int64, checkType string) (*[]dependency, error) {
+	ds := &[]dependency{}
+	err := s.db.SelectContext(ctx, ds,
+		`SELECT
+			user_id, check_id, check_type, parent_id, parent_type
+		FROM
+			check_dependencies
+		WHERE
+			(check_id = ? AND check_type = ?)
+			OR (parent_id = ? AND parent_type = ?)`,
+		id, checkType, id, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get dependencies of %v check %v, %w", checkType, id, err)
+	}
+	return ds, nil
+}
+
+func (s *sqlRepository) GetDependenciesByUser(ctx context.Context, id int64) (*[]dependency, error) {
+	ds := &[]dependency{}
+	err := s.db.SelectContext(ctx, ds,
+		`SELECT
+			user_id, check_id, check_type, parent_id, parent_type
+		FROM
+			check_dependencies
+		WHERE
+			user_id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get dependencies from user %v, %w", id, err)
+	}
+	return ds, nil
+}
+
+// SetDependencies replaces the parents of the check
+func (s *sqlRepository) SetDependencies(ctx context.Context, userID int64, key checkKey, parents []checkKey) error {
+	return s.transaction(ctx, func(tx *sqlRepository) error {
+		_, err := tx.db.ExecContext(ctx,
+			`DELETE FROM check_dependencies
+			WHERE check_id = ? AND check_type = ?`,
+			key.checkID, key.checkType)
+		if err != nil {
+			return fmt.Errorf("unable to delete dependencies of %v check %v, %w", key.checkType, key.checkID, err)
+		}
+		for _, parent := range parents {
+			_, err = tx.db.ExecContext(ctx,
+				`INSERT INTO check_dependencies
+					(user_id, check_id, check_type, parent_id, parent_type)
+				VALUES (?, ?, ?, ?, ?)`,
+				userID, key.checkID, key.checkType, parent.checkID, parent.checkType)
+			if err != nil {
+				return fmt.Errorf("unable to insert dependency of %v check %v, %w", key.checkType, key.checkID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteDependencies deletes the dependencies of a deleted check on its
+// parents and of its children on it
+func (s *sqlRepository) DeleteDependencies(ctx context.Context, id int64, checkType string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM check_dependencies
+		WHERE (check_id = ? AND check_type = ?)
+			OR (parent_id = ? AND parent_type = ?)`,
+		id, checkType, id, checkType)
+	return err
+}
+
+// GetParentCheckStates returns the states of the parents of the check.
+// Parents without state are skipped.
+func (s *sqlRepository) GetParentCheckStates(ctx context.Context, id int64, checkType string) (*[]checkState, error) {
+	states := &[]checkState{}
+	err := s.db.SelectContext(ctx, states,
+		`SELECT
+			s.check_id, s.check_type, s.state, s.failures, s.changed,
+			s.updated, s.suppressed, s.unreachable, s.history, s.flapping
+		FROM
+			check_dependencies d
+			JOIN check_states s
+				ON s.check_id = d.parent_id AND s.check_type = d.parent_type
+		WHERE
+			d.check_id = ?
+			AND d.check_type = ?`,
+		id, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get parent states of %v check %v, %w", checkType, id, err)
+	}
+	return states, nil
+}
+
+func (s *sqlRepository) GetLabels(ctx context.Context, id int64, checkType string) (*[]label, error) {
+	ls := &[]label{}
+	err := s.db.SelectContext(ctx, ls,
+		`SELECT
+			user_id, check_id, check_type, name, value
+		FROM
+			check_labels
+		WHERE
+			check_id = ?
+			AND check_type = ?`,
+		id, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get labels of %v check %v, %w", checkType, id, err)
+	}
+	return ls, nil
+}
+
+func (s *sqlRepository) GetLabelsByUser(ctx context.Context, id int64) (*[]label, error) {
+	ls := &[]label{}
+	err := s.db.SelectContext(ctx, ls,
+		`SELECT
+			user_id, check_id, check_type, name, value
+		FROM
+			check_labels
+		WHERE
+			user_id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get labels of user %v, %w", id, err)
+	}
+	return ls, nil
+}
+
+func (s *sqlRepository) GetGroups(ctx context.Context, id int64, checkType string) (*[]groupMember, error) {
+	gs := &[]groupMember{}
+	err := s.db.SelectContext(ctx, gs,
+		`SELECT
+			user_id, check_id, check_type, name
+		FROM
+			check_groups
+		WHERE
+			check_id = ?
+			AND check_type = ?`,
+		id, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get groups of %v check %v, %w", checkType, id, err)
+	}
+	return gs, nil
+}
+
+func (s *sqlRepository) GetGroupsByUser(ctx context.Context, id int64) (*[]groupMember, error) {
+	gs := &[]groupMember{}
+	err := s.db.SelectContext(ctx, gs,
+		`SELECT
+			user_id, check_id, check_type, name
+		FROM
+			check_groups
+		WHERE
+			user_id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get groups of user %v, %w", id, err)
+	}
+	return gs, nil
+}
+
+// SetLabels replaces the labels and groups of the check
+func (s *sqlRepository) SetLabels(ctx context.Context, userID int64, key checkKey, labels map[string]string, groups []string) error {
+	return s.transaction(ctx, func(tx *sqlRepository) error {
+		_, err := tx.db.ExecContext(ctx,
+			`DELETE FROM check_labels
+			WHERE check_id = ? AND check_type = ?`,
+			key.checkID, key.checkType)
+		if err != nil {
+			return fmt.Errorf("unable to delete labels of %v check %v, %w", key.checkType, key.checkID, err)
+		}
+		_, err = tx.db.ExecContext(ctx,
+			`DELETE FROM check_groups
+			WHERE check_id = ? AND check_type = ?`,
+			key.checkID, key.checkType)
+		if err != nil {
+			return fmt.Errorf("unable to delete groups of %v check %v, %w", key.checkType, key.checkID, err)
+		}
+		for name, value := range labels {
+			_, err = tx.db.ExecContext(ctx,
+				`INSERT INTO check_labels
+					(user_id, check_id, check_type, name, value)
+				VALUES (?, ?, ?, ?, ?)`,
+				userID, key.checkID, key.checkType, name, value)
+			if err != nil {
+				return fmt.Errorf("unable to insert label of %v check %v, %w", key.checkType, key.checkID, err)
+			}
+		}
+		for _, group := range groups {
+			_, err = tx.db.ExecContext(ctx,
+				`INSERT INTO check_groups
+					(user_id, check_id, check_type, name)
+				VALUES (?, ?, ?, ?)`,
+				userID, key.checkID, key.checkType, group)
+			if err != nil {
+				return fmt.Errorf("unable to insert group of %v check %v, %w", key.checkType, key.checkID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlRepository) DeleteLabels(ctx context.Context, id int64, checkType string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM check_labels
+		WHERE check_id = ? AND check_type = ?`,
+		id, checkType)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`DELETE FROM check_groups
+		WHERE check_id = ? AND check_type = ?`,
+		id, checkType)
+	return err
+}
+
+// resultSamplesQuery returns the query for the results of a check type in a
+// time range together with the minimum of failed locations of their check.
+// Start pings of heartbeat checks are no runs and skipped.
+func resultSamplesQuery(checkType string) (string, error) {
+	switch checkType {
+	case "http":
+		return `SELECT
+				r.check_id, r.timestamp, r.success, r.duration, r.error,
+				r.status_code, r.maintenance,
+				COALESCE(c.min_failed_locations, 1) AS min_failed_locations
+			FROM
+				http_results r
+				LEFT JOIN http_checks c ON c.id = r.check_id
+			WHERE
+				r.timestamp >= ? AND r.timestamp < ?`, nil
+	case "tls", "tcp", "dns":
+		return `SELECT
+				r.check_id, r.timestamp, r.success, r.duration, r.error,
+				0 AS status_code, r.maintenance,
+				COALESCE(c.min_failed_locations, 1) AS min_failed_locations
+			FROM
+				` + checkType + `_results r
+				LEFT JOIN ` + checkType + `_checks c ON c.id = r.check_id
+			WHERE
+				r.timestamp >= ? AND r.timestamp < ?`, nil
+	case "heartbeat":
+		return `SELECT
+				r.check_id, r.timestamp, r.success, r.duration,
+				IF(r.message = '', r.kind, r.message) AS error, 0 AS status_code,
+				r.maintenance, 1 AS min_failed_locations
+			FROM
+				heartbeat_results r
+			WHERE
+				r.timestamp >= ? AND r.timestamp < ?
+				AND r.kind != 'start'`, nil
+	}
+	return "", fmt.Errorf("unknown check type %v", checkType)
+}
+
+// GetResultSamples returns the results of the check in the time range
+// ordered by time
+func (s *sqlRepository) GetResultSamples(ctx context.Context, id int64, checkType string, from time.Time, to time.Time) (*[]resultSample, error) {
+	query, err := resultSamplesQuery(checkType)
+	if err != nil {
+		return nil, err
+	}
+	rs := &[]resultSample{}
+	err = s.db.SelectContext(ctx, rs, query+` AND r.check_id = ? ORDER BY r.timestamp, r.id`,
+		from, to, id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get %v results for check %v, %w", checkType, id, err)
+	}
+	return rs, nil
+}
+
+// GetResultSamplesByType returns the results of all checks of the type in
+// the time range ordered by time
+func (s *sqlRepository) GetResultSamplesByType(ctx context.Context, checkType string, from time.Time, to time.Time) (*[]resultSample, error) {
+	query, err := resultSamplesQuery(checkType)
+	if err != nil {
+		return nil, err
+	}
+	rs := &[]resultSample{}
+	err = s.db.SelectContext(ctx, rs, query+` ORDER BY r.timestamp, r.id`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get %v results, %w", checkType, err)
+	}
+	return rs, nil
+}
+
+// GetFirstResultTimestamp returns the time of the oldest result of the check
+// type or the zero time, if there is none
+func (s *sqlRepository) GetFirstResultTimestamp(ctx context.Context, checkType string) (time.Time, error) {
+	var t sql.NullTime
+	err := s.db.GetContext(ctx, &t, `SELECT MIN(timestamp) FROM `+checkType+`_results`)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to get first %v result, %w", checkType, err)
+	}
+	return t.Time, nil
+}
+
+// PurgeResults deletes at most limit results of the check type older than
+// before and returns the number of deleted results
+func (s *sqlRepository) PurgeResults(ctx context.Context, checkType string, before time.Time, limit int64) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`DELETE FROM `+checkType+`_results
+		WHERE timestamp < ?
+		ORDER BY timestamp
+		LIMIT ?`,
+		before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge %v results, %w", checkType, err)
+	}
+	return o.RowsAffected()
+}
+
+// rollupTable returns the table of the rollups of the resolution
+func rollupTable(resolution string) string {
+	if resolution == resolutionDay {
+		return "daily_rollups"
+	}
+	return "hourly_rollups"
+}
+
+func (s *sqlRepository) GetRollups(ctx context.Context, q *rollupQuery) (*[]rollup, error) {
+	rs := &[]rollup{}
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			check_id, check_type, bucket, runs, failures, outages, monitored,
+			downtime, latency_min, latency_avg, latency_max, latency_p50,
+			latency_p95, latency_p99, errors
+		FROM
+			`+rollupTable(q.Resolution)+`
+		WHERE
+			check_id = ? AND check_type = ? AND bucket >= ? AND bucket < ?
+		ORDER BY bucket`,
+		q.CheckID, q.CheckType, q.From, q.To)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get rollups for %v check %v, %w", q.CheckType, q.CheckID, err)
+	}
+	return rs, nil
+}
+
+func (s *sqlRepository) GetRollupsByType(ctx context.Context, resolution string, checkType string, from time.Time, to time.Time) (*[]rollup, error) {
+	rs := &[]rollup{}
+	err := s.db.SelectContext(ctx, rs,
+		`SELECT
+			check_id, check_type, bucket, runs, failures, outages, monitored,
+			downtime, latency_min, latency_avg, latency_max, latency_p50,
+			latency_p95, latency_p99, errors
+		FROM
+			`+rollupTable(resolution)+`
+		WHERE
+			check_type = ? AND bucket >= ? AND bucket < ?
+		ORDER BY bucket`,
+		checkType, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get rollups for %v checks, %w", checkType, err)
+	}
+	return rs, nil
+}
+
+// GetFirstRollupBucket returns the oldest bucket of the check type or the
+// zero time, if there is none
+func (s *sqlRepository) GetFirstRollupBucket(ctx context.Context, resolution string, checkType string) (time.Time, error) {
+	var t sql.NullTime
+	err := s.db.GetContext(ctx, &t,
+		`SELECT MIN(bucket) FROM `+rollupTable(resolution)+` WHERE check_type = ?`,
+		checkType)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to get first %v rollup, %w", checkType, err)
+	}
+	return t.Time, nil
+}
+
+// CreateRollup creates or replaces the rollup
+func (s *sqlRepository) CreateRollup(ctx context.Context, resolution string, r *rollup) error {
+	_, err := s.db.NamedExecContext(ctx,
+		`INSERT INTO `+rollupTable(resolution)+`
+			(check_id, check_type, bucket, runs, failures, outages, monitored,
+			downtime, latency_min, latency_avg, latency_max, latency_p50,
+			latency_p95, latency_p99, errors)
+		VALUES
+			(:check_id, :check_type, :bucket, :runs, :failures, :outages,
+			:monitored, :downtime, :latency_min, :latency_avg, :latency_max,
+			:latency_p50, :latency_p95, :latency_p99, :errors)
+		ON DUPLICATE KEY UPDATE
+			runs = VALUES(runs), failures = VALUES(failures),
+			outages = VALUES(outages), monitored = VALUES(monitored),
+			downtime = VALUES(downtime), latency_min = VALUES(latency_min),
+			latency_avg = VALUES(latency_avg), latency_max = VALUES(latency_max),
+			latency_p50 = VALUES(latency_p50), latency_p95 = VALUES(latency_p95),
+			latency_p99 = VALUES(latency_p99), errors = VALUES(errors)`,
+		r)
+	if err != nil {
+		return fmt.Errorf("unable to insert rollup %v into database, %w", *r, err)
+	}
+	return nil
+}
+
+// PurgeRollups deletes at most limit rollups of the check type older than
+// before and returns the number of deleted rollups
+func (s *sqlRepository) PurgeRollups(ctx context.Context, resolution string, checkType string, before time.Time, limit int64) (int64, error) {
+	o, err := s.db.ExecContext(ctx,
+		`DELETE FROM `+rollupTable(resolution)+`
+		WHERE check_type = ? AND bucket < ?
+		ORDER BY bucket
+		LIMIT ?`,
+		checkType, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge %v rollups, %w", checkType, err)
+	}
+	return o.RowsAffected()
+}
+
+// DeleteRollups deletes all rollups of the check
+func (s *sqlRepository) DeleteRollups(ctx context.Context, id int64, checkType string) error {
+	for _, table := range []string{rollupTable(resolutionHour), rollupTable(resolutionDay)} {
+		_, err := s.db.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE check_id = ? AND check_type = ?`,
+			id, checkType)
+		if err != nil {
+			return fmt.Errorf("unable to delete rollups of %v check %v, %w", checkType, id, err)
+		}
+	}
+	return nil
+}
+
+// GetRollupProgress returns the end of the last rolled up bucket of the
+// check type or the zero time, if nothing was rolled up yet
+func (s *sqlRepository) GetRollupProgress(ctx context.Context, resolution string, checkType string) (time.Time, error) {
+	var t time.Time
+	err := s.db.GetContext(ctx, &t,
+		`SELECT
+			rolled_up
+		FROM
+			rollup_progress
+		WHERE
+			resolution = ? AND check_type = ?`,
+		resolution, checkType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to get %v rollup progress of %v checks, %w", resolution, checkType, err)
+	}
+	return t, nil
+}
+
+func (s *sqlRepository) UpdateRollupProgress(ctx context.Context, resolution string, checkType string, t time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO rollup_progress
+			(resolution, check_type, rolled_up)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			rolled_up = VALUES(rolled_up)`,
+		resolution, checkType, t)
+	if err != nil {
+		return fmt.Errorf("unable to update %v rollup progress of %v checks, %w", resolution, checkType, err)
+	}
+	return nil
+}
+
+// UpdateReplica stores the heartbeat of the replica
+func (s *sqlRepository) UpdateReplica(ctx context.Context, id string, heartbeat time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO replicas
+			(id, heartbeat)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE
+			heartbeat = VALUES(heartbeat)`,
+		id, heartbeat)
+	if err != nil {
+		return fmt.Errorf("unable to update replica %v, %w", id, err)
+	}
+	return nil
+}
+
+// CountReplicas returns the number of replicas with a heartbeat since the
+// given time and deletes replicas, which are long gone
+func (s *sqlRepository) CountReplicas(ctx context.Context, since time.Time) (int64, error) {
+	var n int64
+	err := s.db.GetContext(ctx, &n,
+		`SELECT COUNT(*) FROM replicas WHERE heartbeat >= ?`,
+		since)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to count replicas, %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`DELETE FROM replicas WHERE heartbeat < ?`,
+		since.Add(-24*time.Hour))
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete old replicas, %w", err)
+	}
+	return n, nil
+}
+
+// InitShardLeases creates unowned leases for all shards, which have none
+func (s *sqlRepository) InitShardLeases(ctx context.Context, shards int) error {
+	for shard := 0; shard < shards; shard++ {
+		_, err := s.db.ExecContext(ctx,
+			`INSERT IGNORE INTO shard_leases
+				(shard, owner, expires)
+			VALUES (?, '', UTC_TIMESTAMP())`,
+			shard)
+		if err != nil {
+			return fmt.Errorf("unable to initialize lease of shard %v, %w", shard, err)
+		}
+	}
+	return nil
+}
+
+// GetFreeShards returns the shards without owner or with an expired lease
+func (s *sqlRepository) GetFreeShards(ctx context.Context, now time.Time) ([]int, error) {
+	shards := []int{}
+	err := s.db.SelectContext(ctx, &shards,
+		`SELECT
+			shard
+		FROM
+			shard_leases
+		WHERE
+			owner = '' OR expires < ?
+		ORDER BY shard`,
+		now)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get free shards, %w", err)
+	}
+	return shards, nil
+}
+
+// AcquireShardLease takes the lease on the shard, if it is free or expired,
+// and returns if it succeeded
+func (s *sqlRepository) AcquireShardLease(ctx context.Context, shard int, owner string, expires time.Time, now time.Time) (bool, error) {
+	o, err := s.db.ExecContext(ctx,
+		`UPDATE shard_leases
+		SET owner = ?, expires = ?
+		WHERE shard = ? AND (owner = '' OR expires < ?)`,
+		owner, expires, shard, now)
+	if err != nil {
+		return false, fmt.Errorf("unable to acquire lease of shard %v, %w", shard, err)
+	}
+	n, err := o.RowsAffected()
+	return n == 1, err
+}
+
+// RenewShardLease extends the lease of the owner on the shard and returns,
+// if the owner still holds it
+func (s *sqlRepository) RenewShardLease(ctx context.Context, shard int, owner string, expires time.Time) (bool, error) {
+	o, err := s.db.ExecContext(ctx,
+		`UPDATE shard_leases
+		SET expires = ?
+		WHERE shard = ? AND owner = ?`,
+		expires, shard, owner)
+	if err != nil {
+		return false, fmt.Errorf("unable to renew lease of shard %v, %w", shard, err)
+	}
+	n, err := o.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseShardLease gives up the lease of the owner on the shard
+func (s *sqlRepository) ReleaseShardLease(ctx context.Context, shard int, owner string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE shard_leases
+		SET owner = ''
+		WHERE shard = ? AND owner = ?`,
+		shard, owner)
+	if err != nil {
+		return fmt.Errorf("unable to release lease of shard %v, %w", shard, err)
+	}
+	return nil
+}
+
+// UpdateWorker registers the worker or refreshes its heartbeat
+func (s *sqlRepository) UpdateWorker(ctx context.Context, w *worker) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO workers
+			(address, location, heartbeat)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			location = VALUES(location), heartbeat = VALUES(heartbeat)`,
+		w.Address, w.Location, w.Heartbeat)
+	if err != nil {
+		return fmt.Errorf("unable to update worker %v, %w", w.Address, err)
+	}
+	return nil
+}
+
+// GetWorkers returns the workers with a heartbeat since the given time
+func (s *sqlRepository) GetWorkers(ctx context.Context, since time.Time) (*[]worker, error) {
+	ws := &[]worker{}
+	err := s.db.SelectContext(ctx, ws,
+		`SELECT
+			address, location, heartbeat
+		FROM
+			workers
+		WHERE
+			heartbeat >= ?
+		ORDER BY location, address`,
+		since)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get workers, %w", err)
+	}
+	return ws, nil
+}
+
+func (s *sqlRepository) GetAgent(ctx context.Context, id int64) (*agent, error) {
+	a := &agent{}
+	err := s.db.GetContext(ctx, a,
+		`SELECT
+			id, user_id, name, token, last_seen
+		FROM
+			agents
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get agent %v, %w", id, err)
+	}
+	return a, nil
+}
+
+func (s *sqlRepository) GetAgentByToken(ctx context.Context, token string) (*agent, error) {
+	a := &agent{}
+	err := s.db.GetContext(ctx, a,
+		`SELECT
+			id, user_id, name, token, last_seen
+		FROM
+			agents
+		WHERE
+			token = ?`,
+		token)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get agent by token, %w", err)
+	}
+	return a, nil
+}
+
+func (s *sqlRepository) GetAgentsByUser(ctx context.Context, id int64) (*[]agent, error) {
+	as := &[]agent{}
+	err := s.db.SelectContext(ctx, as,
+		`SELECT
+			id, user_id, name, token, last_seen
+		FROM
+			agents
+		WHERE
+			user_id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get agents from user %v, %w", id, err)
+	}
+	return as, nil
+}
+
+func (s *sqlRepository) CreateAgent(ctx context.Context, a *agent) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO agents
+			(user_id, name, token)
+		VALUES (?, ?, ?)`,
+		a.UserID, a.Name, a.Token)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new agent %v into database, %w", a.Name, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) DeleteAgent(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM agents
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+// UpdateAgentSeen records the last sign of life of the agent
+func (s *sqlRepository) UpdateAgentSeen(ctx context.Context, id int64, t time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE agents
+		SET last_seen = ?
+		WHERE id = ?`,
+		t, id)
+	if err != nil {
+		return fmt.Errorf("unable to update last seen of agent %v, %w", id, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) GetMaintenanceWindows(ctx context.Context) (*[]maintenanceWindow, error) {
+	ws := &[]maintenanceWindow{}
+	err := s.db.SelectContext(ctx, ws,
+		`SELECT
+			id, user_id, check_id, check_type, name, mode, starts_at, ends_at,
+			schedule, duration, timezone
+		FROM
+			maintenance_windows`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get maintenance windows, %w", err)
+	}
+	return ws, nil
+}
+
+func (s *sqlRepository) GetMaintenanceWindow(ctx context.Context, id int64) (*maintenanceWindow, error) {
+	w := &maintenanceWindow{}
+	err := s.db.GetContext(ctx, w,
+		`SELECT
+			id, user_id, check_id, check_type, name, mode, starts_at, ends_at,
+			schedule, duration, timezone
+		FROM
+			maintenance_windows
+		WHERE
+			id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get maintenance window %v, %w", id, err)
+	}
+	return w, nil
+}
+
+func (s *sqlRepository) GetMaintenanceWindowsByUser(ctx context.Context, id int64) (*[]maintenanceWindow, error) {
+	ws := &[]maintenanceWindow{}
+	err := s.db.SelectContext(ctx, ws,
+		`SELECT
+			id, user_id, check_id, check_type, name, mode, starts_at, ends_at,
+			schedule, duration, timezone
+		FROM
+			maintenance_windows
+		WHERE
+			user_id = ?`,
+		id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get maintenance windows from user %v, %w", id, err)
+	}
+	return ws, nil
+}
+
+func (s *sqlRepository) CreateMaintenanceWindow(ctx context.Context, w *maintenanceWindow) (int64, error) {
+	r, err := s.db.ExecContext(ctx,
+		`INSERT INTO maintenance_windows
+			(user_id, check_id, check_type, name, mode, starts_at, ends_at,
+				schedule, duration, timezone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.UserID, w.CheckID, w.CheckType, w.Name, w.Mode, w.StartsAt, w.EndsAt,
+		w.Schedule, w.Duration, w.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert new maintenance window %v into database, %w", w.Name, err)
+	}
+	return r.LastInsertId()
+}
+
+func (s *sqlRepository) UpdateMaintenanceWindow(ctx context.Context, w *maintenanceWindow) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE maintenance_windows
+		SET check_id = ?, check_type = ?, name = ?, mode = ?, starts_at = ?,
+			ends_at = ?, schedule = ?, duration = ?, timezone = ?
+		WHERE id = ?`,
+		w.CheckID, w.CheckType, w.Name, w.Mode, w.StartsAt,
+		w.EndsAt, w.Schedule, w.Duration, w.Timezone,
+		w.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update maintenance window %v, %w", w.ID, err)
+	}
+	return nil
+}
+
+func (s *sqlRepository) DeleteMaintenanceWindow(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM maintenance_windows
+		WHERE id = ?`,
+		id)
+	return err
+}
+
+// DeleteMaintenanceWindowsByCheck deletes the windows of a deleted check
+func (s *sqlRepository) DeleteMaintenanceWindowsByCheck(ctx context.Context, id int64, checkType string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM maintenance_windows
+		WHERE check_id = ? AND check_type = ?`,
+		id, checkType)
+	return err
+}
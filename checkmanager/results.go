@@ -0,0 +1,187 @@
+package checkmanager
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+const (
+	// defaultResultLimit is the page size, if none is requested
+	defaultResultLimit = 100
+	// maxResultLimit is the maximum page size
+	maxResultLimit = 1000
+	// maxErrorLength is the size of the error columns of the results
+	maxErrorLength = 255
+)
+
+// truncateError shortens the error of a result to the size of its column,
+// so storing the result does not fail in strict sql mode
+func truncateError(s string) string {
+	if len(s) <= maxErrorLength {
+		return s
+	}
+	// Do not split a multi-byte character
+	i := maxErrorLength
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}
+
+// resultCursor points to the last result of a page
+type resultCursor struct {
+	Timestamp time.Time
+	ID        int64
+}
+
+// encode the cursor as url friendly string
+func (c resultCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d,%d", c.Timestamp.UnixNano(), c.ID)))
+}
+
+func decodeResultCursor(s string) (*resultCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cursor, %w", err)
+	}
+	parts := strings.SplitN(string(b), ",", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor timestamp, %w", err)
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor id, %w", err)
+	}
+	return &resultCursor{Timestamp: time.Unix(0, ns), ID: id}, nil
+}
+
+// resultQuery selects a page of results of a check
+type resultQuery struct {
+	CheckID int64
+	// From and To limit the time range, zero values are unbounded
+	From time.Time
+	To   time.Time
+	// Success filters for successful or failed results, if not nil
+	Success *bool
+	// After is the cursor of the previous page
+	After *resultCursor
+	Limit int64
+	// Ascending orders the oldest results first
+	Ascending bool
+}
+
+func marshalResultQuery(q *proto.ResultQuery) (*resultQuery, error) {
+	rq := &resultQuery{
+		CheckID: q.CheckId,
+		Limit:   q.Limit,
+	}
+	var err error
+	if q.From != nil {
+		rq.From, err = ptypes.Timestamp(q.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of time range, %w", err)
+		}
+	}
+	if q.To != nil {
+		rq.To, err = ptypes.Timestamp(q.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of time range, %w", err)
+		}
+	}
+	if !rq.From.IsZero() && !rq.To.IsZero() && rq.To.Before(rq.From) {
+		return nil, fmt.Errorf("end of time range %v before start %v", rq.To, rq.From)
+	}
+
+	switch q.Filter {
+	case "", "all":
+	case "success":
+		success := true
+		rq.Success = &success
+	case "failure":
+		success := false
+		rq.Success = &success
+	default:
+		return nil, fmt.Errorf("unknown filter %v", q.Filter)
+	}
+
+	switch q.Order {
+	case "", "desc":
+	case "asc":
+		rq.Ascending = true
+	default:
+		return nil, fmt.Errorf("unknown order %v", q.Order)
+	}
+
+	if q.Cursor != "" {
+		rq.After, err = decodeResultCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rq.Limit == 0 {
+		rq.Limit = defaultResultLimit
+	}
+	if rq.Limit < 0 || rq.Limit > maxResultLimit {
+		return nil, fmt.Errorf("limit %v not between 1 and %v", rq.Limit, maxResultLimit)
+	}
+	return rq, nil
+}
+
+// sql returns the where, order and limit clauses of the query together with
+// their arguments. One more result than the limit is selected to find out,
+// if there is a next page.
+func (q *resultQuery) sql() (string, []interface{}) {
+	where := []string{"check_id = ?"}
+	args := []interface{}{q.CheckID}
+	if !q.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.To)
+	}
+	if q.Success != nil {
+		where = append(where, "success = ?")
+		args = append(args, *q.Success)
+	}
+
+	order := "DESC"
+	cmp := "<"
+	if q.Ascending {
+		order = "ASC"
+		cmp = ">"
+	}
+	if q.After != nil {
+		where = append(where, fmt.Sprintf(
+			"(timestamp %v ? OR (timestamp = ? AND id %v ?))", cmp, cmp))
+		args = append(args, q.After.Timestamp, q.After.Timestamp, q.After.ID)
+	}
+
+	return fmt.Sprintf("WHERE %v ORDER BY timestamp %v, id %v LIMIT %d",
+		strings.Join(where, " AND "), order, order, q.Limit+1), args
+}
+
+// page returns the number of results to return and the cursor for the next
+// page, if there are more results than the limit. last returns the cursor of
+// the result at the given index.
+func (q *resultQuery) page(n int, last func(i int) resultCursor) (int, string) {
+	if int64(n) <= q.Limit {
+		return n, ""
+	}
+	return int(q.Limit), last(int(q.Limit) - 1).encode()
+}
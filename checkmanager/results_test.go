@@ -0,0 +1,35 @@
+package checkmanager
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		error  string
+		length int
+	}{
+		{name: "short", error: "body does not contain \"ok\"", length: 26},
+		{name: "exact", error: strings.Repeat("a", maxErrorLength), length: maxErrorLength},
+		{name: "long", error: strings.Repeat("a", 1000), length: maxErrorLength},
+		// The multi-byte character at the limit is dropped completely
+		{name: "rune boundary", error: strings.Repeat("a", maxErrorLength-1) + "ü" + "a", length: maxErrorLength - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateError(tt.error)
+			if len(got) != tt.length {
+				t.Errorf("length %v, expected %v", len(got), tt.length)
+			}
+			if !strings.HasPrefix(tt.error, got) {
+				t.Errorf("%q is no prefix of the error", got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q is not valid utf-8", got)
+			}
+		})
+	}
+}
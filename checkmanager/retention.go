@@ -0,0 +1,539 @@
+package checkmanager
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"go.uber.org/zap"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// Resolutions of the rollups
+const (
+	resolutionHour = "hour"
+	resolutionDay  = "day"
+)
+
+const (
+	// rollupDelay is the time to wait after the end of an hour before it is
+	// rolled up, so that runs of the last interval are stored
+	rollupDelay = 2 * maxTimeout
+	// maxRollupBuckets is the number of buckets per check type rolled up in
+	// one run, so a long backlog is worked off in bounded steps
+	maxRollupBuckets = 7 * 24
+	// defaultRollupWindow is the time range of rollup queries, if none is
+	// requested
+	defaultRollupWindow = 7 * 24 * time.Hour
+)
+
+// checkTypes are the types of all checks with results
+var checkTypes = []string{"http", "tls", "tcp", "dns", "heartbeat"}
+
+// bucketLength returns the length of a bucket of the resolution
+func bucketLength(resolution string) time.Duration {
+	if resolution == resolutionDay {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// errorCounts are stored as json in the database
+type errorCounts []errorCount
+
+// Value implements the driver.Valuer interface
+func (e errorCounts) Value() (driver.Value, error) {
+	if e == nil {
+		return jsonValue([]errorCount{})
+	}
+	return jsonValue([]errorCount(e))
+}
+
+// Scan implements the sql.Scanner interface
+func (e *errorCounts) Scan(src interface{}) error {
+	return jsonScan(src, (*[]errorCount)(e))
+}
+
+// rollup aggregates the results of a check in one bucket
+type rollup struct {
+	CheckID    int64         `db:"check_id"`
+	CheckType  string        `db:"check_type"`
+	Bucket     time.Time     `db:"bucket"`
+	Runs       int64         `db:"runs"`
+	Failures   int64         `db:"failures"`
+	Outages    int64         `db:"outages"`
+	Monitored  time.Duration `db:"monitored"`
+	Downtime   time.Duration `db:"downtime"`
+	LatencyMin time.Duration `db:"latency_min"`
+	LatencyAvg time.Duration `db:"latency_avg"`
+	LatencyMax time.Duration `db:"latency_max"`
+	LatencyP50 time.Duration `db:"latency_p50"`
+	LatencyP95 time.Duration `db:"latency_p95"`
+	LatencyP99 time.Duration `db:"latency_p99"`
+	Errors     errorCounts   `db:"errors"`
+}
+
+// newRollup creates the rollup of a bucket from its statistics
+func newRollup(checkID int64, checkType string, bucket time.Time, st *statistics) *rollup {
+	return &rollup{
+		CheckID:    checkID,
+		CheckType:  checkType,
+		Bucket:     bucket,
+		Runs:       st.Runs,
+		Failures:   st.Failures,
+		Outages:    st.OutageCount,
+		Monitored:  st.Monitored,
+		Downtime:   st.OutageDuration,
+		LatencyMin: st.LatencyMin,
+		LatencyAvg: st.LatencyMean,
+		LatencyMax: st.LatencyMax,
+		LatencyP50: st.LatencyP50,
+		LatencyP95: st.LatencyP95,
+		LatencyP99: st.LatencyP99,
+		Errors:     st.Errors,
+	}
+}
+
+// successes returns the number of successful runs, which the latencies
+// are based on
+func (r *rollup) successes() int64 {
+	return r.Runs - r.Failures
+}
+
+// merge o into the rollup.
+//
+// Counts and durations are summed up. The mean latency and the percentiles
+// are weighted by the number of successful runs, so the percentiles are an
+// approximation.
+func (r *rollup) merge(o *rollup) {
+	n, m := r.successes(), o.successes()
+	if m > 0 {
+		if n == 0 || o.LatencyMin < r.LatencyMin {
+			r.LatencyMin = o.LatencyMin
+		}
+		if o.LatencyMax > r.LatencyMax {
+			r.LatencyMax = o.LatencyMax
+		}
+		weighted := func(a, b time.Duration) time.Duration {
+			return time.Duration((int64(a)*n + int64(b)*m) / (n + m))
+		}
+		r.LatencyAvg = weighted(r.LatencyAvg, o.LatencyAvg)
+		r.LatencyP50 = weighted(r.LatencyP50, o.LatencyP50)
+		r.LatencyP95 = weighted(r.LatencyP95, o.LatencyP95)
+		r.LatencyP99 = weighted(r.LatencyP99, o.LatencyP99)
+	}
+
+	r.Runs += o.Runs
+	r.Failures += o.Failures
+	r.Outages += o.Outages
+	r.Monitored += o.Monitored
+	r.Downtime += o.Downtime
+
+	for _, e := range o.Errors {
+		found := false
+		for i := range r.Errors {
+			if r.Errors[i].Error == e.Error && r.Errors[i].StatusCode == e.StatusCode {
+				r.Errors[i].Count += e.Count
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.Errors = append(r.Errors, e)
+		}
+	}
+	sortErrorCounts(r.Errors)
+}
+
+// statistics returns the statistics of the rollup
+func (r *rollup) statistics(end time.Time) *statistics {
+	st := &statistics{
+		End:            end,
+		Runs:           r.Runs,
+		Failures:       r.Failures,
+		Monitored:      r.Monitored,
+		OutageCount:    r.Outages,
+		OutageDuration: r.Downtime,
+		LatencyMin:     r.LatencyMin,
+		LatencyMean:    r.LatencyAvg,
+		LatencyMax:     r.LatencyMax,
+		LatencyP50:     r.LatencyP50,
+		LatencyP95:     r.LatencyP95,
+		LatencyP99:     r.LatencyP99,
+		Errors:         r.Errors,
+		RolledUp:       true,
+	}
+	st.computeUptime()
+	return st
+}
+
+func unmarshalRollup(r *rollup) (*proto.Rollup, error) {
+	bucket, err := ptypes.TimestampProto(r.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *r, err)
+	}
+	pr := &proto.Rollup{
+		Bucket:     bucket,
+		Runs:       r.Runs,
+		Failures:   r.Failures,
+		Outages:    r.Outages,
+		Monitored:  ptypes.DurationProto(r.Monitored),
+		Downtime:   ptypes.DurationProto(r.Downtime),
+		LatencyMin: ptypes.DurationProto(r.LatencyMin),
+		LatencyAvg: ptypes.DurationProto(r.LatencyAvg),
+		LatencyMax: ptypes.DurationProto(r.LatencyMax),
+		LatencyP50: ptypes.DurationProto(r.LatencyP50),
+		LatencyP95: ptypes.DurationProto(r.LatencyP95),
+		LatencyP99: ptypes.DurationProto(r.LatencyP99),
+		Errors:     make([]*proto.ErrorCount, len(r.Errors)),
+	}
+	for i, e := range r.Errors {
+		pr.Errors[i] = &proto.ErrorCount{
+			Error:      e.Error,
+			StatusCode: e.StatusCode,
+			Count:      e.Count,
+		}
+	}
+	return pr, nil
+}
+
+// rollupQuery selects the rollups of a check
+type rollupQuery struct {
+	CheckID    int64
+	CheckType  string
+	Resolution string
+	From       time.Time
+	To         time.Time
+}
+
+// retention rolls up old results into hourly and daily rollups and purges
+// results and hourly rollups after their retention period.
+// Daily rollups are kept forever.
+type retention struct {
+	db     repository
+	logger *zap.SugaredLogger
+	// raw and hourly are the retention periods of results and hourly rollups
+	raw    time.Duration
+	hourly time.Duration
+	// batchSize is the number of rows deleted by one statement
+	batchSize int64
+	// active returns, if this replica is responsible for the retention
+	active func() bool
+}
+
+// run the retention every interval until the context is done
+func (r *retention) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.do(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// do one run of the retention for all check types
+func (r *retention) do(ctx context.Context, now time.Time) {
+	if r.active != nil && !r.active() {
+		return
+	}
+	for _, t := range checkTypes {
+		if err := r.rollupHours(ctx, t, now); err != nil {
+			r.logger.Errorw("Unable to roll up hours", "error", err, "check_type", t)
+			continue
+		}
+		if err := r.rollupDays(ctx, t); err != nil {
+			r.logger.Errorw("Unable to roll up days", "error", err, "check_type", t)
+		}
+		if err := r.purgeResults(ctx, t, now); err != nil {
+			r.logger.Errorw("Unable to purge results", "error", err, "check_type", t)
+		}
+		if err := r.purgeHourlyRollups(ctx, t, now); err != nil {
+			r.logger.Errorw("Unable to purge hourly rollups", "error", err, "check_type", t)
+		}
+	}
+}
+
+// rollupHours rolls up the results of all complete hours after the last run
+func (r *retention) rollupHours(ctx context.Context, checkType string, now time.Time) error {
+	start, err := r.db.GetRollupProgress(ctx, resolutionHour, checkType)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		first, err := r.db.GetFirstResultTimestamp(ctx, checkType)
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			return nil
+		}
+		start = first.Truncate(time.Hour)
+	}
+	end := now.Add(-rollupDelay).Truncate(time.Hour)
+
+	for i := 0; i < maxRollupBuckets && start.Before(end); i++ {
+		next := start.Add(time.Hour)
+		samples, err := r.db.GetResultSamplesByType(ctx, checkType, start, next)
+		if err != nil {
+			return err
+		}
+		// The samples of a check stay ordered by time, so computeStatistics
+		// groups the locations of each run
+		byCheck := map[int64][]resultSample{}
+		for _, s := range *samples {
+			byCheck[s.CheckID] = append(byCheck[s.CheckID], s)
+		}
+		for id, ss := range byCheck {
+			err := r.db.CreateRollup(ctx, resolutionHour,
+				newRollup(id, checkType, start, computeStatistics(ss, next)))
+			if err != nil {
+				return err
+			}
+		}
+		err = r.db.UpdateRollupProgress(ctx, resolutionHour, checkType, next)
+		if err != nil {
+			return err
+		}
+		start = next
+	}
+	return nil
+}
+
+// rollupDays rolls up the hourly rollups of all complete days after the
+// last run
+func (r *retention) rollupDays(ctx context.Context, checkType string) error {
+	hours, err := r.db.GetRollupProgress(ctx, resolutionHour, checkType)
+	if err != nil {
+		return err
+	}
+	if hours.IsZero() {
+		return nil
+	}
+	start, err := r.db.GetRollupProgress(ctx, resolutionDay, checkType)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		first, err := r.db.GetFirstRollupBucket(ctx, resolutionHour, checkType)
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			return nil
+		}
+		start = first.Truncate(24 * time.Hour)
+	}
+	end := hours.Truncate(24 * time.Hour)
+
+	for i := 0; i < maxRollupBuckets && start.Before(end); i++ {
+		next := start.Add(24 * time.Hour)
+		rs, err := r.db.GetRollupsByType(ctx, resolutionHour, checkType, start, next)
+		if err != nil {
+			return err
+		}
+		byCheck := map[int64]*rollup{}
+		for j := range *rs {
+			hr := &(*rs)[j]
+			dr, ok := byCheck[hr.CheckID]
+			if !ok {
+				dr = &rollup{CheckID: hr.CheckID, CheckType: checkType, Bucket: start}
+				byCheck[hr.CheckID] = dr
+			}
+			dr.merge(hr)
+		}
+		for _, dr := range byCheck {
+			if err := r.db.CreateRollup(ctx, resolutionDay, dr); err != nil {
+				return err
+			}
+		}
+		err = r.db.UpdateRollupProgress(ctx, resolutionDay, checkType, next)
+		if err != nil {
+			return err
+		}
+		start = next
+	}
+	return nil
+}
+
+// purgeResults deletes results older than the retention period, which are
+// already rolled up
+func (r *retention) purgeResults(ctx context.Context, checkType string, now time.Time) error {
+	rolledUp, err := r.db.GetRollupProgress(ctx, resolutionHour, checkType)
+	if err != nil {
+		return err
+	}
+	before := now.Add(-r.raw)
+	if rolledUp.Before(before) {
+		before = rolledUp
+	}
+	return r.purge(ctx, func() (int64, error) {
+		return r.db.PurgeResults(ctx, checkType, before, r.batchSize)
+	})
+}
+
+// purgeHourlyRollups deletes hourly rollups older than the retention
+// period, which are already rolled up into days
+func (r *retention) purgeHourlyRollups(ctx context.Context, checkType string, now time.Time) error {
+	rolledUp, err := r.db.GetRollupProgress(ctx, resolutionDay, checkType)
+	if err != nil {
+		return err
+	}
+	before := now.Add(-r.hourly)
+	if rolledUp.Before(before) {
+		before = rolledUp
+	}
+	return r.purge(ctx, func() (int64, error) {
+		return r.db.PurgeRollups(ctx, resolutionHour, checkType, before, r.batchSize)
+	})
+}
+
+// purge calls del until it deletes less than a batch or the context is done
+func (r *retention) purge(ctx context.Context, del func() (int64, error)) error {
+	for ctx.Err() == nil {
+		n, err := del()
+		if err != nil {
+			return err
+		}
+		if n < r.batchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// checkResults returns an error, if the query reaches back further than the
+// retention period of the results. Queries without start are not limited, so
+// they page through the remaining results.
+func (r *retention) checkResults(q *resultQuery, now time.Time) error {
+	before := now.Add(-r.raw)
+	if (!q.From.IsZero() && q.From.Before(before)) || (!q.To.IsZero() && !q.To.After(before)) {
+		return fmt.Errorf("results before %v are purged, use the rollups of the check instead",
+			before.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// statistics of the query. If the window reaches back further than the
+// retention period of the results, the rollups are used for the rolled up
+// part of the window at bucket granularity.
+func (r *retention) statistics(ctx context.Context, q *statisticsQuery, end time.Time, now time.Time) (*statistics, error) {
+	if !q.From.Before(now.Add(-r.raw)) {
+		samples, err := r.db.GetResultSamples(ctx, q.CheckID, q.CheckType, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		return computeStatistics(*samples, end), nil
+	}
+
+	hours, err := r.db.GetRollupProgress(ctx, resolutionHour, q.CheckType)
+	if err != nil {
+		return nil, err
+	}
+	days, err := r.db.GetRollupProgress(ctx, resolutionDay, q.CheckType)
+	if err != nil {
+		return nil, err
+	}
+	if !q.From.Before(now.Add(-r.hourly)) || days.Before(q.From) {
+		days = q.From
+	}
+	if hours.Before(days) {
+		hours = days
+	}
+	clip := func(t time.Time) time.Time {
+		if q.To.Before(t) {
+			return q.To
+		}
+		return t
+	}
+
+	total := &rollup{}
+	dailies, err := r.db.GetRollups(ctx, &rollupQuery{
+		CheckID: q.CheckID, CheckType: q.CheckType, Resolution: resolutionDay,
+		From: q.From, To: clip(days),
+	})
+	if err != nil {
+		return nil, err
+	}
+	hourlies, err := r.db.GetRollups(ctx, &rollupQuery{
+		CheckID: q.CheckID, CheckType: q.CheckType, Resolution: resolutionHour,
+		From: days, To: clip(hours),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range []*[]rollup{dailies, hourlies} {
+		for i := range *rs {
+			total.merge(&(*rs)[i])
+		}
+	}
+
+	var raw *statistics
+	if hours.Before(q.To) {
+		samples, err := r.db.GetResultSamples(ctx, q.CheckID, q.CheckType, hours, q.To)
+		if err != nil {
+			return nil, err
+		}
+		raw = computeStatistics(*samples, end)
+		total.merge(newRollup(q.CheckID, q.CheckType, hours, raw))
+	}
+
+	st := total.statistics(end)
+	if raw != nil {
+		st.Outages = raw.Outages
+	}
+	return st, nil
+}
+
+func marshalRollupQuery(q *proto.RollupQuery, now time.Time, hourlyRetention time.Duration) (*rollupQuery, error) {
+	rq := &rollupQuery{
+		CheckID:    q.CheckId,
+		CheckType:  q.CheckType,
+		Resolution: q.Resolution,
+		To:         now,
+	}
+	switch rq.CheckType {
+	case "http", "tls", "tcp", "dns", "heartbeat":
+	default:
+		return nil, fmt.Errorf("unknown check type %v", rq.CheckType)
+	}
+
+	var err error
+	if q.To != nil {
+		rq.To, err = ptypes.Timestamp(q.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of time range, %w", err)
+		}
+	}
+	rq.From = rq.To.Add(-defaultRollupWindow)
+	if q.From != nil {
+		rq.From, err = ptypes.Timestamp(q.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of time range, %w", err)
+		}
+	}
+	if !rq.From.Before(rq.To) {
+		return nil, fmt.Errorf("end of time range %v not after start %v", rq.To, rq.From)
+	}
+
+	switch rq.Resolution {
+	case "":
+		rq.Resolution = resolutionHour
+		if rq.From.Before(now.Add(-hourlyRetention)) {
+			rq.Resolution = resolutionDay
+		}
+	case resolutionHour, resolutionDay:
+	default:
+		return nil, fmt.Errorf("unknown resolution %v", rq.Resolution)
+	}
+	if rq.To.Sub(rq.From) > maxResultLimit*bucketLength(rq.Resolution) {
+		return nil, fmt.Errorf("time range longer than %v buckets", maxResultLimit)
+	}
+	return rq, nil
+}
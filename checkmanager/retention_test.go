@@ -0,0 +1,129 @@
+package checkmanager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRollupMerge(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		r    rollup
+		o    rollup
+		want rollup
+	}{
+		{
+			name: "into empty rollup",
+			o: rollup{
+				Runs: 2, Monitored: time.Hour,
+				LatencyMin: 10 * ms, LatencyAvg: 20 * ms, LatencyMax: 30 * ms,
+				LatencyP50: 20 * ms, LatencyP95: 30 * ms, LatencyP99: 30 * ms,
+			},
+			want: rollup{
+				Runs: 2, Monitored: time.Hour,
+				LatencyMin: 10 * ms, LatencyAvg: 20 * ms, LatencyMax: 30 * ms,
+				LatencyP50: 20 * ms, LatencyP95: 30 * ms, LatencyP99: 30 * ms,
+			},
+		},
+		{
+			name: "weighted by successful runs",
+			r: rollup{
+				Runs: 4, Failures: 1, Outages: 1, Monitored: time.Hour, Downtime: time.Minute,
+				LatencyMin: 50 * ms, LatencyAvg: 100 * ms, LatencyMax: 200 * ms,
+				LatencyP50: 100 * ms, LatencyP95: 200 * ms, LatencyP99: 200 * ms,
+				Errors: errorCounts{{Error: "timeout", Count: 1}},
+			},
+			o: rollup{
+				Runs: 1, Monitored: time.Hour,
+				LatencyMin: 500 * ms, LatencyAvg: 500 * ms, LatencyMax: 500 * ms,
+				LatencyP50: 500 * ms, LatencyP95: 500 * ms, LatencyP99: 500 * ms,
+			},
+			want: rollup{
+				Runs: 5, Failures: 1, Outages: 1, Monitored: 2 * time.Hour, Downtime: time.Minute,
+				LatencyMin: 50 * ms, LatencyAvg: 200 * ms, LatencyMax: 500 * ms,
+				LatencyP50: 200 * ms, LatencyP95: 275 * ms, LatencyP99: 275 * ms,
+				Errors: errorCounts{{Error: "timeout", Count: 1}},
+			},
+		},
+		{
+			name: "without successful runs keeps latency",
+			r: rollup{
+				Runs: 1, Monitored: time.Hour,
+				LatencyMin: 50 * ms, LatencyAvg: 50 * ms, LatencyMax: 50 * ms,
+				LatencyP50: 50 * ms, LatencyP95: 50 * ms, LatencyP99: 50 * ms,
+			},
+			o: rollup{
+				Runs: 2, Failures: 2, Outages: 1, Monitored: time.Hour, Downtime: time.Hour,
+				Errors: errorCounts{{Error: "timeout", Count: 2}},
+			},
+			want: rollup{
+				Runs: 3, Failures: 2, Outages: 1, Monitored: 2 * time.Hour, Downtime: time.Hour,
+				LatencyMin: 50 * ms, LatencyAvg: 50 * ms, LatencyMax: 50 * ms,
+				LatencyP50: 50 * ms, LatencyP95: 50 * ms, LatencyP99: 50 * ms,
+				Errors: errorCounts{{Error: "timeout", Count: 2}},
+			},
+		},
+		{
+			name: "errors are summed up and sorted",
+			r: rollup{
+				Runs: 3, Failures: 3,
+				Errors: errorCounts{
+					{Error: "timeout", Count: 2},
+					{Error: "unexpected status code", StatusCode: 500, Count: 1},
+				},
+			},
+			o: rollup{
+				Runs: 3, Failures: 3,
+				Errors: errorCounts{
+					{Error: "connection refused", Count: 1},
+					{Error: "unexpected status code", StatusCode: 500, Count: 2},
+				},
+			},
+			want: rollup{
+				Runs: 6, Failures: 6,
+				Errors: errorCounts{
+					{Error: "unexpected status code", StatusCode: 500, Count: 3},
+					{Error: "timeout", Count: 2},
+					{Error: "connection refused", Count: 1},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.merge(&tt.o)
+			if !reflect.DeepEqual(tt.r, tt.want) {
+				t.Errorf("rollup\n%+v\nexpected\n%+v", tt.r, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	now := time.Date(2020, 6, 8, 12, 0, 0, 0, time.UTC)
+	r := &retention{raw: 7 * 24 * time.Hour}
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		purged bool
+	}{
+		{name: "unbounded"},
+		{name: "within retention", from: now.Add(-24 * time.Hour)},
+		{name: "start at retention", from: now.Add(-r.raw)},
+		{name: "start before retention", from: now.Add(-8 * 24 * time.Hour), purged: true},
+		{name: "end within retention", to: now.Add(-24 * time.Hour)},
+		{name: "end before retention", to: now.Add(-8 * 24 * time.Hour), purged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.checkResults(&resultQuery{From: tt.from, To: tt.to}, now)
+			if (err != nil) != tt.purged {
+				t.Errorf("error %v, expected purged %v", err, tt.purged)
+			}
+		})
+	}
+}
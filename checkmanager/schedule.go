@@ -0,0 +1,73 @@
+package checkmanager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// Defaults and limits of the schedule of a check
+const (
+	defaultInterval  = 30 * time.Second
+	minInterval      = proto.MinInterval
+	maxInterval      = proto.MaxInterval
+	defaultTimeout   = 10 * time.Second
+	minTimeout       = proto.MinTimeout
+	maxTimeout       = proto.MaxTimeout
+	defaultThreshold = 3
+	maxThreshold     = 100
+)
+
+// schedule describes how often a check runs, how long a single run may take
+// and after how many consecutive failures an alert is fired.
+// It is embedded in all polled checks.
+type schedule struct {
+	Interval  time.Duration `db:"check_interval"`
+	Timeout   time.Duration `db:"timeout"`
+	Threshold int64         `db:"threshold"`
+}
+
+// marshalSchedule validates the schedule and fills in defaults
+func marshalSchedule(interval *duration.Duration, timeout *duration.Duration, threshold int64) (schedule, error) {
+	s := schedule{
+		Interval:  defaultInterval,
+		Timeout:   defaultTimeout,
+		Threshold: defaultThreshold,
+	}
+	var err error
+	if interval != nil {
+		s.Interval, err = ptypes.Duration(interval)
+		if err != nil {
+			return s, fmt.Errorf("unable to marshal interval, %w", err)
+		}
+		if s.Interval < minInterval || s.Interval > maxInterval {
+			return s, fmt.Errorf("interval %v not between %v and %v",
+				s.Interval, minInterval, maxInterval)
+		}
+	}
+	if timeout != nil {
+		s.Timeout, err = ptypes.Duration(timeout)
+		if err != nil {
+			return s, fmt.Errorf("unable to marshal timeout, %w", err)
+		}
+		if s.Timeout < minTimeout || s.Timeout > maxTimeout {
+			return s, fmt.Errorf("timeout %v not between %v and %v",
+				s.Timeout, minTimeout, maxTimeout)
+		}
+	}
+	if s.Timeout > s.Interval {
+		return s, fmt.Errorf("timeout %v longer than interval %v", s.Timeout, s.Interval)
+	}
+	if threshold != 0 {
+		if threshold < 1 || threshold > maxThreshold {
+			return s, fmt.Errorf("failure threshold %v not between 1 and %v",
+				threshold, maxThreshold)
+		}
+		s.Threshold = threshold
+	}
+	return s, nil
+}
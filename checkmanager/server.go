@@ -2,40 +2,71 @@ package checkmanager
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
+	empty "github.com/golang/protobuf/ptypes/empty"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"github.com/joeshaw/envdecode"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	alert "github.com/shaardie/mondane/alert/proto"
 	"github.com/shaardie/mondane/checkmanager/proto"
-	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
 )
 
 // Config read from environment
 type config struct {
-	Database  string `env:"MONDANE_CHECKMANAGER_DATABASE,required"`
-	Listen    string `env:"MONDANE_CHECKMANAGER_LISTEN,default=:8083"`
-	Alert     string `env:"MONDANE_CHECKMANAGER_ALERT_SERVER,required"`
-	HTTPCheck string `env:"MONDANE_CHECKMANAGER_HTTPCHECK_SERVER,required"`
+	Database string `env:"MONDANE_CHECKMANAGER_DATABASE,required"`
+	Listen   string `env:"MONDANE_CHECKMANAGER_LISTEN,default=:8083"`
+	Alert    string `env:"MONDANE_CHECKMANAGER_ALERT_SERVER,required"`
+	// HTTPCheck is an optional static worker in the default location in
+	// addition to the registered workers
+	HTTPCheck string `env:"MONDANE_CHECKMANAGER_HTTPCHECK_SERVER"`
+	// Workers is the number of checks running concurrently
+	Workers int `env:"MONDANE_CHECKMANAGER_WORKERS,default=100"`
+	// Coordination distributes the checks between several replicas
+	Coordination bool          `env:"MONDANE_CHECKMANAGER_COORDINATION,default=false"`
+	ReplicaID    string        `env:"MONDANE_CHECKMANAGER_REPLICA_ID"`
+	Shards       int           `env:"MONDANE_CHECKMANAGER_SHARDS,default=64"`
+	LeaseTTL     time.Duration `env:"MONDANE_CHECKMANAGER_LEASE_TTL,default=30s"`
+	// ReconcileInterval is the time between two reconciliations of the
+	// running checks with the database
+	ReconcileInterval time.Duration `env:"MONDANE_CHECKMANAGER_RECONCILE_INTERVAL,default=1m"`
+	// Retention of results and hourly rollups, daily rollups are kept forever
+	RetentionRaw      time.Duration `env:"MONDANE_CHECKMANAGER_RETENTION_RAW,default=168h"`
+	RetentionHourly   time.Duration `env:"MONDANE_CHECKMANAGER_RETENTION_HOURLY,default=2160h"`
+	RetentionInterval time.Duration `env:"MONDANE_CHECKMANAGER_RETENTION_INTERVAL,default=5m"`
+	PurgeBatchSize    int64         `env:"MONDANE_CHECKMANAGER_PURGE_BATCH_SIZE,default=1000"`
 }
 
 // grpc server with all resources
 type server struct {
-	config    *config
-	db        repository
-	m         *memoryManager
-	alert     alert.AlertServiceClient
-	httpcheck httpcheck.HTTPCheckServiceClient
-	logger    *zap.SugaredLogger
-	initOnce  sync.Once
+	config      *config
+	db          repository
+	m           *memoryManager
+	retention   *retention
+	coordinator *coordinator
+	// ctx is canceled on shutdown
+	ctx         context.Context
+	alert       alert.AlertServiceClient
+	workers     *workerPool
+	maintenance *maintenance
+	logger      *zap.SugaredLogger
+	initOnce    sync.Once
 }
 
 func (s *server) init() {
@@ -50,12 +81,15 @@ func (s *server) init() {
 			s.logger.Info("Connected to database")
 		}
 
-		// Start manager
-		s.m = newMemoryManager(30*time.Second, s.logger)
-		cs, err := s.db.GetHTTPChecks(context.Background())
-		if err != nil {
-			s.logger.Infow("Unable to get checks from database", "error", err)
+		// Start retention
+		s.retention = &retention{
+			db:        s.db,
+			logger:    s.logger,
+			raw:       s.config.RetentionRaw,
+			hourly:    s.config.RetentionHourly,
+			batchSize: s.config.PurgeBatchSize,
 		}
+		go s.retention.run(s.ctx, s.config.RetentionInterval)
 
 		// Connect to alert service
 		d, err := grpc.Dial(s.config.Alert, grpc.WithInsecure())
@@ -65,97 +99,1574 @@ func (s *server) init() {
 		s.alert = alert.NewAlertServiceClient(d)
 		s.logger.Info("Connected to alert service")
 
-		// Connect to httpcheck service
-		d, err = grpc.Dial(s.config.HTTPCheck, grpc.WithInsecure())
+		// Connect to the httpcheck workers
+		s.workers = newWorkerPool(s.db, s.logger, s.config.HTTPCheck)
+		err = s.workers.refresh(s.ctx, time.Now())
+		if err != nil {
+			s.logger.Errorw("Unable to get workers", "error", err)
+		}
+		go s.workers.run(s.ctx)
+
+		// Load the maintenance windows
+		s.maintenance = newMaintenance(s.db, s.logger)
+		err = s.maintenance.refresh(s.ctx)
+		if err != nil {
+			s.logger.Errorw("Unable to get maintenance windows", "error", err)
+		}
+		go s.maintenance.run(s.ctx)
+
+		// Start manager and reconcile it periodically with the database as
+		// safety net for missed changes and changes by other replicas
+		s.m = newMemoryManager(s.logger, s.config.Workers)
+		go func() {
+			ticker := time.NewTicker(s.config.ReconcileInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-ticker.C:
+					s.reconcileChecks(s.ctx)
+				}
+			}
+		}()
+		if !s.config.Coordination {
+			s.logger.Info("Start all stored checks")
+			s.reconcileChecks(s.ctx)
+			return
+		}
+
+		// Start coordination with the other replicas, which starts the
+		// checks of the acquired shards
+		if s.config.Shards < 1 || s.config.LeaseTTL <= 0 {
+			s.logger.Fatalw("Invalid coordination config",
+				"shards", s.config.Shards, "lease_ttl", s.config.LeaseTTL)
+		}
+		id := s.config.ReplicaID
+		if id == "" {
+			id = replicaID()
+		}
+		s.coordinator = newCoordinator(s.db, s.logger, id, s.config.Shards,
+			s.config.LeaseTTL, func(ctx context.Context) { s.reconcileChecks(ctx) })
+		s.retention.active = func() bool { return s.coordinator.holds(0) }
+		s.logger.Infow("Start coordination", "replica_id", id)
+		go s.coordinator.run(s.ctx)
+	})
+}
+
+// owns returns, if the check is run by this replica
+func (s *server) owns(c check) bool {
+	if s.coordinator == nil {
+		return true
+	}
+	return s.coordinator.owns(c.CheckID(), c.CheckType())
+}
+
+// runs returns, if the check should be running on this replica
+func (s *server) runs(c check) bool {
+	return c.Enabled() && s.owns(c)
+}
+
+// loadCheck returns the stored check or nil, if it does not exist
+func (s *server) loadCheck(ctx context.Context, id int64, checkType string) (check, error) {
+	var c check
+	var err error
+	switch checkType {
+	case "http":
+		var hc *httpCheck
+		if hc, err = s.db.GetHTTPCheck(ctx, id); err == nil {
+			c = s.newHTTPRunnerCheck(*hc)
+		}
+	case "tls":
+		var tc *tlsCheck
+		if tc, err = s.db.GetTLSCheck(ctx, id); err == nil {
+			c = s.newTLSRunnerCheck(*tc)
+		}
+	case "tcp":
+		var tc *tcpCheck
+		if tc, err = s.db.GetTCPCheck(ctx, id); err == nil {
+			c = s.newTCPRunnerCheck(*tc)
+		}
+	case "dns":
+		var dc *dnsCheck
+		if dc, err = s.db.GetDNSCheck(ctx, id); err == nil {
+			c = s.newDNSRunnerCheck(*dc)
+		}
+	case "heartbeat":
+		var hc *heartbeatCheck
+		if hc, err = s.db.GetHeartbeatCheck(ctx, id); err == nil {
+			c = s.newHeartbeatRunnerCheck(*hc)
+		}
+	default:
+		return nil, fmt.Errorf("unknown check type %v", checkType)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return c, err
+}
+
+// reconcileCheck reconciles the running check with the database after it
+// was changed
+func (s *server) reconcileCheck(ctx context.Context, id int64, checkType string) {
+	c, err := s.loadCheck(ctx, id, checkType)
+	if err != nil {
+		s.logger.Errorw("Unable to get check from database", "error", err,
+			"check_id", id, "check_type", checkType)
+		return
+	}
+	if c != nil && !s.runs(c) {
+		c = nil
+	}
+	key := checkKey{checkID: id, checkType: checkType}
+	if c == nil && !s.m.running(key) {
+		return
+	}
+	report := &reconcileReport{}
+	s.m.reconcileOne(key, c, report)
+	s.logReconcileReport(report)
+}
+
+// loadChecks returns all stored checks
+func (s *server) loadChecks(ctx context.Context) ([]check, error) {
+	cs := []check{}
+
+	httpChecks, err := s.db.GetHTTPChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *httpChecks {
+		cs = append(cs, s.newHTTPRunnerCheck(c))
+	}
+
+	tlsChecks, err := s.db.GetTLSChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *tlsChecks {
+		cs = append(cs, s.newTLSRunnerCheck(c))
+	}
+
+	tcpChecks, err := s.db.GetTCPChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *tcpChecks {
+		cs = append(cs, s.newTCPRunnerCheck(c))
+	}
+
+	dnsChecks, err := s.db.GetDNSChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *dnsChecks {
+		cs = append(cs, s.newDNSRunnerCheck(c))
+	}
+
+	heartbeatChecks, err := s.db.GetHeartbeatChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *heartbeatChecks {
+		cs = append(cs, s.newHeartbeatRunnerCheck(c))
+	}
+	return cs, nil
+}
+
+// reconcileChecks runs all enabled checks owned by this replica with their
+// current configuration and stops all other checks
+func (s *server) reconcileChecks(ctx context.Context) (*reconcileReport, error) {
+	cs, err := s.loadChecks(ctx)
+	if err != nil {
+		s.logger.Errorw("Unable to get checks from database", "error", err)
+		return nil, err
+	}
+	wanted := make(map[checkKey]check)
+	for _, c := range cs {
+		if s.runs(c) {
+			wanted[checkKey{checkID: c.CheckID(), checkType: c.CheckType()}] = c
+		}
+	}
+	report := s.m.reconcile(wanted)
+	s.logReconcileReport(report)
+	return report, nil
+}
+
+func (s *server) logReconcileReport(report *reconcileReport) {
+	if report.empty() {
+		return
+	}
+	s.logger.Infow("Reconciled checks",
+		"added", report.Added, "removed", report.Removed,
+		"updated", report.Updated)
+}
+
+func (s *server) ReconcileChecks(ctx context.Context, _ *empty.Empty) (*proto.ReconcileReport, error) {
+	report, err := s.reconcileChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalReconcileReport(report, time.Now())
+}
+
+func (s *server) RegisterWorker(ctx context.Context, w *proto.Worker) (*proto.Response, error) {
+	now := time.Now()
+	wo, err := marshalWorker(w, now)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid worker, %v", err)
+	}
+	err = s.db.UpdateWorker(ctx, wo)
+	if err != nil {
+		s.logger.Errorw("Unable to register worker", "error", err, "address", wo.Address)
+		return nil, err
+	}
+	if !s.workers.known(wo.Address) {
+		err = s.workers.refresh(ctx, now)
+		if err != nil {
+			s.logger.Errorw("Unable to refresh workers", "error", err)
+		}
+	}
+	return &proto.Response{}, nil
+}
+
+func (s *server) GetWorkers(ctx context.Context, _ *empty.Empty) (*proto.Workers, error) {
+	ws, err := s.db.GetWorkers(ctx, time.Now().Add(-workerTTL))
+	if err != nil {
+		s.logger.Errorw("Unable to get workers", "error", err)
+		return nil, err
+	}
+	return unmarshalWorkers(*ws)
+}
+
+func (s *server) CreateAgent(ctx context.Context, a *proto.Agent) (*proto.Agent, error) {
+	ag, err := marshalAgent(a)
+	if err != nil {
+		s.logger.Infow("Invalid agent", "error", err, "user_id", a.UserId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid agent, %v", err)
+	}
+	ag.Token, err = generateToken(agentTokenLength)
+	if err != nil {
+		s.logger.Errorw("Unable to generate agent token", "error", err)
+		return nil, err
+	}
+	id, err := s.db.CreateAgent(ctx, ag)
+	if err != nil {
+		s.logger.Errorw("Unable to create agent", "error", err, "user_id", a.UserId)
+		return nil, err
+	}
+	ag.ID = id
+
+	s.logger.Infow("Created agent", "agent_id", id, "user_id", a.UserId)
+	pa, err := unmarshalAgent(ag, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	pa.Token = ag.Token
+	return pa, nil
+}
+
+func (s *server) GetAgent(ctx context.Context, id *proto.Id) (*proto.Agent, error) {
+	a, err := s.db.GetAgent(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get agent by id", "error", err, "agent_id", id.Id)
+		return nil, err
+	}
+	return unmarshalAgent(a, time.Now())
+}
+
+func (s *server) GetAgentsByUser(ctx context.Context, id *proto.Id) (*proto.Agents, error) {
+	as, err := s.db.GetAgentsByUser(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get agents by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	return unmarshalAgentCollection(as, time.Now())
+}
+
+func (s *server) DeleteAgent(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteAgent(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete agent", "error", err, "agent_id", id.Id)
+		return nil, err
+	}
+	s.workers.removeAgent(id.Id)
+
+	s.logger.Infow("Deleted agent", "agent_id", id.Id)
+	return &proto.Response{}, nil
+}
+
+// ConnectAgent serves the stream of a probe agent. The agent has to
+// authenticate with its token in the first message and gets the jobs of the
+// checks in its location afterwards.
+func (s *server) ConnectAgent(stream proto.CheckManagerService_ConnectAgentServer) error {
+	s.init()
+	ctx := stream.Context()
+
+	m, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if m.Hello == nil {
+		return status.Errorf(codes.Unauthenticated, "missing hello")
+	}
+	a, err := s.db.GetAgentByToken(ctx, m.Hello.Token)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Infow("Agent with invalid token")
+		return status.Errorf(codes.Unauthenticated, "invalid token")
+	}
+	if err != nil {
+		s.logger.Errorw("Unable to get agent by token", "error", err)
+		return err
+	}
+
+	ac := s.workers.attachAgent(*a, stream)
+	defer s.workers.detachAgent(ac, stream)
+	s.logger.Infow("Agent connected", "agent_id", a.ID)
+	err = s.db.UpdateAgentSeen(ctx, a.ID, time.Now())
+	if err != nil {
+		s.logger.Errorw("Unable to update agent", "error", err, "agent_id", a.ID)
+	}
+
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			s.logger.Infow("Agent disconnected", "agent_id", a.ID)
+			return nil
+		}
+		if err != nil {
+			s.logger.Infow("Agent connection failed", "error", err, "agent_id", a.ID)
+			return err
+		}
+		now := time.Now()
+		switch {
+		case m.Heartbeat != nil:
+			err = s.db.UpdateAgentSeen(ctx, a.ID, now)
+			if err != nil {
+				s.logger.Errorw("Unable to update agent", "error", err, "agent_id", a.ID)
+			}
+		case m.Result != nil:
+			run, late := ac.deliver(m.Result, now)
+			if !late {
+				continue
+			}
+			err = s.storeLateResult(ctx, a, run, m.Result)
+			if err != nil {
+				s.logger.Errorw("Unable to store late result", "error", err, "agent_id", a.ID)
+			}
+		}
+	}
+}
+
+// init the resources of the server on first grpc call
+func (s *server) initInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	s.init()
+
+	// Calls the next handler
+	return handler(ctx, req)
+}
+
+func (s *server) newHTTPRunnerCheck(c httpCheck) *httpRunnerCheck {
+	return &httpRunnerCheck{
+		httpCheck:   c,
+		alert:       s.alert,
+		db:          s.db,
+		workers:     s.workers,
+		maintenance: s.maintenance,
+	}
+}
+
+func (s *server) GetHTTPCheck(ctx context.Context, id *proto.Id) (*proto.HTTPCheck, error) {
+	c, err := s.db.GetHTTPCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get http check by id", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	l, err := getCheckLabels(ctx, s.db, checkKey{checkID: c.ID, checkType: "http"})
+	if err != nil {
+		s.logger.Errorw("Unable to get labels of http check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	pc := unmarshalHTTPCheck(c)
+	redactHTTPCheck(pc)
+	pc.Labels, pc.Groups = l.Labels, l.Groups
+	return pc, nil
+}
+
+func (s *server) GetHTTPCheckByUser(ctx context.Context, q *proto.CheckQuery) (*proto.HTTPChecks, error) {
+	f, err := s.labelFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.db.GetHTTPChecksByUser(ctx, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get http checks by user id", "error", err, "user_id", q.UserId)
+		return nil, err
+	}
+	return unmarshalCheckCollection(cs, f), nil
+}
+
+func (s *server) CreateHTTPCheck(ctx context.Context, c *proto.HTTPCheck) (*proto.Id, error) {
+	check, err := marshalHTTPCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid http check", "error", err, "url", c.Url)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid http check, %v", err)
+	}
+	check.keepSecrets(&httpCheck{})
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+	id, err := s.db.CreateHTTPCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to create http check", "error", err, "url", c.Url)
+		return nil, err
+	}
+	check.ID = id
+
+	s.reconcileCheck(ctx, check.ID, "http")
+
+	s.logger.Infow("Created http check", "check_id", id, "url", c.Url)
+	return &proto.Id{Id: id}, nil
+}
+
+func (s *server) UpdateHTTPCheck(ctx context.Context, c *proto.HTTPCheck) (*proto.Response, error) {
+	check, err := marshalHTTPCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid http check", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid http check, %v", err)
+	}
+
+	// Keep the owner and the unchanged secrets of the check
+	old, err := s.db.GetHTTPCheck(ctx, c.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get http check by id", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get http check, %v", err)
+	}
+	check.UserID = old.UserID
+	check.keepSecrets(old)
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateHTTPCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to update http check", "error", err, "check_id", c.Id)
+		return nil, err
+	}
+	s.reconcileCheck(ctx, c.Id, "http")
+
+	s.logger.Infow("Updated http check", "check_id", c.Id, "url", c.Url)
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteHTTPCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteHTTPCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete http check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	s.reconcileCheck(ctx, id.Id, "http")
+	s.deleteState(ctx, &httpRunnerCheck{httpCheck: httpCheck{ID: id.Id}})
+
+	s.logger.Infow("Deleted http check", "id", id.String())
+	return &proto.Response{}, nil
+}
+
+// resultQuery marshals the query of results. Queries reaching back to
+// purged results are rejected, since only the rollups of the check cover
+// them.
+func (s *server) resultQuery(pq *proto.ResultQuery) (*resultQuery, error) {
+	q, err := marshalResultQuery(pq)
+	if err != nil {
+		s.logger.Infow("Invalid result query", "error", err, "check_id", pq.CheckId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid result query, %v", err)
+	}
+	err = s.retention.checkResults(q, time.Now())
+	if err != nil {
+		s.logger.Infow("Result query out of retention", "error", err, "check_id", pq.CheckId)
+		return nil, status.Errorf(codes.OutOfRange, "%v", err)
+	}
+	return q, nil
+}
+
+func (s *server) GetHTTPCheckResultsByCheck(ctx context.Context, pq *proto.ResultQuery) (*proto.HTTPResults, error) {
+	q, err := s.resultQuery(pq)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.db.GetHTTPResults(ctx, q)
+	if err != nil {
+		s.logger.Errorw("Unable to get http results by check", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	n, cursor := q.page(len(*rs), func(i int) resultCursor {
+		return resultCursor{Timestamp: (*rs)[i].Timestamp, ID: (*rs)[i].ID}
+	})
+	*rs = (*rs)[:n]
+	results, err := unmarshalCheckResultCollection(rs)
+	if err != nil {
+		s.logger.Errorw("Unable to unmarshal http results", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	results.NextCursor = cursor
+	return results, nil
+}
+
+func (s *server) newTLSRunnerCheck(c tlsCheck) *tlsRunnerCheck {
+	return &tlsRunnerCheck{
+		tlsCheck:    c,
+		alert:       s.alert,
+		db:          s.db,
+		workers:     s.workers,
+		maintenance: s.maintenance,
+	}
+}
+
+func (s *server) GetTLSCheck(ctx context.Context, id *proto.Id) (*proto.TLSCheck, error) {
+	c, err := s.db.GetTLSCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get tls check by id", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	l, err := getCheckLabels(ctx, s.db, checkKey{checkID: c.ID, checkType: "tls"})
+	if err != nil {
+		s.logger.Errorw("Unable to get labels of tls check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	pc := unmarshalTLSCheck(c)
+	pc.Labels, pc.Groups = l.Labels, l.Groups
+	return pc, nil
+}
+
+func (s *server) GetTLSCheckByUser(ctx context.Context, q *proto.CheckQuery) (*proto.TLSChecks, error) {
+	f, err := s.labelFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.db.GetTLSChecksByUser(ctx, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get tls checks by user id", "error", err, "user_id", q.UserId)
+		return nil, err
+	}
+	return unmarshalTLSCheckCollection(cs, f), nil
+}
+
+func (s *server) CreateTLSCheck(ctx context.Context, c *proto.TLSCheck) (*proto.Id, error) {
+	check, err := marshalTLSCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid tls check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tls check, %v", err)
+	}
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+	id, err := s.db.CreateTLSCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to create tls check", "error", err, "check", c.String())
+		return nil, err
+	}
+	check.ID = id
+
+	s.reconcileCheck(ctx, check.ID, "tls")
+
+	s.logger.Infow("Created tls check", "check", c.String())
+	return &proto.Id{Id: id}, nil
+}
+
+func (s *server) UpdateTLSCheck(ctx context.Context, c *proto.TLSCheck) (*proto.Response, error) {
+	check, err := marshalTLSCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid tls check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tls check, %v", err)
+	}
+
+	// Keep the owner of the check
+	old, err := s.db.GetTLSCheck(ctx, c.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get tls check by id", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get tls check, %v", err)
+	}
+	check.UserID = old.UserID
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateTLSCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to update tls check", "error", err, "check", c.String())
+		return nil, err
+	}
+	s.reconcileCheck(ctx, check.ID, "tls")
+
+	s.logger.Infow("Updated tls check", "check", c.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteTLSCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteTLSCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete tls check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	c := s.newTLSRunnerCheck(tlsCheck{ID: id.Id})
+	s.reconcileCheck(ctx, id.Id, "tls")
+	s.deleteState(ctx, c)
+
+	s.logger.Infow("Deleted tls check", "id", id.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) GetTLSCheckResultsByCheck(ctx context.Context, pq *proto.ResultQuery) (*proto.TLSResults, error) {
+	q, err := s.resultQuery(pq)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.db.GetTLSResults(ctx, q)
+	if err != nil {
+		s.logger.Errorw("Unable to get tls results by check", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	n, cursor := q.page(len(*rs), func(i int) resultCursor {
+		return resultCursor{Timestamp: (*rs)[i].Timestamp, ID: (*rs)[i].ID}
+	})
+	*rs = (*rs)[:n]
+	results, err := unmarshalTLSResultCollection(rs)
+	if err != nil {
+		s.logger.Errorw("Unable to unmarshal tls results", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	results.NextCursor = cursor
+	return results, nil
+}
+
+func (s *server) newTCPRunnerCheck(c tcpCheck) *tcpRunnerCheck {
+	return &tcpRunnerCheck{
+		tcpCheck:    c,
+		alert:       s.alert,
+		db:          s.db,
+		workers:     s.workers,
+		maintenance: s.maintenance,
+	}
+}
+
+func (s *server) GetTCPCheck(ctx context.Context, id *proto.Id) (*proto.TCPCheck, error) {
+	c, err := s.db.GetTCPCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get tcp check by id", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	l, err := getCheckLabels(ctx, s.db, checkKey{checkID: c.ID, checkType: "tcp"})
+	if err != nil {
+		s.logger.Errorw("Unable to get labels of tcp check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	pc := unmarshalTCPCheck(c)
+	pc.Labels, pc.Groups = l.Labels, l.Groups
+	return pc, nil
+}
+
+func (s *server) GetTCPCheckByUser(ctx context.Context, q *proto.CheckQuery) (*proto.TCPChecks, error) {
+	f, err := s.labelFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.db.GetTCPChecksByUser(ctx, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get tcp checks by user id", "error", err, "user_id", q.UserId)
+		return nil, err
+	}
+	return unmarshalTCPCheckCollection(cs, f), nil
+}
+
+func (s *server) CreateTCPCheck(ctx context.Context, c *proto.TCPCheck) (*proto.Id, error) {
+	check, err := marshalTCPCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid tcp check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tcp check, %v", err)
+	}
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+	id, err := s.db.CreateTCPCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to create tcp check", "error", err, "check", c.String())
+		return nil, err
+	}
+	check.ID = id
+
+	s.reconcileCheck(ctx, check.ID, "tcp")
+
+	s.logger.Infow("Created tcp check", "check", c.String())
+	return &proto.Id{Id: id}, nil
+}
+
+func (s *server) UpdateTCPCheck(ctx context.Context, c *proto.TCPCheck) (*proto.Response, error) {
+	check, err := marshalTCPCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid tcp check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tcp check, %v", err)
+	}
+
+	// Keep the owner of the check
+	old, err := s.db.GetTCPCheck(ctx, c.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get tcp check by id", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get tcp check, %v", err)
+	}
+	check.UserID = old.UserID
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateTCPCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to update tcp check", "error", err, "check", c.String())
+		return nil, err
+	}
+	s.reconcileCheck(ctx, check.ID, "tcp")
+
+	s.logger.Infow("Updated tcp check", "check", c.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteTCPCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteTCPCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete tcp check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	c := s.newTCPRunnerCheck(tcpCheck{ID: id.Id})
+	s.reconcileCheck(ctx, id.Id, "tcp")
+	s.deleteState(ctx, c)
+
+	s.logger.Infow("Deleted tcp check", "id", id.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) GetTCPCheckResultsByCheck(ctx context.Context, pq *proto.ResultQuery) (*proto.TCPResults, error) {
+	q, err := s.resultQuery(pq)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.db.GetTCPResults(ctx, q)
+	if err != nil {
+		s.logger.Errorw("Unable to get tcp results by check", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	n, cursor := q.page(len(*rs), func(i int) resultCursor {
+		return resultCursor{Timestamp: (*rs)[i].Timestamp, ID: (*rs)[i].ID}
+	})
+	*rs = (*rs)[:n]
+	results, err := unmarshalTCPResultCollection(rs)
+	if err != nil {
+		s.logger.Errorw("Unable to unmarshal tcp results", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	results.NextCursor = cursor
+	return results, nil
+}
+
+func (s *server) newDNSRunnerCheck(c dnsCheck) *dnsRunnerCheck {
+	return &dnsRunnerCheck{
+		dnsCheck:    c,
+		alert:       s.alert,
+		db:          s.db,
+		workers:     s.workers,
+		maintenance: s.maintenance,
+	}
+}
+
+func (s *server) GetDNSCheck(ctx context.Context, id *proto.Id) (*proto.DNSCheck, error) {
+	c, err := s.db.GetDNSCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get dns check by id", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	l, err := getCheckLabels(ctx, s.db, checkKey{checkID: c.ID, checkType: "dns"})
+	if err != nil {
+		s.logger.Errorw("Unable to get labels of dns check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	pc := unmarshalDNSCheck(c)
+	pc.Labels, pc.Groups = l.Labels, l.Groups
+	return pc, nil
+}
+
+func (s *server) GetDNSCheckByUser(ctx context.Context, q *proto.CheckQuery) (*proto.DNSChecks, error) {
+	f, err := s.labelFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.db.GetDNSChecksByUser(ctx, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get dns checks by user id", "error", err, "user_id", q.UserId)
+		return nil, err
+	}
+	return unmarshalDNSCheckCollection(cs, f), nil
+}
+
+func (s *server) CreateDNSCheck(ctx context.Context, c *proto.DNSCheck) (*proto.Id, error) {
+	check, err := marshalDNSCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid dns check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid dns check, %v", err)
+	}
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+	id, err := s.db.CreateDNSCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to create dns check", "error", err, "check", c.String())
+		return nil, err
+	}
+	check.ID = id
+
+	s.reconcileCheck(ctx, check.ID, "dns")
+
+	s.logger.Infow("Created dns check", "check", c.String())
+	return &proto.Id{Id: id}, nil
+}
+
+func (s *server) UpdateDNSCheck(ctx context.Context, c *proto.DNSCheck) (*proto.Response, error) {
+	check, err := marshalDNSCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid dns check", "error", err, "check", c.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid dns check, %v", err)
+	}
+
+	// Keep the owner of the check
+	old, err := s.db.GetDNSCheck(ctx, c.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get dns check by id", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get dns check, %v", err)
+	}
+	check.UserID = old.UserID
+	if err := s.authorizePlacement(ctx, check.UserID, check.placement); err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateDNSCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to update dns check", "error", err, "check", c.String())
+		return nil, err
+	}
+	s.reconcileCheck(ctx, check.ID, "dns")
+
+	s.logger.Infow("Updated dns check", "check", c.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteDNSCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteDNSCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete dns check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	c := s.newDNSRunnerCheck(dnsCheck{ID: id.Id})
+	s.reconcileCheck(ctx, id.Id, "dns")
+	s.deleteState(ctx, c)
+
+	s.logger.Infow("Deleted dns check", "id", id.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) GetDNSCheckResultsByCheck(ctx context.Context, pq *proto.ResultQuery) (*proto.DNSResults, error) {
+	q, err := s.resultQuery(pq)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.db.GetDNSResults(ctx, q)
+	if err != nil {
+		s.logger.Errorw("Unable to get dns results by check", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	n, cursor := q.page(len(*rs), func(i int) resultCursor {
+		return resultCursor{Timestamp: (*rs)[i].Timestamp, ID: (*rs)[i].ID}
+	})
+	*rs = (*rs)[:n]
+	results, err := unmarshalDNSResultCollection(rs)
+	if err != nil {
+		s.logger.Errorw("Unable to unmarshal dns results", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	results.NextCursor = cursor
+	return results, nil
+}
+
+func (s *server) newHeartbeatRunnerCheck(c heartbeatCheck) *heartbeatRunnerCheck {
+	return &heartbeatRunnerCheck{
+		heartbeatCheck: c,
+		since:          time.Now(),
+		alert:          s.alert,
+		db:             s.db,
+		maintenance:    s.maintenance,
+	}
+}
+
+func (s *server) GetHeartbeatCheck(ctx context.Context, id *proto.Id) (*proto.HeartbeatCheck, error) {
+	c, err := s.db.GetHeartbeatCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get heartbeat check by id", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	l, err := getCheckLabels(ctx, s.db, checkKey{checkID: c.ID, checkType: "heartbeat"})
+	if err != nil {
+		s.logger.Errorw("Unable to get labels of heartbeat check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	pc := unmarshalHeartbeatCheck(c)
+	pc.Labels, pc.Groups = l.Labels, l.Groups
+	return pc, nil
+}
+
+func (s *server) GetHeartbeatCheckByUser(ctx context.Context, q *proto.CheckQuery) (*proto.HeartbeatChecks, error) {
+	f, err := s.labelFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.db.GetHeartbeatChecksByUser(ctx, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get heartbeat checks by user id", "error", err, "user_id", q.UserId)
+		return nil, err
+	}
+	return unmarshalHeartbeatCheckCollection(cs, f), nil
+}
+
+// CreateHeartbeatCheck returns the created check, since the caller needs the
+// generated token to build the ping url.
+func (s *server) CreateHeartbeatCheck(ctx context.Context, c *proto.HeartbeatCheck) (*proto.HeartbeatCheck, error) {
+	check, err := marshalHeartbeatCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid heartbeat check", "error", err, "user_id", c.UserId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid heartbeat check, %v", err)
+	}
+	check.Token, err = generateToken(32)
+	if err != nil {
+		s.logger.Errorw("Unable to generate heartbeat token", "error", err)
+		return nil, err
+	}
+	id, err := s.db.CreateHeartbeatCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to create heartbeat check", "error", err, "user_id", c.UserId)
+		return nil, err
+	}
+	check.ID = id
+	check.Enabled = true
+
+	s.reconcileCheck(ctx, check.ID, "heartbeat")
+
+	s.logger.Infow("Created heartbeat check", "check_id", id, "user_id", c.UserId)
+	return unmarshalHeartbeatCheck(check), nil
+}
+
+func (s *server) UpdateHeartbeatCheck(ctx context.Context, c *proto.HeartbeatCheck) (*proto.Response, error) {
+	check, err := marshalHeartbeatCheck(c)
+	if err != nil {
+		s.logger.Infow("Invalid heartbeat check", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid heartbeat check, %v", err)
+	}
+
+	// Keep the owner and the token of the check
+	old, err := s.db.GetHeartbeatCheck(ctx, c.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get heartbeat check by id", "error", err, "check_id", c.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get heartbeat check, %v", err)
+	}
+	check.UserID = old.UserID
+	check.Token = old.Token
+
+	err = s.db.UpdateHeartbeatCheck(ctx, check)
+	if err != nil {
+		s.logger.Errorw("Unable to update heartbeat check", "error", err, "check_id", c.Id)
+		return nil, err
+	}
+	s.reconcileCheck(ctx, check.ID, "heartbeat")
+
+	s.logger.Infow("Updated heartbeat check", "check_id", c.Id)
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteHeartbeatCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteHeartbeatCheck(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete heartbeat check", "error", err, "check_id", id.Id)
+		return nil, err
+	}
+	c := s.newHeartbeatRunnerCheck(heartbeatCheck{ID: id.Id})
+	s.reconcileCheck(ctx, id.Id, "heartbeat")
+	s.deleteState(ctx, c)
+
+	s.logger.Infow("Deleted heartbeat check", "id", id.String())
+	return &proto.Response{}, nil
+}
+
+func (s *server) GetHeartbeatCheckResultsByCheck(ctx context.Context, pq *proto.ResultQuery) (*proto.HeartbeatResults, error) {
+	q, err := s.resultQuery(pq)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.db.GetHeartbeatResults(ctx, q)
+	if err != nil {
+		s.logger.Errorw("Unable to get heartbeat results by check", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	n, cursor := q.page(len(*rs), func(i int) resultCursor {
+		return resultCursor{Timestamp: (*rs)[i].Timestamp, ID: (*rs)[i].ID}
+	})
+	*rs = (*rs)[:n]
+	results, err := unmarshalHeartbeatResultCollection(rs)
+	if err != nil {
+		s.logger.Errorw("Unable to unmarshal heartbeat results", "error", err, "check_id", pq.CheckId)
+		return nil, err
+	}
+	results.NextCursor = cursor
+	return results, nil
+}
+
+// PingHeartbeat stores a ping for the check with the given token. A success
+// or fail ping following a start ping records the runtime of the job.
+func (s *server) PingHeartbeat(ctx context.Context, p *proto.HeartbeatPing) (*proto.Response, error) {
+	kind := p.Kind
+	if kind == "" {
+		kind = heartbeatSuccess
+	}
+	if kind != heartbeatSuccess && kind != heartbeatStart && kind != heartbeatFail {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ping kind %v", p.Kind)
+	}
+
+	c, err := s.db.GetHeartbeatCheckByToken(ctx, p.Token)
+	if err != nil {
+		s.logger.Infow("Unable to get heartbeat check by token", "error", err)
+		return nil, status.Errorf(codes.NotFound, "unknown heartbeat token")
+	}
+
+	t := time.Now()
+	var duration time.Duration
+	if kind != heartbeatStart {
+		last, err := s.db.GetLastHeartbeatResult(ctx, c.ID)
 		if err != nil {
-			s.logger.Fatalw("Unable to connect to httpcheck service", "error", err)
+			s.logger.Errorw("Unable to get last heartbeat result", "error", err, "check_id", c.ID)
+			return nil, err
 		}
-		s.httpcheck = httpcheck.NewHTTPCheckServiceClient(d)
-		s.logger.Info("Connected to httpcheck service")
-
-		s.logger.Infow("Start all stored http checks")
-		for _, c := range *cs {
-			s.m.start(&httpRunnerCheck{
-				httpCheck: c,
-				alert:     s.alert,
-				db:        s.db,
-				httpcheck: s.httpcheck,
-			})
+		if last != nil && last.Kind == heartbeatStart {
+			duration = t.Sub(last.Timestamp)
 		}
+	}
+
+	message := p.Message
+	if len(message) > maxHeartbeatMessage {
+		message = message[:maxHeartbeatMessage]
+	}
+	_, err = s.db.CreateHeartbeatResult(ctx, &heartbeatResult{
+		CheckID:     c.ID,
+		Timestamp:   t,
+		Kind:        kind,
+		Success:     kind != heartbeatFail,
+		Duration:    int64(duration),
+		Message:     message,
+		Maintenance: s.maintenance.modeOf(c.UserID, checkKey{checkID: c.ID, checkType: "heartbeat"}, t) != "",
 	})
-}
+	if err != nil {
+		s.logger.Errorw("Unable to store heartbeat ping", "error", err, "check_id", c.ID)
+		return nil, err
+	}
 
-// init the resources of the server on first grpc call
-func (s *server) initInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	s.init()
+	s.logger.Infow("Received heartbeat ping", "check_id", c.ID, "kind", kind)
+	return &proto.Response{}, nil
+}
 
-	// Calls the next handler
-	return handler(ctx, req)
+// deleteState removes the persisted state and the rollups of a deleted check
+func (s *server) deleteState(ctx context.Context, c check) {
+	err := s.db.DeleteCheckState(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		s.logger.Errorw("Unable to delete check state", "error", err,
+			"check_id", c.CheckID(), "check_type", c.CheckType())
+	}
+	err = s.db.DeleteRollups(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		s.logger.Errorw("Unable to delete check rollups", "error", err,
+			"check_id", c.CheckID(), "check_type", c.CheckType())
+	}
+	err = s.db.DeleteDependencies(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		s.logger.Errorw("Unable to delete check dependencies", "error", err,
+			"check_id", c.CheckID(), "check_type", c.CheckType())
+	}
+	err = s.db.DeleteLabels(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		s.logger.Errorw("Unable to delete check labels", "error", err,
+			"check_id", c.CheckID(), "check_type", c.CheckType())
+	}
+	err = s.db.DeleteMaintenanceWindowsByCheck(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		s.logger.Errorw("Unable to delete maintenance windows of check", "error", err,
+			"check_id", c.CheckID(), "check_type", c.CheckType())
+	}
+	s.refreshMaintenance(ctx)
 }
 
-func (s *server) GetHTTPCheck(ctx context.Context, id *proto.Id) (*proto.HTTPCheck, error) {
-	c, err := s.db.GetHTTPCheck(ctx, id.Id)
+func (s *server) GetCheckState(ctx context.Context, ref *proto.CheckRef) (*proto.CheckState, error) {
+	cs, err := s.db.GetCheckState(ctx, ref.Id, ref.Type)
 	if err != nil {
-		s.logger.Errorw("Unable to get http check by id", "error", err, "check_id", id.Id)
+		s.logger.Errorw("Unable to get check state", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type)
 		return nil, err
 	}
+	return unmarshalCheckState(cs)
+}
 
-	return unmarshalHTTPCheck(c), nil
+// runnable returns the stored check referenced by ref
+func (s *server) runnable(ctx context.Context, ref *proto.CheckRef) (runnable, error) {
+	var c runnable
+	var err error
+	switch ref.Type {
+	case "http":
+		var check *httpCheck
+		check, err = s.db.GetHTTPCheck(ctx, ref.Id)
+		if err == nil {
+			c = s.newHTTPRunnerCheck(*check)
+		}
+	case "tls":
+		var check *tlsCheck
+		check, err = s.db.GetTLSCheck(ctx, ref.Id)
+		if err == nil {
+			c = s.newTLSRunnerCheck(*check)
+		}
+	case "tcp":
+		var check *tcpCheck
+		check, err = s.db.GetTCPCheck(ctx, ref.Id)
+		if err == nil {
+			c = s.newTCPRunnerCheck(*check)
+		}
+	case "dns":
+		var check *dnsCheck
+		check, err = s.db.GetDNSCheck(ctx, ref.Id)
+		if err == nil {
+			c = s.newDNSRunnerCheck(*check)
+		}
+	case "heartbeat":
+		return nil, status.Errorf(codes.InvalidArgument, "heartbeat checks can not be run")
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown check type %v", ref.Type)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "unknown %v check %v", ref.Type, ref.Id)
+	}
+	if err != nil {
+		s.logger.Errorw("Unable to get check", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type)
+		return nil, err
+	}
+	return c, nil
 }
 
-func (s *server) GetHTTPCheckByUser(ctx context.Context, id *proto.Id) (*proto.HTTPChecks, error) {
-	cs, err := s.db.GetHTTPChecksByUser(ctx, id.Id)
+func (s *server) RunCheck(ctx context.Context, ref *proto.CheckRef) (*proto.RunResult, error) {
+	c, err := s.runnable(ctx, ref)
 	if err != nil {
-		s.logger.Errorw("Unable to get http checks by user id", "error", err, "user_id", id.Id)
 		return nil, err
 	}
-	return unmarshalCheckCollection(cs), nil
+	// Runs of paused checks would record results and states, which the
+	// scheduler does not
+	now := time.Now()
+	if !c.Enabled() {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v check %v is paused", ref.Type, ref.Id)
+	}
+	if s.maintenance.paused(c, now) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v check %v is paused by maintenance", ref.Type, ref.Id)
+	}
+	run, err := c.Run(ctx, now, true)
+	if err != nil {
+		s.logger.Errorw("Unable to run check", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type)
+		return nil, status.Errorf(codes.Unavailable, "unable to run check, %v", err)
+	}
+	s.logger.Infow("Ran check", "check_id", ref.Id, "check_type", ref.Type,
+		"success", run.Success)
+	return run, nil
 }
 
-func (s *server) CreateHTTPCheck(ctx context.Context, c *proto.HTTPCheck) (*proto.Id, error) {
-	check := marshalHTTPCheck(c)
-	id, err := s.db.CreateHTTPCheck(ctx, check)
+func (s *server) PauseCheck(ctx context.Context, ref *proto.CheckRef) (*proto.Response, error) {
+	return s.setCheckEnabled(ctx, ref, false)
+}
+
+func (s *server) ResumeCheck(ctx context.Context, ref *proto.CheckRef) (*proto.Response, error) {
+	return s.setCheckEnabled(ctx, ref, true)
+}
+
+// setCheckEnabled pauses or resumes the check and stops or starts it
+// accordingly
+func (s *server) setCheckEnabled(ctx context.Context, ref *proto.CheckRef, enabled bool) (*proto.Response, error) {
+	c, err := s.loadCheck(ctx, ref.Id, ref.Type)
+	if err != nil {
+		s.logger.Errorw("Unable to get check", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type)
+		return nil, status.Errorf(codes.InvalidArgument, "unable to get check, %v", err)
+	}
+	if c == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown %v check %v", ref.Type, ref.Id)
+	}
+	err = s.db.SetCheckEnabled(ctx, ref.Id, ref.Type, enabled)
 	if err != nil {
-		s.logger.Errorw("Unable to create http check", "error", err, "check", c.String())
+		s.logger.Errorw("Unable to set enabled of check", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type, "enabled", enabled)
 		return nil, err
 	}
-	check.ID = id
+	s.reconcileCheck(ctx, ref.Id, ref.Type)
 
-	s.m.start(&httpRunnerCheck{
-		httpCheck: *check,
-		alert:     s.alert,
-		db:        s.db,
-		httpcheck: s.httpcheck,
-	})
+	if enabled {
+		s.logger.Infow("Resumed check", "check_id", ref.Id, "check_type", ref.Type)
+	} else {
+		s.logger.Infow("Paused check", "check_id", ref.Id, "check_type", ref.Type)
+	}
+	return &proto.Response{}, nil
+}
 
-	s.logger.Infow("Created http check", "check", c.String())
-	return &proto.Id{Id: id}, nil
+func (s *server) GetCheckDependencies(ctx context.Context, ref *proto.CheckRef) (*proto.CheckDependencies, error) {
+	key, err := marshalCheckRef(ref)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid check, %v", err)
+	}
+	ds, err := s.db.GetDependencies(ctx, key.checkID, key.checkType)
+	if err != nil {
+		s.logger.Errorw("Unable to get check dependencies", "error", err,
+			"check_id", ref.Id, "check_type", ref.Type)
+		return nil, err
+	}
+	return unmarshalCheckDependencies(key, *ds), nil
 }
 
-func (s *server) UpdateHTTPCheck(ctx context.Context, c *proto.HTTPCheck) (*proto.Response, error) {
-	err := s.db.UpdateHTTPCheck(ctx, marshalHTTPCheck(c))
+// SetCheckDependencies replaces the parents of the check after ensuring, that
+// they belong to the same user and do not introduce a cycle
+func (s *server) SetCheckDependencies(ctx context.Context, d *proto.CheckDependencies) (*proto.Response, error) {
+	key, parents, err := marshalCheckDependencies(d)
+	if err != nil {
+		s.logger.Infow("Invalid check dependencies", "error", err, "dependencies", d.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid dependencies, %v", err)
+	}
+	c, err := s.loadCheck(ctx, key.checkID, key.checkType)
+	if err != nil {
+		s.logger.Errorw("Unable to get check", "error", err,
+			"check_id", key.checkID, "check_type", key.checkType)
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown %v check %v", key.checkType, key.checkID)
+	}
+	for _, parent := range parents {
+		p, err := s.loadCheck(ctx, parent.checkID, parent.checkType)
+		if err != nil {
+			s.logger.Errorw("Unable to get check", "error", err,
+				"check_id", parent.checkID, "check_type", parent.checkType)
+			return nil, err
+		}
+		if p == nil || p.UserID() != c.UserID() {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown parent %v check %v",
+				parent.checkType, parent.checkID)
+		}
+	}
+
+	ds, err := s.db.GetDependenciesByUser(ctx, c.UserID())
 	if err != nil {
-		s.logger.Errorw("Unable to update http check", "error", err, "check", c.String())
+		s.logger.Errorw("Unable to get dependencies by user id", "error", err, "user_id", c.UserID())
 		return nil, err
 	}
+	if parent, ok := findCycle(*ds, key, parents); ok {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"dependency on %v check %v introduces a cycle", parent.checkType, parent.checkID)
+	}
 
-	s.logger.Infow("Updated http check", "check", c.String())
+	err = s.db.SetDependencies(ctx, c.UserID(), key, parents)
+	if err != nil {
+		s.logger.Errorw("Unable to set check dependencies", "error", err,
+			"check_id", key.checkID, "check_type", key.checkType)
+		return nil, err
+	}
+	s.logger.Infow("Set check dependencies", "check_id", key.checkID,
+		"check_type", key.checkType, "parents", len(parents))
 	return &proto.Response{}, nil
 }
 
-func (s *server) DeleteHTTPCheck(ctx context.Context, id *proto.Id) (*proto.Response, error) {
-	err := s.db.DeleteHTTPCheck(ctx, id.Id)
+// labelFilter returns the filter of the checks selected by the query
+func (s *server) labelFilter(ctx context.Context, q *proto.CheckQuery) (*labelFilter, error) {
+	f, err := marshalCheckQuery(q)
 	if err != nil {
-		s.logger.Errorw("Unable to delete http check", "error", err, "check_id", id.Id)
+		s.logger.Infow("Invalid check query", "error", err, "query", q.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid check query, %v", err)
+	}
+	err = f.load(ctx, s.db, q.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get labels by user id", "error", err, "user_id", q.UserId)
 		return nil, err
 	}
+	return f, nil
+}
 
-	s.logger.Infow("Deleted http check", "id", id.String())
+func (s *server) SetCheckLabels(ctx context.Context, l *proto.CheckLabels) (*proto.Response, error) {
+	key, labels, groups, err := marshalCheckLabels(l)
+	if err != nil {
+		s.logger.Infow("Invalid check labels", "error", err, "labels", l.String())
+		return nil, status.Errorf(codes.InvalidArgument, "invalid labels, %v", err)
+	}
+	c, err := s.loadCheck(ctx, key.checkID, key.checkType)
+	if err != nil {
+		s.logger.Errorw("Unable to get check", "error", err,
+			"check_id", key.checkID, "check_type", key.checkType)
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown %v check %v", key.checkType, key.checkID)
+	}
+
+	// The name of the check is managed by Apply
+	old, err := getCheckLabels(ctx, s.db, key)
+	if err != nil {
+		s.logger.Errorw("Unable to get check labels", "error", err,
+			"check_id", key.checkID, "check_type", key.checkType)
+		return nil, err
+	}
+	delete(labels, nameLabel)
+	if name, ok := old.Labels[nameLabel]; ok {
+		labels[nameLabel] = name
+	}
+
+	err = s.db.SetLabels(ctx, c.UserID(), key, labels, groups)
+	if err != nil {
+		s.logger.Errorw("Unable to set check labels", "error", err,
+			"check_id", key.checkID, "check_type", key.checkType)
+		return nil, err
+	}
+	s.logger.Infow("Set check labels", "check_id", key.checkID,
+		"check_type", key.checkType, "labels", len(labels), "groups", len(groups))
 	return &proto.Response{}, nil
 }
 
-func (s *server) GetHTTPCheckResultsByCheck(ctx context.Context, id *proto.Id) (*proto.HTTPResults, error) {
-	return nil, nil
+// GetChecksByUser returns the checks of all types of the user, which match
+// the query
+func (s *server) GetChecksByUser(ctx context.Context, q *proto.CheckQuery) (*proto.Checks, error) {
+	httpChecks, err := s.GetHTTPCheckByUser(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	tlsChecks, err := s.GetTLSCheckByUser(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	tcpChecks, err := s.GetTCPCheckByUser(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	dnsChecks, err := s.GetDNSCheckByUser(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	heartbeatChecks, err := s.GetHeartbeatCheckByUser(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Checks{
+		Http:      httpChecks.Checks,
+		Tls:       tlsChecks.Checks,
+		Tcp:       tcpChecks.Checks,
+		Dns:       dnsChecks.Checks,
+		Heartbeat: heartbeatChecks.Checks,
+	}, nil
+}
+
+func (s *server) GetGroupsByUser(ctx context.Context, id *proto.Id) (*proto.Groups, error) {
+	gs, err := s.db.GetGroupsByUser(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get groups by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	return unmarshalGroups(*gs), nil
+}
+
+func (s *server) GetDependencyGraph(ctx context.Context, id *proto.Id) (*proto.DependencyGraph, error) {
+	ds, err := s.db.GetDependenciesByUser(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get dependencies by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	return unmarshalDependencyGraph(*ds), nil
+}
+
+// Apply changes the checks and alerts of the user to the ones of the
+// document. The checks are changed in a single transaction, afterwards the
+// alerts are changed in the alert service.
+func (s *server) Apply(ctx context.Context, r *proto.ApplyRequest) (*proto.ApplyReport, error) {
+	desired, desiredAlerts, err := marshalDocument(r.UserId, r.Document)
+	if err != nil {
+		s.logger.Infow("Invalid document", "error", err, "user_id", r.UserId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid document, %v", err)
+	}
+	for _, c := range desired {
+		if err := s.authorizePlacement(ctx, r.UserId, c.placement()); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := s.loadAppliedChecks(ctx, r.UserId)
+	if err != nil {
+		s.logger.Errorw("Unable to get checks by user id", "error", err, "user_id", r.UserId)
+		return nil, err
+	}
+	currentAlerts, err := s.loadAppliedAlerts(ctx, r.UserId, current)
+	if err != nil {
+		s.logger.Errorw("Unable to get alerts by user id", "error", err, "user_id", r.UserId)
+		return nil, err
+	}
+
+	changes, unchanged, err := planChecks(desired, current, r.Prune)
+	if err != nil {
+		s.logger.Infow("Unable to plan checks", "error", err, "user_id", r.UserId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid checks, %v", err)
+	}
+	deleted := deletedChecks(changes)
+	var alertChanges []alertChange
+	var alertsUnchanged int64
+	if r.DryRun {
+		resolveAlerts(desired, desiredAlerts)
+		alertChanges, alertsUnchanged = planAlerts(desiredAlerts, currentAlerts, deleted, r.Prune)
+	} else {
+		// Alerts target the checks by their ids, which are only known after
+		// the checks are stored. So the alerts are applied before the checks
+		// are committed and reverted, if anything fails.
+		err = s.db.WithTransaction(ctx, func(db repository) error {
+			if err := applyChecks(ctx, db, r.UserId, changes); err != nil {
+				return err
+			}
+			resolveAlerts(desired, desiredAlerts)
+			alertChanges, alertsUnchanged = planAlerts(desiredAlerts, currentAlerts, deleted, r.Prune)
+			return s.applyAlerts(ctx, r.UserId, alertChanges)
+		})
+		if err != nil {
+			s.revertAlerts(ctx, r.UserId, alertChanges)
+			s.logger.Errorw("Unable to apply document", "error", err, "user_id", r.UserId)
+			return nil, err
+		}
+		for _, ch := range changes {
+			if ch.action == applyDelete {
+				s.reconcileCheck(ctx, ch.current.id, ch.current.checkType)
+				s.deleteState(ctx, s.runnerCheck(ch.current.config))
+				continue
+			}
+			s.reconcileCheck(ctx, ch.desired.id, ch.desired.checkType)
+		}
+	}
+
+	report := unmarshalApplyReport(changes, alertChanges, unchanged+alertsUnchanged, r.DryRun)
+	s.logger.Infow("Applied document", "user_id", r.UserId,
+		"changes", len(report.Changes), "unchanged", report.Unchanged, "dry_run", r.DryRun)
+	return report, nil
+}
+
+// Export returns the checks and alerts of the user as document for Apply
+func (s *server) Export(ctx context.Context, id *proto.Id) (*proto.Document, error) {
+	checks, err := s.loadAppliedChecks(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get checks by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	alerts, err := s.loadAppliedAlerts(ctx, id.Id, checks)
+	if err != nil {
+		s.logger.Errorw("Unable to get alerts by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	return unmarshalDocument(checks, alerts), nil
+}
+
+func (s *server) DryRunCheck(ctx context.Context, d *proto.DryRun) (*proto.RunResult, error) {
+	var c runnable
+	var userID int64
+	var p placement
+	switch {
+	case d.Http != nil:
+		check, err := marshalHTTPCheck(d.Http)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid http check, %v", err)
+		}
+		check.ID = 0
+		c, userID, p = s.newHTTPRunnerCheck(*check), check.UserID, check.placement
+	case d.Tls != nil:
+		check, err := marshalTLSCheck(d.Tls)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid tls check, %v", err)
+		}
+		check.ID = 0
+		c, userID, p = s.newTLSRunnerCheck(*check), check.UserID, check.placement
+	case d.Tcp != nil:
+		check, err := marshalTCPCheck(d.Tcp)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid tcp check, %v", err)
+		}
+		check.ID = 0
+		c, userID, p = s.newTCPRunnerCheck(*check), check.UserID, check.placement
+	case d.Dns != nil:
+		check, err := marshalDNSCheck(d.Dns)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid dns check, %v", err)
+		}
+		check.ID = 0
+		c, userID, p = s.newDNSRunnerCheck(*check), check.UserID, check.placement
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "no check to run")
+	}
+	if err := s.authorizePlacement(ctx, userID, p); err != nil {
+		return nil, err
+	}
+
+	run, err := c.Run(ctx, time.Now(), false)
+	if err != nil {
+		s.logger.Infow("Unable to dry run check", "error", err, "check_type", c.CheckType())
+		return nil, status.Errorf(codes.Unavailable, "unable to run check, %v", err)
+	}
+	return run, nil
+}
+
+func (s *server) GetCheckStatistics(ctx context.Context, q *proto.StatisticsQuery) (*proto.Statistics, error) {
+	now := time.Now()
+	sq, err := marshalStatisticsQuery(q, now)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid statistics query, %v", err)
+	}
+
+	end := sq.To
+	if now.Before(end) {
+		end = now
+	}
+	st, err := s.retention.statistics(ctx, sq, end, now)
+	if err != nil {
+		s.logger.Errorw("Unable to compute statistics", "error", err,
+			"check_id", sq.CheckID, "check_type", sq.CheckType)
+		return nil, err
+	}
+	return unmarshalStatistics(sq, st)
+}
+
+func (s *server) GetCheckRollups(ctx context.Context, q *proto.RollupQuery) (*proto.Rollups, error) {
+	rq, err := marshalRollupQuery(q, time.Now(), s.config.RetentionHourly)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid rollup query, %v", err)
+	}
+
+	rs, err := s.db.GetRollups(ctx, rq)
+	if err != nil {
+		s.logger.Errorw("Unable to get rollups", "error", err,
+			"check_id", rq.CheckID, "check_type", rq.CheckType)
+		return nil, err
+	}
+
+	prs := &proto.Rollups{
+		Resolution: rq.Resolution,
+		Rollups:    make([]*proto.Rollup, len(*rs)),
+	}
+	for i := range *rs {
+		prs.Rollups[i], err = unmarshalRollup(&(*rs)[i])
+		if err != nil {
+			s.logger.Errorw("Unable to unmarshal rollup", "error", err)
+			return nil, err
+		}
+	}
+	return prs, nil
 }
 
 // Run the server
@@ -182,10 +1693,13 @@ func Run() error {
 		return err
 	}
 
-	// Create server
+	// Create server, whose context is canceled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	s := &server{
 		config: &c,
 		logger: logger,
+		ctx:    ctx,
 	}
 
 	// Start sync directly
@@ -203,10 +1717,138 @@ func Run() error {
 	// GRPC Server with init interceptor
 	proto.RegisterCheckManagerServiceServer(grpcServer, s)
 
+	// Shut down gracefully, so the leases of the shards are handed over
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		logger.Info("Shutting down")
+		cancel()
+		grpcServer.GracefulStop()
+	}()
+
 	// Serve
 	if err := grpcServer.Serve(l); err != nil {
 		logger.Errorw("Error while serving grpc server", "error", err)
 		return err
 	}
+
+	// Wait for a running initialization and skip it, if it did not start yet
+	s.initOnce.Do(func() {})
+	if s.coordinator != nil {
+		s.coordinator.wait()
+	}
+	// Wait for the running checks, so their results and alerts are not
+	// abandoned halfway
+	if s.m != nil {
+		if err := s.m.stopAll(); err != nil {
+			logger.Errorw("Unable to stop checks", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshMaintenance applies changed maintenance windows right away instead
+// of waiting for the next periodic refresh
+func (s *server) refreshMaintenance(ctx context.Context) {
+	err := s.maintenance.refresh(ctx)
+	if err != nil {
+		s.logger.Errorw("Unable to refresh maintenance windows", "error", err)
+	}
+}
+
+// authorizeMaintenanceWindow ensures, that the window only covers a check of
+// its user
+func (s *server) authorizeMaintenanceWindow(ctx context.Context, w *maintenanceWindow) error {
+	if w.CheckType == "" {
+		return nil
+	}
+	c, err := s.loadCheck(ctx, w.CheckID, w.CheckType)
+	if err != nil {
+		return err
+	}
+	if c == nil || c.UserID() != w.UserID {
+		return status.Errorf(codes.InvalidArgument, "unknown %v check %v", w.CheckType, w.CheckID)
+	}
 	return nil
 }
+
+func (s *server) CreateMaintenanceWindow(ctx context.Context, pw *proto.MaintenanceWindow) (*proto.Id, error) {
+	w, err := marshalMaintenanceWindow(pw)
+	if err != nil {
+		s.logger.Infow("Invalid maintenance window", "error", err, "user_id", pw.UserId)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid maintenance window, %v", err)
+	}
+	if err := s.authorizeMaintenanceWindow(ctx, w); err != nil {
+		return nil, err
+	}
+	id, err := s.db.CreateMaintenanceWindow(ctx, w)
+	if err != nil {
+		s.logger.Errorw("Unable to create maintenance window", "error", err, "user_id", pw.UserId)
+		return nil, err
+	}
+	s.refreshMaintenance(ctx)
+
+	s.logger.Infow("Created maintenance window", "window_id", id, "user_id", pw.UserId)
+	return &proto.Id{Id: id}, nil
+}
+
+func (s *server) GetMaintenanceWindow(ctx context.Context, id *proto.Id) (*proto.MaintenanceWindow, error) {
+	w, err := s.db.GetMaintenanceWindow(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get maintenance window by id", "error", err, "window_id", id.Id)
+		return nil, err
+	}
+	return unmarshalMaintenanceWindow(w, time.Now())
+}
+
+func (s *server) GetMaintenanceWindowsByUser(ctx context.Context, id *proto.Id) (*proto.MaintenanceWindows, error) {
+	ws, err := s.db.GetMaintenanceWindowsByUser(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get maintenance windows by user id", "error", err, "user_id", id.Id)
+		return nil, err
+	}
+	return unmarshalMaintenanceWindowCollection(ws, time.Now())
+}
+
+func (s *server) UpdateMaintenanceWindow(ctx context.Context, pw *proto.MaintenanceWindow) (*proto.Response, error) {
+	w, err := marshalMaintenanceWindow(pw)
+	if err != nil {
+		s.logger.Infow("Invalid maintenance window", "error", err, "window_id", pw.Id)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid maintenance window, %v", err)
+	}
+
+	// Keep the owner of the window
+	old, err := s.db.GetMaintenanceWindow(ctx, pw.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to get maintenance window by id", "error", err, "window_id", pw.Id)
+		return nil, status.Errorf(codes.NotFound, "unable to get maintenance window, %v", err)
+	}
+	w.UserID = old.UserID
+	if err := s.authorizeMaintenanceWindow(ctx, w); err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateMaintenanceWindow(ctx, w)
+	if err != nil {
+		s.logger.Errorw("Unable to update maintenance window", "error", err, "window_id", pw.Id)
+		return nil, err
+	}
+	s.refreshMaintenance(ctx)
+
+	s.logger.Infow("Updated maintenance window", "window_id", pw.Id)
+	return &proto.Response{}, nil
+}
+
+func (s *server) DeleteMaintenanceWindow(ctx context.Context, id *proto.Id) (*proto.Response, error) {
+	err := s.db.DeleteMaintenanceWindow(ctx, id.Id)
+	if err != nil {
+		s.logger.Errorw("Unable to delete maintenance window", "error", err, "window_id", id.Id)
+		return nil, err
+	}
+	s.refreshMaintenance(ctx)
+
+	s.logger.Infow("Deleted maintenance window", "window_id", id.Id)
+	return &proto.Response{}, nil
+}
@@ -0,0 +1,231 @@
+package checkmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+)
+
+// States of a check
+const (
+	// stateUnknown is the state of a check without results
+	stateUnknown = "unknown"
+	// stateUp is the state of a check whose last run succeeded
+	stateUp = "up"
+	// stateDegraded is the state of a failing check, which has not reached
+	// its failure threshold yet
+	stateDegraded = "degraded"
+	// stateDown is the state of a check which reached its failure threshold
+	stateDown = "down"
+)
+
+// checkState is the persisted state of a check
+type checkState struct {
+	CheckID   int64     `db:"check_id"`
+	CheckType string    `db:"check_type"`
+	State     string    `db:"state"`
+	Failures  int64     `db:"failures"`
+	Changed   time.Time `db:"changed"`
+	Updated   time.Time `db:"updated"`
+	// Suppressed is set, if the check went down during a maintenance
+	// window, while unreachable or while flapping, so the alert was not sent
+	// yet
+	Suppressed bool `db:"suppressed"`
+	// Unreachable is set, if the last run failed while a parent check was
+	// down
+	Unreachable bool `db:"unreachable"`
+	// History contains the outcomes of the recent runs, oldest first
+	History string `db:"history"`
+	// Flapping is set, if the check changes between success and failure
+	// too often
+	Flapping bool `db:"flapping"`
+}
+
+// transition is the result of recording a run in the state machine
+type transition int
+
+const (
+	transitionNone transition = iota
+	// transitionDown means the check went down and an alert has to be fired
+	transitionDown
+	// transitionUp means the check recovered from being down
+	transitionUp
+)
+
+// record the result of a run at time t and return the resulting transition.
+//
+// A success always leads to up. A failure leads to degraded and, as soon as
+// the number of consecutive failures reaches the threshold, to down.
+// Alerting transitions only happen between down and the other states, so a
+// check fires once per outage and resolves once afterwards.
+func (cs *checkState) record(success bool, threshold int64, t time.Time) transition {
+	cs.Updated = t
+	old := cs.State
+
+	if success {
+		cs.Failures = 0
+		cs.setState(stateUp, t)
+		if old == stateDown {
+			return transitionUp
+		}
+		return transitionNone
+	}
+
+	cs.Failures++
+	if cs.Failures >= threshold {
+		cs.setState(stateDown, t)
+		if old != stateDown {
+			return transitionDown
+		}
+		return transitionNone
+	}
+	if old != stateDown {
+		cs.setState(stateDegraded, t)
+	}
+	return transitionNone
+}
+
+func (cs *checkState) setState(state string, t time.Time) {
+	if cs.State != state {
+		cs.State = state
+		cs.Changed = t
+	}
+}
+
+// recordState records the result of a run of the check in its persisted
+// state and notifies the alert service about state transitions.
+//
+// A failed run is unreachable, if a parent check is down.
+// Alerts of checks going down during maintenance or while unreachable are
+// suppressed. They fire with the first regular run afterwards, if the check
+// is still down, and are never resolved, if the check recovers before.
+//
+// A flapping check sends a single notification when it starts flapping and
+// another one with its state when it is stable again. All alerts in between
+// are suppressed.
+//
+// Runs of the same check may be recorded concurrently, e.g. by a manual run
+// on another replica, so the state is locked until the notifications are
+// sent.
+func recordState(ctx context.Context, db repository, alertService alert.AlertServiceClient, c check, success bool, threshold int64, t time.Time, maintenance bool) error {
+	// The row has to exist to be locked
+	err := db.CreateCheckState(ctx, &checkState{
+		CheckID:   c.CheckID(),
+		CheckType: c.CheckType(),
+		State:     stateUnknown,
+		Changed:   t,
+		Updated:   t,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create state of check, %w", err)
+	}
+	return db.WithTransaction(ctx, func(db repository) error {
+		return updateState(ctx, db, alertService, c, success, threshold, t, maintenance)
+	})
+}
+
+// updateState records the run in the locked state of the check
+func updateState(ctx context.Context, db repository, alertService alert.AlertServiceClient, c check, success bool, threshold int64, t time.Time, maintenance bool) error {
+	cs, err := db.LockCheckState(ctx, c.CheckID(), c.CheckType())
+	if err != nil {
+		return fmt.Errorf("unable to get state of check, %w", err)
+	}
+	unreachable := false
+	if !success {
+		unreachable, err = parentDown(ctx, db, c)
+		if err != nil {
+			return fmt.Errorf("unable to get state of parent checks, %w", err)
+		}
+	}
+
+	tr := cs.record(success, threshold, t)
+	ft := cs.flap(success)
+	cs.Unreachable = unreachable
+	suppress := maintenance || unreachable || cs.Flapping
+	switch {
+	case ft == flapStop:
+		// The notification about the end of the flapping contains the state
+		cs.Suppressed = false
+		tr = transitionNone
+	case tr == transitionDown && suppress:
+		cs.Suppressed = true
+	case tr == transitionUp && (cs.Suppressed || cs.Flapping):
+		cs.Suppressed = false
+		tr = transitionNone
+	case tr == transitionNone && cs.Suppressed && !suppress && cs.State == stateDown:
+		cs.Suppressed = false
+		tr = transitionDown
+	}
+	err = db.UpdateCheckState(ctx, cs)
+	if err != nil {
+		return fmt.Errorf("unable to update state of check, %w", err)
+	}
+
+	if tr == transitionNone && ft == flapNone {
+		return nil
+	}
+
+	// Alerts may target the labels or groups of the check
+	l, err := getCheckLabels(ctx, db, checkKey{checkID: c.CheckID(), checkType: c.CheckType()})
+	if err != nil {
+		return fmt.Errorf("unable to get labels of check, %w", err)
+	}
+	ac := &alert.Check{
+		Id:          c.CheckID(),
+		Type:        c.CheckType(),
+		Maintenance: maintenance,
+		Unreachable: unreachable,
+		State:       cs.State,
+		UserId:      c.UserID(),
+		Labels:      l.Labels,
+		Groups:      l.Groups,
+	}
+	switch ft {
+	case flapStart, flapStop:
+		ac.Flapping = cs.Flapping
+		_, err = alertService.Flapping(ctx, ac)
+		if err != nil {
+			return fmt.Errorf("unable to notify about flapping %w", err)
+		}
+	}
+	switch tr {
+	case transitionDown:
+		_, err = alertService.Firing(ctx, ac)
+		if err != nil {
+			return fmt.Errorf("unable to fire alert %w", err)
+		}
+	case transitionUp:
+		_, err = alertService.Resolved(ctx, ac)
+		if err != nil {
+			return fmt.Errorf("unable to resolve alert %w", err)
+		}
+	}
+	return nil
+}
+
+func unmarshalCheckState(cs *checkState) (*proto.CheckState, error) {
+	changed, err := ptypes.TimestampProto(cs.Changed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *cs, err)
+	}
+	updated, err := ptypes.TimestampProto(cs.Updated)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *cs, err)
+	}
+	return &proto.CheckState{
+		CheckId:     cs.CheckID,
+		CheckType:   cs.CheckType,
+		State:       cs.State,
+		Failures:    cs.Failures,
+		Changed:     changed,
+		Updated:     updated,
+		Unreachable: cs.Unreachable,
+		Flapping:    cs.Flapping,
+		StateChange: stateChange(cs.History),
+	}, nil
+}
@@ -0,0 +1,349 @@
+package checkmanager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// defaultStatisticsWindow is the time window of the statistics, if none is
+// requested
+const defaultStatisticsWindow = 30 * 24 * time.Hour
+
+// resultSample is the part of a result of any check type, which is needed
+// for the statistics
+type resultSample struct {
+	CheckID    int64     `db:"check_id"`
+	Timestamp  time.Time `db:"timestamp"`
+	Success    bool      `db:"success"`
+	Duration   int64     `db:"duration"`
+	Error      string    `db:"error"`
+	StatusCode int64     `db:"status_code"`
+	// Maintenance is set, if the run was in a maintenance window
+	Maintenance bool `db:"maintenance"`
+	// MinFailed is the number of locations, which have to fail, before the
+	// run of the check counts as failed
+	MinFailed int64 `db:"min_failed_locations"`
+}
+
+// run is a single run of a check, which consists of the samples of all its
+// locations with the same timestamp
+type run struct {
+	Timestamp   time.Time
+	Success     bool
+	Maintenance bool
+	// Duration is the mean duration of the successful locations
+	Duration time.Duration
+	// Errors are the distinct errors of the failed locations
+	Errors []errorCount
+}
+
+// groupRuns groups the samples, ordered by time, into runs. A run fails, if
+// at least the minimum of failed locations failed, like in the probe of the
+// worker pool.
+func groupRuns(samples []resultSample) []run {
+	runs := []run{}
+	for start := 0; start < len(samples); {
+		end := start + 1
+		for end < len(samples) && samples[end].Timestamp.Equal(samples[start].Timestamp) {
+			end++
+		}
+		r := run{Timestamp: samples[start].Timestamp}
+		minFailed := samples[start].MinFailed
+		if minFailed < 1 {
+			minFailed = 1
+		}
+		var failed, succeeded int64
+		var sum time.Duration
+		seen := map[errorCount]bool{}
+		for _, s := range samples[start:end] {
+			r.Maintenance = r.Maintenance || s.Maintenance
+			if s.Success {
+				succeeded++
+				sum += time.Duration(s.Duration)
+				continue
+			}
+			failed++
+			e := errorCount{Error: s.Error, StatusCode: s.StatusCode}
+			if !seen[e] {
+				seen[e] = true
+				r.Errors = append(r.Errors, e)
+			}
+		}
+		r.Success = failed < minFailed
+		if succeeded > 0 {
+			r.Duration = sum / time.Duration(succeeded)
+		}
+		runs = append(runs, r)
+		start = end
+	}
+	return runs
+}
+
+// statisticsQuery selects the time window of the statistics of a check
+type statisticsQuery struct {
+	CheckID   int64
+	CheckType string
+	From      time.Time
+	To        time.Time
+}
+
+func marshalStatisticsQuery(q *proto.StatisticsQuery, now time.Time) (*statisticsQuery, error) {
+	sq := &statisticsQuery{
+		CheckID:   q.CheckId,
+		CheckType: q.CheckType,
+		To:        now,
+	}
+	switch sq.CheckType {
+	case "http", "tls", "tcp", "dns", "heartbeat":
+	default:
+		return nil, fmt.Errorf("unknown check type %v", sq.CheckType)
+	}
+
+	var err error
+	if q.To != nil {
+		sq.To, err = ptypes.Timestamp(q.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of time window, %w", err)
+		}
+	}
+	sq.From = sq.To.Add(-defaultStatisticsWindow)
+	if q.From != nil {
+		sq.From, err = ptypes.Timestamp(q.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of time window, %w", err)
+		}
+	}
+	if !sq.From.Before(sq.To) {
+		return nil, fmt.Errorf("end of time window %v not after start %v", sq.To, sq.From)
+	}
+	return sq, nil
+}
+
+// outage is a period of consecutive failed runs. It ends with the next
+// successful run. A zero end means, that the check was still failing at the
+// end of the window.
+type outage struct {
+	Start time.Time
+	End   time.Time
+}
+
+type errorCount struct {
+	Error      string `json:"error"`
+	StatusCode int64  `json:"status_code,omitempty"`
+	Count      int64  `json:"count"`
+}
+
+// statistics of a check in a time window
+type statistics struct {
+	// End of the monitored time, which is the end of the window or now
+	End      time.Time
+	Runs     int64
+	Failures int64
+	// Monitored is the time from the first run until the end without the
+	// time in maintenance
+	Monitored time.Duration
+	Uptime    float64
+	// Outages only contains the outages found in raw results, while
+	// OutageCount and OutageDuration also cover rolled up data
+	Outages        []outage
+	OutageCount    int64
+	OutageDuration time.Duration
+	LatencyMin     time.Duration
+	LatencyMean    time.Duration
+	LatencyMax     time.Duration
+	LatencyP50     time.Duration
+	LatencyP95     time.Duration
+	LatencyP99     time.Duration
+	Errors         []errorCount
+	// RolledUp is set, if rolled up data was used
+	RolledUp bool
+}
+
+// computeStatistics computes the statistics from the samples, ordered by
+// time, in the window ending at end. The samples of all locations of a run
+// are grouped into a single run.
+//
+// The uptime is the percentage of the monitored time, from the first run
+// until the end of the window, which was not part of an outage. It is 0
+// without any runs. The latency only covers successful runs, since failed
+// runs often abort early or run into the timeout.
+//
+// Runs in maintenance windows are excluded. The time from such a run until
+// the next regular run is neither monitored nor part of an outage.
+func computeStatistics(samples []resultSample, end time.Time) *statistics {
+	st := &statistics{End: end}
+	if len(samples) == 0 {
+		return st
+	}
+
+	latencies := []time.Duration{}
+	errors := map[errorCount]int64{}
+	var current *outage
+	var excluded time.Duration
+	var maintenanceStart time.Time
+	for _, s := range groupRuns(samples) {
+		if s.Maintenance {
+			if current != nil {
+				current.End = s.Timestamp
+				st.Outages = append(st.Outages, *current)
+				current = nil
+			}
+			if maintenanceStart.IsZero() {
+				maintenanceStart = s.Timestamp
+			}
+			continue
+		}
+		if !maintenanceStart.IsZero() {
+			excluded += s.Timestamp.Sub(maintenanceStart)
+			maintenanceStart = time.Time{}
+		}
+		st.Runs++
+		if s.Success {
+			latencies = append(latencies, s.Duration)
+			if current != nil {
+				current.End = s.Timestamp
+				st.Outages = append(st.Outages, *current)
+				current = nil
+			}
+			continue
+		}
+		st.Failures++
+		for _, e := range s.Errors {
+			errors[e]++
+		}
+		if current == nil {
+			current = &outage{Start: s.Timestamp}
+		}
+	}
+	if current != nil {
+		st.Outages = append(st.Outages, *current)
+	}
+	if !maintenanceStart.IsZero() {
+		excluded += end.Sub(maintenanceStart)
+	}
+
+	st.OutageCount = int64(len(st.Outages))
+	for _, o := range st.Outages {
+		oEnd := o.End
+		if oEnd.IsZero() {
+			oEnd = end
+		}
+		st.OutageDuration += oEnd.Sub(o.Start)
+	}
+	st.Monitored = end.Sub(samples[0].Timestamp) - excluded
+	st.computeUptime()
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var sum time.Duration
+		for _, l := range latencies {
+			sum += l
+		}
+		st.LatencyMin = latencies[0]
+		st.LatencyMax = latencies[len(latencies)-1]
+		st.LatencyMean = sum / time.Duration(len(latencies))
+		st.LatencyP50 = percentile(latencies, 50)
+		st.LatencyP95 = percentile(latencies, 95)
+		st.LatencyP99 = percentile(latencies, 99)
+	}
+
+	for e, n := range errors {
+		e.Count = n
+		st.Errors = append(st.Errors, e)
+	}
+	sortErrorCounts(st.Errors)
+	return st
+}
+
+// computeUptime computes the uptime from the monitored time and the outages
+func (st *statistics) computeUptime() {
+	switch {
+	case st.Monitored > 0:
+		st.Uptime = 100 * float64(st.Monitored-st.OutageDuration) / float64(st.Monitored)
+	case st.Runs > 0 && st.Failures == 0:
+		st.Uptime = 100
+	default:
+		st.Uptime = 0
+	}
+}
+
+// sortErrorCounts sorts the most frequent errors first
+func sortErrorCounts(es []errorCount) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Count != es[j].Count {
+			return es[i].Count > es[j].Count
+		}
+		return es[i].Error < es[j].Error
+	})
+}
+
+// percentile returns the p-th percentile of the sorted durations using the
+// nearest rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func unmarshalStatistics(q *statisticsQuery, st *statistics) (*proto.Statistics, error) {
+	from, err := ptypes.TimestampProto(q.From)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *q, err)
+	}
+	to, err := ptypes.TimestampProto(q.To)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", *q, err)
+	}
+	ps := &proto.Statistics{
+		CheckId:        q.CheckID,
+		CheckType:      q.CheckType,
+		From:           from,
+		To:             to,
+		Runs:           st.Runs,
+		Failures:       st.Failures,
+		Uptime:         st.Uptime,
+		OutageCount:    st.OutageCount,
+		OutageDuration: ptypes.DurationProto(st.OutageDuration),
+		LatencyMin:     ptypes.DurationProto(st.LatencyMin),
+		LatencyMean:    ptypes.DurationProto(st.LatencyMean),
+		LatencyMax:     ptypes.DurationProto(st.LatencyMax),
+		LatencyP50:     ptypes.DurationProto(st.LatencyP50),
+		LatencyP95:     ptypes.DurationProto(st.LatencyP95),
+		LatencyP99:     ptypes.DurationProto(st.LatencyP99),
+		Outages:        make([]*proto.Outage, 0, len(st.Outages)),
+		Errors:         make([]*proto.ErrorCount, 0, len(st.Errors)),
+		RolledUp:       st.RolledUp,
+	}
+	for _, o := range st.Outages {
+		po := &proto.Outage{}
+		po.Start, err = ptypes.TimestampProto(o.Start)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", o, err)
+		}
+		end := st.End
+		if !o.End.IsZero() {
+			end = o.End
+			po.End, err = ptypes.TimestampProto(o.End)
+			if err != nil {
+				return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", o, err)
+			}
+		}
+		po.Duration = ptypes.DurationProto(end.Sub(o.Start))
+		ps.Outages = append(ps.Outages, po)
+	}
+	for _, e := range st.Errors {
+		ps.Errors = append(ps.Errors, &proto.ErrorCount{
+			Error:      e.Error,
+			StatusCode: e.StatusCode,
+			Count:      e.Count,
+		})
+	}
+	return ps, nil
+}
@@ -0,0 +1,218 @@
+package checkmanager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeStatistics(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	ok := func(minutes int, d time.Duration) resultSample {
+		return resultSample{Timestamp: at(minutes), Success: true, Duration: int64(d)}
+	}
+	failed := func(minutes int) resultSample {
+		return resultSample{Timestamp: at(minutes), Error: "timeout"}
+	}
+	maintenance := func(s resultSample) resultSample {
+		s.Maintenance = true
+		return s
+	}
+	minFailed := func(n int64, s resultSample) resultSample {
+		s.MinFailed = n
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		samples []resultSample
+		end     time.Time
+		want    statistics
+	}{
+		{
+			name: "no runs",
+			end:  at(10),
+			want: statistics{End: at(10)},
+		},
+		{
+			name: "only successful runs",
+			samples: []resultSample{
+				ok(0, 100*time.Millisecond),
+				ok(1, 300*time.Millisecond),
+				ok(2, 200*time.Millisecond),
+			},
+			end: at(3),
+			want: statistics{
+				End:         at(3),
+				Runs:        3,
+				Monitored:   3 * time.Minute,
+				Uptime:      100,
+				LatencyMin:  100 * time.Millisecond,
+				LatencyMean: 200 * time.Millisecond,
+				LatencyMax:  300 * time.Millisecond,
+				LatencyP50:  200 * time.Millisecond,
+				LatencyP95:  300 * time.Millisecond,
+				LatencyP99:  300 * time.Millisecond,
+			},
+		},
+		{
+			name: "closed outage",
+			samples: []resultSample{
+				ok(0, 100*time.Millisecond),
+				failed(1),
+				failed(2),
+				ok(3, 100*time.Millisecond),
+			},
+			end: at(4),
+			want: statistics{
+				End:            at(4),
+				Runs:           4,
+				Failures:       2,
+				Monitored:      4 * time.Minute,
+				Uptime:         50,
+				Outages:        []outage{{Start: at(1), End: at(3)}},
+				OutageCount:    1,
+				OutageDuration: 2 * time.Minute,
+				LatencyMin:     100 * time.Millisecond,
+				LatencyMean:    100 * time.Millisecond,
+				LatencyMax:     100 * time.Millisecond,
+				LatencyP50:     100 * time.Millisecond,
+				LatencyP95:     100 * time.Millisecond,
+				LatencyP99:     100 * time.Millisecond,
+				Errors:         []errorCount{{Error: "timeout", Count: 2}},
+			},
+		},
+		{
+			name: "open outage",
+			samples: []resultSample{
+				failed(0),
+				failed(1),
+			},
+			end: at(4),
+			want: statistics{
+				End:            at(4),
+				Runs:           2,
+				Failures:       2,
+				Monitored:      4 * time.Minute,
+				Outages:        []outage{{Start: at(0)}},
+				OutageCount:    1,
+				OutageDuration: 4 * time.Minute,
+				Errors:         []errorCount{{Error: "timeout", Count: 2}},
+			},
+		},
+		{
+			name: "maintenance ends outage and is not monitored",
+			samples: []resultSample{
+				failed(0),
+				maintenance(failed(1)),
+				maintenance(ok(2, time.Second)),
+				ok(3, 100*time.Millisecond),
+			},
+			end: at(4),
+			want: statistics{
+				End:            at(4),
+				Runs:           2,
+				Failures:       1,
+				Monitored:      2 * time.Minute,
+				Uptime:         50,
+				Outages:        []outage{{Start: at(0), End: at(1)}},
+				OutageCount:    1,
+				OutageDuration: time.Minute,
+				LatencyMin:     100 * time.Millisecond,
+				LatencyMean:    100 * time.Millisecond,
+				LatencyMax:     100 * time.Millisecond,
+				LatencyP50:     100 * time.Millisecond,
+				LatencyP95:     100 * time.Millisecond,
+				LatencyP99:     100 * time.Millisecond,
+				Errors:         []errorCount{{Error: "timeout", Count: 1}},
+			},
+		},
+		{
+			name: "single failed location fails the run",
+			samples: []resultSample{
+				ok(0, 100*time.Millisecond),
+				failed(0),
+				ok(1, 100*time.Millisecond),
+				ok(1, 300*time.Millisecond),
+			},
+			end: at(2),
+			want: statistics{
+				End:            at(2),
+				Runs:           2,
+				Failures:       1,
+				Monitored:      2 * time.Minute,
+				Uptime:         50,
+				Outages:        []outage{{Start: at(0), End: at(1)}},
+				OutageCount:    1,
+				OutageDuration: time.Minute,
+				LatencyMin:     200 * time.Millisecond,
+				LatencyMean:    200 * time.Millisecond,
+				LatencyMax:     200 * time.Millisecond,
+				LatencyP50:     200 * time.Millisecond,
+				LatencyP95:     200 * time.Millisecond,
+				LatencyP99:     200 * time.Millisecond,
+				Errors:         []errorCount{{Error: "timeout", Count: 1}},
+			},
+		},
+		{
+			name: "minimum of failed locations",
+			samples: []resultSample{
+				minFailed(2, ok(0, 100*time.Millisecond)),
+				minFailed(2, failed(0)),
+				minFailed(2, failed(1)),
+				minFailed(2, failed(1)),
+			},
+			end: at(2),
+			want: statistics{
+				End:            at(2),
+				Runs:           2,
+				Failures:       1,
+				Monitored:      2 * time.Minute,
+				Uptime:         50,
+				Outages:        []outage{{Start: at(1)}},
+				OutageCount:    1,
+				OutageDuration: time.Minute,
+				LatencyMin:     100 * time.Millisecond,
+				LatencyMean:    100 * time.Millisecond,
+				LatencyMax:     100 * time.Millisecond,
+				LatencyP50:     100 * time.Millisecond,
+				LatencyP95:     100 * time.Millisecond,
+				LatencyP99:     100 * time.Millisecond,
+				// The same error of both locations counts once per run
+				Errors: []errorCount{{Error: "timeout", Count: 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeStatistics(tt.samples, tt.end)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("statistics\n%+v\nexpected\n%+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{}
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0, want: time.Millisecond},
+		{p: 50, want: 5 * time.Millisecond},
+		{p: 95, want: 10 * time.Millisecond},
+		{p: 99, want: 10 * time.Millisecond},
+		{p: 100, want: 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile %v is %v, expected %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package checkmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// maxStoredResponse is the number of bytes of a response stored in the database
+const maxStoredResponse = 255
+
+type tcpRunnerCheck struct {
+	tcpCheck    tcpCheck
+	db          repository
+	alert       alert.AlertServiceClient
+	workers     *workerPool
+	maintenance *maintenance
+}
+
+func (trc *tcpRunnerCheck) CheckID() int64 {
+	return trc.tcpCheck.ID
+}
+
+func (trc *tcpRunnerCheck) UserID() int64 {
+	return trc.tcpCheck.UserID
+}
+
+func (trc *tcpRunnerCheck) Enabled() bool {
+	return trc.tcpCheck.Enabled
+}
+
+func (*tcpRunnerCheck) CheckType() string {
+	return "tcp"
+}
+
+func (trc *tcpRunnerCheck) Config() interface{} {
+	return trc.tcpCheck
+}
+
+func (trc *tcpRunnerCheck) Interval() time.Duration {
+	return trc.tcpCheck.Interval
+}
+
+func (trc *tcpRunnerCheck) DoCheck(ctx context.Context, t time.Time) error {
+	if trc.maintenance.paused(trc, t) {
+		return nil
+	}
+	_, err := trc.Run(ctx, t, true)
+	return err
+}
+
+func (trc *tcpRunnerCheck) Run(ctx context.Context, t time.Time, record bool) (*proto.RunResult, error) {
+	run, err := newRunResult(trc, t)
+	if err != nil {
+		return nil, err
+	}
+	inMaintenance := record && trc.maintenance.active(trc, t)
+	mutex := &sync.Mutex{}
+	success, err := trc.workers.probe(ctx, trc, t, trc.tcpCheck.placement, func(ctx context.Context, client httpcheck.HTTPCheckServiceClient, location string) (bool, error) {
+		r, err := client.DoTCP(ctx, &httpcheck.TCPCheck{
+			Address: trc.tcpCheck.Address,
+			Timeout: int64(trc.tcpCheck.Timeout),
+			Payload: trc.tcpCheck.Payload,
+			Expect:  trc.tcpCheck.Expect,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to do check via httpcheck service, %w", err)
+		}
+
+		result := newTCPResult(trc.tcpCheck.ID, t, location, r)
+		result.Maintenance = inMaintenance
+		if record {
+			result.ID, err = trc.db.CreateTCPResult(ctx, result)
+			if err != nil {
+				return false, fmt.Errorf("unable to store new tcp result, %w", err)
+			}
+		}
+		pr, err := unmarshalTCPResult(result)
+		if err != nil {
+			return false, err
+		}
+		mutex.Lock()
+		run.Tcp = append(run.Tcp, pr)
+		mutex.Unlock()
+		return r.Success, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.Success = success
+	if !record {
+		return run, nil
+	}
+
+	return run, recordState(ctx, trc.db, trc.alert, trc, success,
+		trc.tcpCheck.Threshold, t, inMaintenance)
+}
+
+// newTCPResult returns the result of a run in the location
+func newTCPResult(checkID int64, t time.Time, location string, r *httpcheck.TCPResult) *tcpResult {
+	response := r.Response
+	if len(response) > maxStoredResponse {
+		response = response[:maxStoredResponse]
+	}
+	return &tcpResult{
+		CheckID:   checkID,
+		Duration:  r.Duration,
+		Error:     truncateError(r.Error),
+		Success:   r.Success,
+		Timestamp: t,
+		Response:  response,
+		Location:  location,
+	}
+}
+
+type tcpCheck struct {
+	ID      int64  `db:"id"`
+	UserID  int64  `db:"user_id"`
+	Address string `db:"address"`
+	Payload string `db:"payload"`
+	Expect  string `db:"expect"`
+	// Enabled is false, while the check is paused
+	Enabled bool `db:"enabled"`
+	schedule
+	placement
+}
+
+func marshalTCPCheck(c *proto.TCPCheck) (*tcpCheck, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %v, %w", c.Address, err)
+	}
+	if _, err := regexp.Compile(c.Expect); err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q, %w", c.Expect, err)
+	}
+	schedule, err := marshalSchedule(c.Interval, c.Timeout, c.FailureThreshold)
+	if err != nil {
+		return nil, err
+	}
+	placement, err := marshalPlacement(c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpCheck{
+		ID:        c.Id,
+		UserID:    c.UserId,
+		Address:   c.Address,
+		Payload:   c.Payload,
+		Expect:    c.Expect,
+		schedule:  schedule,
+		placement: placement,
+	}, nil
+}
+
+func unmarshalTCPCheck(c *tcpCheck) *proto.TCPCheck {
+	return &proto.TCPCheck{
+		Id:                 c.ID,
+		UserId:             c.UserID,
+		Address:            c.Address,
+		Timeout:            ptypes.DurationProto(c.Timeout),
+		Payload:            c.Payload,
+		Expect:             c.Expect,
+		Interval:           ptypes.DurationProto(c.Interval),
+		FailureThreshold:   c.Threshold,
+		Locations:          c.Locations,
+		MinFailedLocations: c.MinFailedLocations,
+		Enabled:            c.Enabled,
+	}
+}
+
+// unmarshalTCPCheckCollection returns the checks matching the filter with
+// their labels and groups
+func unmarshalTCPCheckCollection(cs *[]tcpCheck, f *labelFilter) *proto.TCPChecks {
+	checks := []*proto.TCPCheck{}
+	for _, c := range *cs {
+		l, ok := f.match(checkKey{checkID: c.ID, checkType: "tcp"})
+		if !ok {
+			continue
+		}
+		pc := unmarshalTCPCheck(&c)
+		pc.Labels, pc.Groups = l.Labels, l.Groups
+		checks = append(checks, pc)
+	}
+	return &proto.TCPChecks{Checks: checks}
+}
+
+type tcpResult struct {
+	ID          int64     `db:"id"`
+	CheckID     int64     `db:"check_id"`
+	Timestamp   time.Time `db:"timestamp"`
+	Success     bool      `db:"success"`
+	Duration    int64     `db:"duration"`
+	Error       string    `db:"error"`
+	Response    string    `db:"response"`
+	Location    string    `db:"location"`
+	Maintenance bool      `db:"maintenance"`
+}
+
+func unmarshalTCPResult(c *tcpResult) (*proto.TCPResult, error) {
+	t, err := ptypes.TimestampProto(c.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w",
+			*c, err)
+	}
+	return &proto.TCPResult{
+		Id:          c.ID,
+		CheckId:     c.CheckID,
+		Timestamp:   t,
+		Success:     c.Success,
+		Duration:    c.Duration,
+		Error:       c.Error,
+		Response:    c.Response,
+		Location:    c.Location,
+		Maintenance: c.Maintenance,
+	}, nil
+}
+
+func unmarshalTCPResultCollection(cs *[]tcpResult) (*proto.TCPResults, error) {
+	results := make([]*proto.TCPResult, len(*cs))
+	for i, c := range *cs {
+		r, err := unmarshalTCPResult(&c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in result collection, %w", c, err)
+		}
+		results[i] = r
+	}
+	return &proto.TCPResults{Results: results}, nil
+}
@@ -0,0 +1,259 @@
+package checkmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/shaardie/mondane/checkmanager/proto"
+
+	alert "github.com/shaardie/mondane/alert/proto"
+	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// defaultMinDaysValid is used, if no minimum validity is configured
+const defaultMinDaysValid = 14
+
+type tlsRunnerCheck struct {
+	tlsCheck    tlsCheck
+	db          repository
+	alert       alert.AlertServiceClient
+	workers     *workerPool
+	maintenance *maintenance
+}
+
+func (trc *tlsRunnerCheck) CheckID() int64 {
+	return trc.tlsCheck.ID
+}
+
+func (trc *tlsRunnerCheck) UserID() int64 {
+	return trc.tlsCheck.UserID
+}
+
+func (trc *tlsRunnerCheck) Enabled() bool {
+	return trc.tlsCheck.Enabled
+}
+
+func (*tlsRunnerCheck) CheckType() string {
+	return "tls"
+}
+
+func (trc *tlsRunnerCheck) Config() interface{} {
+	return trc.tlsCheck
+}
+
+func (trc *tlsRunnerCheck) Interval() time.Duration {
+	return trc.tlsCheck.Interval
+}
+
+func (trc *tlsRunnerCheck) DoCheck(ctx context.Context, t time.Time) error {
+	if trc.maintenance.paused(trc, t) {
+		return nil
+	}
+	_, err := trc.Run(ctx, t, true)
+	return err
+}
+
+func (trc *tlsRunnerCheck) Run(ctx context.Context, t time.Time, record bool) (*proto.RunResult, error) {
+	run, err := newRunResult(trc, t)
+	if err != nil {
+		return nil, err
+	}
+	inMaintenance := record && trc.maintenance.active(trc, t)
+	mutex := &sync.Mutex{}
+	success, err := trc.workers.probe(ctx, trc, t, trc.tlsCheck.placement, func(ctx context.Context, client httpcheck.HTTPCheckServiceClient, location string) (bool, error) {
+		r, err := client.DoTLS(ctx, &httpcheck.TLSCheck{
+			Address:      trc.tlsCheck.Address,
+			ServerName:   trc.tlsCheck.ServerName,
+			MinDaysValid: trc.tlsCheck.MinDaysValid,
+			Timeout:      int64(trc.tlsCheck.Timeout),
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to do check via httpcheck service, %w", err)
+		}
+
+		result, err := newTLSResult(trc.tlsCheck.ID, t, location, r)
+		if err != nil {
+			return false, err
+		}
+		result.Maintenance = inMaintenance
+		if record {
+			result.ID, err = trc.db.CreateTLSResult(ctx, result)
+			if err != nil {
+				return false, fmt.Errorf("unable to store new tls result, %w", err)
+			}
+		}
+		pr, err := unmarshalTLSResult(result)
+		if err != nil {
+			return false, err
+		}
+		mutex.Lock()
+		run.Tls = append(run.Tls, pr)
+		mutex.Unlock()
+		return r.Success, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	run.Success = success
+	if !record {
+		return run, nil
+	}
+
+	return run, recordState(ctx, trc.db, trc.alert, trc, success,
+		trc.tlsCheck.Threshold, t, inMaintenance)
+}
+
+// newTLSResult returns the result of a run in the location
+func newTLSResult(checkID int64, t time.Time, location string, r *httpcheck.TLSResult) (*tlsResult, error) {
+	result := &tlsResult{
+		CheckID:   checkID,
+		Duration:  r.Duration,
+		Error:     truncateError(r.Error),
+		Success:   r.Success,
+		Timestamp: t,
+		Issuer:    r.Issuer,
+		Location:  location,
+	}
+	if r.NotAfter != nil {
+		var err error
+		result.NotAfter, err = ptypes.Timestamp(r.NotAfter)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal expiry date %v, %w", r.NotAfter, err)
+		}
+	}
+	return result, nil
+}
+
+type tlsCheck struct {
+	ID           int64  `db:"id"`
+	UserID       int64  `db:"user_id"`
+	Address      string `db:"address"`
+	ServerName   string `db:"server_name"`
+	MinDaysValid int64  `db:"min_days_valid"`
+	// Enabled is false, while the check is paused
+	Enabled bool `db:"enabled"`
+	schedule
+	placement
+}
+
+func marshalTLSCheck(c *proto.TLSCheck) (*tlsCheck, error) {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %v, %w", c.Address, err)
+	}
+	if c.MinDaysValid < 0 {
+		return nil, fmt.Errorf("negative minimum validity %v", c.MinDaysValid)
+	}
+	minDaysValid := c.MinDaysValid
+	if minDaysValid == 0 {
+		minDaysValid = defaultMinDaysValid
+	}
+	schedule, err := marshalSchedule(c.Interval, c.Timeout, c.FailureThreshold)
+	if err != nil {
+		return nil, err
+	}
+	placement, err := marshalPlacement(c.Locations, c.MinFailedLocations)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsCheck{
+		ID:           c.Id,
+		UserID:       c.UserId,
+		Address:      c.Address,
+		ServerName:   c.ServerName,
+		MinDaysValid: minDaysValid,
+		schedule:     schedule,
+		placement:    placement,
+	}, nil
+}
+
+func unmarshalTLSCheck(c *tlsCheck) *proto.TLSCheck {
+	return &proto.TLSCheck{
+		Id:                 c.ID,
+		UserId:             c.UserID,
+		Address:            c.Address,
+		ServerName:         c.ServerName,
+		MinDaysValid:       c.MinDaysValid,
+		Interval:           ptypes.DurationProto(c.Interval),
+		Timeout:            ptypes.DurationProto(c.Timeout),
+		FailureThreshold:   c.Threshold,
+		Locations:          c.Locations,
+		MinFailedLocations: c.MinFailedLocations,
+		Enabled:            c.Enabled,
+	}
+}
+
+// unmarshalTLSCheckCollection returns the checks matching the filter with
+// their labels and groups
+func unmarshalTLSCheckCollection(cs *[]tlsCheck, f *labelFilter) *proto.TLSChecks {
+	checks := []*proto.TLSCheck{}
+	for _, c := range *cs {
+		l, ok := f.match(checkKey{checkID: c.ID, checkType: "tls"})
+		if !ok {
+			continue
+		}
+		pc := unmarshalTLSCheck(&c)
+		pc.Labels, pc.Groups = l.Labels, l.Groups
+		checks = append(checks, pc)
+	}
+	return &proto.TLSChecks{Checks: checks}
+}
+
+type tlsResult struct {
+	ID          int64     `db:"id"`
+	CheckID     int64     `db:"check_id"`
+	Timestamp   time.Time `db:"timestamp"`
+	Success     bool      `db:"success"`
+	Duration    int64     `db:"duration"`
+	Error       string    `db:"error"`
+	NotAfter    time.Time `db:"not_after"`
+	Issuer      string    `db:"issuer"`
+	Location    string    `db:"location"`
+	Maintenance bool      `db:"maintenance"`
+}
+
+func unmarshalTLSResult(c *tlsResult) (*proto.TLSResult, error) {
+	t, err := ptypes.TimestampProto(c.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal timestamp from %v, %w",
+			*c, err)
+	}
+	r := &proto.TLSResult{
+		Id:          c.ID,
+		CheckId:     c.CheckID,
+		Timestamp:   t,
+		Success:     c.Success,
+		Duration:    c.Duration,
+		Error:       c.Error,
+		Issuer:      c.Issuer,
+		Location:    c.Location,
+		Maintenance: c.Maintenance,
+	}
+
+	// No certificate was inspected, e.g. the connection failed
+	if c.NotAfter.IsZero() {
+		return r, nil
+	}
+	r.NotAfter, err = ptypes.TimestampProto(c.NotAfter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal expiry date from %v, %w",
+			*c, err)
+	}
+	r.ExpiresInDays = int64(time.Until(c.NotAfter).Hours() / 24)
+	return r, nil
+}
+
+func unmarshalTLSResultCollection(cs *[]tlsResult) (*proto.TLSResults, error) {
+	results := make([]*proto.TLSResult, len(*cs))
+	for i, c := range *cs {
+		r, err := unmarshalTLSResult(&c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %v in result collection, %w", c, err)
+		}
+		results[i] = r
+	}
+	return &proto.TLSResults{Results: results}, nil
+}
@@ -0,0 +1,321 @@
+package checkmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/shaardie/mondane/checkmanager/proto"
+	httpcheck "github.com/shaardie/mondane/httpcheck/proto"
+)
+
+const (
+	// defaultLocation is the location of workers without location label
+	defaultLocation = "default"
+	// maxLocations is the maximal number of locations of a single check
+	maxLocations = 16
+	// workerTTL is the time after which a worker without registration is
+	// considered dead
+	workerTTL = 90 * time.Second
+	// workerRefreshInterval is the time between two refreshes of the live
+	// workers from the database
+	workerRefreshInterval = 30 * time.Second
+)
+
+// placement selects the locations a check runs in and how many of them have
+// to fail, before a run counts as failed.
+// It is embedded in all checks run by the httpcheck workers.
+type placement struct {
+	Locations          stringList `db:"locations"`
+	MinFailedLocations int64      `db:"min_failed_locations"`
+}
+
+// marshalPlacement validates the placement and fills in defaults
+func marshalPlacement(locations []string, minFailed int64) (placement, error) {
+	p := placement{
+		Locations:          stringList{},
+		MinFailedLocations: 1,
+	}
+	seen := map[string]bool{}
+	for _, l := range locations {
+		if l == "" {
+			return p, errors.New("empty location")
+		}
+		if seen[l] {
+			return p, fmt.Errorf("duplicate location %v", l)
+		}
+		seen[l] = true
+		p.Locations = append(p.Locations, l)
+	}
+	if len(p.Locations) > maxLocations {
+		return p, fmt.Errorf("more than %v locations", maxLocations)
+	}
+	if minFailed != 0 {
+		n := int64(len(p.Locations))
+		if n == 0 {
+			n = 1
+		}
+		if minFailed < 1 || minFailed > n {
+			return p, fmt.Errorf("minimum of failed locations %v not between 1 and %v",
+				minFailed, n)
+		}
+		p.MinFailedLocations = minFailed
+	}
+	return p, nil
+}
+
+// worker is an httpcheck service registered for a location
+type worker struct {
+	Address   string    `db:"address"`
+	Location  string    `db:"location"`
+	Heartbeat time.Time `db:"heartbeat"`
+}
+
+func marshalWorker(w *proto.Worker, now time.Time) (*worker, error) {
+	if w.Address == "" {
+		return nil, errors.New("worker without address")
+	}
+	location := w.Location
+	if location == "" {
+		location = defaultLocation
+	}
+	return &worker{
+		Address:   w.Address,
+		Location:  location,
+		Heartbeat: now,
+	}, nil
+}
+
+func unmarshalWorkers(ws []worker) (*proto.Workers, error) {
+	workers := make([]*proto.Worker, len(ws))
+	for i, w := range ws {
+		t, err := ptypes.TimestampProto(w.Heartbeat)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal timestamp from %v, %w", w, err)
+		}
+		workers[i] = &proto.Worker{
+			Address:  w.Address,
+			Location: w.Location,
+			LastSeen: t,
+		}
+	}
+	return &proto.Workers{Workers: workers}, nil
+}
+
+// probeFunc does a single run of a check with the worker of the location and
+// returns, if the run succeeded
+type probeFunc func(ctx context.Context, client httpcheck.HTTPCheckServiceClient, location string) (bool, error)
+
+// workerPool keeps connections to all live httpcheck workers.
+//
+// Workers register themselves periodically in the database with their
+// location and are dropped after they missed their registrations for
+// workerTTL. A statically configured worker is always part of the pool.
+// The workers of a location are used round-robin.
+type workerPool struct {
+	db     repository
+	logger *zap.SugaredLogger
+	// static is the address of the configured worker or empty
+	static string
+
+	mutex   *sync.Mutex
+	conns   map[string]*grpc.ClientConn
+	workers []worker
+	next    int
+	// agents are the connected agents by location
+	agents map[string]*agentConn
+}
+
+func newWorkerPool(db repository, logger *zap.SugaredLogger, static string) *workerPool {
+	return &workerPool{
+		db:     db,
+		logger: logger,
+		static: static,
+		mutex:  &sync.Mutex{},
+		conns:  make(map[string]*grpc.ClientConn),
+		agents: make(map[string]*agentConn),
+	}
+}
+
+// run refreshes the workers periodically until the context is done
+func (wp *workerPool) run(ctx context.Context) {
+	ticker := time.NewTicker(workerRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wp.close()
+			return
+		case <-ticker.C:
+			err := wp.refresh(ctx, time.Now())
+			if err != nil {
+				wp.logger.Errorw("Unable to refresh workers", "error", err)
+			}
+		}
+	}
+}
+
+// known returns, if the worker is part of the pool
+func (wp *workerPool) known(address string) bool {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	_, ok := wp.conns[address]
+	return ok
+}
+
+// refresh the live workers and their connections
+func (wp *workerPool) refresh(ctx context.Context, now time.Time) error {
+	live, err := wp.db.GetWorkers(ctx, now.Add(-workerTTL))
+	if err != nil {
+		return err
+	}
+	workers := []worker{}
+	for _, w := range *live {
+		if w.Address != wp.static {
+			workers = append(workers, w)
+		}
+	}
+	if wp.static != "" {
+		workers = append(workers, worker{
+			Address:   wp.static,
+			Location:  defaultLocation,
+			Heartbeat: now,
+		})
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Address < workers[j].Address })
+
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	alive := map[string]bool{}
+	for _, w := range workers {
+		alive[w.Address] = true
+		if _, ok := wp.conns[w.Address]; ok {
+			continue
+		}
+		conn, err := grpc.Dial(w.Address, grpc.WithInsecure())
+		if err != nil {
+			wp.logger.Errorw("Unable to connect to worker", "error", err,
+				"address", w.Address)
+			continue
+		}
+		wp.conns[w.Address] = conn
+		wp.logger.Infow("Connected to worker", "address", w.Address,
+			"location", w.Location)
+	}
+	for address, conn := range wp.conns {
+		if alive[address] {
+			continue
+		}
+		conn.Close()
+		delete(wp.conns, address)
+		wp.logger.Infow("Disconnected from worker", "address", address)
+	}
+	wp.workers = workers
+	return nil
+}
+
+// close all connections
+func (wp *workerPool) close() {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	for address, conn := range wp.conns {
+		conn.Close()
+		delete(wp.conns, address)
+	}
+	wp.workers = nil
+}
+
+// client returns a client of the next worker in the location and the
+// location of the worker. An empty location selects any worker, but never
+// an agent.
+func (wp *workerPool) client(location string) (httpcheck.HTTPCheckServiceClient, string, error) {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	if isAgentLocation(location) {
+		ac, ok := wp.agents[location]
+		if !ok || !ac.connected() {
+			return nil, "", fmt.Errorf("agent %v not connected", location)
+		}
+		return ac, location, nil
+	}
+	candidates := []worker{}
+	for _, w := range wp.workers {
+		if _, ok := wp.conns[w.Address]; ok && (location == "" || w.Location == location) {
+			candidates = append(candidates, w)
+		}
+	}
+	if len(candidates) == 0 {
+		if location == "" {
+			return nil, "", errors.New("no worker available")
+		}
+		return nil, "", fmt.Errorf("no worker available in location %v", location)
+	}
+	wp.next++
+	w := candidates[wp.next%len(candidates)]
+	return httpcheck.NewHTTPCheckServiceClient(wp.conns[w.Address]), w.Location, nil
+}
+
+// probe runs the check concurrently in all locations of the placement.
+//
+// Locations without a result, because no worker is available or the worker
+// failed, do not count. The run fails, if at least MinFailedLocations of the
+// locations with a result failed, and returns an error, if no location
+// returned a result at all.
+func (wp *workerPool) probe(ctx context.Context, c check, t time.Time, p placement, do probeFunc) (bool, error) {
+	ctx = withRun(ctx, c, t)
+	locations := []string(p.Locations)
+	if len(locations) == 0 {
+		locations = []string{""}
+	}
+
+	type outcome struct {
+		success bool
+		err     error
+	}
+	outcomes := make([]outcome, len(locations))
+	var wg sync.WaitGroup
+	for i, l := range locations {
+		wg.Add(1)
+		go func(i int, l string) {
+			defer wg.Done()
+			client, location, err := wp.client(l)
+			if err != nil {
+				outcomes[i].err = err
+				return
+			}
+			outcomes[i].success, outcomes[i].err = do(ctx, client, location)
+		}(i, l)
+	}
+	wg.Wait()
+
+	var results, failed int64
+	errs := []string{}
+	for i, o := range outcomes {
+		if o.err != nil {
+			errs = append(errs, o.err.Error())
+			wp.logger.Warnw("Unable to probe location", "error", o.err,
+				"location", locations[i])
+			continue
+		}
+		results++
+		if !o.success {
+			failed++
+		}
+	}
+	if results == 0 {
+		return false, fmt.Errorf("no result from any location, %v", strings.Join(errs, "; "))
+	}
+	minFailed := p.MinFailedLocations
+	if minFailed < 1 {
+		minFailed = 1
+	}
+	return failed < minFailed, nil
+}
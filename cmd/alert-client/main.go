@@ -19,14 +19,26 @@ var (
 
 	create           = kingpin.Command("create", "create an alert")
 	createUserID     = create.Arg("user-id", "user id of the alert").Required().Int64()
-	createCheckID    = create.Arg("check-id", "check id of the alert").Required().Int64()
-	createCheckType  = create.Arg("check-type", "type of the alert").Required().String()
 	createSendMail   = create.Arg("send-mail", "if mail is sent").Required().Bool()
 	createSendPeriod = create.Arg("send-period", "period in second between sends").Required().Int64()
+	createCheckID    = create.Flag("check-id", "check id of the alert").Int64()
+	createCheckType  = create.Flag("check-type", "check type of the alert").String()
+	createSelector   = create.Flag("selector", "label selector of the checks instead of a single check").String()
+	createGroup      = create.Flag("group", "group of the checks instead of a single check").String()
 
 	firing     = kingpin.Command("firing", "firing an alert")
 	firingID   = firing.Arg("id", "id of the check to fire").Required().Int64()
 	firingType = firing.Arg("type", "type of the check to fire").Required().String()
+
+	resolved     = kingpin.Command("resolved", "resolve an alert")
+	resolvedID   = resolved.Arg("id", "id of the recovered check").Required().Int64()
+	resolvedType = resolved.Arg("type", "type of the recovered check").Required().String()
+
+	flapping        = kingpin.Command("flapping", "notify about a flapping check")
+	flappingID      = flapping.Arg("id", "id of the check").Required().Int64()
+	flappingType    = flapping.Arg("type", "type of the check").Required().String()
+	flappingStopped = flapping.Flag("stopped", "the check stopped flapping").Bool()
+	flappingState   = flapping.Flag("state", "state of the check after it stopped flapping").Default("up").String()
 )
 
 func mainWithError() error {
@@ -43,6 +55,9 @@ func mainWithError() error {
 	// Switch to different modes
 	switch parse {
 	case "create":
+		if err := validateTarget(); err != nil {
+			return err
+		}
 		_, err := c.Create(context.Background(), &proto.CreateAlert{
 			UserId:    *createUserID,
 			CheckId:   *createCheckID,
@@ -50,6 +65,8 @@ func mainWithError() error {
 			SendMail:  *createSendMail,
 			SendPeriod: ptypes.DurationProto(
 				time.Second * time.Duration(*createSendPeriod)),
+			Selector: *createSelector,
+			Group:    *createGroup,
 		})
 		if err != nil {
 			return fmt.Errorf("Unable to trigger alert: %v", err)
@@ -61,6 +78,39 @@ func mainWithError() error {
 		if err != nil {
 			return fmt.Errorf("Unable to fire alert: %v", err)
 		}
+	case "resolved":
+		_, err := c.Resolved(context.Background(), &proto.Check{
+			Id: *resolvedID, Type: *resolvedType,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to resolve alert: %v", err)
+		}
+	case "flapping":
+		_, err := c.Flapping(context.Background(), &proto.Check{
+			Id: *flappingID, Type: *flappingType,
+			Flapping: !*flappingStopped, State: *flappingState,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to notify about flapping: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateTarget returns an error, unless the alert targets exactly one of a
+// check, a selector or a group
+func validateTarget() error {
+	if (*createCheckID != 0) != (*createCheckType != "") {
+		return fmt.Errorf("check id and check type are only allowed together")
+	}
+	targets := 0
+	for _, set := range []bool{*createCheckID != 0, *createSelector != "", *createGroup != ""} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("exactly one of --check-id and --check-type, --selector or --group is required")
 	}
 	return nil
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/shaardie/mondane/checkmanager/importer"
+	"github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// readDocument reads the yaml document from the file or stdin. The document
+// uses the field names of the protobuf messages and durations in seconds,
+// e.g.
+//
+//	checks:
+//	  - name: website
+//	    http:
+//	      url: https://example.com
+//	      interval: 60s
+//	    labels:
+//	      env: prod
+//	alerts:
+//	  - check: website
+//	    send_mail: true
+func readDocument(file string) (*proto.Document, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the yaml to json, so protojson handles the durations and
+	// field names
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err = jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := &proto.Document{}
+	return d, protojson.Unmarshal(data, d)
+}
+
+// marshalDocument returns the document as yaml
+func marshalDocument(d *proto.Document) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var v yaml.MapSlice
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+// jsonValue converts the maps of the yaml value to maps with string keys
+func jsonValue(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range value {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v", key)
+			}
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i, item := range value {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = converted
+		}
+		return value, nil
+	}
+	return v, nil
+}
+
+type importFlags struct {
+	group    *string
+	sendMail *bool
+	dryRun   *bool
+}
+
+func newImportFlags(cmd *kingpin.CmdClause) *importFlags {
+	return &importFlags{
+		group:    cmd.Flag("group", "put the imported checks into this group").String(),
+		sendMail: cmd.Flag("send-mail", "add a mail alert for the group").Bool(),
+		dryRun:   cmd.Flag("dry-run", "only show the changes").Bool(),
+	}
+}
+
+// apply the imported checks and alerts for the user
+func (f *importFlags) apply(c proto.CheckManagerServiceClient, userID int64, r *importer.Result) error {
+	if *f.group != "" {
+		if err := r.AddGroup(*f.group); err != nil {
+			return fmt.Errorf("Invalid group: %v", err)
+		}
+		if *f.sendMail {
+			r.Document.Alerts = append(r.Document.Alerts, &proto.DocumentAlert{
+				Group:    *f.group,
+				SendMail: true,
+			})
+		}
+	}
+	for _, u := range r.Unmapped {
+		fmt.Printf("unmapped source=%q, reason=%q, skipped=%v\n", u.Source, u.Reason, u.Skipped)
+	}
+	report, err := c.Apply(context.Background(), &proto.ApplyRequest{
+		UserId:   userID,
+		Document: r.Document,
+		DryRun:   *f.dryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to apply imported checks: %v", err)
+	}
+	printApplyReport(report)
+	return nil
+}
+
+func printApplyReport(r *proto.ApplyReport) {
+	for _, c := range r.Changes {
+		fmt.Printf("action=%v, kind=%v, name=%q, type=%v, id=%v\n",
+			c.Action, c.Kind, c.Name, c.CheckType, c.Id)
+	}
+	fmt.Printf("changes=%v, unchanged=%v, dry_run=%v\n", len(r.Changes), r.Unchanged, r.DryRun)
+}
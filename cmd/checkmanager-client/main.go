@@ -3,11 +3,20 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	empty "github.com/golang/protobuf/ptypes/empty"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/shaardie/mondane/checkmanager/importer"
 	"github.com/shaardie/mondane/checkmanager/proto"
 )
 
@@ -20,19 +29,668 @@ var (
 	httpCheckCreate       = httpCheck.Command("create", "create a check")
 	httpCheckCreateUserID = httpCheckCreate.Arg("user-id", "id of the user").Required().Int64()
 	httpCheckCreateURL    = httpCheckCreate.Arg("url", "url for the check").Required().String()
+	httpCheckCreateMethod = httpCheckCreate.Flag("method", "http method of the request").Default("GET").String()
+	httpCheckCreateHeader = httpCheckCreate.Flag("header", "header of the request, e.g. Accept=text/plain").StringMap()
+	httpCheckCreateBody   = httpCheckCreate.Flag("body", "body of the request").String()
+	httpCheckCreateUser   = httpCheckCreate.Flag("username", "username for basic auth").String()
+	httpCheckCreatePass   = httpCheckCreate.Flag("password", "password for basic auth").String()
+	httpCheckCreateToken  = httpCheckCreate.Flag("bearer-token", "bearer token for authorization").String()
+
+	httpCheckCreateStatus          = httpCheckCreate.Flag("expect-status", "accepted status code or range, e.g. 200-299").Strings()
+	httpCheckCreateBodyContains    = httpCheckCreate.Flag("body-contains", "required substring of the body").Strings()
+	httpCheckCreateBodyNotContains = httpCheckCreate.Flag("body-not-contains", "forbidden substring of the body").Strings()
+	httpCheckCreateBodyMatches     = httpCheckCreate.Flag("body-matches", "regular expression the body has to match").Strings()
+	httpCheckCreateBodyNotMatches  = httpCheckCreate.Flag("body-not-matches", "regular expression the body must not match").Strings()
+	httpCheckCreateJSONPath        = httpCheckCreate.Flag("json-path", "expected value of a json path, e.g. $.status=ok").StringMap()
+	httpCheckCreateExpectHeader    = httpCheckCreate.Flag("expect-header", "regular expression for a response header, e.g. Content-Type=json").StringMap()
+	httpCheckCreateMaxResponseTime = httpCheckCreate.Flag("max-response-time", "maximum response time").Duration()
+
+	httpCheckCreateInterval  = httpCheckCreate.Flag("interval", "time between two runs").Default("30s").Duration()
+	httpCheckCreateTimeout   = httpCheckCreate.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	httpCheckCreateThreshold = httpCheckCreate.Flag("failure-threshold", "number of consecutive failures before alerting").Default("3").Int64()
+	httpCheckCreateLocations = httpCheckCreate.Flag("location", "location the check runs in, may be repeated").Strings()
+	httpCheckCreateMinFailed = httpCheckCreate.Flag("min-failed-locations", "number of locations which have to fail").Int64()
 
 	httpCheckget   = httpCheck.Command("get", "get a check")
 	httpCheckgetID = httpCheckget.Arg("id", "id of the check").Required().Int64()
 
-	httpCheckgetByUser   = httpCheck.Command("get-by-user", "get checks by user id")
-	httpCheckgetByUserID = httpCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	httpCheckgetByUser      = httpCheck.Command("get-by-user", "get checks by user id")
+	httpCheckgetByUserID    = httpCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	httpCheckgetByUserQuery = newCheckQueryFlags(httpCheckgetByUser)
 
-	httpCheckdelete   = kingpin.Command("delete", "delete a check")
+	httpCheckdelete   = httpCheck.Command("delete", "delete a check")
 	httpCheckdeleteID = httpCheckdelete.Arg("id", "id of the check").Required().Int64()
+
+	httpCheckResults      = httpCheck.Command("results", "get results of a check")
+	httpCheckResultsID    = httpCheckResults.Arg("id", "id of the check").Required().Int64()
+	httpCheckResultsQuery = newResultQueryFlags(httpCheckResults)
+
+	tlsCheck = kingpin.Command("tlscheck", "tlscheck related commands")
+
+	tlsCheckCreate             = tlsCheck.Command("create", "create a check")
+	tlsCheckCreateUserID       = tlsCheckCreate.Arg("user-id", "id of the user").Required().Int64()
+	tlsCheckCreateAddress      = tlsCheckCreate.Arg("address", "address for the check in the form host:port").Required().String()
+	tlsCheckCreateServerName   = tlsCheckCreate.Flag("server-name", "server name to verify").String()
+	tlsCheckCreateMinDaysValid = tlsCheckCreate.Flag("min-days-valid", "minimum number of days the certificates have to be valid").Int64()
+	tlsCheckCreateInterval     = tlsCheckCreate.Flag("interval", "time between two runs").Default("30s").Duration()
+	tlsCheckCreateTimeout      = tlsCheckCreate.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	tlsCheckCreateThreshold    = tlsCheckCreate.Flag("failure-threshold", "number of consecutive failures before alerting").Default("3").Int64()
+	tlsCheckCreateLocations    = tlsCheckCreate.Flag("location", "location the check runs in, may be repeated").Strings()
+	tlsCheckCreateMinFailed    = tlsCheckCreate.Flag("min-failed-locations", "number of locations which have to fail").Int64()
+
+	tlsCheckget   = tlsCheck.Command("get", "get a check")
+	tlsCheckgetID = tlsCheckget.Arg("id", "id of the check").Required().Int64()
+
+	tlsCheckgetByUser      = tlsCheck.Command("get-by-user", "get checks by user id")
+	tlsCheckgetByUserID    = tlsCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	tlsCheckgetByUserQuery = newCheckQueryFlags(tlsCheckgetByUser)
+
+	tlsCheckdelete   = tlsCheck.Command("delete", "delete a check")
+	tlsCheckdeleteID = tlsCheckdelete.Arg("id", "id of the check").Required().Int64()
+
+	tlsCheckResults      = tlsCheck.Command("results", "get results of a check")
+	tlsCheckResultsID    = tlsCheckResults.Arg("id", "id of the check").Required().Int64()
+	tlsCheckResultsQuery = newResultQueryFlags(tlsCheckResults)
+
+	tcpCheck = kingpin.Command("tcpcheck", "tcpcheck related commands")
+
+	tcpCheckCreate          = tcpCheck.Command("create", "create a check")
+	tcpCheckCreateUserID    = tcpCheckCreate.Arg("user-id", "id of the user").Required().Int64()
+	tcpCheckCreateAddress   = tcpCheckCreate.Arg("address", "address for the check in the form host:port").Required().String()
+	tcpCheckCreateTimeout   = tcpCheckCreate.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	tcpCheckCreatePayload   = tcpCheckCreate.Flag("payload", "payload sent after connecting, escape sequences like \\r\\n are interpreted").String()
+	tcpCheckCreateExpect    = tcpCheckCreate.Flag("expect", "regular expression the response has to match").String()
+	tcpCheckCreateInterval  = tcpCheckCreate.Flag("interval", "time between two runs").Default("30s").Duration()
+	tcpCheckCreateThreshold = tcpCheckCreate.Flag("failure-threshold", "number of consecutive failures before alerting").Default("3").Int64()
+	tcpCheckCreateLocations = tcpCheckCreate.Flag("location", "location the check runs in, may be repeated").Strings()
+	tcpCheckCreateMinFailed = tcpCheckCreate.Flag("min-failed-locations", "number of locations which have to fail").Int64()
+
+	tcpCheckget   = tcpCheck.Command("get", "get a check")
+	tcpCheckgetID = tcpCheckget.Arg("id", "id of the check").Required().Int64()
+
+	tcpCheckgetByUser      = tcpCheck.Command("get-by-user", "get checks by user id")
+	tcpCheckgetByUserID    = tcpCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	tcpCheckgetByUserQuery = newCheckQueryFlags(tcpCheckgetByUser)
+
+	tcpCheckdelete   = tcpCheck.Command("delete", "delete a check")
+	tcpCheckdeleteID = tcpCheckdelete.Arg("id", "id of the check").Required().Int64()
+
+	tcpCheckResults      = tcpCheck.Command("results", "get results of a check")
+	tcpCheckResultsID    = tcpCheckResults.Arg("id", "id of the check").Required().Int64()
+	tcpCheckResultsQuery = newResultQueryFlags(tcpCheckResults)
+
+	dnsCheck = kingpin.Command("dnscheck", "dnscheck related commands")
+
+	dnsCheckCreate           = dnsCheck.Command("create", "create a check")
+	dnsCheckCreateUserID     = dnsCheckCreate.Arg("user-id", "id of the user").Required().Int64()
+	dnsCheckCreateName       = dnsCheckCreate.Arg("name", "name to query").Required().String()
+	dnsCheckCreateRecordType = dnsCheckCreate.Arg("record-type", "record type to query, one of A, AAAA, CNAME, MX, TXT and NS").Required().String()
+	dnsCheckCreateResolver   = dnsCheckCreate.Flag("resolver", "resolver address in the form host:port").String()
+	dnsCheckCreateTimeout    = dnsCheckCreate.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	dnsCheckCreateExpected   = dnsCheckCreate.Flag("expect", "answer which has to be part of the response").Strings()
+	dnsCheckCreateMinTTL     = dnsCheckCreate.Flag("min-ttl", "minimum ttl of the answers in seconds").Int64()
+	dnsCheckCreateMaxTTL     = dnsCheckCreate.Flag("max-ttl", "maximum ttl of the answers in seconds").Int64()
+	dnsCheckCreateRCode      = dnsCheckCreate.Flag("rcode", "expected response code").Default("NOERROR").String()
+	dnsCheckCreateInterval   = dnsCheckCreate.Flag("interval", "time between two runs").Default("30s").Duration()
+	dnsCheckCreateThreshold  = dnsCheckCreate.Flag("failure-threshold", "number of consecutive failures before alerting").Default("3").Int64()
+	dnsCheckCreateLocations  = dnsCheckCreate.Flag("location", "location the check runs in, may be repeated").Strings()
+	dnsCheckCreateMinFailed  = dnsCheckCreate.Flag("min-failed-locations", "number of locations which have to fail").Int64()
+
+	dnsCheckget   = dnsCheck.Command("get", "get a check")
+	dnsCheckgetID = dnsCheckget.Arg("id", "id of the check").Required().Int64()
+
+	dnsCheckgetByUser      = dnsCheck.Command("get-by-user", "get checks by user id")
+	dnsCheckgetByUserID    = dnsCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	dnsCheckgetByUserQuery = newCheckQueryFlags(dnsCheckgetByUser)
+
+	dnsCheckdelete   = dnsCheck.Command("delete", "delete a check")
+	dnsCheckdeleteID = dnsCheckdelete.Arg("id", "id of the check").Required().Int64()
+
+	dnsCheckResults      = dnsCheck.Command("results", "get results of a check")
+	dnsCheckResultsID    = dnsCheckResults.Arg("id", "id of the check").Required().Int64()
+	dnsCheckResultsQuery = newResultQueryFlags(dnsCheckResults)
+
+	heartbeatCheck = kingpin.Command("heartbeatcheck", "heartbeatcheck related commands")
+
+	heartbeatCheckCreate       = heartbeatCheck.Command("create", "create a check")
+	heartbeatCheckCreateUserID = heartbeatCheckCreate.Arg("user-id", "id of the user").Required().Int64()
+	heartbeatCheckCreatePeriod = heartbeatCheckCreate.Arg("period", "expected time between two pings").Required().Duration()
+	heartbeatCheckCreateGrace  = heartbeatCheckCreate.Flag("grace", "additional time before a missing ping is reported").Default("1m").Duration()
+
+	heartbeatCheckget   = heartbeatCheck.Command("get", "get a check")
+	heartbeatCheckgetID = heartbeatCheckget.Arg("id", "id of the check").Required().Int64()
+
+	heartbeatCheckgetByUser      = heartbeatCheck.Command("get-by-user", "get checks by user id")
+	heartbeatCheckgetByUserID    = heartbeatCheckgetByUser.Arg("id", "id of the user").Required().Int64()
+	heartbeatCheckgetByUserQuery = newCheckQueryFlags(heartbeatCheckgetByUser)
+
+	heartbeatCheckdelete   = heartbeatCheck.Command("delete", "delete a check")
+	heartbeatCheckdeleteID = heartbeatCheckdelete.Arg("id", "id of the check").Required().Int64()
+
+	heartbeatCheckResults      = heartbeatCheck.Command("results", "get results of a check")
+	heartbeatCheckResultsID    = heartbeatCheckResults.Arg("id", "id of the check").Required().Int64()
+	heartbeatCheckResultsQuery = newResultQueryFlags(heartbeatCheckResults)
+
+	heartbeatCheckPing        = heartbeatCheck.Command("ping", "send a ping")
+	heartbeatCheckPingToken   = heartbeatCheckPing.Arg("token", "token of the check").Required().String()
+	heartbeatCheckPingKind    = heartbeatCheckPing.Flag("kind", "kind of the ping, one of success, start and fail").Default("success").String()
+	heartbeatCheckPingMessage = heartbeatCheckPing.Flag("message", "message of the ping").String()
+
+	state     = kingpin.Command("state", "get the state of a check")
+	stateType = state.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	stateID   = state.Arg("id", "id of the check").Required().Int64()
+
+	statistics      = kingpin.Command("statistics", "get uptime and latency statistics of a check")
+	statisticsType  = statistics.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	statisticsID    = statistics.Arg("id", "id of the check").Required().Int64()
+	statisticsMonth = statistics.Flag("month", "calendar month in UTC like 2006-01, overrides from and to").String()
+	statisticsFrom  = statistics.Flag("from", "start of the time window in RFC 3339, defaults to 30 days before the end").String()
+	statisticsTo    = statistics.Flag("to", "end of the time window in RFC 3339, defaults to now").String()
+
+	run     = kingpin.Command("run", "run a check immediately and record the result")
+	runType = run.Arg("type", "type of the check, one of http, tls, tcp and dns").Required().String()
+	runID   = run.Arg("id", "id of the check").Required().Int64()
+
+	pause     = kingpin.Command("pause", "pause a check without deleting it")
+	pauseType = pause.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	pauseID   = pause.Arg("id", "id of the check").Required().Int64()
+
+	resume     = kingpin.Command("resume", "resume a paused check")
+	resumeType = resume.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	resumeID   = resume.Arg("id", "id of the check").Required().Int64()
+
+	dryRun     = kingpin.Command("dry-run", "run an unsaved check once without recording the result")
+	dryRunFile = dryRun.Arg("file", "json file with the check definition, e.g. {\"http\": {\"url\": \"https://example.com\"}}, - for stdin").Required().String()
+
+	reconcile = kingpin.Command("reconcile", "reconcile the running checks with the database")
+
+	workers = kingpin.Command("workers", "list the live httpcheck workers")
+
+	agent = kingpin.Command("agent", "probe agent related commands")
+
+	agentCreate       = agent.Command("create", "create an agent")
+	agentCreateUserID = agentCreate.Arg("user-id", "id of the user").Required().Int64()
+	agentCreateName   = agentCreate.Arg("name", "name of the agent").Required().String()
+
+	agentGet   = agent.Command("get", "get an agent")
+	agentGetID = agentGet.Arg("id", "id of the agent").Required().Int64()
+
+	agentGetByUser   = agent.Command("get-by-user", "get agents by user id")
+	agentGetByUserID = agentGetByUser.Arg("id", "id of the user").Required().Int64()
+
+	agentDelete   = agent.Command("delete", "delete an agent")
+	agentDeleteID = agentDelete.Arg("id", "id of the agent").Required().Int64()
+
+	maintenance = kingpin.Command("maintenance", "maintenance window related commands")
+
+	maintenanceCreate       = maintenance.Command("create", "create a maintenance window")
+	maintenanceCreateUserID = maintenanceCreate.Arg("user-id", "id of the user").Required().Int64()
+	maintenanceCreateFlags  = newMaintenanceWindowFlags(maintenanceCreate)
+
+	maintenanceGet   = maintenance.Command("get", "get a maintenance window")
+	maintenanceGetID = maintenanceGet.Arg("id", "id of the window").Required().Int64()
+
+	maintenanceGetByUser   = maintenance.Command("get-by-user", "get maintenance windows by user id")
+	maintenanceGetByUserID = maintenanceGetByUser.Arg("id", "id of the user").Required().Int64()
+
+	maintenanceUpdate      = maintenance.Command("update", "replace a maintenance window")
+	maintenanceUpdateID    = maintenanceUpdate.Arg("id", "id of the window").Required().Int64()
+	maintenanceUpdateFlags = newMaintenanceWindowFlags(maintenanceUpdate)
+
+	maintenanceDelete   = maintenance.Command("delete", "delete a maintenance window")
+	maintenanceDeleteID = maintenanceDelete.Arg("id", "id of the window").Required().Int64()
+
+	dependencies = kingpin.Command("dependencies", "check dependency related commands")
+
+	dependenciesGet     = dependencies.Command("get", "get the parents and children of a check")
+	dependenciesGetType = dependenciesGet.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	dependenciesGetID   = dependenciesGet.Arg("id", "id of the check").Required().Int64()
+
+	dependenciesSet        = dependencies.Command("set", "replace the parents of a check")
+	dependenciesSetType    = dependenciesSet.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	dependenciesSetID      = dependenciesSet.Arg("id", "id of the check").Required().Int64()
+	dependenciesSetParents = dependenciesSet.Flag("parent", "parent check as type:id, may be repeated").Strings()
+
+	dependenciesGraph       = dependencies.Command("graph", "get the dependencies of all checks of a user")
+	dependenciesGraphUserID = dependenciesGraph.Arg("user-id", "id of the user").Required().Int64()
+
+	labels       = kingpin.Command("labels", "replace the labels and groups of a check")
+	labelsType   = labels.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	labelsID     = labels.Arg("id", "id of the check").Required().Int64()
+	labelsLabels = labels.Flag("label", "label of the check as name=value, may be repeated").StringMap()
+	labelsGroups = labels.Flag("group", "group of the check, may be repeated").Strings()
+
+	checks       = kingpin.Command("checks", "get checks of all types by user id")
+	checksUserID = checks.Arg("user-id", "id of the user").Required().Int64()
+	checksQuery  = newCheckQueryFlags(checks)
+
+	groups       = kingpin.Command("groups", "get the groups of the checks of a user")
+	groupsUserID = groups.Arg("user-id", "id of the user").Required().Int64()
+
+	rollups           = kingpin.Command("rollups", "get hourly or daily rolled up results of a check")
+	rollupsType       = rollups.Arg("type", "type of the check, one of http, tls, tcp, dns and heartbeat").Required().String()
+	rollupsID         = rollups.Arg("id", "id of the check").Required().Int64()
+	rollupsResolution = rollups.Flag("resolution", "one of hour and day, defaults to the finest available").String()
+	rollupsSince      = rollups.Flag("since", "only rollups newer than this duration").Default("168h").Duration()
+
+	apply       = kingpin.Command("apply", "apply the checks and alerts of a yaml document")
+	applyUserID = apply.Arg("user-id", "id of the user").Required().Int64()
+	applyFile   = apply.Flag("file", "yaml file with the document, - for stdin").Short('f').Required().String()
+	applyDryRun = apply.Flag("dry-run", "only show the changes").Bool()
+	applyPrune  = apply.Flag("prune", "delete checks and alerts missing in the document").Bool()
+
+	export       = kingpin.Command("export", "export the checks and alerts of a user as yaml document")
+	exportUserID = export.Arg("user-id", "id of the user").Required().Int64()
+
+	importCmd = kingpin.Command("import", "import checks and alerts from other monitoring tools")
+
+	importBlackbox        = importCmd.Command("blackbox", "import the targets of a Prometheus blackbox_exporter")
+	importBlackboxUserID  = importBlackbox.Arg("user-id", "id of the user").Required().Int64()
+	importBlackboxModules = importBlackbox.Flag("modules", "blackbox_exporter configuration with the modules").Required().String()
+	importBlackboxTargets = importBlackbox.Flag("targets", "Prometheus configuration with the probed targets").Required().String()
+	importBlackboxFlags   = newImportFlags(importBlackbox)
+
+	importUptimeRobot       = importCmd.Command("uptimerobot", "import the monitors of an UptimeRobot export")
+	importUptimeRobotUserID = importUptimeRobot.Arg("user-id", "id of the user").Required().Int64()
+	importUptimeRobotFile   = importUptimeRobot.Flag("file", "json response of getMonitors or csv export").Short('f').Required().String()
+	importUptimeRobotFormat = importUptimeRobot.Flag("format", "one of json and csv, defaults to the file extension").Enum("json", "csv")
+	importUptimeRobotFlags  = newImportFlags(importUptimeRobot)
 )
 
 func printCheck(c *proto.HTTPCheck) {
-	fmt.Printf("id=%v, user_id=%v, url=%v\n", c.Id, c.UserId, c.Url)
+	interval, _ := ptypes.Duration(c.Interval)
+	timeout, _ := ptypes.Duration(c.Timeout)
+	fmt.Printf("id=%v, user_id=%v, method=%v, url=%v, headers=%v, interval=%v, timeout=%v, failure_threshold=%v, locations=%v, min_failed_locations=%v, enabled=%v, labels=%v, groups=%v\n",
+		c.Id, c.UserId, c.Method, c.Url, c.Headers, interval, timeout,
+		c.FailureThreshold, c.Locations, c.MinFailedLocations, c.Enabled, c.Labels, c.Groups)
+}
+
+func printTLSCheck(c *proto.TLSCheck) {
+	interval, _ := ptypes.Duration(c.Interval)
+	timeout, _ := ptypes.Duration(c.Timeout)
+	fmt.Printf("id=%v, user_id=%v, address=%v, server_name=%v, min_days_valid=%v, interval=%v, timeout=%v, failure_threshold=%v, locations=%v, min_failed_locations=%v, enabled=%v, labels=%v, groups=%v\n",
+		c.Id, c.UserId, c.Address, c.ServerName, c.MinDaysValid, interval,
+		timeout, c.FailureThreshold, c.Locations, c.MinFailedLocations,
+		c.Enabled, c.Labels, c.Groups)
+}
+
+func printTLSResult(r *proto.TLSResult) {
+	fmt.Printf("timestamp=%v, location=%v, success=%v, duration=%v, expires_in_days=%v, issuer=%v, error=%v, maintenance=%v\n",
+		ptypes.TimestampString(r.Timestamp), r.Location, r.Success,
+		time.Duration(r.Duration), r.ExpiresInDays, r.Issuer, r.Error,
+		r.Maintenance)
+}
+
+func printTCPCheck(c *proto.TCPCheck) {
+	timeout, _ := ptypes.Duration(c.Timeout)
+	interval, _ := ptypes.Duration(c.Interval)
+	fmt.Printf("id=%v, user_id=%v, address=%v, timeout=%v, payload=%q, expect=%q, interval=%v, failure_threshold=%v, locations=%v, min_failed_locations=%v, enabled=%v, labels=%v, groups=%v\n",
+		c.Id, c.UserId, c.Address, timeout, c.Payload, c.Expect, interval,
+		c.FailureThreshold, c.Locations, c.MinFailedLocations, c.Enabled, c.Labels, c.Groups)
+}
+
+func printTCPResult(r *proto.TCPResult) {
+	fmt.Printf("timestamp=%v, location=%v, success=%v, duration=%v, response=%q, error=%v, maintenance=%v\n",
+		ptypes.TimestampString(r.Timestamp), r.Location, r.Success,
+		time.Duration(r.Duration), r.Response, r.Error, r.Maintenance)
+}
+
+func printDNSCheck(c *proto.DNSCheck) {
+	timeout, _ := ptypes.Duration(c.Timeout)
+	interval, _ := ptypes.Duration(c.Interval)
+	fmt.Printf("id=%v, user_id=%v, name=%v, record_type=%v, resolver=%v, timeout=%v, expected=%v, ttl=%v-%v, rcode=%v, interval=%v, failure_threshold=%v, locations=%v, min_failed_locations=%v, enabled=%v, labels=%v, groups=%v\n",
+		c.Id, c.UserId, c.Name, c.RecordType, c.Resolver, timeout, c.Expected,
+		c.MinTtl, c.MaxTtl, c.Rcode, interval, c.FailureThreshold, c.Locations,
+		c.MinFailedLocations, c.Enabled, c.Labels, c.Groups)
+}
+
+func printDNSResult(r *proto.DNSResult) {
+	fmt.Printf("timestamp=%v, location=%v, success=%v, duration=%v, rcode=%v, answers=%v, error=%v, maintenance=%v\n",
+		ptypes.TimestampString(r.Timestamp), r.Location, r.Success,
+		time.Duration(r.Duration), r.Rcode, r.Answers, r.Error, r.Maintenance)
+}
+
+func printHeartbeatCheck(c *proto.HeartbeatCheck) {
+	period, _ := ptypes.Duration(c.Period)
+	grace, _ := ptypes.Duration(c.Grace)
+	fmt.Printf("id=%v, user_id=%v, token=%v, period=%v, grace=%v, enabled=%v, labels=%v, groups=%v\n",
+		c.Id, c.UserId, c.Token, period, grace, c.Enabled, c.Labels, c.Groups)
+}
+
+func printHeartbeatResult(r *proto.HeartbeatResult) {
+	fmt.Printf("timestamp=%v, kind=%v, success=%v, duration=%v, message=%q, maintenance=%v\n",
+		ptypes.TimestampString(r.Timestamp), r.Kind, r.Success,
+		time.Duration(r.Duration), r.Message, r.Maintenance)
+}
+
+func printCheckState(s *proto.CheckState) {
+	fmt.Printf("check_id=%v, check_type=%v, state=%v, failures=%v, changed=%v, updated=%v, unreachable=%v, flapping=%v, state_change=%.1f%%\n",
+		s.CheckId, s.CheckType, s.State, s.Failures,
+		ptypes.TimestampString(s.Changed), ptypes.TimestampString(s.Updated), s.Unreachable,
+		s.Flapping, s.StateChange)
+}
+
+func printStatistics(s *proto.Statistics) {
+	outageDuration, _ := ptypes.Duration(s.OutageDuration)
+	mean, _ := ptypes.Duration(s.LatencyMean)
+	p50, _ := ptypes.Duration(s.LatencyP50)
+	p95, _ := ptypes.Duration(s.LatencyP95)
+	p99, _ := ptypes.Duration(s.LatencyP99)
+	latencyMin, _ := ptypes.Duration(s.LatencyMin)
+	latencyMax, _ := ptypes.Duration(s.LatencyMax)
+	fmt.Printf("check_id=%v, check_type=%v, from=%v, to=%v, runs=%v, failures=%v, uptime=%.3f%%, outages=%v, outage_duration=%v, rolled_up=%v\n",
+		s.CheckId, s.CheckType, ptypes.TimestampString(s.From),
+		ptypes.TimestampString(s.To), s.Runs, s.Failures, s.Uptime,
+		s.OutageCount, outageDuration, s.RolledUp)
+	fmt.Printf("latency min=%v, mean=%v, max=%v, p50=%v, p95=%v, p99=%v\n",
+		latencyMin, mean, latencyMax, p50, p95, p99)
+	for _, o := range s.Outages {
+		d, _ := ptypes.Duration(o.Duration)
+		end := "ongoing"
+		if o.End != nil {
+			end = ptypes.TimestampString(o.End)
+		}
+		fmt.Printf("outage start=%v, end=%v, duration=%v\n",
+			ptypes.TimestampString(o.Start), end, d)
+	}
+	for _, e := range s.Errors {
+		fmt.Printf("error count=%v, status_code=%v, error=%q\n",
+			e.Count, e.StatusCode, e.Error)
+	}
+}
+
+func printReconcileReport(r *proto.ReconcileReport) {
+	fmt.Printf("timestamp=%v, running=%v\n", ptypes.TimestampString(r.Timestamp), r.Running)
+	for _, ref := range r.Added {
+		fmt.Printf("added type=%v, id=%v\n", ref.Type, ref.Id)
+	}
+	for _, ref := range r.Removed {
+		fmt.Printf("removed type=%v, id=%v\n", ref.Type, ref.Id)
+	}
+	for _, ref := range r.Updated {
+		fmt.Printf("updated type=%v, id=%v\n", ref.Type, ref.Id)
+	}
+}
+
+func printRollup(r *proto.Rollup) {
+	monitored, _ := ptypes.Duration(r.Monitored)
+	downtime, _ := ptypes.Duration(r.Downtime)
+	avg, _ := ptypes.Duration(r.LatencyAvg)
+	p95, _ := ptypes.Duration(r.LatencyP95)
+	fmt.Printf("bucket=%v, runs=%v, failures=%v, outages=%v, monitored=%v, downtime=%v, latency_avg=%v, latency_p95=%v, errors=%v\n",
+		ptypes.TimestampString(r.Bucket), r.Runs, r.Failures, r.Outages,
+		monitored, downtime, avg, p95, len(r.Errors))
+}
+
+// statisticsQuery returns the query of the statistics command
+func statisticsQuery() (*proto.StatisticsQuery, error) {
+	q := &proto.StatisticsQuery{
+		CheckId:   *statisticsID,
+		CheckType: *statisticsType,
+	}
+	var from, to time.Time
+	var err error
+	if *statisticsMonth != "" {
+		from, err = time.Parse("2006-01", *statisticsMonth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid month %v, %v", *statisticsMonth, err)
+		}
+		to = from.AddDate(0, 1, 0)
+	} else {
+		if *statisticsFrom != "" {
+			from, err = time.Parse(time.RFC3339, *statisticsFrom)
+			if err != nil {
+				return nil, fmt.Errorf("invalid from %v, %v", *statisticsFrom, err)
+			}
+		}
+		if *statisticsTo != "" {
+			to, err = time.Parse(time.RFC3339, *statisticsTo)
+			if err != nil {
+				return nil, fmt.Errorf("invalid to %v, %v", *statisticsTo, err)
+			}
+		}
+	}
+	if !from.IsZero() {
+		q.From, _ = ptypes.TimestampProto(from)
+	}
+	if !to.IsZero() {
+		q.To, _ = ptypes.TimestampProto(to)
+	}
+	return q, nil
+}
+
+// parseStatusCodes parses status codes like 200 or 200-299
+func parseStatusCodes(codes []string) ([]*proto.StatusCodeRange, error) {
+	ranges := make([]*proto.StatusCodeRange, len(codes))
+	for i, c := range codes {
+		parts := strings.SplitN(c, "-", 2)
+		from, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %v, %v", c, err)
+		}
+		to := from
+		if len(parts) == 2 {
+			to, err = strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status code %v, %v", c, err)
+			}
+		}
+		ranges[i] = &proto.StatusCodeRange{From: from, To: to}
+	}
+	return ranges, nil
+}
+
+// resultQueryFlags are the flags shared by all results commands
+type resultQueryFlags struct {
+	since  *time.Duration
+	filter *string
+	cursor *string
+	limit  *int64
+	order  *string
+}
+
+func newResultQueryFlags(cmd *kingpin.CmdClause) *resultQueryFlags {
+	return &resultQueryFlags{
+		since:  cmd.Flag("since", "only results newer than this duration").Duration(),
+		filter: cmd.Flag("filter", "one of all, success and failure").Default("all").String(),
+		cursor: cmd.Flag("cursor", "cursor of the page to get").String(),
+		limit:  cmd.Flag("limit", "number of results per page").Default("100").Int64(),
+		order:  cmd.Flag("order", "one of desc and asc").Default("desc").String(),
+	}
+}
+
+func (f *resultQueryFlags) query(id int64) *proto.ResultQuery {
+	q := &proto.ResultQuery{
+		CheckId: id,
+		Filter:  *f.filter,
+		Cursor:  *f.cursor,
+		Limit:   *f.limit,
+		Order:   *f.order,
+	}
+	if *f.since > 0 {
+		q.From, _ = ptypes.TimestampProto(time.Now().Add(-*f.since))
+	}
+	return q
+}
+
+type maintenanceWindowFlags struct {
+	checkID   *int64
+	checkType *string
+	name      *string
+	mode      *string
+	start     *string
+	end       *string
+	schedule  *string
+	duration  *time.Duration
+	timezone  *string
+}
+
+func newMaintenanceWindowFlags(cmd *kingpin.CmdClause) *maintenanceWindowFlags {
+	return &maintenanceWindowFlags{
+		checkID:   cmd.Flag("check-id", "id of the check, all checks of the user without check type").Int64(),
+		checkType: cmd.Flag("check-type", "type of the check, one of http, tls, tcp, dns and heartbeat").String(),
+		name:      cmd.Flag("name", "name of the window").Required().String(),
+		mode:      cmd.Flag("mode", "one of record and pause").Default("record").String(),
+		start:     cmd.Flag("start", "start of a one-off window in RFC 3339").String(),
+		end:       cmd.Flag("end", "end of a one-off window in RFC 3339").String(),
+		schedule:  cmd.Flag("schedule", "cron rule of a recurring window, e.g. \"0 2 * * SUN\"").String(),
+		duration:  cmd.Flag("duration", "duration of a recurring window").Duration(),
+		timezone:  cmd.Flag("timezone", "timezone of the schedule, defaults to UTC").String(),
+	}
+}
+
+func (f *maintenanceWindowFlags) window(id int64, userID int64) (*proto.MaintenanceWindow, error) {
+	w := &proto.MaintenanceWindow{
+		Id:        id,
+		UserId:    userID,
+		CheckId:   *f.checkID,
+		CheckType: *f.checkType,
+		Name:      *f.name,
+		Mode:      *f.mode,
+		Schedule:  *f.schedule,
+		Timezone:  *f.timezone,
+	}
+	if *f.start != "" {
+		start, err := time.Parse(time.RFC3339, *f.start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start %v, %v", *f.start, err)
+		}
+		w.StartsAt, _ = ptypes.TimestampProto(start)
+	}
+	if *f.end != "" {
+		end, err := time.Parse(time.RFC3339, *f.end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end %v, %v", *f.end, err)
+		}
+		w.EndsAt, _ = ptypes.TimestampProto(end)
+	}
+	if *f.duration > 0 {
+		w.Duration = ptypes.DurationProto(*f.duration)
+	}
+	return w, nil
+}
+
+func printMaintenanceWindow(w *proto.MaintenanceWindow) {
+	window := ""
+	if w.Schedule != "" {
+		duration, _ := ptypes.Duration(w.Duration)
+		window = fmt.Sprintf("schedule=%q, duration=%v, timezone=%v",
+			w.Schedule, duration, w.Timezone)
+	} else {
+		window = fmt.Sprintf("start=%v, end=%v",
+			ptypes.TimestampString(w.StartsAt), ptypes.TimestampString(w.EndsAt))
+	}
+	fmt.Printf("id=%v, user_id=%v, check_id=%v, check_type=%v, name=%q, mode=%v, %v, active=%v\n",
+		w.Id, w.UserId, w.CheckId, w.CheckType, w.Name, w.Mode, window, w.Active)
+}
+
+// parseCheckRef parses a check reference of the form type:id
+func parseCheckRef(s string) (*proto.CheckRef, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("check %q not of the form type:id", s)
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id of check %q, %v", s, err)
+	}
+	return &proto.CheckRef{Id: id, Type: parts[0]}, nil
+}
+
+func formatCheckRefs(refs []*proto.CheckRef) string {
+	s := make([]string, len(refs))
+	for i, ref := range refs {
+		s[i] = fmt.Sprintf("%v:%v", ref.Type, ref.Id)
+	}
+	return strings.Join(s, ",")
+}
+
+func printDependencies(d *proto.CheckDependencies) {
+	fmt.Printf("check=%v:%v, parents=%v, children=%v\n",
+		d.Check.Type, d.Check.Id, formatCheckRefs(d.Parents), formatCheckRefs(d.Children))
+}
+
+type checkQueryFlags struct {
+	selector *string
+	group    *string
+}
+
+func newCheckQueryFlags(cmd *kingpin.CmdClause) *checkQueryFlags {
+	return &checkQueryFlags{
+		selector: cmd.Flag("selector", "label selector, e.g. env=prod,team!=ops").String(),
+		group:    cmd.Flag("group", "only checks in this group").String(),
+	}
+}
+
+func (f *checkQueryFlags) query(userID int64) *proto.CheckQuery {
+	return &proto.CheckQuery{
+		UserId:   userID,
+		Selector: *f.selector,
+		Group:    *f.group,
+	}
+}
+
+func printNextCursor(cursor string) {
+	if cursor != "" {
+		fmt.Printf("next_cursor=%v\n", cursor)
+	}
+}
+
+func printHTTPResult(r *proto.HTTPResult) {
+	fmt.Printf("timestamp=%v, location=%v, success=%v, status_code=%v, duration=%v, error=%v, dns_lookup=%v, tcp_connect=%v, tls_handshake=%v, time_to_first_byte=%v, content_transfer=%v, remote_ip=%v, protocol=%v, tls_version=%v, maintenance=%v\n",
+		ptypes.TimestampString(r.Timestamp), r.Location, r.Success,
+		r.StatusCode, time.Duration(r.Duration), r.Error,
+		time.Duration(r.DnsLookup), time.Duration(r.TcpConnect),
+		time.Duration(r.TlsHandshake), time.Duration(r.TimeToFirstByte),
+		time.Duration(r.ContentTransfer), r.RemoteIp, r.Protocol, r.TlsVersion,
+		r.Maintenance)
+}
+
+func printWorker(w *proto.Worker) {
+	fmt.Printf("address=%v, location=%v, last_seen=%v\n",
+		w.Address, w.Location, ptypes.TimestampString(w.LastSeen))
+}
+
+func printAgent(a *proto.Agent) {
+	lastSeen := "never"
+	if a.LastSeen != nil {
+		lastSeen = ptypes.TimestampString(a.LastSeen)
+	}
+	fmt.Printf("id=%v, user_id=%v, name=%v, location=%v, connected=%v, last_seen=%v\n",
+		a.Id, a.UserId, a.Name, a.Location, a.Connected, lastSeen)
+}
+
+func printRunResult(r *proto.RunResult) {
+	fmt.Printf("check_id=%v, check_type=%v, timestamp=%v, success=%v\n",
+		r.Check.Id, r.Check.Type, ptypes.TimestampString(r.Timestamp), r.Success)
+	for _, result := range r.Http {
+		printHTTPResult(result)
+	}
+	for _, result := range r.Tls {
+		printTLSResult(result)
+	}
+	for _, result := range r.Tcp {
+		printTCPResult(result)
+	}
+	for _, result := range r.Dns {
+		printDNSResult(result)
+	}
+}
+
+// readDryRun reads the check definition from the file or stdin
+func readDryRun(file string) (*proto.DryRun, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &proto.DryRun{}
+	return d, protojson.Unmarshal(data, d)
 }
 
 func printID(id *proto.Id) {
@@ -52,9 +710,43 @@ func mainWithError() error {
 	// Switch to different modes
 	switch parse {
 	case "httpcheck create":
+		statusCodes, err := parseStatusCodes(*httpCheckCreateStatus)
+		if err != nil {
+			return err
+		}
+		assertions := &proto.HTTPAssertions{
+			StatusCodes:     statusCodes,
+			BodyContains:    *httpCheckCreateBodyContains,
+			BodyNotContains: *httpCheckCreateBodyNotContains,
+			BodyMatches:     *httpCheckCreateBodyMatches,
+			BodyNotMatches:  *httpCheckCreateBodyNotMatches,
+		}
+		for path, value := range *httpCheckCreateJSONPath {
+			assertions.JsonPaths = append(assertions.JsonPaths,
+				&proto.JSONPathAssertion{Path: path, Value: value})
+		}
+		for name, value := range *httpCheckCreateExpectHeader {
+			assertions.Headers = append(assertions.Headers,
+				&proto.HeaderAssertion{Name: name, Value: value})
+		}
+		if *httpCheckCreateMaxResponseTime != 0 {
+			assertions.MaxResponseTime = ptypes.DurationProto(*httpCheckCreateMaxResponseTime)
+		}
 		id, err := c.CreateHTTPCheck(context.Background(), &proto.HTTPCheck{
-			Url:    *httpCheckCreateURL,
-			UserId: *httpCheckCreateUserID,
+			Url:                *httpCheckCreateURL,
+			UserId:             *httpCheckCreateUserID,
+			Method:             *httpCheckCreateMethod,
+			Headers:            *httpCheckCreateHeader,
+			Body:               *httpCheckCreateBody,
+			Username:           *httpCheckCreateUser,
+			Password:           *httpCheckCreatePass,
+			BearerToken:        *httpCheckCreateToken,
+			Assertions:         assertions,
+			Interval:           ptypes.DurationProto(*httpCheckCreateInterval),
+			Timeout:            ptypes.DurationProto(*httpCheckCreateTimeout),
+			FailureThreshold:   *httpCheckCreateThreshold,
+			Locations:          *httpCheckCreateLocations,
+			MinFailedLocations: *httpCheckCreateMinFailed,
 		})
 		if err != nil {
 			return fmt.Errorf("Unable to create new check: %v", err)
@@ -67,7 +759,7 @@ func mainWithError() error {
 		}
 		printCheck(check)
 	case "httpcheck get-by-user":
-		checks, err := c.GetHTTPCheckByUser(context.Background(), &proto.Id{Id: *httpCheckgetByUserID})
+		checks, err := c.GetHTTPCheckByUser(context.Background(), httpCheckgetByUserQuery.query(*httpCheckgetByUserID))
 		if err != nil {
 			return fmt.Errorf("Unable to get check by user id %v: %v", *httpCheckgetByUserID, err)
 		}
@@ -80,6 +772,475 @@ func mainWithError() error {
 			return fmt.Errorf("Unable to delete check %v: %v", *httpCheckdeleteID, err)
 		}
 		fmt.Println("Check deleted")
+	case "httpcheck results":
+		results, err := c.GetHTTPCheckResultsByCheck(context.Background(), httpCheckResultsQuery.query(*httpCheckResultsID))
+		if err != nil {
+			return fmt.Errorf("Unable to get results of check %v: %v", *httpCheckResultsID, err)
+		}
+		for _, r := range results.Results {
+			printHTTPResult(r)
+		}
+		printNextCursor(results.NextCursor)
+	case "tlscheck create":
+		id, err := c.CreateTLSCheck(context.Background(), &proto.TLSCheck{
+			UserId:             *tlsCheckCreateUserID,
+			Address:            *tlsCheckCreateAddress,
+			ServerName:         *tlsCheckCreateServerName,
+			MinDaysValid:       *tlsCheckCreateMinDaysValid,
+			Interval:           ptypes.DurationProto(*tlsCheckCreateInterval),
+			Timeout:            ptypes.DurationProto(*tlsCheckCreateTimeout),
+			FailureThreshold:   *tlsCheckCreateThreshold,
+			Locations:          *tlsCheckCreateLocations,
+			MinFailedLocations: *tlsCheckCreateMinFailed,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create new check: %v", err)
+		}
+		printID(id)
+	case "tlscheck get":
+		check, err := c.GetTLSCheck(context.Background(), &proto.Id{Id: *tlsCheckgetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get check %v: %v", *tlsCheckgetID, err)
+		}
+		printTLSCheck(check)
+	case "tlscheck get-by-user":
+		checks, err := c.GetTLSCheckByUser(context.Background(), tlsCheckgetByUserQuery.query(*tlsCheckgetByUserID))
+		if err != nil {
+			return fmt.Errorf("Unable to get check by user id %v: %v", *tlsCheckgetByUserID, err)
+		}
+		for _, check := range checks.Checks {
+			printTLSCheck(check)
+		}
+	case "tlscheck delete":
+		_, err := c.DeleteTLSCheck(context.Background(), &proto.Id{Id: *tlsCheckdeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete check %v: %v", *tlsCheckdeleteID, err)
+		}
+		fmt.Println("Check deleted")
+	case "tlscheck results":
+		results, err := c.GetTLSCheckResultsByCheck(context.Background(), tlsCheckResultsQuery.query(*tlsCheckResultsID))
+		if err != nil {
+			return fmt.Errorf("Unable to get results of check %v: %v", *tlsCheckResultsID, err)
+		}
+		for _, r := range results.Results {
+			printTLSResult(r)
+		}
+		printNextCursor(results.NextCursor)
+	case "tcpcheck create":
+		payload, err := strconv.Unquote(`"` + strings.ReplaceAll(*tcpCheckCreatePayload, `"`, `\"`) + `"`)
+		if err != nil {
+			return fmt.Errorf("Invalid payload %v: %v", *tcpCheckCreatePayload, err)
+		}
+		id, err := c.CreateTCPCheck(context.Background(), &proto.TCPCheck{
+			UserId:             *tcpCheckCreateUserID,
+			Address:            *tcpCheckCreateAddress,
+			Timeout:            ptypes.DurationProto(*tcpCheckCreateTimeout),
+			Payload:            payload,
+			Expect:             *tcpCheckCreateExpect,
+			Interval:           ptypes.DurationProto(*tcpCheckCreateInterval),
+			FailureThreshold:   *tcpCheckCreateThreshold,
+			Locations:          *tcpCheckCreateLocations,
+			MinFailedLocations: *tcpCheckCreateMinFailed,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create new check: %v", err)
+		}
+		printID(id)
+	case "tcpcheck get":
+		check, err := c.GetTCPCheck(context.Background(), &proto.Id{Id: *tcpCheckgetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get check %v: %v", *tcpCheckgetID, err)
+		}
+		printTCPCheck(check)
+	case "tcpcheck get-by-user":
+		checks, err := c.GetTCPCheckByUser(context.Background(), tcpCheckgetByUserQuery.query(*tcpCheckgetByUserID))
+		if err != nil {
+			return fmt.Errorf("Unable to get check by user id %v: %v", *tcpCheckgetByUserID, err)
+		}
+		for _, check := range checks.Checks {
+			printTCPCheck(check)
+		}
+	case "tcpcheck delete":
+		_, err := c.DeleteTCPCheck(context.Background(), &proto.Id{Id: *tcpCheckdeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete check %v: %v", *tcpCheckdeleteID, err)
+		}
+		fmt.Println("Check deleted")
+	case "tcpcheck results":
+		results, err := c.GetTCPCheckResultsByCheck(context.Background(), tcpCheckResultsQuery.query(*tcpCheckResultsID))
+		if err != nil {
+			return fmt.Errorf("Unable to get results of check %v: %v", *tcpCheckResultsID, err)
+		}
+		for _, r := range results.Results {
+			printTCPResult(r)
+		}
+		printNextCursor(results.NextCursor)
+	case "dnscheck create":
+		id, err := c.CreateDNSCheck(context.Background(), &proto.DNSCheck{
+			UserId:             *dnsCheckCreateUserID,
+			Name:               *dnsCheckCreateName,
+			RecordType:         *dnsCheckCreateRecordType,
+			Resolver:           *dnsCheckCreateResolver,
+			Timeout:            ptypes.DurationProto(*dnsCheckCreateTimeout),
+			Expected:           *dnsCheckCreateExpected,
+			MinTtl:             *dnsCheckCreateMinTTL,
+			MaxTtl:             *dnsCheckCreateMaxTTL,
+			Rcode:              *dnsCheckCreateRCode,
+			Interval:           ptypes.DurationProto(*dnsCheckCreateInterval),
+			FailureThreshold:   *dnsCheckCreateThreshold,
+			Locations:          *dnsCheckCreateLocations,
+			MinFailedLocations: *dnsCheckCreateMinFailed,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create new check: %v", err)
+		}
+		printID(id)
+	case "dnscheck get":
+		check, err := c.GetDNSCheck(context.Background(), &proto.Id{Id: *dnsCheckgetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get check %v: %v", *dnsCheckgetID, err)
+		}
+		printDNSCheck(check)
+	case "dnscheck get-by-user":
+		checks, err := c.GetDNSCheckByUser(context.Background(), dnsCheckgetByUserQuery.query(*dnsCheckgetByUserID))
+		if err != nil {
+			return fmt.Errorf("Unable to get check by user id %v: %v", *dnsCheckgetByUserID, err)
+		}
+		for _, check := range checks.Checks {
+			printDNSCheck(check)
+		}
+	case "dnscheck delete":
+		_, err := c.DeleteDNSCheck(context.Background(), &proto.Id{Id: *dnsCheckdeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete check %v: %v", *dnsCheckdeleteID, err)
+		}
+		fmt.Println("Check deleted")
+	case "dnscheck results":
+		results, err := c.GetDNSCheckResultsByCheck(context.Background(), dnsCheckResultsQuery.query(*dnsCheckResultsID))
+		if err != nil {
+			return fmt.Errorf("Unable to get results of check %v: %v", *dnsCheckResultsID, err)
+		}
+		for _, r := range results.Results {
+			printDNSResult(r)
+		}
+		printNextCursor(results.NextCursor)
+	case "heartbeatcheck create":
+		check, err := c.CreateHeartbeatCheck(context.Background(), &proto.HeartbeatCheck{
+			UserId: *heartbeatCheckCreateUserID,
+			Period: ptypes.DurationProto(*heartbeatCheckCreatePeriod),
+			Grace:  ptypes.DurationProto(*heartbeatCheckCreateGrace),
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create new check: %v", err)
+		}
+		printHeartbeatCheck(check)
+	case "heartbeatcheck get":
+		check, err := c.GetHeartbeatCheck(context.Background(), &proto.Id{Id: *heartbeatCheckgetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get check %v: %v", *heartbeatCheckgetID, err)
+		}
+		printHeartbeatCheck(check)
+	case "heartbeatcheck get-by-user":
+		checks, err := c.GetHeartbeatCheckByUser(context.Background(), heartbeatCheckgetByUserQuery.query(*heartbeatCheckgetByUserID))
+		if err != nil {
+			return fmt.Errorf("Unable to get check by user id %v: %v", *heartbeatCheckgetByUserID, err)
+		}
+		for _, check := range checks.Checks {
+			printHeartbeatCheck(check)
+		}
+	case "heartbeatcheck delete":
+		_, err := c.DeleteHeartbeatCheck(context.Background(), &proto.Id{Id: *heartbeatCheckdeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete check %v: %v", *heartbeatCheckdeleteID, err)
+		}
+		fmt.Println("Check deleted")
+	case "heartbeatcheck results":
+		results, err := c.GetHeartbeatCheckResultsByCheck(context.Background(), heartbeatCheckResultsQuery.query(*heartbeatCheckResultsID))
+		if err != nil {
+			return fmt.Errorf("Unable to get results of check %v: %v", *heartbeatCheckResultsID, err)
+		}
+		for _, r := range results.Results {
+			printHeartbeatResult(r)
+		}
+		printNextCursor(results.NextCursor)
+	case "heartbeatcheck ping":
+		_, err := c.PingHeartbeat(context.Background(), &proto.HeartbeatPing{
+			Token:   *heartbeatCheckPingToken,
+			Kind:    *heartbeatCheckPingKind,
+			Message: *heartbeatCheckPingMessage,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to send ping: %v", err)
+		}
+		fmt.Println("Ping sent")
+	case "state":
+		s, err := c.GetCheckState(context.Background(), &proto.CheckRef{
+			Id:   *stateID,
+			Type: *stateType,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to get state of check %v: %v", *stateID, err)
+		}
+		printCheckState(s)
+	case "statistics":
+		q, err := statisticsQuery()
+		if err != nil {
+			return err
+		}
+		s, err := c.GetCheckStatistics(context.Background(), q)
+		if err != nil {
+			return fmt.Errorf("Unable to get statistics of check %v: %v", *statisticsID, err)
+		}
+		printStatistics(s)
+	case "run":
+		r, err := c.RunCheck(context.Background(), &proto.CheckRef{Id: *runID, Type: *runType})
+		if err != nil {
+			return fmt.Errorf("Unable to run check %v: %v", *runID, err)
+		}
+		printRunResult(r)
+	case "pause":
+		_, err := c.PauseCheck(context.Background(), &proto.CheckRef{Id: *pauseID, Type: *pauseType})
+		if err != nil {
+			return fmt.Errorf("Unable to pause check %v: %v", *pauseID, err)
+		}
+	case "resume":
+		_, err := c.ResumeCheck(context.Background(), &proto.CheckRef{Id: *resumeID, Type: *resumeType})
+		if err != nil {
+			return fmt.Errorf("Unable to resume check %v: %v", *resumeID, err)
+		}
+	case "dry-run":
+		d, err := readDryRun(*dryRunFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read check from %v: %v", *dryRunFile, err)
+		}
+		r, err := c.DryRunCheck(context.Background(), d)
+		if err != nil {
+			return fmt.Errorf("Unable to dry run check: %v", err)
+		}
+		printRunResult(r)
+	case "reconcile":
+		r, err := c.ReconcileChecks(context.Background(), &empty.Empty{})
+		if err != nil {
+			return fmt.Errorf("Unable to reconcile checks: %v", err)
+		}
+		printReconcileReport(r)
+	case "workers":
+		ws, err := c.GetWorkers(context.Background(), &empty.Empty{})
+		if err != nil {
+			return fmt.Errorf("Unable to get workers: %v", err)
+		}
+		for _, w := range ws.Workers {
+			printWorker(w)
+		}
+	case "agent create":
+		a, err := c.CreateAgent(context.Background(), &proto.Agent{
+			UserId: *agentCreateUserID,
+			Name:   *agentCreateName,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create new agent: %v", err)
+		}
+		printAgent(a)
+		fmt.Printf("token=%v\n", a.Token)
+	case "agent get":
+		a, err := c.GetAgent(context.Background(), &proto.Id{Id: *agentGetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get agent %v: %v", *agentGetID, err)
+		}
+		printAgent(a)
+	case "agent get-by-user":
+		as, err := c.GetAgentsByUser(context.Background(), &proto.Id{Id: *agentGetByUserID})
+		if err != nil {
+			return fmt.Errorf("Unable to get agents by user id %v: %v", *agentGetByUserID, err)
+		}
+		for _, a := range as.Agents {
+			printAgent(a)
+		}
+	case "agent delete":
+		_, err := c.DeleteAgent(context.Background(), &proto.Id{Id: *agentDeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete agent %v: %v", *agentDeleteID, err)
+		}
+	case "maintenance create":
+		w, err := maintenanceCreateFlags.window(0, *maintenanceCreateUserID)
+		if err != nil {
+			return err
+		}
+		id, err := c.CreateMaintenanceWindow(context.Background(), w)
+		if err != nil {
+			return fmt.Errorf("Unable to create new maintenance window: %v", err)
+		}
+		fmt.Printf("id=%v\n", id.Id)
+	case "maintenance get":
+		w, err := c.GetMaintenanceWindow(context.Background(), &proto.Id{Id: *maintenanceGetID})
+		if err != nil {
+			return fmt.Errorf("Unable to get maintenance window %v: %v", *maintenanceGetID, err)
+		}
+		printMaintenanceWindow(w)
+	case "maintenance get-by-user":
+		ws, err := c.GetMaintenanceWindowsByUser(context.Background(), &proto.Id{Id: *maintenanceGetByUserID})
+		if err != nil {
+			return fmt.Errorf("Unable to get maintenance windows by user id %v: %v", *maintenanceGetByUserID, err)
+		}
+		for _, w := range ws.Windows {
+			printMaintenanceWindow(w)
+		}
+	case "maintenance update":
+		w, err := maintenanceUpdateFlags.window(*maintenanceUpdateID, 0)
+		if err != nil {
+			return err
+		}
+		_, err = c.UpdateMaintenanceWindow(context.Background(), w)
+		if err != nil {
+			return fmt.Errorf("Unable to update maintenance window %v: %v", *maintenanceUpdateID, err)
+		}
+	case "maintenance delete":
+		_, err := c.DeleteMaintenanceWindow(context.Background(), &proto.Id{Id: *maintenanceDeleteID})
+		if err != nil {
+			return fmt.Errorf("Unable to delete maintenance window %v: %v", *maintenanceDeleteID, err)
+		}
+	case "dependencies get":
+		d, err := c.GetCheckDependencies(context.Background(), &proto.CheckRef{Id: *dependenciesGetID, Type: *dependenciesGetType})
+		if err != nil {
+			return fmt.Errorf("Unable to get dependencies of check %v: %v", *dependenciesGetID, err)
+		}
+		printDependencies(d)
+	case "dependencies set":
+		d := &proto.CheckDependencies{
+			Check: &proto.CheckRef{Id: *dependenciesSetID, Type: *dependenciesSetType},
+		}
+		for _, p := range *dependenciesSetParents {
+			ref, err := parseCheckRef(p)
+			if err != nil {
+				return fmt.Errorf("Unable to parse parent: %v", err)
+			}
+			d.Parents = append(d.Parents, ref)
+		}
+		_, err := c.SetCheckDependencies(context.Background(), d)
+		if err != nil {
+			return fmt.Errorf("Unable to set dependencies of check %v: %v", *dependenciesSetID, err)
+		}
+	case "dependencies graph":
+		g, err := c.GetDependencyGraph(context.Background(), &proto.Id{Id: *dependenciesGraphUserID})
+		if err != nil {
+			return fmt.Errorf("Unable to get dependency graph of user %v: %v", *dependenciesGraphUserID, err)
+		}
+		for _, d := range g.Checks {
+			printDependencies(d)
+		}
+	case "labels":
+		_, err := c.SetCheckLabels(context.Background(), &proto.CheckLabels{
+			Check:  &proto.CheckRef{Id: *labelsID, Type: *labelsType},
+			Labels: *labelsLabels,
+			Groups: *labelsGroups,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to set labels of check %v: %v", *labelsID, err)
+		}
+	case "checks":
+		cs, err := c.GetChecksByUser(context.Background(), checksQuery.query(*checksUserID))
+		if err != nil {
+			return fmt.Errorf("Unable to get checks by user id %v: %v", *checksUserID, err)
+		}
+		for _, check := range cs.Http {
+			printCheck(check)
+		}
+		for _, check := range cs.Tls {
+			printTLSCheck(check)
+		}
+		for _, check := range cs.Tcp {
+			printTCPCheck(check)
+		}
+		for _, check := range cs.Dns {
+			printDNSCheck(check)
+		}
+		for _, check := range cs.Heartbeat {
+			printHeartbeatCheck(check)
+		}
+	case "groups":
+		gs, err := c.GetGroupsByUser(context.Background(), &proto.Id{Id: *groupsUserID})
+		if err != nil {
+			return fmt.Errorf("Unable to get groups by user id %v: %v", *groupsUserID, err)
+		}
+		for _, g := range gs.Groups {
+			fmt.Printf("name=%q, checks=%v\n", g.Name, g.Checks)
+		}
+	case "rollups":
+		from, _ := ptypes.TimestampProto(time.Now().Add(-*rollupsSince))
+		rs, err := c.GetCheckRollups(context.Background(), &proto.RollupQuery{
+			CheckId:    *rollupsID,
+			CheckType:  *rollupsType,
+			Resolution: *rollupsResolution,
+			From:       from,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to get rollups of check %v: %v", *rollupsID, err)
+		}
+		fmt.Printf("resolution=%v\n", rs.Resolution)
+		for _, r := range rs.Rollups {
+			printRollup(r)
+		}
+	case "apply":
+		doc, err := readDocument(*applyFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read document from %v: %v", *applyFile, err)
+		}
+		r, err := c.Apply(context.Background(), &proto.ApplyRequest{
+			UserId:   *applyUserID,
+			Document: doc,
+			DryRun:   *applyDryRun,
+			Prune:    *applyPrune,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to apply document: %v", err)
+		}
+		printApplyReport(r)
+	case "export":
+		doc, err := c.Export(context.Background(), &proto.Id{Id: *exportUserID})
+		if err != nil {
+			return fmt.Errorf("Unable to export checks of user %v: %v", *exportUserID, err)
+		}
+		out, err := marshalDocument(doc)
+		if err != nil {
+			return fmt.Errorf("Unable to marshal document: %v", err)
+		}
+		fmt.Print(string(out))
+	case "import blackbox":
+		modules, err := ioutil.ReadFile(*importBlackboxModules)
+		if err != nil {
+			return fmt.Errorf("Unable to read modules from %v: %v", *importBlackboxModules, err)
+		}
+		targets, err := ioutil.ReadFile(*importBlackboxTargets)
+		if err != nil {
+			return fmt.Errorf("Unable to read targets from %v: %v", *importBlackboxTargets, err)
+		}
+		r, err := importer.Blackbox(modules, targets)
+		if err != nil {
+			return fmt.Errorf("Unable to import blackbox_exporter targets: %v", err)
+		}
+		return importBlackboxFlags.apply(c, *importBlackboxUserID, r)
+	case "import uptimerobot":
+		data, err := ioutil.ReadFile(*importUptimeRobotFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read export from %v: %v", *importUptimeRobotFile, err)
+		}
+		format := *importUptimeRobotFormat
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*importUptimeRobotFile)), ".")
+		}
+		var r *importer.Result
+		switch format {
+		case "json":
+			r, err = importer.UptimeRobotJSON(data)
+		case "csv":
+			r, err = importer.UptimeRobotCSV(data)
+		default:
+			return fmt.Errorf("Unknown format of %v, use --format", *importUptimeRobotFile)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to import UptimeRobot monitors: %v", err)
+		}
+		return importUptimeRobotFlags.apply(c, *importUptimeRobotUserID, r)
 	}
 
 	return nil
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/grpc"
 	"gopkg.in/alecthomas/kingpin.v2"
 
@@ -16,10 +19,69 @@ var (
 	// Command line arguments
 	server = kingpin.Flag("server", "server address").Default("127.0.0.1:8085").String()
 
-	do    = kingpin.Command("do", "do a HTTP Check")
-	doURL = do.Arg("url", "URL to check").Required().String()
+	do        = kingpin.Command("do", "do a HTTP Check")
+	doURL     = do.Arg("url", "URL to check").Required().String()
+	doMethod  = do.Flag("method", "http method of the request").Default("GET").String()
+	doHeader  = do.Flag("header", "header of the request, e.g. Accept=text/plain").StringMap()
+	doBody    = do.Flag("body", "body of the request").String()
+	doUser    = do.Flag("username", "username for basic auth").String()
+	doPass    = do.Flag("password", "password for basic auth").String()
+	doToken   = do.Flag("bearer-token", "bearer token for authorization").String()
+	doTimeout = do.Flag("timeout", "timeout of the check").Default("10s").Duration()
+
+	doStatus          = do.Flag("expect-status", "accepted status code or range, e.g. 200-299").Strings()
+	doBodyContains    = do.Flag("body-contains", "required substring of the body").Strings()
+	doBodyNotContains = do.Flag("body-not-contains", "forbidden substring of the body").Strings()
+	doBodyMatches     = do.Flag("body-matches", "regular expression the body has to match").Strings()
+	doBodyNotMatches  = do.Flag("body-not-matches", "regular expression the body must not match").Strings()
+	doJSONPath        = do.Flag("json-path", "expected value of a json path, e.g. $.status=ok").StringMap()
+	doExpectHeader    = do.Flag("expect-header", "regular expression for a response header, e.g. Content-Type=json").StringMap()
+	doMaxResponseTime = do.Flag("max-response-time", "maximum response time").Duration()
+
+	tls             = kingpin.Command("tls", "do a TLS Check")
+	tlsAddress      = tls.Arg("address", "address to check in the form host:port").Required().String()
+	tlsServerName   = tls.Flag("server-name", "server name to verify").String()
+	tlsMinDaysValid = tls.Flag("min-days-valid", "minimum number of days the certificates have to be valid").Default("14").Int64()
+	tlsTimeout      = tls.Flag("timeout", "timeout of the check").Default("10s").Duration()
+
+	tcp        = kingpin.Command("tcp", "do a TCP Check")
+	tcpAddress = tcp.Arg("address", "address to check in the form host:port").Required().String()
+	tcpTimeout = tcp.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	tcpPayload = tcp.Flag("payload", "payload sent after connecting, escape sequences like \\r\\n are interpreted").String()
+	tcpExpect  = tcp.Flag("expect", "regular expression the response has to match").String()
+
+	dns           = kingpin.Command("dns", "do a DNS Check")
+	dnsName       = dns.Arg("name", "name to query").Required().String()
+	dnsRecordType = dns.Arg("record-type", "record type to query, one of A, AAAA, CNAME, MX, TXT and NS").Required().String()
+	dnsResolver   = dns.Flag("resolver", "resolver address in the form host:port").String()
+	dnsTimeout    = dns.Flag("timeout", "timeout of the check").Default("10s").Duration()
+	dnsExpected   = dns.Flag("expect", "answer which has to be part of the response").Strings()
+	dnsMinTTL     = dns.Flag("min-ttl", "minimum ttl of the answers in seconds").Int64()
+	dnsMaxTTL     = dns.Flag("max-ttl", "maximum ttl of the answers in seconds").Int64()
+	dnsRCode      = dns.Flag("rcode", "expected response code").Default("NOERROR").String()
 )
 
+// parseStatusCodes parses status codes like 200 or 200-299
+func parseStatusCodes(codes []string) ([]*proto.StatusCodeRange, error) {
+	ranges := make([]*proto.StatusCodeRange, len(codes))
+	for i, c := range codes {
+		parts := strings.SplitN(c, "-", 2)
+		from, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %v, %v", c, err)
+		}
+		to := from
+		if len(parts) == 2 {
+			to, err = strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status code %v, %v", c, err)
+			}
+		}
+		ranges[i] = &proto.StatusCodeRange{From: from, To: to}
+	}
+	return ranges, nil
+}
+
 func mainWithError() error {
 	parse := kingpin.Parse()
 
@@ -33,14 +95,93 @@ func mainWithError() error {
 	// Switch to different modes
 	switch parse {
 	case "do":
+		statusCodes, err := parseStatusCodes(*doStatus)
+		if err != nil {
+			return err
+		}
+		assertions := &proto.Assertions{
+			StatusCodes:     statusCodes,
+			BodyContains:    *doBodyContains,
+			BodyNotContains: *doBodyNotContains,
+			BodyMatches:     *doBodyMatches,
+			BodyNotMatches:  *doBodyNotMatches,
+			MaxResponseTime: int64(*doMaxResponseTime),
+		}
+		for path, value := range *doJSONPath {
+			assertions.JsonPaths = append(assertions.JsonPaths,
+				&proto.JSONPathAssertion{Path: path, Value: value})
+		}
+		for name, value := range *doExpectHeader {
+			assertions.Headers = append(assertions.Headers,
+				&proto.HeaderAssertion{Name: name, Value: value})
+		}
 		result, err := c.Do(context.Background(), &proto.Check{
-			Url: *doURL,
+			Url:         *doURL,
+			Method:      *doMethod,
+			Headers:     *doHeader,
+			Body:        *doBody,
+			Username:    *doUser,
+			Password:    *doPass,
+			BearerToken: *doToken,
+			Assertions:  assertions,
+			Timeout:     int64(*doTimeout),
 		})
 		if err != nil {
 			return fmt.Errorf("Error during check: %v", err)
 		}
 		fmt.Printf("success=%v, status_code=%v, duration=%v, error=%v\n",
 			result.Success, result.StatusCode, time.Duration(result.Duration), result.Error)
+		fmt.Printf("dns_lookup=%v, tcp_connect=%v, tls_handshake=%v, time_to_first_byte=%v, content_transfer=%v, remote_ip=%v, protocol=%v, tls_version=%v\n",
+			time.Duration(result.DnsLookup), time.Duration(result.TcpConnect),
+			time.Duration(result.TlsHandshake), time.Duration(result.TimeToFirstByte),
+			time.Duration(result.ContentTransfer), result.RemoteIp, result.Protocol,
+			result.TlsVersion)
+	case "tls":
+		result, err := c.DoTLS(context.Background(), &proto.TLSCheck{
+			Address:      *tlsAddress,
+			ServerName:   *tlsServerName,
+			MinDaysValid: *tlsMinDaysValid,
+			Timeout:      int64(*tlsTimeout),
+		})
+		if err != nil {
+			return fmt.Errorf("Error during check: %v", err)
+		}
+		fmt.Printf("success=%v, duration=%v, not_after=%v, issuer=%v, error=%v\n",
+			result.Success, time.Duration(result.Duration),
+			ptypes.TimestampString(result.NotAfter), result.Issuer, result.Error)
+	case "tcp":
+		payload, err := strconv.Unquote(`"` + strings.ReplaceAll(*tcpPayload, `"`, `\"`) + `"`)
+		if err != nil {
+			return fmt.Errorf("Invalid payload %v: %v", *tcpPayload, err)
+		}
+		result, err := c.DoTCP(context.Background(), &proto.TCPCheck{
+			Address: *tcpAddress,
+			Timeout: int64(*tcpTimeout),
+			Payload: payload,
+			Expect:  *tcpExpect,
+		})
+		if err != nil {
+			return fmt.Errorf("Error during check: %v", err)
+		}
+		fmt.Printf("success=%v, duration=%v, response=%q, error=%v\n",
+			result.Success, time.Duration(result.Duration), result.Response, result.Error)
+	case "dns":
+		result, err := c.DoDNS(context.Background(), &proto.DNSCheck{
+			Name:       *dnsName,
+			RecordType: *dnsRecordType,
+			Resolver:   *dnsResolver,
+			Timeout:    int64(*dnsTimeout),
+			Expected:   *dnsExpected,
+			MinTtl:     *dnsMinTTL,
+			MaxTtl:     *dnsMaxTTL,
+			Rcode:      *dnsRCode,
+		})
+		if err != nil {
+			return fmt.Errorf("Error during check: %v", err)
+		}
+		fmt.Printf("success=%v, duration=%v, rcode=%v, answers=%v, error=%v\n",
+			result.Success, time.Duration(result.Duration), result.Rcode,
+			result.Answers, result.Error)
 	}
 
 	return nil
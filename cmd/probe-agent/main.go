@@ -0,0 +1,19 @@
+// Probe Agent
+package main
+
+import (
+	"log"
+
+	"github.com/shaardie/mondane/agent"
+)
+
+func mainWithError() error {
+	// run agent
+	return agent.Run()
+}
+
+func main() {
+	if err := mainWithError(); err != nil {
+		log.Fatalln(err)
+	}
+}
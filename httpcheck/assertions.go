@@ -0,0 +1,228 @@
+package httpcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// maxBodySize is the maximum number of bytes read from a response body
+const maxBodySize = 1 << 20
+
+// needsBody reports if the assertions require the response body
+func needsBody(a *proto.Assertions) bool {
+	if a == nil {
+		return false
+	}
+	return len(a.BodyContains) > 0 || len(a.BodyNotContains) > 0 ||
+		len(a.BodyMatches) > 0 || len(a.BodyNotMatches) > 0 ||
+		len(a.JsonPaths) > 0
+}
+
+// readBody reads the response body if needed and discards it otherwise,
+// so the connection can be reused.
+func readBody(a *proto.Assertions, resp *http.Response) ([]byte, error) {
+	if !needsBody(a) {
+		_, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBodySize))
+		return nil, err
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+}
+
+// assert checks the response against the assertions and returns an error
+// describing the first failing assertion.
+func assert(a *proto.Assertions, resp *http.Response, body []byte, d time.Duration) error {
+	if a == nil {
+		a = &proto.Assertions{}
+	}
+
+	if err := assertStatusCode(a.StatusCodes, int64(resp.StatusCode)); err != nil {
+		return err
+	}
+
+	if a.MaxResponseTime > 0 && d > time.Duration(a.MaxResponseTime) {
+		return fmt.Errorf("response time %v exceeds %v",
+			d, time.Duration(a.MaxResponseTime))
+	}
+
+	for _, h := range a.Headers {
+		re, err := regexp.Compile(h.Value)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q for header %v, %w",
+				h.Value, h.Name, err)
+		}
+		values, ok := resp.Header[http.CanonicalHeaderKey(h.Name)]
+		if !ok {
+			return fmt.Errorf("header %v missing", h.Name)
+		}
+		if !re.MatchString(strings.Join(values, ", ")) {
+			return fmt.Errorf("header %v does not match %q", h.Name, h.Value)
+		}
+	}
+
+	for _, c := range a.BodyContains {
+		if !bytes.Contains(body, []byte(c)) {
+			return fmt.Errorf("body does not contain %q", c)
+		}
+	}
+
+	for _, c := range a.BodyNotContains {
+		if bytes.Contains(body, []byte(c)) {
+			return fmt.Errorf("body contains %q", c)
+		}
+	}
+
+	for _, m := range a.BodyMatches {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q, %w", m, err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match %q", m)
+		}
+	}
+
+	for _, m := range a.BodyNotMatches {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q, %w", m, err)
+		}
+		if re.Match(body) {
+			return fmt.Errorf("body matches %q", m)
+		}
+	}
+
+	if len(a.JsonPaths) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("body is not valid json, %w", err)
+		}
+		for _, jp := range a.JsonPaths {
+			v, err := jsonPath(doc, jp.Path)
+			if err != nil {
+				return err
+			}
+			s, err := jsonString(v)
+			if err != nil {
+				return fmt.Errorf("unable to compare json path %v, %w", jp.Path, err)
+			}
+			if s != jp.Value {
+				return fmt.Errorf("json path %v is %v, expected %v",
+					jp.Path, s, jp.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func assertStatusCode(ranges []*proto.StatusCodeRange, code int64) error {
+	if len(ranges) == 0 {
+		ranges = []*proto.StatusCodeRange{{From: 200, To: 299}}
+	}
+	for _, r := range ranges {
+		to := r.To
+		if to == 0 {
+			to = r.From
+		}
+		if code >= r.From && code <= to {
+			return nil
+		}
+	}
+
+	accepted := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.To == 0 || r.To == r.From {
+			accepted[i] = strconv.FormatInt(r.From, 10)
+			continue
+		}
+		accepted[i] = fmt.Sprintf("%v-%v", r.From, r.To)
+	}
+	return fmt.Errorf("status code %v not in %v", code, strings.Join(accepted, ","))
+}
+
+// jsonString returns strings as they are and everything else json encoded
+func jsonString(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// jsonPath evaluates a simple JSONPath expression like `$.items[0].name` or
+// `$['key']` against a decoded json document.
+func jsonPath(doc interface{}, path string) (interface{}, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	cur := doc
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key := p[:end]
+			p = p[end:]
+			if key == "" {
+				return nil, fmt.Errorf("invalid json path %v", path)
+			}
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %v, %v is not an object", path, key)
+			}
+			if cur, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("json path %v, key %v not found", path, key)
+			}
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path %v", path)
+			}
+			sel := p[1:end]
+			p = p[end+1:]
+			if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				key := sel[1 : len(sel)-1]
+				obj, ok := cur.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("json path %v, %v is not an object", path, key)
+				}
+				if cur, ok = obj[key]; !ok {
+					return nil, fmt.Errorf("json path %v, key %v not found", path, key)
+				}
+				continue
+			}
+			i, err := strconv.Atoi(sel)
+			if err != nil {
+				return nil, fmt.Errorf("invalid json path %v, %w", path, err)
+			}
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %v, not an array at index %v", path, i)
+			}
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("json path %v, index %v out of range", path, i)
+			}
+			cur = arr[i]
+		default:
+			return nil, fmt.Errorf("invalid json path %v", path)
+		}
+	}
+	return cur, nil
+}
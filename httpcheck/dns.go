@@ -0,0 +1,262 @@
+package httpcheck
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// maxDNSMessageSize is the maximum size of a dns message
+const maxDNSMessageSize = 65535
+
+var recordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"NS":    dnsmessage.TypeNS,
+}
+
+var rcodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// DoDNS queries the resolver and checks the answers
+func (s *server) DoDNS(ctx context.Context, c *proto.DNSCheck) (*proto.DNSResult, error) {
+	recordType, ok := recordTypes[strings.ToUpper(c.RecordType)]
+	if !ok {
+		return &proto.DNSResult{
+			Success: false,
+			Error:   fmt.Sprintf("unsupported record type %v", c.RecordType),
+		}, nil
+	}
+
+	resolver := c.Resolver
+	if resolver == "" {
+		resolver = systemResolver()
+	}
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+
+	t := time.Now()
+	msg, err := query(ctx, resolver, c.Name, recordType, checkTimeout(c.Timeout))
+	d := time.Now().Sub(t)
+	if err != nil {
+		s.logger.Infow("DNS Check failed", "error", err, "name", c.Name, "resolver", resolver)
+		return &proto.DNSResult{
+			Success:  false,
+			Duration: int64(d),
+			Error:    err.Error(),
+		}, nil
+	}
+
+	result := &proto.DNSResult{
+		Success:  true,
+		Duration: int64(d),
+		Rcode:    rcodeString(msg.Header.RCode),
+	}
+	var ttls []uint32
+	for _, a := range msg.Answers {
+		if a.Header.Type != recordType {
+			continue
+		}
+		result.Answers = append(result.Answers, answerString(a.Body))
+		ttls = append(ttls, a.Header.TTL)
+	}
+
+	if err := assertDNS(c, result.Rcode, result.Answers, ttls); err != nil {
+		s.logger.Infow("DNS Check assertion failed", "error", err, "name", c.Name, "resolver", resolver)
+		result.Success = false
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// assertDNS checks the response code, answers and ttls against the check
+func assertDNS(c *proto.DNSCheck, rcode string, answers []string, ttls []uint32) error {
+	expectedRCode := strings.ToUpper(c.Rcode)
+	if expectedRCode == "" {
+		expectedRCode = "NOERROR"
+	}
+	if rcode != expectedRCode {
+		return fmt.Errorf("response code %v, expected %v", rcode, expectedRCode)
+	}
+
+	for _, e := range c.Expected {
+		found := false
+		for _, a := range answers {
+			if normalizeAnswer(a) == normalizeAnswer(e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("answer %v not found in %v", e, strings.Join(answers, ", "))
+		}
+	}
+
+	for _, ttl := range ttls {
+		if c.MinTtl > 0 && int64(ttl) < c.MinTtl {
+			return fmt.Errorf("ttl %v lower than %v", ttl, c.MinTtl)
+		}
+		if c.MaxTtl > 0 && int64(ttl) > c.MaxTtl {
+			return fmt.Errorf("ttl %v greater than %v", ttl, c.MaxTtl)
+		}
+	}
+	return nil
+}
+
+// query sends the question to the resolver via udp and falls back to tcp,
+// if the answer is truncated.
+func query(ctx context.Context, resolver string, name string, t dnsmessage.Type, timeout time.Duration) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %v, %w", name, err)
+	}
+
+	id := uint16(rand.Uint32())
+	q := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  n,
+			Type:  t,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack dns query, %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	msg, err := exchange(ctx, "udp", resolver, packed, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Header.Truncated {
+		msg, err = exchange(ctx, "tcp", resolver, packed, deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if msg.Header.ID != id {
+		return nil, errors.New("dns response id does not match query")
+	}
+	return msg, nil
+}
+
+// exchange a packed dns message with the resolver
+func exchange(ctx context.Context, network string, resolver string, packed []byte, deadline time.Time) (*dnsmessage.Message, error) {
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, network, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to resolver %v, %w", resolver, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	var buf []byte
+	if network == "tcp" {
+		// Messages over tcp are prefixed with their length
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(packed)))
+		if _, err := conn.Write(append(l, packed...)); err != nil {
+			return nil, fmt.Errorf("unable to send dns query, %w", err)
+		}
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return nil, fmt.Errorf("unable to read dns response, %w", err)
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(l))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, fmt.Errorf("unable to read dns response, %w", err)
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, fmt.Errorf("unable to send dns query, %w", err)
+		}
+		buf = make([]byte, maxDNSMessageSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read dns response, %w", err)
+		}
+		buf = buf[:n]
+	}
+
+	msg := &dnsmessage.Message{}
+	if err := msg.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("unable to unpack dns response, %w", err)
+	}
+	return msg, nil
+}
+
+func rcodeString(rcode dnsmessage.RCode) string {
+	if s, ok := rcodes[rcode]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// answerString returns the answer in presentation format
+func answerString(body dnsmessage.ResourceBody) string {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(b.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(b.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return b.CNAME.String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %v", b.Pref, b.MX.String())
+	case *dnsmessage.NSResource:
+		return b.NS.String()
+	case *dnsmessage.TXTResource:
+		return strings.Join(b.TXT, "")
+	default:
+		return fmt.Sprintf("%v", body)
+	}
+}
+
+// normalizeAnswer makes answers comparable regardless of case and
+// trailing dots
+func normalizeAnswer(a string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(a)), ".")
+}
+
+// systemResolver returns the first nameserver from /etc/resolv.conf
+func systemResolver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1:53"
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return "127.0.0.1:53"
+}
@@ -0,0 +1,244 @@
+package httpcheck
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// records served by the test server
+var testRecords = map[uint16]map[string]string{
+	dns.TypeA: {
+		"example.com.": "example.com. 300 IN A 192.0.2.1",
+	},
+	dns.TypeAAAA: {
+		"example.com.": "example.com. 300 IN AAAA 2001:db8::1",
+	},
+	dns.TypeCNAME: {
+		"www.example.com.": "www.example.com. 300 IN CNAME example.com.",
+	},
+	dns.TypeMX: {
+		"example.com.": "example.com. 3600 IN MX 10 mail.example.com.",
+	},
+	dns.TypeTXT: {
+		"example.com.": `example.com. 60 IN TXT "v=spf1 -all"`,
+	},
+	dns.TypeNS: {
+		"example.com.": "example.com. 86400 IN NS ns1.example.com.",
+	},
+}
+
+// startDNSServer starts an in-process dns server on a random local port and
+// returns its address
+func startDNSServer(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen, %v", err)
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		switch q.Name {
+		case "servfail.example.com.":
+			m.Rcode = dns.RcodeServerFailure
+		default:
+			record, ok := testRecords[q.Qtype][q.Name]
+			if !ok {
+				m.Rcode = dns.RcodeNameError
+				break
+			}
+			rr, err := dns.NewRR(record)
+			if err != nil {
+				t.Errorf("invalid test record %v, %v", record, err)
+			}
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// startSilentServer returns the address of a udp socket, which never answers
+func startSilentServer(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen, %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc.LocalAddr().String()
+}
+
+func TestDoDNS(t *testing.T) {
+	s := &server{logger: zap.NewNop().Sugar()}
+	resolver := startDNSServer(t)
+
+	tests := []struct {
+		name    string
+		check   *proto.DNSCheck
+		success bool
+		rcode   string
+		answers []string
+		err     string
+	}{
+		{
+			name:    "a record",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "A", Expected: []string{"192.0.2.1"}},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"192.0.2.1"},
+		},
+		{
+			name:    "aaaa record",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "aaaa", Expected: []string{"2001:db8::1"}},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"2001:db8::1"},
+		},
+		{
+			name:    "cname record ignores trailing dot and case",
+			check:   &proto.DNSCheck{Name: "www.example.com", RecordType: "CNAME", Expected: []string{"EXAMPLE.com"}},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"example.com."},
+		},
+		{
+			name:    "mx record",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "MX", Expected: []string{"10 mail.example.com"}},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"10 mail.example.com."},
+		},
+		{
+			name:    "txt record",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "TXT", Expected: []string{"v=spf1 -all"}},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"v=spf1 -all"},
+		},
+		{
+			name:    "ns record",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "NS"},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"ns1.example.com."},
+		},
+		{
+			name:    "unexpected answer",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "A", Expected: []string{"192.0.2.2"}},
+			success: false,
+			rcode:   "NOERROR",
+			answers: []string{"192.0.2.1"},
+			err:     "answer 192.0.2.2 not found",
+		},
+		{
+			name:    "unsupported record type",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "SRV"},
+			success: false,
+			err:     "unsupported record type",
+		},
+		{
+			name:    "ttl within bounds",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "A", MinTtl: 300, MaxTtl: 300},
+			success: true,
+			rcode:   "NOERROR",
+			answers: []string{"192.0.2.1"},
+		},
+		{
+			name:    "ttl below minimum",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "A", MinTtl: 600},
+			success: false,
+			rcode:   "NOERROR",
+			answers: []string{"192.0.2.1"},
+			err:     "ttl 300 lower than 600",
+		},
+		{
+			name:    "ttl above maximum",
+			check:   &proto.DNSCheck{Name: "example.com", RecordType: "A", MaxTtl: 60},
+			success: false,
+			rcode:   "NOERROR",
+			answers: []string{"192.0.2.1"},
+			err:     "ttl 300 greater than 60",
+		},
+		{
+			name:    "nxdomain expected",
+			check:   &proto.DNSCheck{Name: "missing.example.com", RecordType: "A", Rcode: "nxdomain"},
+			success: true,
+			rcode:   "NXDOMAIN",
+		},
+		{
+			name:    "nxdomain unexpected",
+			check:   &proto.DNSCheck{Name: "missing.example.com", RecordType: "A"},
+			success: false,
+			rcode:   "NXDOMAIN",
+			err:     "response code NXDOMAIN, expected NOERROR",
+		},
+		{
+			name:    "servfail",
+			check:   &proto.DNSCheck{Name: "servfail.example.com", RecordType: "A"},
+			success: false,
+			rcode:   "SERVFAIL",
+			err:     "response code SERVFAIL, expected NOERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.Resolver = resolver
+			r, err := s.DoDNS(context.Background(), tt.check)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if r.Success != tt.success {
+				t.Errorf("success %v, expected %v, error %q", r.Success, tt.success, r.Error)
+			}
+			if r.Rcode != tt.rcode {
+				t.Errorf("rcode %v, expected %v", r.Rcode, tt.rcode)
+			}
+			if strings.Join(r.Answers, ",") != strings.Join(tt.answers, ",") {
+				t.Errorf("answers %v, expected %v", r.Answers, tt.answers)
+			}
+			if !strings.Contains(r.Error, tt.err) || (tt.err == "" && r.Error != "") {
+				t.Errorf("error %q, expected %q", r.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestDoDNSTimeout(t *testing.T) {
+	s := &server{logger: zap.NewNop().Sugar()}
+	timeout := 200 * time.Millisecond
+	start := time.Now()
+	r, err := s.DoDNS(context.Background(), &proto.DNSCheck{
+		Name:       "example.com",
+		RecordType: "A",
+		Resolver:   startSilentServer(t),
+		Timeout:    int64(timeout),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.Success {
+		t.Error("success of a query without answer")
+	}
+	if !strings.Contains(r.Error, "unable to read dns response") {
+		t.Errorf("error %q, expected read failure", r.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*timeout {
+		t.Errorf("query took %v, expected about %v", elapsed, timeout)
+	}
+}
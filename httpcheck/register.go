@@ -0,0 +1,71 @@
+package httpcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	checkmanager "github.com/shaardie/mondane/checkmanager/proto"
+)
+
+// registerInterval is the time between two registrations at the
+// checkmanager. It has to be well below the time, after which the
+// checkmanager considers a worker dead.
+const registerInterval = 30 * time.Second
+
+// advertiseAddress returns the address under which the checkmanager reaches
+// this worker. It defaults to the hostname with the port of the listen
+// address.
+func advertiseAddress(c *config) (string, error) {
+	if c.Advertise != "" {
+		return c.Advertise, nil
+	}
+	_, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %v, %w", c.Listen, err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to get hostname, %w", err)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// register this worker with its location periodically at the checkmanager
+func register(c *config, logger *zap.SugaredLogger) error {
+	address, err := advertiseAddress(c)
+	if err != nil {
+		return err
+	}
+	d, err := grpc.Dial(c.CheckManager, grpc.WithInsecure())
+	if err != nil {
+		return fmt.Errorf("unable to connect to checkmanager service, %w", err)
+	}
+	cm := checkmanager.NewCheckManagerServiceClient(d)
+	w := &checkmanager.Worker{
+		Address:  address,
+		Location: c.Location,
+	}
+	logger.Infow("Register at checkmanager service", "address", address,
+		"location", c.Location)
+
+	go func() {
+		ticker := time.NewTicker(registerInterval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), registerInterval)
+			_, err := cm.RegisterWorker(ctx, w)
+			cancel()
+			if err != nil {
+				logger.Errorw("Unable to register at checkmanager service", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+	return nil
+}
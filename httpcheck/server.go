@@ -2,9 +2,12 @@ package httpcheck
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,9 +21,29 @@ import (
 	"github.com/shaardie/mondane/httpcheck/proto"
 )
 
+// defaultTimeout for the checks
+const defaultTimeout = 10 * time.Second
+
+// checkTimeout returns the timeout in nanoseconds as duration and falls back
+// to the default timeout, if none is set.
+func checkTimeout(ns int64) time.Duration {
+	if ns <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(ns)
+}
+
 // Config read from environment
 type config struct {
 	Listen string `env:"MONDANE_HTTPCHECK_LISTEN,default=:8085"`
+	// Location label of the worker
+	Location string `env:"MONDANE_HTTPCHECK_LOCATION,default=default"`
+	// CheckManager is the checkmanager service to register at. Without it,
+	// the worker has to be configured statically in the checkmanager.
+	CheckManager string `env:"MONDANE_HTTPCHECK_CHECKMANAGER_SERVER"`
+	// Advertise is the address under which the checkmanager reaches the
+	// worker, defaults to the hostname and the port of the listen address
+	Advertise string `env:"MONDANE_HTTPCHECK_ADVERTISE"`
 }
 
 // grpc server with all resources
@@ -34,31 +57,112 @@ type server struct {
 // init the resources of the server on first grpc call
 func (s *server) initInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	s.initOnce.Do(func() {
-		s.client = &http.Client{
-			Timeout: 10 * time.Second,
-		}
+		// The timeout is set per request via the context
+		s.client = &http.Client{}
 	})
 
 	// Calls the next handler
 	return handler(ctx, req)
 }
 
+// newRequest creates the http request described by the check
+func newRequest(ctx context.Context, c *proto.Check) (*http.Request, error) {
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.Url, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request, %w", err)
+	}
+
+	for k, v := range c.Headers {
+		// The host header is not sent from the header map
+		if http.CanonicalHeaderKey(k) == "Host" {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+	return req, nil
+}
+
 func (s *server) Do(ctx context.Context, c *proto.Check) (*proto.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout(c.Timeout))
+	defer cancel()
+
 	t := time.Now()
-	resp, err := s.client.Get(c.Url)
+	tm := newTimings(t)
+	req, err := newRequest(tm.withTrace(ctx), c)
 	if err != nil {
-		s.logger.Infow("HTTP Check failed", "error", err, "check", c)
+		s.logger.Infow("HTTP Check invalid", "error", err, "url", c.Url)
 		return &proto.Result{
 			Success: false,
 			Error:   err.Error(),
 		}, nil
 	}
+	// Use a new connection, so every run measures all phases
+	req.Close = true
+
+	resp, err := s.client.Do(req)
+	d := time.Now().Sub(t)
+	if err != nil {
+		s.logger.Infow("HTTP Check failed", "error", err, "url", c.Url)
+		result := &proto.Result{
+			Success:  false,
+			Duration: int64(d),
+			Error:    err.Error(),
+		}
+		tm.apply(result, time.Now())
+		return result, nil
+	}
 	defer resp.Body.Close()
-	return &proto.Result{
-		Duration:   int64(time.Now().Sub(t)),
+
+	result := &proto.Result{
+		Duration:   int64(d),
 		StatusCode: int64(resp.StatusCode),
-		Success:    resp.StatusCode >= 200 && resp.StatusCode < 300,
-	}, nil
+		Success:    true,
+	}
+	applyResponse(result, resp)
+
+	body, err := readBody(c.Assertions, resp)
+	tm.apply(result, time.Now())
+	if err != nil {
+		s.logger.Infow("Unable to read response body", "error", err, "url", c.Url)
+		result.Success = false
+		result.Error = fmt.Sprintf("unable to read response body, %v", err)
+		return result, nil
+	}
+
+	if err := assert(c.Assertions, resp, body, d); err != nil {
+		s.logger.Infow("HTTP Check assertion failed", "error", err, "url", c.Url)
+		result.Success = false
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// NewChecker returns the checks of the service without the grpc server, so
+// they can be run in process, e.g. by the probe agent
+func NewChecker(logger *zap.SugaredLogger) proto.HTTPCheckServiceServer {
+	return &server{
+		config: &config{},
+		client: &http.Client{},
+		logger: logger,
+	}
 }
 
 // Run the server
@@ -91,6 +195,14 @@ func Run() error {
 		logger: logger,
 	}
 
+	// Register at the checkmanager
+	if c.CheckManager != "" {
+		if err := register(&c, logger); err != nil {
+			logger.Errorw("Unable to register at checkmanager service", "error", err)
+			return err
+		}
+	}
+
 	// Make sure that log statements internal to gRPC library are logged using the zapLogger as well.
 	grpc_zap.ReplaceGrpcLoggerV2(baseLogger)
 	// Create a server, make sure we put the grpc_ctxtags context before everything else.
@@ -0,0 +1,96 @@
+package httpcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// maxResponseSize is the maximum number of bytes read from a tcp connection
+const maxResponseSize = 4096
+
+// DoTCP connects to the address, optionally sends a payload and matches the
+// response against the expected pattern.
+func (s *server) DoTCP(ctx context.Context, c *proto.TCPCheck) (*proto.TCPResult, error) {
+	var expect *regexp.Regexp
+	if c.Expect != "" {
+		var err error
+		expect, err = regexp.Compile(c.Expect)
+		if err != nil {
+			return &proto.TCPResult{
+				Success: false,
+				Error:   fmt.Sprintf("invalid regular expression %q, %v", c.Expect, err),
+			}, nil
+		}
+	}
+
+	timeout := checkTimeout(c.Timeout)
+
+	t := time.Now()
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		s.logger.Infow("TCP Check failed", "error", err, "address", c.Address)
+		return &proto.TCPResult{
+			Success:  false,
+			Duration: int64(time.Now().Sub(t)),
+			Error:    err.Error(),
+		}, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Add(timeout))
+
+	if c.Payload != "" {
+		if _, err := io.WriteString(conn, c.Payload); err != nil {
+			s.logger.Infow("TCP Check unable to send payload", "error", err, "address", c.Address)
+			return &proto.TCPResult{
+				Success:  false,
+				Duration: int64(time.Now().Sub(t)),
+				Error:    fmt.Sprintf("unable to send payload, %v", err),
+			}, nil
+		}
+	}
+
+	if expect == nil {
+		return &proto.TCPResult{
+			Success:  true,
+			Duration: int64(time.Now().Sub(t)),
+		}, nil
+	}
+
+	// Read until the response matches, the connection is closed or the
+	// deadline is reached.
+	buf := make([]byte, 0, maxResponseSize)
+	for len(buf) < maxResponseSize {
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if expect.Match(buf) {
+			return &proto.TCPResult{
+				Success:  true,
+				Duration: int64(time.Now().Sub(t)),
+				Response: string(buf),
+			}, nil
+		}
+		if err != nil {
+			s.logger.Infow("TCP Check response does not match", "error", err, "address", c.Address)
+			return &proto.TCPResult{
+				Success:  false,
+				Duration: int64(time.Now().Sub(t)),
+				Response: string(buf),
+				Error:    fmt.Sprintf("response does not match %q, %v", c.Expect, err),
+			}, nil
+		}
+	}
+
+	return &proto.TCPResult{
+		Success:  false,
+		Duration: int64(time.Now().Sub(t)),
+		Response: string(buf),
+		Error:    fmt.Sprintf("response does not match %q", c.Expect),
+	}, nil
+}
@@ -0,0 +1,167 @@
+package httpcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// weakSignatureAlgorithms are not considered secure anymore
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// DoTLS connects to the address and inspects the presented certificate chain
+func (s *server) DoTLS(ctx context.Context, c *proto.TLSCheck) (*proto.TLSResult, error) {
+	serverName := c.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(c.Address)
+		if err != nil {
+			return &proto.TLSResult{
+				Success: false,
+				Error:   fmt.Sprintf("invalid address %v, %v", c.Address, err),
+			}, nil
+		}
+		serverName = host
+	}
+
+	timeout := checkTimeout(c.Timeout)
+	t := time.Now()
+	dialer := &net.Dialer{Timeout: timeout}
+	rawConn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		s.logger.Infow("TLS Check failed", "error", err, "address", c.Address)
+		return &proto.TLSResult{
+			Success:  false,
+			Duration: int64(time.Now().Sub(t)),
+			Error:    err.Error(),
+		}, nil
+	}
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName: serverName,
+		// The chain is verified below, so that invalid certificates
+		// can still be inspected.
+		InsecureSkipVerify: true,
+	})
+	conn.SetDeadline(t.Add(timeout))
+	if err := conn.Handshake(); err != nil {
+		rawConn.Close()
+		s.logger.Infow("TLS Check handshake failed", "error", err, "address", c.Address)
+		return &proto.TLSResult{
+			Success:  false,
+			Duration: int64(time.Now().Sub(t)),
+			Error:    err.Error(),
+		}, nil
+	}
+	defer conn.Close()
+	d := time.Now().Sub(t)
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return &proto.TLSResult{
+			Success:  false,
+			Duration: int64(d),
+			Error:    "no certificate presented",
+		}, nil
+	}
+	leaf := certs[0]
+
+	// The chain is only as valid as its shortest living certificate
+	notAfter := leaf.NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+
+	pNotAfter, err := ptypes.TimestampProto(notAfter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal expiry date %v, %w", notAfter, err)
+	}
+	result := &proto.TLSResult{
+		Success:  true,
+		Duration: int64(d),
+		NotAfter: pNotAfter,
+		Issuer:   leaf.Issuer.String(),
+		Subject:  leaf.Subject.String(),
+	}
+
+	if err := verifyChain(certs, serverName, c.MinDaysValid, time.Now()); err != nil {
+		s.logger.Infow("TLS Check verification failed", "error", err, "address", c.Address)
+		result.Success = false
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// verifyChain checks the presented certificate chain and returns an error
+// describing the first problem found.
+func verifyChain(certs []*x509.Certificate, serverName string, minDaysValid int64, now time.Time) error {
+	leaf := certs[0]
+
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate %v not valid before %v",
+				cert.Subject, cert.NotBefore)
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %v expired at %v",
+				cert.Subject, cert.NotAfter)
+		}
+		daysLeft := int64(cert.NotAfter.Sub(now).Hours() / 24)
+		if daysLeft < minDaysValid {
+			return fmt.Errorf("certificate %v expires in %v days",
+				cert.Subject, daysLeft)
+		}
+	}
+
+	if err := leaf.VerifyHostname(serverName); err != nil {
+		return fmt.Errorf("hostname mismatch, %w", err)
+	}
+
+	if isSelfSigned(leaf) {
+		return errors.New("certificate is self-signed")
+	}
+
+	// Signatures of the root certificates are not relevant
+	for _, cert := range certs {
+		if isSelfSigned(cert) {
+			continue
+		}
+		if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+			return fmt.Errorf("certificate %v uses weak signature algorithm %v",
+				cert.Subject, cert.SignatureAlgorithm)
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to verify certificate chain, %w", err)
+	}
+	return nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
@@ -0,0 +1,130 @@
+package httpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/shaardie/mondane/httpcheck/proto"
+)
+
+// tlsVersions are the names of the tls versions
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// tlsVersion returns the name of the tls version
+func tlsVersion(v uint16) string {
+	if name, ok := tlsVersions[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// timings collects the phases of a single request. The hooks of the trace
+// may be called concurrently, e.g. while dialing multiple addresses.
+type timings struct {
+	mutex *sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	remoteIP     string
+}
+
+func newTimings(start time.Time) *timings {
+	return &timings{
+		mutex: &sync.Mutex{},
+		start: start,
+	}
+}
+
+// set the time, if it is not already set
+func (t *timings) set(field *time.Time) {
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if field.IsZero() {
+		*field = now
+	}
+}
+
+// withTrace returns a context, which records the timings of the request
+func (t *timings) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.set(&t.connectStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			// Only the successful connection counts
+			if err == nil {
+				t.set(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String())
+			if err != nil {
+				return
+			}
+			t.mutex.Lock()
+			t.remoteIP = host
+			t.mutex.Unlock()
+		},
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	})
+}
+
+// between returns the time between from and to, or zero, if one of them is
+// not set
+func between(from time.Time, to time.Time) int64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return int64(to.Sub(from))
+}
+
+// apply the timings to the result. end is the time the body was read.
+func (t *timings) apply(r *proto.Result, end time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	r.DnsLookup = between(t.dnsStart, t.dnsDone)
+	r.TcpConnect = between(t.connectStart, t.connectDone)
+	r.TlsHandshake = between(t.tlsStart, t.tlsDone)
+	// The time to first byte starts after the connection is ready
+	ready := t.start
+	for _, done := range []time.Time{t.dnsDone, t.connectDone, t.tlsDone} {
+		if done.After(ready) {
+			ready = done
+		}
+	}
+	r.TimeToFirstByte = between(ready, t.firstByte)
+	r.ContentTransfer = between(t.firstByte, end)
+	r.RemoteIp = t.remoteIP
+}
+
+// applyResponse sets the protocol and tls version of the response
+func applyResponse(r *proto.Result, resp *http.Response) {
+	r.Protocol = resp.Proto
+	if resp.TLS != nil {
+		r.TlsVersion = tlsVersion(resp.TLS.Version)
+	}
+}
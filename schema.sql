@@ -12,6 +12,19 @@ CREATE TABLE IF NOT EXISTS http_checks (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     user_id INTEGER NOT NULL,
     url VARCHAR(255) NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT 'GET',
+    headers TEXT NOT NULL,
+    body TEXT NOT NULL,
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    password VARCHAR(255) NOT NULL DEFAULT '',
+    bearer_token VARCHAR(1024) NOT NULL DEFAULT '',
+    assertions TEXT NOT NULL,
+    check_interval BIGINT NOT NULL DEFAULT 30000000000,
+    timeout BIGINT NOT NULL DEFAULT 10000000000,
+    threshold INTEGER NOT NULL DEFAULT 3,
+    locations TEXT NOT NULL,
+    min_failed_locations INTEGER NOT NULL DEFAULT 1,
+    enabled BOOL NOT NULL DEFAULT TRUE,
     FOREIGN KEY (user_id)
         REFERENCES users (id)
         ON DELETE CASCADE
@@ -25,11 +38,299 @@ CREATE TABLE IF NOT EXISTS http_results (
     status_code INTEGER NOT NULL,
     duration BIGINT NOT NULL,
     error VARCHAR(255) NOT NULL,
+    location VARCHAR(64) NOT NULL DEFAULT '',
+    dns_lookup BIGINT NOT NULL DEFAULT 0,
+    tcp_connect BIGINT NOT NULL DEFAULT 0,
+    tls_handshake BIGINT NOT NULL DEFAULT 0,
+    time_to_first_byte BIGINT NOT NULL DEFAULT 0,
+    content_transfer BIGINT NOT NULL DEFAULT 0,
+    remote_ip VARCHAR(45) NOT NULL DEFAULT '',
+    protocol VARCHAR(16) NOT NULL DEFAULT '',
+    tls_version VARCHAR(16) NOT NULL DEFAULT '',
+    maintenance BOOL NOT NULL DEFAULT FALSE,
+    INDEX (timestamp),
     FOREIGN KEY (check_id)
         REFERENCES http_checks (id)
         ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS tls_checks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    server_name VARCHAR(255) NOT NULL DEFAULT '',
+    min_days_valid INTEGER NOT NULL,
+    check_interval BIGINT NOT NULL DEFAULT 30000000000,
+    timeout BIGINT NOT NULL DEFAULT 10000000000,
+    threshold INTEGER NOT NULL DEFAULT 3,
+    locations TEXT NOT NULL,
+    min_failed_locations INTEGER NOT NULL DEFAULT 1,
+    enabled BOOL NOT NULL DEFAULT TRUE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tls_results (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    timestamp DATETIME NOT NULL,
+    check_id INTEGER NOT NULL,
+    success BOOL NOT NULL,
+    duration BIGINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    not_after DATETIME NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    location VARCHAR(64) NOT NULL DEFAULT '',
+    maintenance BOOL NOT NULL DEFAULT FALSE,
+    INDEX (timestamp),
+    FOREIGN KEY (check_id)
+        REFERENCES tls_checks (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tcp_checks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    timeout BIGINT NOT NULL,
+    payload TEXT NOT NULL,
+    expect VARCHAR(255) NOT NULL DEFAULT '',
+    check_interval BIGINT NOT NULL DEFAULT 30000000000,
+    threshold INTEGER NOT NULL DEFAULT 3,
+    locations TEXT NOT NULL,
+    min_failed_locations INTEGER NOT NULL DEFAULT 1,
+    enabled BOOL NOT NULL DEFAULT TRUE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tcp_results (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    timestamp DATETIME NOT NULL,
+    check_id INTEGER NOT NULL,
+    success BOOL NOT NULL,
+    duration BIGINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    response VARCHAR(255) NOT NULL,
+    location VARCHAR(64) NOT NULL DEFAULT '',
+    maintenance BOOL NOT NULL DEFAULT FALSE,
+    INDEX (timestamp),
+    FOREIGN KEY (check_id)
+        REFERENCES tcp_checks (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS dns_checks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    record_type VARCHAR(16) NOT NULL,
+    resolver VARCHAR(255) NOT NULL DEFAULT '',
+    timeout BIGINT NOT NULL,
+    expected TEXT NOT NULL,
+    min_ttl BIGINT NOT NULL DEFAULT 0,
+    max_ttl BIGINT NOT NULL DEFAULT 0,
+    rcode VARCHAR(16) NOT NULL DEFAULT 'NOERROR',
+    check_interval BIGINT NOT NULL DEFAULT 30000000000,
+    threshold INTEGER NOT NULL DEFAULT 3,
+    locations TEXT NOT NULL,
+    min_failed_locations INTEGER NOT NULL DEFAULT 1,
+    enabled BOOL NOT NULL DEFAULT TRUE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS dns_results (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    timestamp DATETIME NOT NULL,
+    check_id INTEGER NOT NULL,
+    success BOOL NOT NULL,
+    duration BIGINT NOT NULL,
+    error VARCHAR(255) NOT NULL,
+    rcode VARCHAR(16) NOT NULL,
+    answers TEXT NOT NULL,
+    location VARCHAR(64) NOT NULL DEFAULT '',
+    maintenance BOOL NOT NULL DEFAULT FALSE,
+    INDEX (timestamp),
+    FOREIGN KEY (check_id)
+        REFERENCES dns_checks (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS heartbeat_checks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    period BIGINT NOT NULL,
+    grace BIGINT NOT NULL,
+    enabled BOOL NOT NULL DEFAULT TRUE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS heartbeat_results (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    timestamp DATETIME NOT NULL,
+    check_id INTEGER NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    success BOOL NOT NULL,
+    duration BIGINT NOT NULL,
+    message VARCHAR(255) NOT NULL,
+    maintenance BOOL NOT NULL DEFAULT FALSE,
+    INDEX (timestamp),
+    FOREIGN KEY (check_id)
+        REFERENCES heartbeat_checks (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS check_states (
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    failures INTEGER NOT NULL,
+    changed DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    suppressed BOOL NOT NULL DEFAULT FALSE,
+    unreachable BOOL NOT NULL DEFAULT FALSE,
+    history VARCHAR(32) NOT NULL DEFAULT '',
+    flapping BOOL NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (check_id, check_type)
+);
+
+CREATE TABLE IF NOT EXISTS check_dependencies (
+    user_id INTEGER NOT NULL,
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    parent_id INTEGER NOT NULL,
+    parent_type VARCHAR(16) NOT NULL,
+    PRIMARY KEY (check_id, check_type, parent_id, parent_type),
+    INDEX (parent_id, parent_type),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS check_labels (
+    user_id INTEGER NOT NULL,
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    name VARCHAR(63) NOT NULL,
+    value VARCHAR(63) NOT NULL,
+    PRIMARY KEY (check_id, check_type, name),
+    INDEX (user_id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS check_groups (
+    user_id INTEGER NOT NULL,
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    PRIMARY KEY (check_id, check_type, name),
+    INDEX (user_id, name),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS hourly_rollups (
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    bucket DATETIME NOT NULL,
+    runs INTEGER NOT NULL,
+    failures INTEGER NOT NULL,
+    outages INTEGER NOT NULL,
+    monitored BIGINT NOT NULL,
+    downtime BIGINT NOT NULL,
+    latency_min BIGINT NOT NULL,
+    latency_avg BIGINT NOT NULL,
+    latency_max BIGINT NOT NULL,
+    latency_p50 BIGINT NOT NULL,
+    latency_p95 BIGINT NOT NULL,
+    latency_p99 BIGINT NOT NULL,
+    errors TEXT NOT NULL,
+    PRIMARY KEY (check_id, check_type, bucket),
+    INDEX (check_type, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS daily_rollups (
+    check_id INTEGER NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    bucket DATETIME NOT NULL,
+    runs INTEGER NOT NULL,
+    failures INTEGER NOT NULL,
+    outages INTEGER NOT NULL,
+    monitored BIGINT NOT NULL,
+    downtime BIGINT NOT NULL,
+    latency_min BIGINT NOT NULL,
+    latency_avg BIGINT NOT NULL,
+    latency_max BIGINT NOT NULL,
+    latency_p50 BIGINT NOT NULL,
+    latency_p95 BIGINT NOT NULL,
+    latency_p99 BIGINT NOT NULL,
+    errors TEXT NOT NULL,
+    PRIMARY KEY (check_id, check_type, bucket),
+    INDEX (check_type, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS rollup_progress (
+    resolution VARCHAR(16) NOT NULL,
+    check_type VARCHAR(16) NOT NULL,
+    rolled_up DATETIME NOT NULL,
+    PRIMARY KEY (resolution, check_type)
+);
+
+CREATE TABLE IF NOT EXISTS replicas (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    heartbeat DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS shard_leases (
+    shard INTEGER NOT NULL PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    expires DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workers (
+    address VARCHAR(255) NOT NULL PRIMARY KEY,
+    location VARCHAR(64) NOT NULL,
+    heartbeat DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS agents (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    last_seen DATETIME NULL,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    check_id INTEGER NOT NULL DEFAULT 0,
+    check_type VARCHAR(16) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL,
+    mode VARCHAR(16) NOT NULL,
+    starts_at DATETIME NULL,
+    ends_at DATETIME NULL,
+    schedule VARCHAR(255) NOT NULL DEFAULT '',
+    duration BIGINT NOT NULL DEFAULT 0,
+    timezone VARCHAR(64) NOT NULL DEFAULT '',
+    INDEX (check_id, check_type),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS alerts (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     user_id INTEGER NOT NULL,
@@ -38,6 +339,8 @@ CREATE TABLE IF NOT EXISTS alerts (
     send_mail BOOL NOT NULL,
     last_send DATETIME NOT NULL,
     send_period BIGINT NOT NULL,
+    selector VARCHAR(1024) NOT NULL DEFAULT '',
+    check_group VARCHAR(255) NOT NULL DEFAULT '',
     FOREIGN KEY (user_id)
         REFERENCES users (id)
         ON DELETE CASCADE
@@ -0,0 +1,174 @@
+// Package selector contains the labels and groups of checks and the
+// selectors to choose checks by them. It is shared by the checkmanager,
+// which stores the labels, and the alert service, whose alerts may target a
+// selector or a group instead of a single check.
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits of labels and groups
+const (
+	maxNameLength = 63
+	// MaxValueLength is also the limit of the names of checks, which are
+	// stored as label values
+	MaxValueLength = 63
+	maxGroupLength = 255
+)
+
+var (
+	// names of labels, like "env" or "team.web"
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+	// values of labels follow the names, but may be empty
+	valueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?)?$`)
+	// folders of groups, like "acme" or "web servers"
+	folderRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+( [A-Za-z0-9_.-]+)*$`)
+)
+
+// ValidateLabel returns an error, if name or value of the label are invalid
+func ValidateLabel(name string, value string) error {
+	if len(name) > maxNameLength || !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	if len(value) > MaxValueLength || !valueRegexp.MatchString(value) {
+		return fmt.Errorf("invalid value %q of label %v", value, name)
+	}
+	return nil
+}
+
+// ValidateGroup returns an error, if the name of the group is invalid.
+// Groups are separated into folders by slashes, like "customers/acme".
+func ValidateGroup(group string) error {
+	if len(group) > maxGroupLength {
+		return fmt.Errorf("group %q longer than %v characters", group, maxGroupLength)
+	}
+	for _, folder := range strings.Split(group, "/") {
+		if !folderRegexp.MatchString(folder) {
+			return fmt.Errorf("invalid group %q", group)
+		}
+	}
+	return nil
+}
+
+// InGroup returns, if one of the groups is the group or one of its
+// subfolders
+func InGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if g == group || strings.HasPrefix(g, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Operators of requirements
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opExists    = "exists"
+	opNotExists = "!exists"
+)
+
+// requirement is a single term of a selector
+type requirement struct {
+	name  string
+	op    string
+	value string
+}
+
+func (r *requirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.name]
+	switch r.op {
+	case opEquals:
+		return ok && value == r.value
+	case opNotEquals:
+		return !ok || value != r.value
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	}
+	return false
+}
+
+func (r *requirement) String() string {
+	switch r.op {
+	case opExists:
+		return r.name
+	case opNotExists:
+		return "!" + r.name
+	}
+	return r.name + r.op + r.value
+}
+
+// Selector chooses checks by their labels. All requirements have to match.
+type Selector []requirement
+
+// Parse the selector, a comma separated list of requirements of the forms
+// "name=value", "name==value", "name!=value", "name" and "!name".
+// The empty selector matches all checks.
+func Parse(s string) (Selector, error) {
+	selector := Selector{}
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		r, err := parseRequirement(strings.TrimSpace(term))
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+func parseRequirement(term string) (requirement, error) {
+	r := requirement{}
+	switch {
+	case strings.Contains(term, "!="):
+		parts := strings.SplitN(term, "!=", 2)
+		r = requirement{name: parts[0], op: opNotEquals, value: parts[1]}
+	case strings.Contains(term, "=="):
+		parts := strings.SplitN(term, "==", 2)
+		r = requirement{name: parts[0], op: opEquals, value: parts[1]}
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		r = requirement{name: parts[0], op: opEquals, value: parts[1]}
+	case strings.HasPrefix(term, "!"):
+		r = requirement{name: term[1:], op: opNotExists}
+	default:
+		r = requirement{name: term, op: opExists}
+	}
+	r.name = strings.TrimSpace(r.name)
+	r.value = strings.TrimSpace(r.value)
+	if err := ValidateLabel(r.name, r.value); err != nil {
+		return r, fmt.Errorf("invalid requirement %q, %w", term, err)
+	}
+	return r, nil
+}
+
+// Matches returns, if the labels fulfill all requirements of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns, if the selector has no requirements
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, r := range s {
+		terms[i] = r.String()
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,103 @@
+package selector
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     string
+		err      bool
+	}{
+		{name: "empty", selector: "", want: ""},
+		{name: "blank", selector: "  ", want: ""},
+		{name: "equals", selector: "env=prod", want: "env=prod"},
+		{name: "double equals", selector: "env==prod", want: "env=prod"},
+		{name: "not equals", selector: "env!=prod", want: "env!=prod"},
+		{name: "exists", selector: "env", want: "env"},
+		{name: "not exists", selector: "!env", want: "!env"},
+		{name: "empty value", selector: "env=", want: "env="},
+		{name: "multiple", selector: "env=prod, team.web ,!canary", want: "env=prod,team.web,!canary"},
+		{name: "spaces around operator", selector: "env = prod", want: "env=prod"},
+		{name: "empty term", selector: "env=prod,", err: true},
+		{name: "empty name", selector: "=prod", err: true},
+		{name: "invalid name", selector: "-env=prod", err: true},
+		{name: "invalid value", selector: "env=prod/eu", err: true},
+		{name: "invalid not exists", selector: "!", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.selector)
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, expected error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if s.String() != tt.want {
+				t.Errorf("selector %q, expected %q", s.String(), tt.want)
+			}
+			if s.Empty() != (tt.want == "") {
+				t.Errorf("empty %v for %q", s.Empty(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "web", "canary": ""}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "", want: true},
+		{selector: "env=prod", want: true},
+		{selector: "env=dev", want: false},
+		{selector: "region=eu", want: false},
+		{selector: "env!=dev", want: true},
+		{selector: "env!=prod", want: false},
+		{selector: "region!=eu", want: true},
+		{selector: "canary", want: true},
+		{selector: "canary=", want: true},
+		{selector: "region", want: false},
+		{selector: "!region", want: true},
+		{selector: "!canary", want: false},
+		{selector: "env=prod,team=web", want: true},
+		{selector: "env=prod,team=db", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := Parse(tt.selector)
+			if err != nil {
+				t.Fatalf("unable to parse selector, %v", err)
+			}
+			if got := s.Matches(labels); got != tt.want {
+				t.Errorf("matches %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		group  string
+		want   bool
+	}{
+		{name: "no groups", groups: nil, group: "customers", want: false},
+		{name: "same group", groups: []string{"customers"}, group: "customers", want: true},
+		{name: "subfolder", groups: []string{"customers/acme"}, group: "customers", want: true},
+		{name: "nested subfolder", groups: []string{"customers/acme/web"}, group: "customers/acme", want: true},
+		{name: "parent folder", groups: []string{"customers"}, group: "customers/acme", want: false},
+		{name: "common prefix", groups: []string{"customers-old"}, group: "customers", want: false},
+		{name: "one of many", groups: []string{"internal", "customers/acme"}, group: "customers/acme", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InGroup(tt.groups, tt.group); got != tt.want {
+				t.Errorf("in group %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}